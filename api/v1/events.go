@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/process-tracker/core"
+)
+
+// EventHandler handles process lifecycle event API endpoints
+type EventHandler struct {
+	app *core.App
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(app *core.App) *EventHandler {
+	return &EventHandler{app: app}
+}
+
+// ListEvents returns process lifecycle events, newest first
+// Query parameters: process (PID or name), type, from, to, host
+// Events are only detected on the machine that collects them, so other hosts have none.
+func (h *EventHandler) ListEvents(c *gin.Context) {
+	params := c.MustGet("query_params").(QueryParams)
+
+	now := time.Now()
+	from, err := core.ParseQueryTime(c.Query("from"), now.Add(-24*time.Hour), now)
+	if err != nil {
+		SendBadRequest(c, "Invalid 'from' parameter: "+err.Error())
+		return
+	}
+	to, err := core.ParseQueryTime(c.Query("to"), now, now)
+	if err != nil {
+		SendBadRequest(c, "Invalid 'to' parameter: "+err.Error())
+		return
+	}
+	if to.Before(from) {
+		SendBadRequest(c, "'to' must not be before 'from'")
+		return
+	}
+
+	var events []core.ProcessEvent
+	if h.app.IsLocalHost(params.Host) {
+		events, err = h.app.GetProcessEvents(c.Query("process"), from, to)
+		if err != nil {
+			SendInternalServerError(c, fmt.Errorf("failed to read process events: %w", err))
+			return
+		}
+	}
+
+	// Filter by event type
+	if eventType := c.Query("type"); eventType != "" {
+		var filtered []core.ProcessEvent
+		for _, event := range events {
+			if string(event.Type) == eventType {
+				filtered = append(filtered, event)
+			}
+		}
+		events = filtered
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+
+	total := len(events)
+	start := params.Offset
+	if start > total {
+		start = total
+	}
+	end := start + params.Limit
+	if end > total {
+		end = total
+	}
+
+	response := make([]EventResponse, 0, end-start)
+	for _, event := range events[start:end] {
+		response = append(response, eventToResponse(event))
+	}
+
+	SendPaginated(c, KindEventList, response, total, params)
+}
+
+// eventToResponse converts a core process event to API response format
+func eventToResponse(event core.ProcessEvent) EventResponse {
+	response := EventResponse{
+		Timestamp:       event.Timestamp,
+		Type:            string(event.Type),
+		PID:             event.PID,
+		PPID:            event.PPID,
+		Name:            event.Name,
+		Command:         event.Command,
+		PreviousCommand: event.PreviousCommand,
+		Category:        event.Category,
+		Lifetime:        formatUptime(time.Duration(event.LifetimeSeconds) * time.Second),
+		LifetimeSeconds: event.LifetimeSeconds,
+		CPUPercent:      event.CPUPercent,
+		MemoryMB:        event.MemoryMB,
+		Threads:         event.Threads,
+		CPUTime:         event.CPUTime,
+	}
+	if event.CreateTime > 0 {
+		startedAt := time.UnixMilli(event.CreateTime)
+		response.StartedAt = &startedAt
+	}
+	if !event.LastSeen.IsZero() {
+		lastSeen := event.LastSeen
+		response.LastSeen = &lastSeen
+	}
+	return response
+}
@@ -0,0 +1,51 @@
+package v1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/process-tracker/core"
+)
+
+// HostHandler handles the fleet overview API endpoint
+type HostHandler struct {
+	app *core.App
+}
+
+// NewHostHandler creates a new host handler
+func NewHostHandler(app *core.App) *HostHandler {
+	return &HostHandler{app: app}
+}
+
+// ListHosts returns every host with stored records or reporting to the aggregator,
+// with its status and the totals of its latest processes
+func (h *HostHandler) ListHosts(c *gin.Context) {
+	fleet, err := h.app.FleetOverview()
+	if err != nil {
+		SendInternalServerError(c, fmt.Errorf("failed to read hosts: %w", err))
+		return
+	}
+
+	hosts := make([]HostResponse, 0, len(fleet))
+	for _, s := range fleet {
+		hosts = append(hosts, HostResponse{
+			Host:            s.Host,
+			Role:            s.Role,
+			Address:         s.Address,
+			Online:          s.Online,
+			LastSeen:        s.LastSeen,
+			IntervalSeconds: s.IntervalSeconds,
+			Batches:         s.Batches,
+			Records:         s.Records,
+			Processes:       s.Processes,
+			CPUPercent:      s.CPUPercent,
+			MemoryMB:        s.MemoryMB,
+		})
+	}
+
+	SendSuccess(c, KindHostList, hosts, &ResponseMetadata{
+		Total:       len(hosts),
+		GeneratedAt: time.Now(),
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yourusername/process-tracker/core"
 )
 
 // CORSMiddleware handles Cross-Origin Resource Sharing
@@ -81,6 +82,14 @@ func ValidationMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if params.Host != "" {
+			if err := core.ValidateHostName(params.Host); err != nil {
+				SendBadRequest(c, "Invalid 'host' parameter: "+err.Error())
+				c.Abort()
+				return
+			}
+		}
+
 		// Set default values
 		if params.Limit == 0 {
 			params.Limit = 20 // Default limit
@@ -181,4 +190,17 @@ func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 		c.Request = c.Request.WithContext(c.Request.Context())
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// queryHost returns the validated host filter; empty selects every host
+func queryHost(c *gin.Context) string {
+	return c.MustGet("query_params").(QueryParams).Host
+}
+
+// hostFilter turns the host parameter into a record query filter
+func hostFilter(host string) []string {
+	if host == "" {
+		return nil
+	}
+	return []string{host}
+}
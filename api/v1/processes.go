@@ -3,6 +3,7 @@ package v1
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -29,18 +30,21 @@ func (h *ProcessHandler) ListProcesses(c *gin.Context) {
 		view = "flat"
 	}
 
-	// Get recent processes from storage
-	records, err := h.readRecentRecords(5 * time.Minute)
+	query, err := processQuery(params, 5*time.Minute)
 	if err != nil {
-		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
+		SendBadRequest(c, err.Error())
 		return
 	}
 
 	var response interface{}
 	if view == "tree" {
-		response = h.getProcessTree(records)
+		response, err = h.getProcessTree(c, query)
 	} else {
-		response = h.getProcessList(records, params)
+		response, err = h.getProcessList(c, query, params)
+	}
+	if err != nil {
+		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
+		return
 	}
 
 	metadata := &ResponseMetadata{
@@ -61,28 +65,24 @@ func (h *ProcessHandler) GetProcess(c *gin.Context) {
 		return
 	}
 
-	// Get recent processes
-	records, err := h.readRecentRecords(5 * time.Minute)
+	// Get latest record of the process
+	records, err := h.app.QueryRecords(c.Request.Context(), core.RecordQuery{
+		Start:      time.Now().Add(-5 * time.Minute),
+		PIDs:       []int32{int32(pid)},
+		Hosts:      hostFilter(queryHost(c)),
+		LatestOnly: true,
+	})
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
 		return
 	}
 
-	// Find the specific process
-	var process *core.ResourceRecord
-	for _, record := range records {
-		if record.PID == int32(pid) {
-			process = &record
-			break
-		}
-	}
-
-	if process == nil {
+	if len(records) == 0 {
 		SendNotFoundError(c, "process", pid)
 		return
 	}
 
-	response := h.processToResponse(process)
+	response := h.processToResponse(&records[0])
 	SendSuccess(c, KindProcess, response, &ResponseMetadata{
 		GeneratedAt: time.Now(),
 	})
@@ -97,8 +97,8 @@ func (h *ProcessHandler) GetProcessChildren(c *gin.Context) {
 		return
 	}
 
-	// Get recent processes
-	records, err := h.readRecentRecords(5 * time.Minute)
+	// Get latest record of each recent process
+	records, err := h.app.GetLatestProcesses(5*time.Minute, queryHost(c))
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
 		return
@@ -132,8 +132,8 @@ func (h *ProcessHandler) GetProcessTree(c *gin.Context) {
 		return
 	}
 
-	// Get recent processes
-	records, err := h.readRecentRecords(5 * time.Minute)
+	// Get latest record of each recent process
+	records, err := h.app.GetLatestProcesses(5*time.Minute, queryHost(c))
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
 		return
@@ -170,15 +170,19 @@ func (h *ProcessHandler) GetProcessTree(c *gin.Context) {
 
 // GetLiveProcesses returns real-time process data
 func (h *ProcessHandler) GetLiveProcesses(c *gin.Context) {
-	// Get very recent records (last 30 seconds)
-	records, err := h.readRecentRecords(30 * time.Second)
+	// Get latest record of each process seen in the last 30 seconds
+	records, err := h.app.QueryRecords(c.Request.Context(), core.RecordQuery{
+		Start:      time.Now().Add(-30 * time.Second),
+		Hosts:      hostFilter(queryHost(c)),
+		LatestOnly: true,
+		OrderBy:    "pid",
+	})
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to read live process records: %w", err))
 		return
 	}
 
-	// Get latest processes
-	processes := h.getLatestProcesses(records)
+	processes := h.recordsToResponses(records)
 
 	response := map[string]interface{}{
 		"timestamp": time.Now().Unix(),
@@ -193,44 +197,13 @@ func (h *ProcessHandler) GetLiveProcesses(c *gin.Context) {
 
 // Helper functions
 
-// readRecentRecords reads recent process records from storage
-func (h *ProcessHandler) readRecentRecords(duration time.Duration) ([]core.ResourceRecord, error) {
-	// Create a temporary storage manager to read data
-	storageManager := core.NewManager(h.app.DataFile, 0, false, core.StorageConfig{})
-
-	// Read all records from the data file
-	allRecords, err := storageManager.ReadRecords(h.app.DataFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read records: %w", err)
-	}
-
-	// Filter records within the time window
-	cutoffTime := time.Now().Add(-duration)
-	var recentRecords []core.ResourceRecord
-
-	for _, record := range allRecords {
-		if record.Timestamp.After(cutoffTime) {
-			recentRecords = append(recentRecords, record)
-		}
-	}
-
-	return recentRecords, nil
-}
-
 // getProcessTree returns the process tree structure
-func (h *ProcessHandler) getProcessTree(records []core.ResourceRecord) map[string]interface{} {
-	// Get latest record for each process
-	latest := make(map[int32]core.ResourceRecord)
-	for _, r := range records {
-		if existing, ok := latest[r.PID]; !ok || r.Timestamp.After(existing.Timestamp) {
-			latest[r.PID] = r
-		}
-	}
-
-	// Convert map to slice
-	var latestRecords []core.ResourceRecord
-	for _, r := range latest {
-		latestRecords = append(latestRecords, r)
+func (h *ProcessHandler) getProcessTree(c *gin.Context, query core.RecordQuery) (map[string]interface{}, error) {
+	// The tree always covers every matching process, so paging does not apply
+	query.Limit, query.Offset = 0, 0
+	latestRecords, err := h.app.QueryRecords(c.Request.Context(), query)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build process tree
@@ -245,60 +218,91 @@ func (h *ProcessHandler) getProcessTree(records []core.ResourceRecord) map[strin
 	return map[string]interface{}{
 		"tree": trees,
 		"view": "tree",
-	}
+	}, nil
 }
 
-// getProcessList returns the flat process list
-func (h *ProcessHandler) getProcessList(records []core.ResourceRecord, params QueryParams) []ProcessResponse {
-	processes := h.getLatestProcesses(records)
-
-	// Apply sorting
-	if params.Sort != "" {
-		h.sortProcesses(processes, params.Sort)
+// getProcessList returns the flat process list, sorted and paged by the storage backend
+func (h *ProcessHandler) getProcessList(c *gin.Context, query core.RecordQuery, params QueryParams) ([]ProcessResponse, error) {
+	query.Limit = params.Limit
+	if query.Limit == 0 {
+		query.Limit = 20
 	}
+	query.Offset = params.Offset
 
-	// Apply pagination
-	limit := params.Limit
-	offset := params.Offset
-	if limit == 0 {
-		limit = 20
+	records, err := h.app.QueryRecords(c.Request.Context(), query)
+	if err != nil {
+		return nil, err
 	}
+	return h.recordsToResponses(records), nil
+}
 
-	total := len(processes)
-	start := offset
-	end := offset + limit
-	if start > total {
-		return []ProcessResponse{}
-	}
-	if end > total {
-		end = total
+// recordsToResponses converts records to ProcessResponses
+func (h *ProcessHandler) recordsToResponses(records []core.ResourceRecord) []ProcessResponse {
+	processes := make([]ProcessResponse, 0, len(records))
+	for i := range records {
+		processes = append(processes, h.processToResponse(&records[i]))
 	}
-
-	return processes[start:end]
+	return processes
 }
 
-// getLatestProcesses gets the latest record for each process
-func (h *ProcessHandler) getLatestProcesses(records []core.ResourceRecord) []ProcessResponse {
-	if len(records) == 0 {
-		return []ProcessResponse{}
+// processQuery translates list parameters into a storage query for the latest record of each process
+// Filters take the form key=value with keys name, category, pid and user; repeated keys match any value
+func processQuery(params QueryParams, window time.Duration) (core.RecordQuery, error) {
+	query := core.RecordQuery{
+		Start:      time.Now().Add(-window),
+		Hosts:      hostFilter(params.Host),
+		LatestOnly: true,
+		OrderBy:    "pid",
 	}
 
-	// Get latest record for each process
-	latest := make(map[int32]core.ResourceRecord)
-	for _, r := range records {
-		if existing, ok := latest[r.PID]; !ok || r.Timestamp.After(existing.Timestamp) {
-			latest[r.PID] = r
+	for _, filter := range params.Filter {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || value == "" {
+			return query, fmt.Errorf("invalid filter %q, expected key=value", filter)
+		}
+		switch key {
+		case "name":
+			query.Names = append(query.Names, value)
+		case "category":
+			query.Categories = append(query.Categories, value)
+		case "user":
+			query.Users = append(query.Users, value)
+		case "pid":
+			pid, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return query, fmt.Errorf("invalid pid filter: %s", value)
+			}
+			query.PIDs = append(query.PIDs, int32(pid))
+		default:
+			return query, fmt.Errorf("unknown filter %q", key)
 		}
 	}
 
-	// Convert to ProcessResponse
-	var processes []ProcessResponse
-	for _, r := range latest {
-		process := h.processToResponse(&r)
-		processes = append(processes, process)
+	if params.Sort != "" {
+		field := strings.TrimPrefix(params.Sort, "-")
+		descending := strings.HasPrefix(params.Sort, "-")
+		switch field {
+		case "pid":
+			query.OrderBy = "pid"
+		case "name":
+			query.OrderBy = "name"
+		case "cpu", "cpuPercent":
+			query.OrderBy = "cpu_percent_normalized"
+		case "memory", "memoryMb":
+			query.OrderBy = "memory_mb"
+		case "category":
+			query.OrderBy = "category"
+		case "status":
+			// "active" sorts before "idle"
+			query.OrderBy = "is_active"
+			descending = !descending
+		default:
+			return query, nil
+		}
+		query.Descending = descending
 	}
 
-	return processes
+	return query, nil
 }
 
 // processToResponse converts a ResourceRecord to ProcessResponse
@@ -331,10 +335,13 @@ func (h *ProcessHandler) processToResponse(record *core.ResourceRecord) ProcessR
 		MemoryMB:      record.MemoryMB,
 		MemoryPercent: memoryPercent,
 		Category:      record.Category,
+		Labels:        record.Labels,
+		Username:      record.Username,
 		WorkDir:       record.WorkingDir,
 		CreatedAt:     record.Timestamp,
 		IsActive:      record.IsActive,
 		Uptime:        uptime,
+		Host:          record.Host,
 	}
 }
 
@@ -370,6 +377,9 @@ func (h *ProcessHandler) processTreeToMap(node *core.ProcessTreeNode) map[string
 		"isActive":      process.IsActive,
 		"uptime":        process.Uptime,
 	}
+	if process.Host != "" {
+		result["host"] = process.Host
+	}
 
 	// Add children recursively
 	if len(node.Children) > 0 {
@@ -398,156 +408,6 @@ func (h *ProcessHandler) findProcessInTree(node *core.ProcessTreeNode, pid int32
 	return nil
 }
 
-// sortProcesses sorts processes by the specified field
-func (h *ProcessHandler) sortProcesses(processes []ProcessResponse, sortField string) {
-	// Parse sort direction (default is descending for processes)
-	direction := "desc"
-	if len(sortField) > 0 && sortField[0] != '-' {
-		direction = "asc"
-	}
-
-	field := sortField
-	if len(sortField) > 0 && sortField[0] == '-' {
-		field = sortField[1:]
-	}
-
-	switch field {
-	case "pid":
-		h.sortByPID(processes, direction)
-	case "name":
-		h.sortByName(processes, direction)
-	case "cpu", "cpuPercent":
-		h.sortByCPU(processes, direction)
-	case "memory", "memoryMb":
-		h.sortByMemory(processes, direction)
-	case "status":
-		h.sortByStatus(processes, direction)
-	case "category":
-		h.sortByCategory(processes, direction)
-	}
-}
-
-// Sorting functions
-func (h *ProcessHandler) sortByPID(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].PID > processes[j].PID {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].PID < processes[j].PID {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
-func (h *ProcessHandler) sortByName(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Name > processes[j].Name {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Name < processes[j].Name {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
-func (h *ProcessHandler) sortByCPU(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].CPUPercent > processes[j].CPUPercent {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].CPUPercent < processes[j].CPUPercent {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
-func (h *ProcessHandler) sortByMemory(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].MemoryMB > processes[j].MemoryMB {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].MemoryMB < processes[j].MemoryMB {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
-func (h *ProcessHandler) sortByStatus(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Status > processes[j].Status {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Status < processes[j].Status {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
-func (h *ProcessHandler) sortByCategory(processes []ProcessResponse, direction string) {
-	if direction == "asc" {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Category > processes[j].Category {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	} else {
-		for i := 0; i < len(processes)-1; i++ {
-			for j := i + 1; j < len(processes); j++ {
-				if processes[i].Category < processes[j].Category {
-					processes[i], processes[j] = processes[j], processes[i]
-				}
-			}
-		}
-	}
-}
-
 // formatUptime formats duration into human readable string
 func formatUptime(d time.Duration) string {
 	if d < time.Minute {
@@ -564,4 +424,4 @@ func formatUptime(d time.Duration) string {
 		}
 		return fmt.Sprintf("%dd", days)
 	}
-}
\ No newline at end of file
+}
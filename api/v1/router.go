@@ -1,18 +1,25 @@
 package v1
 
 import (
+	"bytes"
+	"fmt"
+	"runtime"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v3/host"
 	"github.com/yourusername/process-tracker/core"
 )
 
 // Router sets up the API v1 routes
 type Router struct {
-	engine       *gin.Engine
-	taskHandler  *TaskHandler
-	procHandler  *ProcessHandler
-	statsHandler *StatsHandler
+	engine        *gin.Engine
+	taskHandler   *TaskHandler
+	procHandler   *ProcessHandler
+	statsHandler  *StatsHandler
+	eventHandler  *EventHandler
+	searchHandler *SearchHandler
+	hostHandler   *HostHandler
 }
 
 // NewRouter creates a new API v1 router
@@ -35,13 +42,19 @@ func NewRouter(app *core.App) *Router {
 	taskHandler := NewTaskHandler(app)
 	procHandler := NewProcessHandler(app)
 	statsHandler := NewStatsHandler(app)
+	eventHandler := NewEventHandler(app)
+	searchHandler := NewSearchHandler(app)
+	hostHandler := NewHostHandler(app)
 
 	// Create router
 	router := &Router{
-		engine:       engine,
-		taskHandler:  taskHandler,
-		procHandler:  procHandler,
-		statsHandler: statsHandler,
+		engine:        engine,
+		taskHandler:   taskHandler,
+		procHandler:   procHandler,
+		statsHandler:  statsHandler,
+		eventHandler:  eventHandler,
+		searchHandler: searchHandler,
+		hostHandler:   hostHandler,
 	}
 
 	// Setup routes
@@ -86,6 +99,15 @@ func (r *Router) setupRoutes() {
 		processes.GET("/:pid/tree", r.procHandler.GetProcessTree)
 	}
 
+	// Process lifecycle event routes
+	v1.GET("/events", r.eventHandler.ListEvents)
+
+	// Command line search routes
+	v1.GET("/search", r.searchHandler.Search)
+
+	// Fleet overview (agent/aggregator mode)
+	v1.GET("/hosts", r.hostHandler.ListHosts)
+
 	// Statistics routes
 	stats := v1.Group("/stats")
 	{
@@ -95,6 +117,7 @@ func (r *Router) setupRoutes() {
 		stats.GET("/top", r.statsHandler.GetStatsTop)
 		stats.GET("/resources", r.statsHandler.GetStatsResources)
 		stats.GET("/history", r.statsHandler.GetStatsHistory)
+		stats.GET("/system", r.statsHandler.GetStatsSystem)
 	}
 
 	// Legacy compatibility routes (mapped to new endpoints)
@@ -138,9 +161,9 @@ func (r *Router) setupRoutes() {
 // System info handlers
 func (r *Router) handleSystemInfo(c *gin.Context) {
 	systemInfo := SystemInfoResponse{
-		Hostname:     "localhost", // Would need actual hostname
-		OS:           "linux",     // Would need actual OS info
-		Architecture: "x86_64",   // Would need actual architecture
+		Hostname:     "unknown",
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
 		CPUInfo: CPUInfo{
 			Model:     "Unknown CPU",
 			Cores:     core.SystemCPUCores(),
@@ -149,20 +172,40 @@ func (r *Router) handleSystemInfo(c *gin.Context) {
 			Cache:     "Unknown",
 		},
 		MemoryInfo: MemoryInfo{
-			Total:     uint64(core.SystemMemoryMB()) * 1024 * 1024,
-			Available: 0, // Would need calculation
-			Used:      0, // Would need calculation
-			Free:      0, // Would need calculation
-			Buffers:   0,
-			Cached:    0,
-			SwapTotal: 0,
-			SwapUsed:  0,
+			Total: uint64(core.SystemMemoryMB()) * 1024 * 1024,
 		},
 		NetworkInfo: []NetworkInfo{}, // Would need actual network info
-		DiskInfo:    []DiskInfo{},    // Would need actual disk info
-		Uptime:      "unknown",
+		DiskInfo:    []DiskInfo{},
+		Uptime:      systemUptime(),
 		LoadAverage: []float64{0, 0, 0},
-		GeneratedAt:  time.Now(),
+		GeneratedAt: time.Now(),
+	}
+
+	if info, err := host.Info(); err == nil {
+		systemInfo.Hostname = info.Hostname
+		if info.Platform != "" {
+			systemInfo.OS = fmt.Sprintf("%s %s (%s)", info.Platform, info.PlatformVersion, info.OS)
+		}
+	}
+
+	if record, err := r.statsHandler.app.GetLatestSystemRecord(); err == nil {
+		const mb = 1024 * 1024
+		free := record.MemoryTotalMB - record.MemoryUsedMB - record.MemoryCachedMB - record.MemoryBuffersMB
+		if free < 0 {
+			free = 0
+		}
+		systemInfo.MemoryInfo = MemoryInfo{
+			Total:     uint64(record.MemoryTotalMB * mb),
+			Available: uint64(record.MemoryAvailableMB * mb),
+			Used:      uint64(record.MemoryUsedMB * mb),
+			Free:      uint64(free * mb),
+			Buffers:   uint64(record.MemoryBuffersMB * mb),
+			Cached:    uint64(record.MemoryCachedMB * mb),
+			SwapTotal: uint64(record.SwapTotalMB * mb),
+			SwapUsed:  uint64(record.SwapUsedMB * mb),
+		}
+		systemInfo.DiskInfo = toDiskInfos(record.Disks)
+		systemInfo.LoadAverage = []float64{record.Load1, record.Load5, record.Load15}
 	}
 
 	SendSuccess(c, KindSystemInfo, systemInfo, &ResponseMetadata{
@@ -192,16 +235,14 @@ func (r *Router) handleVersion(c *gin.Context) {
 	})
 }
 
+// handleMetrics serves the latest collection in the Prometheus text exposition format
 func (r *Router) handleMetrics(c *gin.Context) {
-	// This would return Prometheus-style metrics
-	// For now, return a placeholder
-	c.Header("Content-Type", "text/plain")
-	c.String(200, "# HELP process_tracker_metrics\n# Process Tracker metrics\n\n"+
-		"# Total number of tasks\nprocess_tracker_tasks_total 0\n\n"+
-		"# Number of running tasks\nprocess_tracker_tasks_running 0\n\n"+
-		"# Total number of processes\nprocess_tracker_processes_total 0\n\n"+
-		"# CPU usage percentage\nprocess_tracker_cpu_usage 0.0\n\n"+
-		"# Memory usage in MB\nprocess_tracker_memory_usage 0.0")
+	var buf bytes.Buffer
+	if err := r.statsHandler.app.WriteMetrics(&buf); err != nil {
+		SendInternalServerError(c, err)
+		return
+	}
+	c.Data(200, core.MetricsContentType, buf.Bytes())
 }
 
 func (r *Router) handleAPIDocs(c *gin.Context) {
@@ -233,6 +274,9 @@ func (r *Router) handleAPIDocs(c *gin.Context) {
     <h2>Authentication</h2>
     <p>Currently no authentication is required. This may change in future versions.</p>
 
+    <h2>Hosts</h2>
+    <p>When an aggregator collects records from agents, every endpoint that reads process records accepts <code>host</code> to select one machine (e.g. <code>/v1/processes?host=web-01</code>); without it, all hosts are included. Host metrics and process events are only kept for the machine serving the API.</p>
+
     <h2>Response Format</h2>
     <pre>
 {
@@ -294,19 +338,31 @@ func (r *Router) handleAPIDocs(c *gin.Context) {
         <p>Stop a task.</p>
     </div>
 
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/tasks/{id}/stats</h3>
+        <p>Resource time series of a task's process tree (CPU, memory, I/O, process count), recorded each collection tick by the monitoring daemon, with peak, average and total summaries.</p>
+    </div>
+
     <div class="endpoint">
         <h3><span class="method get">GET</span> /v1/processes</h3>
         <p>List all processes with filtering support.</p>
         <p><strong>Query Parameters:</strong></p>
         <ul>
             <li><code>view</code> - View mode: flat or tree</li>
-            <li><code>sort</code> - Sort results</li>
+            <li><code>filter</code> - Filter processes, repeatable (e.g., filter=user=alice&amp;filter=category=development). Keys: name, category, pid, user</li>
+            <li><code>sort</code> - Sort results: pid, name, cpu, memory, category or status; prefix with - for descending</li>
+            <li><code>limit</code>, <code>offset</code> - Pagination for the flat view</li>
         </ul>
     </div>
 
     <div class="endpoint">
         <h3><span class="method get">GET</span> /v1/stats</h3>
         <p>Get comprehensive statistics.</p>
+        <p><strong>Query Parameters:</strong></p>
+        <ul>
+            <li><code>group_by</code> - Aggregate by owner instead: user</li>
+            <li><code>period</code> - Time period for group_by (e.g., 1h, 24h)</li>
+        </ul>
     </div>
 
     <div class="endpoint">
@@ -318,6 +374,57 @@ func (r *Router) handleAPIDocs(c *gin.Context) {
         </ul>
     </div>
 
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/stats/history</h3>
+        <p>Get average CPU and memory per bucket. With SQLite storage, long ranges are read from the 1m/1h/1d rollup tiers; <code>source</code> in the response names the tier used.</p>
+        <p><strong>Query Parameters:</strong></p>
+        <ul>
+            <li><code>period</code> - Time period (e.g., 24h, 30d, 365d)</li>
+            <li><code>granularity</code> - Bucket size: 1m, 5m, 15m, 1h, 6h or 1d</li>
+        </ul>
+    </div>
+
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/stats/system</h3>
+        <p>Get host-level metrics samples (load average, CPU by mode, memory, swap, pressure stall information, disk usage).</p>
+        <p><strong>Query Parameters:</strong></p>
+        <ul>
+            <li><code>period</code> - Time period (e.g., 1h, 24h)</li>
+        </ul>
+    </div>
+
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/events</h3>
+        <p>List process lifecycle events (process_started, process_exited, cmdline_changed), newest first.</p>
+        <p><strong>Query Parameters:</strong></p>
+        <ul>
+            <li><code>process</code> - PID or process name (substring match)</li>
+            <li><code>type</code> - Event type</li>
+            <li><code>from</code> / <code>to</code> - RFC3339, '2006-01-02 15:04', unix seconds, or a duration ago (e.g. 12h or 30d). Default: last 24h</li>
+        </ul>
+    </div>
+
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/search</h3>
+        <p>Search historical command lines and working directories. Matching processes are grouped into runs (same name, command, working directory and user, observed without a gap), newest first, with first/last seen, PIDs and peak resources.</p>
+        <p><strong>Query Parameters:</strong></p>
+        <ul>
+            <li><code>q</code> - Words to find; each word matches as a phrase of whole words (e.g. q=rsync /data/backup)</li>
+            <li><code>from</code> / <code>to</code> - Same formats as /v1/events. Default: last 30 days</li>
+            <li><code>limit</code>, <code>offset</code> - Pagination</li>
+        </ul>
+    </div>
+
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/hosts</h3>
+        <p>Fleet overview: every host reporting to the aggregator or with stored records, with role, last contact, online status, batches and records received, and the process count, CPU and memory totals of its latest processes.</p>
+    </div>
+
+    <div class="endpoint">
+        <h3><span class="method get">GET</span> /v1/system/metrics</h3>
+        <p>Prometheus text exposition of the latest collection: per-process CPU, memory, threads, CPU time and disk I/O (labeled by name and category, plus the optional pid, cmdline_hash, user and container labels configured under <code>metrics</code>), host metrics, task counts by status, active alerts, collector duration and storage size.</p>
+    </div>
+
     <h2>Error Handling</h2>
     <p>Errors are returned with appropriate HTTP status codes and consistent error format:</p>
     <pre>
@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/process-tracker/core"
+)
+
+// defaultSearchRange is searched when 'from' is not given
+const defaultSearchRange = 30 * 24 * time.Hour
+
+// SearchHandler handles command line search API endpoints
+type SearchHandler struct {
+	app *core.App
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(app *core.App) *SearchHandler {
+	return &SearchHandler{app: app}
+}
+
+// Search returns the runs of commands matching a search, newest first
+// Query parameters: q (required), from, to, host
+func (h *SearchHandler) Search(c *gin.Context) {
+	params := c.MustGet("query_params").(QueryParams)
+
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		SendBadRequest(c, "Missing 'q' parameter")
+		return
+	}
+	if err := core.ValidateSearchText(text); err != nil {
+		SendBadRequest(c, "Invalid 'q' parameter: "+err.Error())
+		return
+	}
+	now := time.Now()
+	from, err := core.ParseQueryTime(c.Query("from"), now.Add(-defaultSearchRange), now)
+	if err != nil {
+		SendBadRequest(c, "Invalid 'from' parameter: "+err.Error())
+		return
+	}
+	to, err := core.ParseQueryTime(c.Query("to"), now, now)
+	if err != nil {
+		SendBadRequest(c, "Invalid 'to' parameter: "+err.Error())
+		return
+	}
+	if to.Before(from) {
+		SendBadRequest(c, "'to' must not be before 'from'")
+		return
+	}
+
+	runs, err := h.app.SearchCommands(c.Request.Context(), core.SearchQuery{Text: text, Start: from, End: to, Host: params.Host})
+	if err != nil {
+		SendInternalServerError(c, fmt.Errorf("failed to search commands: %w", err))
+		return
+	}
+
+	total := len(runs)
+	start := params.Offset
+	if start > total {
+		start = total
+	}
+	end := start + params.Limit
+	if end > total {
+		end = total
+	}
+
+	response := make([]CommandRunResponse, 0, end-start)
+	for _, run := range runs[start:end] {
+		response = append(response, commandRunToResponse(run))
+	}
+	SendPaginated(c, KindSearchList, response, total, params)
+}
+
+// commandRunToResponse converts a core command run to API response format
+func commandRunToResponse(run core.CommandRun) CommandRunResponse {
+	return CommandRunResponse{
+		Name:            run.Name,
+		Command:         run.Command,
+		WorkingDir:      run.WorkingDir,
+		Username:        run.Username,
+		Category:        run.Category,
+		Host:            run.Host,
+		PIDs:            run.PIDs,
+		FirstSeen:       run.FirstSeen,
+		LastSeen:        run.LastSeen,
+		Duration:        formatUptime(run.TotalUptime),
+		DurationSeconds: run.TotalUptime.Seconds(),
+		ActiveTime:      formatUptime(run.ActiveTime),
+		Samples:         run.Samples,
+		PeakCPU:         run.CPUMax,
+		AvgCPU:          run.CPUAvg,
+		PeakMemoryMB:    run.MemoryMax,
+		AvgMemoryMB:     run.MemoryAvg,
+		CPUSeconds:      run.TotalCPUTime.Seconds(),
+	}
+}
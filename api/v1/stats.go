@@ -1,12 +1,15 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v3/host"
 	"github.com/yourusername/process-tracker/core"
 )
 
@@ -75,8 +78,21 @@ func NewStatsHandler(app *core.App) *StatsHandler {
 
 // GetStats returns comprehensive statistics
 func (h *StatsHandler) GetStats(c *gin.Context) {
+	switch groupBy := c.Query("group_by"); groupBy {
+	case "":
+	case "user":
+		h.getStatsByUser(c)
+		return
+	default:
+		SendBadRequest(c, fmt.Sprintf("Invalid group_by '%s'. Supported: user", groupBy))
+		return
+	}
+
+	host := queryHost(c)
+
 	// Check cache first
-	if cached, ok := h.cache.Get("comprehensive"); ok {
+	cacheKey := "comprehensive_" + host
+	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
 
@@ -85,24 +101,79 @@ func (h *StatsHandler) GetStats(c *gin.Context) {
 	}
 
 	// Calculate comprehensive statistics
-	stats, err := h.calculateComprehensiveStats()
+	stats, err := h.calculateComprehensiveStats(c.Request.Context(), host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to calculate statistics: %w", err))
 		return
 	}
 
 	// Cache result
-	h.cache.Set("comprehensive", stats)
+	h.cache.Set(cacheKey, stats)
 
 	SendSuccess(c, KindStats, stats, &ResponseMetadata{
 		GeneratedAt: time.Now(),
 	})
 }
 
+// getStatsByUser returns resource usage aggregated by process owner
+func (h *StatsHandler) getStatsByUser(c *gin.Context) {
+	periodStr := c.DefaultQuery("period", "1h")
+	duration, err := parsePeriod(periodStr)
+	if err != nil {
+		SendBadRequest(c, "Invalid period format. Use format like '1h', '24h', '7d'")
+		return
+	}
+
+	host := queryHost(c)
+	cacheKey := "users_" + periodStr + "_" + host
+	if cached, ok := h.cache.Get(cacheKey); ok {
+		SendSuccess(c, KindStats, cached, &ResponseMetadata{
+			GeneratedAt: time.Now(),
+		})
+		return
+	}
+
+	stats, err := h.app.CalculateUserStats(duration, host)
+	if err != nil {
+		SendInternalServerError(c, fmt.Errorf("failed to calculate user statistics: %w", err))
+		return
+	}
+
+	users := make([]UserStatsResponse, 0, len(stats))
+	for _, s := range stats {
+		users = append(users, UserStatsResponse{
+			Username:      s.Username,
+			UID:           s.UID,
+			ProcessCount:  s.ProcessCount,
+			Samples:       s.Samples,
+			AvgCPUPercent: s.AvgCPU,
+			MaxCPUPercent: s.MaxCPU,
+			AvgMemoryMB:   s.AvgMemoryMB,
+			MaxMemoryMB:   s.MaxMemoryMB,
+		})
+	}
+
+	response := map[string]interface{}{
+		"groupBy":     "user",
+		"period":      periodStr,
+		"users":       users,
+		"generatedAt": time.Now(),
+	}
+	h.cache.Set(cacheKey, response)
+
+	SendSuccess(c, KindStats, response, &ResponseMetadata{
+		Total:       len(users),
+		GeneratedAt: time.Now(),
+	})
+}
+
 // GetStatsSummary returns summary statistics
 func (h *StatsHandler) GetStatsSummary(c *gin.Context) {
+	host := queryHost(c)
+
 	// Check cache first
-	if cached, ok := h.cache.Get("summary"); ok {
+	cacheKey := "summary_" + host
+	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
 
@@ -111,14 +182,14 @@ func (h *StatsHandler) GetStatsSummary(c *gin.Context) {
 	}
 
 	// Calculate summary statistics
-	summary, err := h.calculateSummaryStats()
+	summary, err := h.calculateSummaryStats(c.Request.Context(), host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to calculate summary statistics: %w", err))
 		return
 	}
 
 	// Cache result
-	h.cache.Set("summary", summary)
+	h.cache.Set(cacheKey, summary)
 
 	SendSuccess(c, KindStats, summary, &ResponseMetadata{
 		GeneratedAt: time.Now(),
@@ -129,14 +200,15 @@ func (h *StatsHandler) GetStatsSummary(c *gin.Context) {
 func (h *StatsHandler) GetStatsTimeline(c *gin.Context) {
 	// Get query parameters
 	periodStr := c.DefaultQuery("period", "1h")
-	duration, err := time.ParseDuration(periodStr)
+	duration, err := parsePeriod(periodStr)
 	if err != nil {
 		SendBadRequest(c, "Invalid period format. Use format like '1h', '24h', '7d'")
 		return
 	}
 
 	// Check cache first
-	cacheKey := "timeline_" + periodStr
+	host := queryHost(c)
+	cacheKey := "timeline_" + periodStr + "_" + host
 	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
@@ -146,7 +218,7 @@ func (h *StatsHandler) GetStatsTimeline(c *gin.Context) {
 	}
 
 	// Calculate timeline statistics
-	timeline, err := h.calculateTimelineStats(duration)
+	timeline, err := h.calculateTimelineStats(c.Request.Context(), duration, host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to calculate timeline statistics: %w", err))
 		return
@@ -177,7 +249,8 @@ func (h *StatsHandler) GetStatsTop(c *gin.Context) {
 	}
 
 	// Check cache first
-	cacheKey := fmt.Sprintf("top_%s_%d", metric, limit)
+	host := queryHost(c)
+	cacheKey := fmt.Sprintf("top_%s_%d_%s", metric, limit, host)
 	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
@@ -187,7 +260,7 @@ func (h *StatsHandler) GetStatsTop(c *gin.Context) {
 	}
 
 	// Get recent processes
-	records, err := h.readRecentRecords(5 * time.Minute)
+	records, err := h.recentRecords(c.Request.Context(), 5*time.Minute, host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to read process records: %w", err))
 		return
@@ -217,8 +290,11 @@ func (h *StatsHandler) GetStatsTop(c *gin.Context) {
 
 // GetStatsResources returns resource usage statistics
 func (h *StatsHandler) GetStatsResources(c *gin.Context) {
+	host := queryHost(c)
+
 	// Check cache first
-	if cached, ok := h.cache.Get("resources"); ok {
+	cacheKey := "resources_" + host
+	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
 
@@ -227,14 +303,14 @@ func (h *StatsHandler) GetStatsResources(c *gin.Context) {
 	}
 
 	// Calculate resource statistics
-	resources, err := h.calculateResourceStats()
+	resources, err := h.calculateResourceStats(c.Request.Context(), host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to calculate resource statistics: %w", err))
 		return
 	}
 
 	// Cache result
-	h.cache.Set("resources", resources)
+	h.cache.Set(cacheKey, resources)
 
 	SendSuccess(c, KindStats, resources, &ResponseMetadata{
 		GeneratedAt: time.Now(),
@@ -245,7 +321,7 @@ func (h *StatsHandler) GetStatsResources(c *gin.Context) {
 func (h *StatsHandler) GetStatsHistory(c *gin.Context) {
 	// Get query parameters
 	periodStr := c.DefaultQuery("period", "24h")
-	duration, err := time.ParseDuration(periodStr)
+	duration, err := parsePeriod(periodStr)
 	if err != nil {
 		SendBadRequest(c, "Invalid period format. Use format like '1h', '24h', '7d'")
 		return
@@ -254,7 +330,8 @@ func (h *StatsHandler) GetStatsHistory(c *gin.Context) {
 	granularity := c.DefaultQuery("granularity", "1h")
 
 	// Check cache first
-	cacheKey := fmt.Sprintf("history_%s_%s", periodStr, granularity)
+	host := queryHost(c)
+	cacheKey := fmt.Sprintf("history_%s_%s_%s", periodStr, granularity, host)
 	if cached, ok := h.cache.Get(cacheKey); ok {
 		SendSuccess(c, KindStats, cached, &ResponseMetadata{
 			GeneratedAt: time.Now(),
@@ -264,7 +341,7 @@ func (h *StatsHandler) GetStatsHistory(c *gin.Context) {
 	}
 
 	// Calculate historical statistics
-	history, err := h.calculateHistoryStats(duration, granularity)
+	history, source, err := h.calculateHistoryStats(c.Request.Context(), duration, granularity, host)
 	if err != nil {
 		SendInternalServerError(c, fmt.Errorf("failed to calculate historical statistics: %w", err))
 		return
@@ -273,6 +350,7 @@ func (h *StatsHandler) GetStatsHistory(c *gin.Context) {
 	response := map[string]interface{}{
 		"period":      periodStr,
 		"granularity": granularity,
+		"source":      source,
 		"history":     history,
 		"generatedAt": time.Now(),
 	}
@@ -287,40 +365,29 @@ func (h *StatsHandler) GetStatsHistory(c *gin.Context) {
 
 // Helper functions
 
-// readRecentRecords reads recent records from storage
-func (h *StatsHandler) readRecentRecords(duration time.Duration) ([]core.ResourceRecord, error) {
-	// Create a temporary storage manager to read data
-	storageManager := core.NewManager(h.app.DataFile, 0, false, core.StorageConfig{})
-
-	// Read all records from the data file
-	allRecords, err := storageManager.ReadRecords(h.app.DataFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read records: %w", err)
-	}
-
-	// Filter records within the time window
-	cutoffTime := time.Now().Add(-duration)
-	var recentRecords []core.ResourceRecord
-
-	for _, record := range allRecords {
-		if record.Timestamp.After(cutoffTime) {
-			recentRecords = append(recentRecords, record)
-		}
-	}
+// timelineFields are the record fields needed to build timelines and history buckets
+var timelineFields = []string{"timestamp", "cpu_percent_normalized", "memory_mb"}
 
-	return recentRecords, nil
+// recentRecords queries records collected within the last window on host ("" for every host),
+// limited to the given fields
+func (h *StatsHandler) recentRecords(ctx context.Context, window time.Duration, host string, fields ...string) ([]core.ResourceRecord, error) {
+	return h.app.QueryRecords(ctx, core.RecordQuery{
+		Start:  time.Now().Add(-window),
+		Hosts:  hostFilter(host),
+		Fields: fields,
+	})
 }
 
 // calculateComprehensiveStats calculates comprehensive statistics
-func (h *StatsHandler) calculateComprehensiveStats() (*StatsResponse, error) {
+func (h *StatsHandler) calculateComprehensiveStats(ctx context.Context, host string) (*StatsResponse, error) {
 	// Get recent records (last hour)
-	records, err := h.readRecentRecords(time.Hour)
+	records, err := h.recentRecords(ctx, time.Hour, host)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get system information
-	systemStats := h.getSystemStats()
+	systemStats := h.getSystemStats(host)
 	processStats := h.getProcessStats(records)
 	timeline := h.generateTimeline(records, time.Hour)
 
@@ -334,67 +401,40 @@ func (h *StatsHandler) calculateComprehensiveStats() (*StatsResponse, error) {
 }
 
 // calculateSummaryStats calculates summary statistics
-func (h *StatsHandler) calculateSummaryStats() (map[string]interface{}, error) {
+func (h *StatsHandler) calculateSummaryStats(ctx context.Context, host string) (map[string]interface{}, error) {
 	// Get system information
 	totalMemoryMB := core.SystemMemoryMB()
 	cpuCores := core.SystemCPUCores()
 
 	// Get recent records
-	records, err := h.readRecentRecords(5 * time.Minute)
+	records, err := h.recentRecords(ctx, 5*time.Minute, host)
 	if err != nil {
 		return nil, err
 	}
 
 	// Calculate process statistics
-	processMap := make(map[string]*processSummary)
-	for _, r := range records {
-		if _, exists := processMap[r.Name]; !exists {
-			processMap[r.Name] = &processSummary{
-				name:       r.Name,
-				totalCPU:   0,
-				totalMem:   0,
-				maxCPU:     0,
-				maxMem:     0,
-				count:      0,
-				lastRecord: r,
-			}
-		}
-
-		ps := processMap[r.Name]
-		ps.totalCPU += r.CPUPercentNormalized
-		ps.totalMem += r.MemoryMB
-		if r.CPUPercentNormalized > ps.maxCPU {
-			ps.maxCPU = r.CPUPercentNormalized
-		}
-		if r.MemoryMB > ps.maxMem {
-			ps.maxMem = r.MemoryMB
-		}
-		ps.count++
-		ps.lastRecord = r
-	}
+	processes := processStats(records)
 
 	// Calculate aggregates
 	var totalCPU, totalMem, maxCPU, maxMem float64
 	activeCount := 0
 	categoryStats := make(map[string]int)
 
-	for _, ps := range processMap {
-		avgCPU := ps.totalCPU / float64(ps.count)
-		avgMem := ps.totalMem / float64(ps.count)
-		totalCPU += avgCPU
-		totalMem += avgMem
-		if ps.maxCPU > maxCPU {
-			maxCPU = ps.maxCPU
+	for _, ps := range processes {
+		totalCPU += ps.CPUAvg
+		totalMem += ps.MemoryAvg
+		if ps.CPUMax > maxCPU {
+			maxCPU = ps.CPUMax
 		}
-		if ps.maxMem > maxMem {
-			maxMem = ps.maxMem
+		if ps.MemoryMax > maxMem {
+			maxMem = ps.MemoryMax
 		}
-		if ps.lastRecord.IsActive {
+		if ps.Latest.IsActive {
 			activeCount++
 		}
 
 		// Category statistics
-		category := ps.lastRecord.Category
+		category := ps.Latest.Category
 		if category == "" {
 			category = "unknown"
 		}
@@ -407,7 +447,7 @@ func (h *StatsHandler) calculateSummaryStats() (map[string]interface{}, error) {
 	}
 
 	return map[string]interface{}{
-		"processCount":  len(processMap),
+		"processCount":  len(processes),
 		"activeCount":   activeCount,
 		"totalCPU":      totalCPU,
 		"maxCPU":        maxCPU,
@@ -422,8 +462,8 @@ func (h *StatsHandler) calculateSummaryStats() (map[string]interface{}, error) {
 }
 
 // calculateTimelineStats calculates timeline statistics
-func (h *StatsHandler) calculateTimelineStats(duration time.Duration) ([]TimelinePoint, error) {
-	records, err := h.readRecentRecords(duration)
+func (h *StatsHandler) calculateTimelineStats(ctx context.Context, duration time.Duration, host string) ([]TimelinePoint, error) {
+	records, err := h.recentRecords(ctx, duration, host, timelineFields...)
 	if err != nil {
 		return nil, err
 	}
@@ -439,62 +479,9 @@ func (h *StatsHandler) calculateTopProcesses(records []core.ResourceRecord, metr
 
 	totalMemoryMB := core.SystemMemoryMB()
 
-	// Group by process name and get latest
-	processMap := make(map[string]*processSummary)
-	for _, r := range records {
-		if _, exists := processMap[r.Name]; !exists {
-			processMap[r.Name] = &processSummary{
-				name:       r.Name,
-				totalCPU:   0,
-				totalMem:   0,
-				maxCPU:     0,
-				maxMem:     0,
-				count:      0,
-				lastRecord: r,
-			}
-		}
-
-		ps := processMap[r.Name]
-		ps.totalCPU += r.CPUPercentNormalized
-		ps.totalMem += r.MemoryMB
-		if r.CPUPercentNormalized > ps.maxCPU {
-			ps.maxCPU = r.CPUPercentNormalized
-		}
-		if r.MemoryMB > ps.maxMem {
-			ps.maxMem = r.MemoryMB
-		}
-		ps.count++
-		ps.lastRecord = r
-	}
-
-	// Convert to slice
 	var processes []ProcessSummary
-	for _, ps := range processMap {
-		avgCPU := ps.totalCPU / float64(ps.count)
-		avgMem := ps.totalMem / float64(ps.count)
-
-		memoryPercent := 0.0
-		if totalMemoryMB > 0 {
-			memoryPercent = (avgMem / totalMemoryMB) * 100
-		}
-
-		uptime := ""
-		if ps.lastRecord.CreateTime > 0 {
-			startTime := time.UnixMilli(ps.lastRecord.CreateTime)
-			uptime = formatUptime(time.Since(startTime))
-		}
-
-		processes = append(processes, ProcessSummary{
-			PID:           ps.lastRecord.PID,
-			Name:          ps.name,
-			CPUPercent:    avgCPU,
-			MemoryMB:      avgMem,
-			MemoryPercent: memoryPercent,
-			Status:        (func(isActive bool) string { if isActive { return "active" } else { return "idle" } })(ps.lastRecord.IsActive),
-			Category:      ps.lastRecord.Category,
-			Command:       ps.lastRecord.Command,
-			Uptime:        uptime,
-		})
+	for _, ps := range processStats(records) {
+		processes = append(processes, toProcessSummary(ps, totalMemoryMB))
 	}
 
 	// Sort by metric
@@ -526,13 +513,13 @@ func (h *StatsHandler) calculateTopProcesses(records []core.ResourceRecord, metr
 }
 
 // calculateResourceStats calculates resource usage statistics
-func (h *StatsHandler) calculateResourceStats() (map[string]interface{}, error) {
+func (h *StatsHandler) calculateResourceStats(ctx context.Context, host string) (map[string]interface{}, error) {
 	// Get system information
 	totalMemoryMB := core.SystemMemoryMB()
 	cpuCores := core.SystemCPUCores()
 
 	// Get recent records
-	records, err := h.readRecentRecords(time.Hour)
+	records, err := h.recentRecords(ctx, time.Hour, host, "cpu_percent_normalized", "memory_mb")
 	if err != nil {
 		return nil, err
 	}
@@ -571,13 +558,8 @@ func (h *StatsHandler) calculateResourceStats() (map[string]interface{}, error)
 	}, nil
 }
 
-// calculateHistoryStats calculates historical statistics
-func (h *StatsHandler) calculateHistoryStats(duration time.Duration, granularity string) ([]map[string]interface{}, error) {
-	records, err := h.readRecentRecords(duration)
-	if err != nil {
-		return nil, err
-	}
-
+// calculateHistoryStats calculates historical statistics, reading rollup tiers for long ranges
+func (h *StatsHandler) calculateHistoryStats(ctx context.Context, duration time.Duration, granularity, host string) ([]map[string]interface{}, string, error) {
 	// Parse granularity
 	var bucketSize time.Duration
 	switch granularity {
@@ -597,76 +579,167 @@ func (h *StatsHandler) calculateHistoryStats(duration time.Duration, granularity
 		bucketSize = time.Hour
 	}
 
-	// Group records into buckets
-	buckets := make(map[string][]core.ResourceRecord)
-	for _, r := range records {
-		key := r.Timestamp.Truncate(bucketSize).Format("2006-01-02T15:04:05Z")
-		buckets[key] = append(buckets[key], r)
+	end := time.Now()
+	points, source, err := h.app.History(ctx, end.Add(-duration), end, bucketSize, host)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Convert to timeline
-	var history []map[string]interface{}
-	for _, bucket := range buckets {
-		if len(bucket) == 0 {
-			continue
-		}
+	history := make([]map[string]interface{}, 0, len(points))
+	for _, p := range points {
+		history = append(history, map[string]interface{}{
+			"timestamp":    p.Timestamp,
+			"cpu":          p.CPU,
+			"memory":       p.MemoryMB,
+			"processCount": p.Samples,
+			"count":        p.Samples,
+		})
+	}
 
-		// Calculate bucket statistics
-		avgCPU := 0.0
-		avgMem := 0.0
-		processCount := len(bucket)
+	return history, source, nil
+}
 
-		for _, r := range bucket {
-			avgCPU += r.CPUPercentNormalized
-			avgMem += r.MemoryMB
+// getSystemStats returns system statistics
+// Host metrics are only collected for the machine serving the API; other hosts get the defaults.
+func (h *StatsHandler) getSystemStats(host string) SystemStats {
+	totalMemoryMB := core.SystemMemoryMB()
+	cpuCores := core.SystemCPUCores()
+
+	stats := SystemStats{
+		TotalMemoryMB: totalMemoryMB,
+		CPUCores:      cpuCores,
+		Uptime:        systemUptime(),
+		LoadAverage:   []float64{0, 0, 0},
+		Disks:         []DiskInfo{},
+	}
+	if !h.app.IsLocalHost(host) {
+		return stats
+	}
+
+	record, err := h.app.GetLatestSystemRecord()
+	if err != nil {
+		return stats
+	}
+
+	if record.MemoryTotalMB > 0 {
+		stats.TotalMemoryMB = record.MemoryTotalMB
+	}
+	stats.UsedMemoryMB = record.MemoryUsedMB
+	stats.AvailableMemoryMB = record.MemoryAvailableMB
+	stats.MemoryPercent = record.MemoryPercent
+	stats.CPUUsage = record.CPUPercent
+	stats.CPUIOWait = record.CPUIOWait
+	stats.LoadAverage = []float64{record.Load1, record.Load5, record.Load15}
+	stats.SwapTotalMB = record.SwapTotalMB
+	stats.SwapUsedMB = record.SwapUsedMB
+	stats.Pressure = toPressureStats(record)
+	stats.Disks = toDiskInfos(record.Disks)
+
+	return stats
+}
+
+// GetStatsSystem returns host-level metrics samples for a period
+func (h *StatsHandler) GetStatsSystem(c *gin.Context) {
+	periodStr := c.DefaultQuery("period", "1h")
+	duration, err := parsePeriod(periodStr)
+	if err != nil {
+		SendBadRequest(c, "Invalid period format. Use format like '1h', '24h', '7d'")
+		return
+	}
+
+	// Host metrics are only kept for the local machine
+	var records []core.SystemRecord
+	if h.app.IsLocalHost(queryHost(c)) {
+		end := time.Now()
+		records, err = h.app.GetSystemRecords(end.Add(-duration), end)
+		if err != nil {
+			SendInternalServerError(c, fmt.Errorf("failed to read system metrics: %w", err))
+			return
 		}
-		avgCPU /= float64(len(bucket))
-		avgMem /= float64(len(bucket))
+	}
 
-		// Use first record's timestamp as bucket time
-		bucketTime := bucket[0].Timestamp
+	points := make([]SystemMetricsPoint, 0, len(records))
+	for i, record := range records {
+		point := toSystemMetricsPoint(record)
+		// Disk usage changes slowly; only include it with the latest sample
+		if i != len(records)-1 {
+			point.Disks = nil
+		}
+		points = append(points, point)
+	}
 
-		history = append(history, map[string]interface{}{
-			"timestamp":    bucketTime,
-			"cpu":          avgCPU,
-			"memory":       avgMem,
-			"processCount": processCount,
-			"count":        len(bucket),
-		})
+	response := map[string]interface{}{
+		"period":      periodStr,
+		"samples":     points,
+		"generatedAt": time.Now(),
 	}
 
-	// Sort by timestamp
-	sort.Slice(history, func(i, j int) bool {
-		timeI := history[i]["timestamp"].(time.Time)
-		timeJ := history[j]["timestamp"].(time.Time)
-		return timeI.Before(timeJ)
+	SendSuccess(c, KindStats, response, &ResponseMetadata{
+		Total:       len(points),
+		GeneratedAt: time.Now(),
 	})
+}
 
-	return history, nil
+// toSystemMetricsPoint converts a core system record into an API sample
+func toSystemMetricsPoint(record core.SystemRecord) SystemMetricsPoint {
+	return SystemMetricsPoint{
+		Timestamp:      record.Timestamp,
+		LoadAverage:    []float64{record.Load1, record.Load5, record.Load15},
+		CPUUsage:       record.CPUPercent,
+		CPUUser:        record.CPUUser,
+		CPUSystem:      record.CPUSystem,
+		CPUIOWait:      record.CPUIOWait,
+		CPUSteal:       record.CPUSteal,
+		MemoryUsedMB:   record.MemoryUsedMB,
+		MemoryCachedMB: record.MemoryCachedMB,
+		MemoryPercent:  record.MemoryPercent,
+		SwapUsedMB:     record.SwapUsedMB,
+		Pressure:       toPressureStats(record),
+		Disks:          toDiskInfos(record.Disks),
+	}
 }
 
-// Helper data structures
-type processSummary struct {
-	name       string
-	totalCPU   float64
-	totalMem   float64
-	maxCPU     float64
-	maxMem     float64
-	count      int
-	lastRecord core.ResourceRecord
+// toPressureStats extracts pressure stall information from a system record
+func toPressureStats(record core.SystemRecord) PressureStats {
+	return PressureStats{
+		CPUSome:    record.PSICPUSome,
+		MemorySome: record.PSIMemorySome,
+		MemoryFull: record.PSIMemoryFull,
+		IOSome:     record.PSIIOSome,
+		IOFull:     record.PSIIOFull,
+	}
 }
 
-// getSystemStats returns system statistics
-func (h *StatsHandler) getSystemStats() SystemStats {
-	totalMemoryMB := core.SystemMemoryMB()
-	cpuCores := core.SystemCPUCores()
+// toDiskInfos converts disk usage (MB) into API disk information (bytes)
+func toDiskInfos(disks []core.DiskUsage) []DiskInfo {
+	infos := make([]DiskInfo, 0, len(disks))
+	for _, d := range disks {
+		total := uint64(d.TotalMB * 1024 * 1024)
+		used := uint64(d.UsedMB * 1024 * 1024)
+		var free uint64
+		if total > used {
+			free = total - used
+		}
+		infos = append(infos, DiskInfo{
+			Device:     d.Device,
+			Mountpoint: d.Mountpoint,
+			Fstype:     d.Fstype,
+			Total:      total,
+			Free:       free,
+			Used:       used,
+			Percent:    d.UsedPercent,
+		})
+	}
+	return infos
+}
 
-	return SystemStats{
-		TotalMemoryMB:    totalMemoryMB,
-		CPUCores:         cpuCores,
-		Uptime:           "unknown", // Would need system uptime calculation
-		LoadAverage:      []float64{0, 0, 0}, // Would need load average calculation
+// systemUptime returns the host uptime as a human readable string
+func systemUptime() string {
+	uptime, err := host.Uptime()
+	if err != nil {
+		return "unknown"
 	}
+	return formatUptime(time.Duration(uptime) * time.Second)
 }
 
 // getProcessStats returns process statistics
@@ -676,49 +749,19 @@ func (h *StatsHandler) getProcessStats(records []core.ResourceRecord) ProcessSta
 	}
 
 	// Track unique processes
-	processMap := make(map[string]*processSummary)
-	for _, r := range records {
-		if _, exists := processMap[r.Name]; !exists {
-			processMap[r.Name] = &processSummary{
-				name:       r.Name,
-				totalCPU:   0,
-				totalMem:   0,
-				maxCPU:     0,
-				maxMem:     0,
-				count:      0,
-				lastRecord: r,
-			}
-		}
-
-		ps := processMap[r.Name]
-		ps.totalCPU += r.CPUPercentNormalized
-		ps.totalMem += r.MemoryMB
-		if r.CPUPercentNormalized > ps.maxCPU {
-			ps.maxCPU = r.CPUPercentNormalized
-		}
-		if r.MemoryMB > ps.maxMem {
-			ps.maxMem = r.MemoryMB
-		}
-		ps.count++
-		ps.lastRecord = r
-	}
+	processes := processStats(records)
 
 	// Calculate aggregates
-	var totalCPU, totalMem float64
 	activeCount := 0
 	categoryStats := make(map[string]int)
 
-	for _, ps := range processMap {
-		avgCPU := ps.totalCPU / float64(ps.count)
-		avgMem := ps.totalMem / float64(ps.count)
-		totalCPU += avgCPU
-		totalMem += avgMem
-		if ps.lastRecord.IsActive {
+	for _, ps := range processes {
+		if ps.Latest.IsActive {
 			activeCount++
 		}
 
 		// Category statistics
-		category := ps.lastRecord.Category
+		category := ps.Latest.Category
 		if category == "" {
 			category = "unknown"
 		}
@@ -726,59 +769,77 @@ func (h *StatsHandler) getProcessStats(records []core.ResourceRecord) ProcessSta
 	}
 
 	// Get top processes
-	topProcesses := h.getTopProcessSummaries(processMap, 10)
+	topProcesses := getTopProcessSummaries(processes, 10)
 
 	return ProcessStats{
-		TotalCount:   len(processMap),
+		TotalCount:   len(processes),
 		ActiveCount:  activeCount,
 		TopProcesses: topProcesses,
 		CategoryStats: categoryStats,
 	}
 }
 
-// getTopProcessSummaries converts process summaries to ProcessSummary slice
-func (h *StatsHandler) getTopProcessSummaries(processMap map[string]*processSummary, n int) []ProcessSummary {
+// getTopProcessSummaries returns the n processes with the highest average CPU
+func getTopProcessSummaries(processes []core.ResourceStats, n int) []ProcessSummary {
 	totalMemoryMB := core.SystemMemoryMB()
 
-	var processes []ProcessSummary
-	for _, ps := range processMap {
-		avgCPU := ps.totalCPU / float64(ps.count)
-		avgMem := ps.totalMem / float64(ps.count)
+	var summaries []ProcessSummary
+	for _, ps := range processes {
+		summaries = append(summaries, toProcessSummary(ps, totalMemoryMB))
+	}
 
-		memoryPercent := 0.0
-		if totalMemoryMB > 0 {
-			memoryPercent = (avgMem / totalMemoryMB) * 100
-		}
+	// Sort by CPU
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CPUPercent > summaries[j].CPUPercent
+	})
 
-		uptime := ""
-		if ps.lastRecord.CreateTime > 0 {
-			startTime := time.UnixMilli(ps.lastRecord.CreateTime)
-			uptime = formatUptime(time.Since(startTime))
-		}
+	if len(summaries) > n {
+		summaries = summaries[:n]
+	}
 
-		processes = append(processes, ProcessSummary{
-			PID:           ps.lastRecord.PID,
-			Name:          ps.name,
-			CPUPercent:    avgCPU,
-			MemoryMB:      avgMem,
-			MemoryPercent: memoryPercent,
-			Status:        (func(isActive bool) string { if isActive { return "active" } else { return "idle" } })(ps.lastRecord.IsActive),
-			Category:      ps.lastRecord.Category,
-			Command:       ps.lastRecord.Command,
-			Uptime:        uptime,
-		})
+	return summaries
+}
+
+// processStats aggregates records per process name with the core stats engine,
+// using normalized CPU like the rest of the API
+func processStats(records []core.ResourceRecord) []core.ResourceStats {
+	return core.ComputeResourceStats(records, core.StatsOptions{NormalizedCPU: true})
+}
+
+// toProcessSummary converts a process's statistics into an API summary
+func toProcessSummary(ps core.ResourceStats, totalMemoryMB float64) ProcessSummary {
+	memoryPercent := 0.0
+	if totalMemoryMB > 0 {
+		memoryPercent = (ps.MemoryAvg / totalMemoryMB) * 100
 	}
 
-	// Sort by CPU
-	sort.Slice(processes, func(i, j int) bool {
-		return processes[i].CPUPercent > processes[j].CPUPercent
-	})
+	uptime := ""
+	if ps.Latest.CreateTime > 0 {
+		startTime := time.UnixMilli(ps.Latest.CreateTime)
+		uptime = formatUptime(time.Since(startTime))
+	}
 
-	if len(processes) > n {
-		processes = processes[:n]
+	status := "idle"
+	if ps.Latest.IsActive {
+		status = "active"
 	}
 
-	return processes
+	return ProcessSummary{
+		PID:           ps.Latest.PID,
+		Name:          ps.Name,
+		CPUPercent:    ps.CPUAvg,
+		CPUMax:        ps.CPUMax,
+		CPUP95:        ps.CPUP95,
+		MemoryMB:      ps.MemoryAvg,
+		MemoryMax:     ps.MemoryMax,
+		MemoryP95:     ps.MemoryP95,
+		MemoryPercent: memoryPercent,
+		Status:        status,
+		Category:      ps.Latest.Category,
+		Username:      ps.Latest.Username,
+		Command:       ps.Latest.Command,
+		Uptime:        uptime,
+	}
 }
 
 // generateTimeline generates timeline data points
@@ -839,4 +900,16 @@ func (h *StatsHandler) generateTimeline(records []core.ResourceRecord, duration
 	})
 
 	return timeline
-}
\ No newline at end of file
+}
+
+// parsePeriod parses a period such as "90m", "24h" or "7d"
+func parsePeriod(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid period %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -295,7 +295,7 @@ func (h *TaskHandler) GetTaskLogs(c *gin.Context) {
 	})
 }
 
-// GetTaskStats returns task statistics
+// GetTaskStats returns a task's resource time series with peak and total summaries
 func (h *TaskHandler) GetTaskStats(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -304,33 +304,54 @@ func (h *TaskHandler) GetTaskStats(c *gin.Context) {
 		return
 	}
 
-	task, err := h.app.GetTask(id)
+	stats, err := h.app.GetTaskStats(id)
 	if err != nil {
-		SendNotFoundError(c, "task", id)
+		if _, getErr := h.app.GetTask(id); getErr != nil {
+			SendNotFoundError(c, "task", id)
+		} else {
+			SendInternalServerError(c, fmt.Errorf("failed to get task stats: %w", err))
+		}
 		return
 	}
 
-	stats := map[string]interface{}{
-		"id":            task.ID,
-		"name":          task.Name,
-		"status":        task.Status,
-		"processCount":  task.ProcessCount,
-		"createdAt":     task.CreatedAt,
-		"startedAt":     task.StartedAt,
-		"completedAt":   task.CompletedAt,
-		"totalCPU":      task.TotalCPU,
-		"totalMemory":   task.TotalMemory,
-		"totalDiskIO":   task.TotalDiskIO,
-		"totalNetIO":    task.TotalNetIO,
-	}
-
-	SendSuccess(c, KindStats, stats, &ResponseMetadata{
+	summary := stats.Summary
+	response := TaskStatsResponse{
+		ID:          stats.Task.ID,
+		Name:        stats.Task.Name,
+		Status:      string(stats.Task.Status),
+		StartedAt:   stats.Task.StartedAt,
+		CompletedAt: stats.Task.CompletedAt,
+		Summary: TaskStatsSummary{
+			Samples:       summary.Samples,
+			FirstSample:   summary.FirstSample,
+			LastSample:    summary.LastSample,
+			PeakCPU:       summary.PeakCPU,
+			AvgCPU:        summary.AvgCPU,
+			PeakMemoryMB:  summary.PeakMemoryMB,
+			AvgMemoryMB:   summary.AvgMemoryMB,
+			PeakProcesses: summary.PeakProcesses,
+			CPUSeconds:    summary.CPUSeconds,
+			TotalDiskIOMB: summary.TotalDiskIOMB,
+			TotalNetIOKB:  summary.TotalNetIOKB,
+		},
+		Samples: make([]TaskSamplePoint, 0, len(stats.Samples)),
+	}
+	for _, s := range stats.Samples {
+		response.Samples = append(response.Samples, TaskSamplePoint{
+			Timestamp:    s.Timestamp,
+			CPU:          s.CPU,
+			MemoryMB:     s.MemoryMB,
+			DiskIOMB:     s.DiskIOMB,
+			NetIOKB:      s.NetIOKB,
+			ProcessCount: s.ProcessCount,
+		})
+	}
+
+	SendSuccess(c, KindStats, response, &ResponseMetadata{
 		GeneratedAt: time.Now(),
 	})
 }
 
-// Helper functions
-
 // taskToResponse converts a core.Task to TaskResponse
 func (h *TaskHandler) taskToResponse(task *core.Task) TaskResponse {
 	response := TaskResponse{
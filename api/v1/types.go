@@ -17,6 +17,9 @@ const (
 	KindProcess     ResponseKind = "Process"
 	KindStats       ResponseKind = "Stats"
 	KindSystemInfo  ResponseKind = "SystemInfo"
+	KindEventList   ResponseKind = "EventList"
+	KindSearchList  ResponseKind = "SearchResultList"
+	KindHostList    ResponseKind = "HostList"
 	KindError       ResponseKind = "Error"
 )
 
@@ -58,6 +61,7 @@ type QueryParams struct {
 	Offset int       `form:"offset" binding:"min=0"`
 	Format string    `form:"format" binding:"omitempty,oneof=json yaml"`
 	View   string    `form:"view" binding:"omitempty,oneof=tree flat"`
+	Host   string    `form:"host" binding:"omitempty"` // Only this machine's data; empty means every host
 }
 
 // TaskRequest represents a task creation request
@@ -103,6 +107,42 @@ type TaskResourceUsage struct {
 	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
+// TaskStatsResponse represents a task's resource time series and summary
+type TaskStatsResponse struct {
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	StartedAt   *time.Time        `json:"startedAt,omitempty"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+	Summary     TaskStatsSummary  `json:"summary"`
+	Samples     []TaskSamplePoint `json:"samples"`
+}
+
+// TaskStatsSummary represents peak and total usage of a task
+type TaskStatsSummary struct {
+	Samples       int        `json:"samples"`
+	FirstSample   *time.Time `json:"firstSample,omitempty"`
+	LastSample    *time.Time `json:"lastSample,omitempty"`
+	PeakCPU       float64    `json:"peakCpu"`
+	AvgCPU        float64    `json:"avgCpu"`
+	PeakMemoryMB  float64    `json:"peakMemoryMb"`
+	AvgMemoryMB   float64    `json:"avgMemoryMb"`
+	PeakProcesses int        `json:"peakProcesses"`
+	CPUSeconds    float64    `json:"cpuSeconds"`
+	TotalDiskIOMB float64    `json:"totalDiskIoMb"`
+	TotalNetIOKB  float64    `json:"totalNetIoKb"`
+}
+
+// TaskSamplePoint represents the aggregated usage of a task's process tree at one tick
+type TaskSamplePoint struct {
+	Timestamp    time.Time `json:"timestamp"`
+	CPU          float64   `json:"cpu"`
+	MemoryMB     float64   `json:"memoryMb"`
+	DiskIOMB     float64   `json:"diskIoMb"`
+	NetIOKB      float64   `json:"netIoKb"`
+	ProcessCount int       `json:"processCount"`
+}
+
 // TaskUpdateRequest represents a task update request
 type TaskUpdateRequest struct {
 	Name     *string            `json:"name,omitempty"`
@@ -122,10 +162,13 @@ type ProcessResponse struct {
 	MemoryMB      float64             `json:"memoryMb"`
 	MemoryPercent float64             `json:"memoryPercent"`
 	Category      string              `json:"category"`
+	Labels        map[string]string   `json:"labels,omitempty"`
+	Username      string              `json:"username,omitempty"`
 	WorkDir       string              `json:"workDir"`
 	CreatedAt     time.Time           `json:"createdAt"`
 	IsActive      bool                `json:"isActive"`
 	Uptime        string              `json:"uptime,omitempty"`
+	Host          string              `json:"host,omitempty"`
 	Children      []ProcessResponse   `json:"children,omitempty"`
 }
 
@@ -150,6 +193,57 @@ type SystemStats struct {
 	Uptime           string  `json:"uptime"`
 	ProcessCount     int     `json:"processCount"`
 	ActiveCount      int     `json:"activeCount"`
+	CPUIOWait        float64 `json:"cpuIowait"`
+	SwapTotalMB      float64 `json:"swapTotalMb"`
+	SwapUsedMB       float64 `json:"swapUsedMb"`
+	Pressure         PressureStats `json:"pressure"`
+	Disks            []DiskInfo    `json:"disks"`
+}
+
+// EventResponse represents a process lifecycle event in API responses
+type EventResponse struct {
+	Timestamp       time.Time  `json:"timestamp"`
+	Type            string     `json:"type"`
+	PID             int32      `json:"pid"`
+	PPID            int32      `json:"ppid"`
+	Name            string     `json:"name"`
+	Command         string     `json:"command"`
+	PreviousCommand string     `json:"previousCommand,omitempty"`
+	Category        string     `json:"category"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	LastSeen        *time.Time `json:"lastSeen,omitempty"`
+	Lifetime        string     `json:"lifetime"`
+	LifetimeSeconds float64    `json:"lifetimeSeconds"`
+	CPUPercent      float64    `json:"cpuPercent"`
+	MemoryMB        float64    `json:"memoryMb"`
+	Threads         int32      `json:"threads"`
+	CPUTime         float64    `json:"cpuTime"`
+}
+
+// PressureStats represents pressure stall information (avg10, percent of time stalled)
+type PressureStats struct {
+	CPUSome    float64 `json:"cpuSome"`
+	MemorySome float64 `json:"memorySome"`
+	MemoryFull float64 `json:"memoryFull"`
+	IOSome     float64 `json:"ioSome"`
+	IOFull     float64 `json:"ioFull"`
+}
+
+// SystemMetricsPoint represents a host-level metrics sample
+type SystemMetricsPoint struct {
+	Timestamp     time.Time     `json:"timestamp"`
+	LoadAverage   []float64     `json:"loadAverage"`
+	CPUUsage      float64       `json:"cpuUsage"`
+	CPUUser       float64       `json:"cpuUser"`
+	CPUSystem     float64       `json:"cpuSystem"`
+	CPUIOWait     float64       `json:"cpuIowait"`
+	CPUSteal      float64       `json:"cpuSteal"`
+	MemoryUsedMB  float64       `json:"memoryUsedMb"`
+	MemoryCachedMB float64      `json:"memoryCachedMb"`
+	MemoryPercent float64       `json:"memoryPercent"`
+	SwapUsedMB    float64       `json:"swapUsedMb"`
+	Pressure      PressureStats `json:"pressure"`
+	Disks         []DiskInfo    `json:"disks,omitempty"`
 }
 
 // ProcessStats represents process statistics
@@ -165,14 +259,53 @@ type ProcessSummary struct {
 	PID           int32   `json:"pid"`
 	Name          string  `json:"name"`
 	CPUPercent    float64 `json:"cpuPercent"`
+	CPUMax        float64 `json:"cpuMax"`
+	CPUP95        float64 `json:"cpuP95"`
 	MemoryMB      float64 `json:"memoryMb"`
+	MemoryMax     float64 `json:"memoryMax"`
+	MemoryP95     float64 `json:"memoryP95"`
 	MemoryPercent float64 `json:"memoryPercent"`
 	Status        string  `json:"status"`
 	Category      string  `json:"category"`
+	Username      string  `json:"username,omitempty"`
 	Command       string  `json:"command"`
 	Uptime        string  `json:"uptime"`
 }
 
+// CommandRunResponse represents one run of a command found by a search
+type CommandRunResponse struct {
+	Name            string    `json:"name"`
+	Command         string    `json:"command"`
+	WorkingDir      string    `json:"workingDir"`
+	Username        string    `json:"username"`
+	Category        string    `json:"category"`
+	Host            string    `json:"host,omitempty"`
+	PIDs            []int32   `json:"pids"`
+	FirstSeen       time.Time `json:"firstSeen"`
+	LastSeen        time.Time `json:"lastSeen"`
+	Duration        string    `json:"duration"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	ActiveTime      string    `json:"activeTime"`
+	Samples         int       `json:"samples"`
+	PeakCPU         float64   `json:"peakCpu"`
+	AvgCPU          float64   `json:"avgCpu"`
+	PeakMemoryMB    float64   `json:"peakMemoryMb"`
+	AvgMemoryMB     float64   `json:"avgMemoryMb"`
+	CPUSeconds      float64   `json:"cpuSeconds"`
+}
+
+// UserStatsResponse represents resource usage aggregated by process owner
+type UserStatsResponse struct {
+	Username      string  `json:"username"`
+	UID           int32   `json:"uid"`
+	ProcessCount  int     `json:"processCount"`
+	Samples       int     `json:"samples"`
+	AvgCPUPercent float64 `json:"avgCpuPercent"`
+	MaxCPUPercent float64 `json:"maxCpuPercent"`
+	AvgMemoryMB   float64 `json:"avgMemoryMb"`
+	MaxMemoryMB   float64 `json:"maxMemoryMb"`
+}
+
 // TimelinePoint represents a timeline data point
 type TimelinePoint struct {
 	Timestamp    time.Time `json:"timestamp"`
@@ -246,4 +379,19 @@ type NetworkStats struct {
 	ErrorsOut     uint64 `json:"errorsOut"`
 	DroppedIn     uint64 `json:"droppedIn"`
 	DroppedOut    uint64 `json:"droppedOut"`
-}
\ No newline at end of file
+}
+
+// HostResponse represents one host of the fleet overview
+type HostResponse struct {
+	Host            string    `json:"host"`
+	Role            string    `json:"role,omitempty"`
+	Address         string    `json:"address,omitempty"`
+	Online          bool      `json:"online"`
+	LastSeen        time.Time `json:"lastSeen"`
+	IntervalSeconds int       `json:"intervalSeconds,omitempty"`
+	Batches         int64     `json:"batches"`
+	Records         int64     `json:"records"`
+	Processes       int       `json:"processes"`
+	CPUPercent      float64   `json:"cpuPercent"`
+	MemoryMB        float64   `json:"memoryMb"`
+}
@@ -10,7 +10,8 @@ VERSION="0.4.0"
 RELEASE_DIR="releases/v${VERSION}"
 
 # Build flags for optimization
-BUILD_FLAGS="-ldflags=\"-s -w -X main.Version=${VERSION}\" -trimpath"
+# sqlite_fts5: use FTS5 for the command search index when SQLite is compiled in
+BUILD_FLAGS="-tags sqlite_fts5 -ldflags=\"-s -w -X main.Version=${VERSION}\" -trimpath"
 
 # Static compilation flags (no CGO for maximum portability)
 export CGO_ENABLED=0
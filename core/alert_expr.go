@@ -0,0 +1,757 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert expressions select process series by label, optionally reduce each series over a
+// window and aggregate the series into groups, then compare each result with a threshold:
+//
+//	avg_over_time(cpu_percent{category="database",name=~"pg.*"}[5m]) > 80
+//	sum by (user) (memory_mb) > 8192
+//
+// A series is one process (host, PID and start time). Every result that passes the
+// comparison is an alert instance of its own, identified by its labels.
+
+// alertBufferMaxWindow bounds the collections kept in memory for range functions;
+// rules with a longer window read it from storage
+const alertBufferMaxWindow = 15 * time.Minute
+
+// alertStorageInterval is how often rules whose window is read from storage are evaluated
+const alertStorageInterval = time.Minute
+
+// alertMaxWindow bounds the range of a range function; every evaluation of a rule with a long
+// window reads all matching samples of the window from storage
+const alertMaxWindow = 24 * time.Hour
+
+// alertExprMetrics are the process metrics an expression can select
+var alertExprMetrics = map[string]func(r ResourceRecord) float64{
+	"cpu_percent":            func(r ResourceRecord) float64 { return r.CPUPercent },
+	"cpu_percent_normalized": func(r ResourceRecord) float64 { return r.CPUPercentNormalized },
+	"memory_mb":              func(r ResourceRecord) float64 { return r.MemoryMB },
+	"memory_percent":         func(r ResourceRecord) float64 { return r.MemoryPercent },
+	"threads":                func(r ResourceRecord) float64 { return float64(r.Threads) },
+	"disk_read_mb":           func(r ResourceRecord) float64 { return r.DiskReadMB },
+	"disk_write_mb":          func(r ResourceRecord) float64 { return r.DiskWriteMB },
+	"net_sent_kb":            func(r ResourceRecord) float64 { return r.NetSentKB },
+	"net_recv_kb":            func(r ResourceRecord) float64 { return r.NetRecvKB },
+}
+
+// alertExprAggregations combine the series of a group
+var alertExprAggregations = []string{"sum", "avg", "max", "min", "count"}
+
+// alertExprRangeFuncs reduce each series over a window
+var alertExprRangeFuncs = []string{
+	"avg_over_time", "max_over_time", "min_over_time", "sum_over_time", "count_over_time", "last_over_time",
+}
+
+var alertExprComparisons = []string{">", ">=", "<", "<=", "==", "!="}
+
+// AlertExprError is a parse error in an alert expression
+type AlertExprError struct {
+	Column int // 1-based position of the offending token
+	Msg    string
+}
+
+func (e *AlertExprError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// AlertExpr is a parsed alert expression
+type AlertExpr struct {
+	source      string
+	metric      string
+	matchers    []labelMatcher
+	rangeFunc   string        // "" for an instant selector
+	window      time.Duration // Range of rangeFunc
+	aggregation string        // "" keeps every series
+	grouping    []string
+	without     bool // grouping lists the labels to drop instead of the labels to keep
+	op          string
+	threshold   float64
+}
+
+// labelMatcher is one name="value" condition of a selector
+type labelMatcher struct {
+	label string
+	op    string // =, !=, =~ or !~
+	value string
+	re    *regexp.Regexp
+}
+
+func (m labelMatcher) matches(r ResourceRecord) bool {
+	value := alertLabel(r, m.label)
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// ParseAlertExpr parses an alert expression
+func ParseAlertExpr(source string) (*AlertExpr, error) {
+	tokens, err := lexAlertExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &alertExprParser{tokens: tokens}
+	expr := &AlertExpr{source: strings.TrimSpace(source)}
+	if err := p.parseRule(expr); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// String returns the expression as written
+func (e *AlertExpr) String() string {
+	return e.source
+}
+
+// Window returns how much history the expression reads; 0 for the latest collection only
+func (e *AlertExpr) Window() time.Duration {
+	return e.window
+}
+
+// query returns the storage query reading the expression's samples between start and end
+// Only the fields the expression uses are loaded, and equality matchers on name, category and
+// user narrow the query; every matcher is still applied to the returned records.
+func (e *AlertExpr) query(start, end time.Time) RecordQuery {
+	q := RecordQuery{Start: start, End: end, Fields: e.fields()}
+	for _, m := range e.matchers {
+		if m.op != "=" {
+			continue
+		}
+		switch m.label {
+		case "name":
+			q.Names = append(q.Names, m.value)
+		case "category":
+			q.Categories = append(q.Categories, m.value)
+		case "user":
+			q.Users = append(q.Users, m.value)
+		}
+	}
+	return q
+}
+
+// fields returns the record fields needed to evaluate the expression
+func (e *AlertExpr) fields() []string {
+	fields := []string{"timestamp", "host", "pid", "create_time", "name", "category", "username", "labels", e.metric}
+	usesCommand := containsString(e.grouping, "command")
+	for _, m := range e.matchers {
+		usesCommand = usesCommand || m.label == "command"
+	}
+	if usesCommand {
+		fields = append(fields, "command")
+	}
+	return fields
+}
+
+// alertLabel returns the value of a label of a record
+// Labels assigned by category rules are available under their own names.
+func alertLabel(r ResourceRecord, label string) string {
+	switch label {
+	case "name":
+		return r.Name
+	case "category":
+		return r.Category
+	case "user":
+		return r.Username
+	case "host":
+		return r.Host
+	case "pid":
+		return strconv.Itoa(int(r.PID))
+	case "command":
+		return r.Command
+	}
+	return r.Labels[label]
+}
+
+// alertSeriesLabels returns the labels identifying a process series
+// The command line is left out: it can be matched on but is too long to name an alert.
+func alertSeriesLabels(r ResourceRecord) map[string]string {
+	labels := make(map[string]string, len(r.Labels)+5)
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	labels["name"] = r.Name
+	labels["category"] = r.Category
+	labels["user"] = r.Username
+	labels["pid"] = strconv.Itoa(int(r.PID))
+	if r.Host != "" {
+		labels["host"] = r.Host
+	}
+	return labels
+}
+
+// formatAlertLabels formats labels as {a="1",b="2"}, ordered by name; "" when there are none
+func formatAlertLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// alertSnapshot is one collection kept for range functions
+type alertSnapshot struct {
+	at      time.Time
+	records []ResourceRecord
+}
+
+// groupAlertSnapshots groups stored records into collections by timestamp
+// Records of one collection are a few milliseconds apart; a gap of a second starts the next.
+func groupAlertSnapshots(records []ResourceRecord) []alertSnapshot {
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	var snapshots []alertSnapshot
+	for i, r := range records {
+		if len(snapshots) == 0 || r.Timestamp.Sub(records[i-1].Timestamp) >= time.Second {
+			snapshots = append(snapshots, alertSnapshot{at: r.Timestamp})
+		}
+		last := &snapshots[len(snapshots)-1]
+		last.records = append(last.records, r)
+	}
+	return snapshots
+}
+
+// alertSeries is the value of a process series or of an aggregation group
+type alertSeries struct {
+	record ResourceRecord // Latest sample of a process series
+	labels map[string]string
+	value  float64
+}
+
+// eval evaluates the expression at now over collections ordered by time and returns the
+// results that pass the comparison
+func (e *AlertExpr) eval(snapshots []alertSnapshot, now time.Time) []alertSeries {
+	metric := alertExprMetrics[e.metric]
+	var series []alertSeries
+
+	if e.rangeFunc == "" {
+		if len(snapshots) > 0 {
+			for _, r := range snapshots[len(snapshots)-1].records {
+				if e.selects(r) {
+					series = append(series, alertSeries{record: r, value: metric(r)})
+				}
+			}
+		}
+	} else {
+		start := now.Add(-e.window)
+		values := make(map[processKey][]float64)
+		latest := make(map[processKey]ResourceRecord)
+		var order []processKey
+		for _, snapshot := range snapshots {
+			if !snapshot.at.After(start) || snapshot.at.After(now) {
+				continue
+			}
+			for _, r := range snapshot.records {
+				if !e.selects(r) {
+					continue
+				}
+				key := recordProcessKey(r)
+				if _, ok := values[key]; !ok {
+					order = append(order, key)
+				}
+				values[key] = append(values[key], metric(r))
+				latest[key] = r
+			}
+		}
+		for _, key := range order {
+			series = append(series, alertSeries{record: latest[key], value: reduceOverTime(e.rangeFunc, values[key])})
+		}
+	}
+
+	if e.aggregation != "" {
+		series = e.aggregate(series)
+	} else {
+		for i := range series {
+			series[i].labels = alertSeriesLabels(series[i].record)
+		}
+	}
+
+	var results []alertSeries
+	for _, s := range series {
+		if compareAlertValue(s.value, e.op, e.threshold) {
+			results = append(results, s)
+		}
+	}
+	return results
+}
+
+func (e *AlertExpr) selects(r ResourceRecord) bool {
+	for _, m := range e.matchers {
+		if !m.matches(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregate combines series into one result per group of grouping labels
+func (e *AlertExpr) aggregate(series []alertSeries) []alertSeries {
+	type group struct {
+		labels map[string]string
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, s := range series {
+		labels := make(map[string]string)
+		if e.without {
+			for k, v := range alertSeriesLabels(s.record) {
+				if !containsString(e.grouping, k) {
+					labels[k] = v
+				}
+			}
+		} else {
+			for _, label := range e.grouping {
+				labels[label] = alertLabel(s.record, label)
+			}
+		}
+		key := formatAlertLabels(labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: labels}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.value)
+	}
+
+	results := make([]alertSeries, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		results = append(results, alertSeries{labels: g.labels, value: aggregateValues(e.aggregation, g.values)})
+	}
+	return results
+}
+
+// reduceOverTime applies a range function to the samples of one series, oldest first
+func reduceOverTime(fn string, values []float64) float64 {
+	if fn == "last_over_time" {
+		return values[len(values)-1]
+	}
+	return aggregateValues(strings.TrimSuffix(fn, "_over_time"), values)
+}
+
+func aggregateValues(aggregation string, values []float64) float64 {
+	switch aggregation {
+	case "count":
+		return float64(len(values))
+	case "max":
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max
+	case "min":
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	if aggregation == "avg" {
+		return sum / float64(len(values))
+	}
+	return sum
+}
+
+func compareAlertValue(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	default:
+		return value != threshold
+	}
+}
+
+// ============== Lexer ==============
+
+type alertTokenKind int
+
+const (
+	alertTokenEOF    alertTokenKind = iota
+	alertTokenIdent                 // Metric, label, function or keyword
+	alertTokenNumber                // Number or duration, e.g. 80, 0.5 or 5m
+	alertTokenString                // Quoted label value, unquoted
+	alertTokenSymbol                // Punctuation and operators
+)
+
+type alertToken struct {
+	kind   alertTokenKind
+	text   string
+	column int
+}
+
+// describe names the token for error messages
+func (t alertToken) describe() string {
+	switch t.kind {
+	case alertTokenEOF:
+		return "end of expression"
+	case alertTokenString:
+		return strconv.Quote(t.text) + " (a string)"
+	}
+	return strconv.Quote(t.text)
+}
+
+func isAlertIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlertIdentChar(c byte) bool {
+	return isAlertIdentStart(c) || c == ':' || (c >= '0' && c <= '9')
+}
+
+func lexAlertExpr(source string) ([]alertToken, error) {
+	var tokens []alertToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case isAlertIdentStart(c):
+			for i < len(source) && isAlertIdentChar(source[i]) {
+				i++
+			}
+			tokens = append(tokens, alertToken{alertTokenIdent, source[start:i], start + 1})
+		case c == '.' || (c >= '0' && c <= '9'):
+			// Durations (5m, 1h30m) and exponents (1e3) continue with letters
+			for i < len(source) && (source[i] == '.' || isAlertIdentChar(source[i])) {
+				i++
+			}
+			tokens = append(tokens, alertToken{alertTokenNumber, source[start:i], start + 1})
+		case c == '"' || c == '\'':
+			i++
+			for i < len(source) && source[i] != c {
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(source) {
+				return nil, &AlertExprError{start + 1, "unterminated string"}
+			}
+			i++
+			body := source[start+1 : i-1]
+			if c == '\'' {
+				body = strings.ReplaceAll(strings.ReplaceAll(body, `\'`, `'`), `"`, `\"`)
+			}
+			value, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return nil, &AlertExprError{start + 1, fmt.Sprintf("invalid string %s", source[start:i])}
+			}
+			tokens = append(tokens, alertToken{alertTokenString, value, start + 1})
+		case strings.ContainsRune("(){}[],", rune(c)):
+			i++
+			tokens = append(tokens, alertToken{alertTokenSymbol, source[start:i], start + 1})
+		case strings.ContainsRune("=!<>", rune(c)):
+			i++
+			if i < len(source) && (source[i] == '=' || (source[i] == '~' && (c == '=' || c == '!'))) {
+				i++
+			}
+			if source[start:i] == "!" {
+				return nil, &AlertExprError{start + 1, `unexpected "!" (use != or !~)`}
+			}
+			tokens = append(tokens, alertToken{alertTokenSymbol, source[start:i], start + 1})
+		case c == '-':
+			i++
+			tokens = append(tokens, alertToken{alertTokenSymbol, "-", start + 1})
+		default:
+			return nil, &AlertExprError{start + 1, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return append(tokens, alertToken{alertTokenEOF, "", len(source) + 1}), nil
+}
+
+// ============== Parser ==============
+
+type alertExprParser struct {
+	tokens []alertToken
+	pos    int
+}
+
+func (p *alertExprParser) peek() alertToken {
+	return p.tokens[p.pos]
+}
+
+func (p *alertExprParser) next() alertToken {
+	t := p.tokens[p.pos]
+	if t.kind != alertTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *alertExprParser) errorf(t alertToken, format string, args ...interface{}) error {
+	return &AlertExprError{t.column, fmt.Sprintf(format, args...)}
+}
+
+func (p *alertExprParser) expect(symbol, context string) error {
+	t := p.next()
+	if t.kind != alertTokenSymbol || t.text != symbol {
+		return p.errorf(t, "expected %q %s, found %s", symbol, context, t.describe())
+	}
+	return nil
+}
+
+// parseRule parses <vector> <comparison> <number>
+func (p *alertExprParser) parseRule(e *AlertExpr) error {
+	if p.peek().kind == alertTokenEOF {
+		return p.errorf(p.peek(), "empty expression")
+	}
+	if err := p.parseVector(e); err != nil {
+		return err
+	}
+
+	op := p.next()
+	if op.kind != alertTokenSymbol || !containsString(alertExprComparisons, op.text) {
+		return p.errorf(op, "expected a comparison (%s) and a threshold, found %s",
+			strings.Join(alertExprComparisons, " "), op.describe())
+	}
+	e.op = op.text
+
+	sign := 1.0
+	if t := p.peek(); t.kind == alertTokenSymbol && t.text == "-" {
+		p.next()
+		sign = -1
+	}
+	t := p.next()
+	value, err := strconv.ParseFloat(t.text, 64)
+	if t.kind != alertTokenNumber || err != nil {
+		return p.errorf(t, "expected a number after %s, found %s", e.op, t.describe())
+	}
+	e.threshold = sign * value
+
+	if t := p.next(); t.kind != alertTokenEOF {
+		return p.errorf(t, "unexpected %s after the threshold", t.describe())
+	}
+	return nil
+}
+
+// parseVector parses an aggregation, a range function or a selector
+func (p *alertExprParser) parseVector(e *AlertExpr) error {
+	t := p.peek()
+	if t.kind != alertTokenIdent {
+		return p.errorf(t, "expected a metric, aggregation or function, found %s", t.describe())
+	}
+	if !containsString(alertExprAggregations, t.text) {
+		return p.parseInner(e)
+	}
+
+	p.next()
+	e.aggregation = t.text
+	if err := p.parseGrouping(e); err != nil {
+		return err
+	}
+	if err := p.expect("(", "after "+t.text); err != nil {
+		return err
+	}
+	if inner := p.peek(); inner.kind == alertTokenIdent && containsString(alertExprAggregations, inner.text) {
+		return p.errorf(inner, "nested aggregations are not supported")
+	}
+	if err := p.parseInner(e); err != nil {
+		return err
+	}
+	if err := p.expect(")", "to close "+t.text); err != nil {
+		return err
+	}
+
+	// The grouping may also follow the argument: sum (memory_mb) by (user)
+	if g := p.peek(); g.kind == alertTokenIdent && (g.text == "by" || g.text == "without") {
+		if e.grouping != nil {
+			return p.errorf(g, "%s given twice", g.text)
+		}
+		return p.parseGrouping(e)
+	}
+	return nil
+}
+
+// parseGrouping parses an optional by (...) or without (...) clause
+func (p *alertExprParser) parseGrouping(e *AlertExpr) error {
+	t := p.peek()
+	if t.kind != alertTokenIdent || (t.text != "by" && t.text != "without") {
+		return nil
+	}
+	p.next()
+	e.without = t.text == "without"
+	e.grouping = []string{}
+	if err := p.expect("(", "after "+t.text); err != nil {
+		return err
+	}
+	for {
+		label := p.next()
+		if label.kind == alertTokenSymbol && label.text == ")" {
+			return nil
+		}
+		if label.kind != alertTokenIdent {
+			return p.errorf(label, "expected a label name in %s (...), found %s", t.text, label.describe())
+		}
+		e.grouping = append(e.grouping, label.text)
+
+		sep := p.next()
+		if sep.kind == alertTokenSymbol && sep.text == ")" {
+			return nil
+		}
+		if sep.kind != alertTokenSymbol || sep.text != "," {
+			return p.errorf(sep, "expected \",\" or \")\" in %s (...), found %s", t.text, sep.describe())
+		}
+	}
+}
+
+// parseInner parses a range function or an instant selector
+func (p *alertExprParser) parseInner(e *AlertExpr) error {
+	t := p.peek()
+	if t.kind != alertTokenIdent {
+		return p.errorf(t, "expected a metric or function, found %s", t.describe())
+	}
+	if p.tokens[p.pos+1].text == "(" && !containsString(alertExprRangeFuncs, t.text) {
+		return p.errorf(t, "unknown function %q (use %s, or an aggregation: %s)", t.text,
+			strings.Join(alertExprRangeFuncs, ", "), strings.Join(alertExprAggregations, ", "))
+	}
+	if !containsString(alertExprRangeFuncs, t.text) {
+		if err := p.parseSelector(e); err != nil {
+			return err
+		}
+		if r := p.peek(); r.kind == alertTokenSymbol && r.text == "[" {
+			return p.errorf(r, "a range needs a function such as avg_over_time(%s[...])", e.metric)
+		}
+		return nil
+	}
+
+	p.next()
+	e.rangeFunc = t.text
+	if err := p.expect("(", "after "+t.text); err != nil {
+		return err
+	}
+	if err := p.parseSelector(e); err != nil {
+		return err
+	}
+	if r := p.next(); r.kind != alertTokenSymbol || r.text != "[" {
+		return p.errorf(r, "%s needs a range, e.g. %s(%s[5m])", t.text, t.text, e.metric)
+	}
+	d := p.next()
+	if d.kind != alertTokenNumber {
+		return p.errorf(d, "expected a range such as 30s, 5m or 1h, found %s", d.describe())
+	}
+	window, err := parseAlertWindow(d.text)
+	if err != nil {
+		return p.errorf(d, "invalid range %q: %v", d.text, err)
+	}
+	e.window = window
+	if err := p.expect("]", "after the range"); err != nil {
+		return err
+	}
+	return p.expect(")", "to close "+t.text)
+}
+
+// parseSelector parses metric{label="value",...}
+func (p *alertExprParser) parseSelector(e *AlertExpr) error {
+	t := p.next()
+	if t.kind != alertTokenIdent {
+		return p.errorf(t, "expected a metric, found %s", t.describe())
+	}
+	if _, ok := alertExprMetrics[t.text]; !ok {
+		return p.errorf(t, "unknown metric %q (use %s)", t.text, strings.Join(alertExprMetricNames(), ", "))
+	}
+	e.metric = t.text
+
+	if b := p.peek(); b.kind != alertTokenSymbol || b.text != "{" {
+		return nil
+	}
+	p.next()
+	for {
+		label := p.next()
+		if label.kind == alertTokenSymbol && label.text == "}" {
+			return nil
+		}
+		if label.kind != alertTokenIdent {
+			return p.errorf(label, "expected a label name, found %s", label.describe())
+		}
+		op := p.next()
+		if op.kind != alertTokenSymbol || (op.text != "=" && op.text != "!=" && op.text != "=~" && op.text != "!~") {
+			return p.errorf(op, "expected =, !=, =~ or !~ after %s, found %s", label.text, op.describe())
+		}
+		value := p.next()
+		if value.kind != alertTokenString {
+			return p.errorf(value, "expected a quoted value for %s, found %s", label.text, value.describe())
+		}
+		m := labelMatcher{label: label.text, op: op.text, value: value.text}
+		if op.text == "=~" || op.text == "!~" {
+			re, err := regexp.Compile("^(?:" + value.text + ")$")
+			if err != nil {
+				return p.errorf(value, "invalid regular expression %q: %v", value.text, err)
+			}
+			m.re = re
+		}
+		e.matchers = append(e.matchers, m)
+
+		sep := p.next()
+		if sep.kind == alertTokenSymbol && sep.text == "}" {
+			return nil
+		}
+		if sep.kind != alertTokenSymbol || sep.text != "," {
+			return p.errorf(sep, "expected \",\" or \"}\" after the %s matcher, found %s", label.text, sep.describe())
+		}
+	}
+}
+
+// parseAlertWindow parses a range: a Go duration, or whole days (d), up to alertMaxWindow
+func parseAlertWindow(text string) (time.Duration, error) {
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		n, convErr := strconv.Atoi(strings.TrimSuffix(text, "d"))
+		if !strings.HasSuffix(text, "d") || convErr != nil {
+			return 0, fmt.Errorf("use a unit such as s, m, h or d")
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("range must be positive")
+	}
+	if d > alertMaxWindow {
+		return 0, fmt.Errorf("range must be at most 1d")
+	}
+	return d, nil
+}
+
+func alertExprMetricNames() []string {
+	names := make([]string, 0, len(alertExprMetrics))
+	for name := range alertExprMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
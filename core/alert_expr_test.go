@@ -0,0 +1,260 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseAlertExpr_Errors tests that invalid expressions are reported with their position
+func TestParseAlertExpr_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "column 1: empty expression"},
+		{"cpu_percent", "column 12: expected a comparison"},
+		{"cpu_percent > ", `column 15: expected a number after >, found end of expression`},
+		{"cpu_percent > high", `column 15: expected a number after >, found "high"`},
+		{"cpu > 80", `column 1: unknown metric "cpu" (use cpu_percent,`},
+		{`cpu_percent{name="pg" > 80`, `column 23: expected "," or "}" after the name matcher, found ">"`},
+		{`cpu_percent{name=pg} > 80`, `column 18: expected a quoted value for name, found "pg"`},
+		{`cpu_percent{name~"pg"} > 80`, `column 17: unexpected character '~'`},
+		{`cpu_percent{name=~"pg("} > 80`, `column 19: invalid regular expression "pg("`},
+		{`cpu_percent{name="pg} > 80`, "column 18: unterminated string"},
+		{"avg_over_time(cpu_percent) > 80", "column 26: avg_over_time needs a range, e.g. avg_over_time(cpu_percent[5m])"},
+		{"avg_over_time(cpu_percent[5x]) > 80", `column 27: invalid range "5x"`},
+		{"avg_over_time(cpu_percent[2d]) > 80", `column 27: invalid range "2d": range must be at most 1d`},
+		{"avg_over_time(cpu_percent[1w]) > 80", `column 27: invalid range "1w"`},
+		{"avg_over_time(cpu_percent[5m) > 80", `column 29: expected "]" after the range, found ")"`},
+		{"cpu_percent[5m] > 80", "column 12: a range needs a function such as avg_over_time(cpu_percent[...])"},
+		{"rate(cpu_percent[5m]) > 80", `column 1: unknown function "rate"`},
+		{"sum by user (memory_mb) > 1", `column 8: expected "(" after by, found "user"`},
+		{"sum(max(memory_mb)) > 1", "column 5: nested aggregations are not supported"},
+		{"sum by (user) (memory_mb) by (host) > 1", "column 27: by given twice"},
+		{"sum(memory_mb) > 1 and 2", `column 20: unexpected "and" after the threshold`},
+	}
+	for _, tt := range tests {
+		_, err := ParseAlertExpr(tt.expr)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%q: expected error %q, got %v", tt.expr, tt.err, err)
+		}
+	}
+
+	for _, expr := range []string{
+		`avg_over_time(cpu_percent{category="database",name=~"pg.*"}[5m]) > 80`,
+		"sum by (user) (memory_mb) > 8192",
+		"sum(memory_mb) without (pid) >= 1e3",
+		`max by (host, team) (last_over_time(threads{user!="root",command!~'.*--test.*'}[1d])) < -1`,
+		"count(cpu_percent) == 0",
+	} {
+		if _, err := ParseAlertExpr(expr); err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+		}
+	}
+}
+
+// TestAlertExpr_Eval tests selectors, range functions and grouping against recent collections
+func TestAlertExpr_Eval(t *testing.T) {
+	now := time.Now()
+	collection := func(age time.Duration, pgCPU float64) alertSnapshot {
+		return alertSnapshot{at: now.Add(-age), records: []ResourceRecord{
+			{Name: "pgsql", Category: "database", Username: "postgres", PID: 10, CPUPercent: pgCPU, MemoryMB: 4096},
+			{Name: "pgbouncer", Category: "database", Username: "postgres", PID: 11, CPUPercent: 90, MemoryMB: 100},
+			{Name: "mysqld", Category: "database", Username: "mysql", PID: 12, CPUPercent: 95, MemoryMB: 6000},
+			{Name: "train", Category: "development", Username: "alice", PID: 20, CPUPercent: 400, MemoryMB: 9000, Labels: map[string]string{"team": "ml"}},
+		}}
+	}
+	// pgsql was busy 10 minutes ago, then averages 80% over the last 5 minutes
+	snapshots := []alertSnapshot{collection(10*time.Minute, 500), collection(4*time.Minute, 70), collection(2*time.Minute, 90), collection(0, 80)}
+
+	eval := func(source string) []alertSeries {
+		expr, err := ParseAlertExpr(source)
+		if err != nil {
+			t.Fatalf("%q: %v", source, err)
+		}
+		return expr.eval(snapshots, now)
+	}
+
+	results := eval(`avg_over_time(cpu_percent{category="database",name=~"pg.*"}[5m]) > 79`)
+	if len(results) != 2 || results[0].labels["name"] != "pgsql" || results[0].value != 80 || results[1].value != 90 {
+		t.Errorf("Expected pgsql at 80 and pgbouncer at 90, got %+v", results)
+	}
+	if len(eval(`avg_over_time(cpu_percent{category="database",name=~"pg.*"}[5m]) > 80`)) != 1 {
+		t.Errorf("Expected only pgbouncer above 80")
+	}
+	if results := eval(`max_over_time(cpu_percent{name="pgsql"}[15m]) > 100`); len(results) != 1 || results[0].value != 500 {
+		t.Errorf("Expected the 15m maximum of 500, got %+v", results)
+	}
+	if results := eval(`count_over_time(cpu_percent{name="pgsql"}[5m]) == 3`); len(results) != 1 {
+		t.Errorf("Expected 3 samples in 5m, got %+v", results)
+	}
+
+	// One result per user, labelled with the grouping only
+	results = eval("sum by (user) (memory_mb) > 4000")
+	if len(results) != 3 {
+		t.Fatalf("Expected postgres, mysql and alice above 4000, got %+v", results)
+	}
+	if results[0].value != 4196 || formatAlertLabels(results[0].labels) != `{user="postgres"}` {
+		t.Errorf("Expected postgres at 4196, got %+v", results[0])
+	}
+	if results := eval("sum by (team) (memory_mb) > 9000"); len(results) != 1 || results[0].labels["team"] != "" {
+		t.Errorf("Expected the processes without a team above 9000, got %+v", results)
+	}
+	if results := eval(`avg(cpu_percent{user!="alice"}) > 80`); len(results) != 1 || len(results[0].labels) != 0 {
+		t.Errorf("Expected one ungrouped result, got %+v", results)
+	}
+	if results := eval("sum without (pid, name, category) (memory_mb) > 9000"); len(results) != 0 {
+		t.Errorf("Expected no user above 9000, got %+v", results)
+	}
+}
+
+// TestAlertManager_ExprInstances tests that each group is an alert instance of its own and
+// that the window starts from stored collections
+func TestAlertManager_ExprInstances(t *testing.T) {
+	am := NewAlertManager(AlertConfig{
+		Enabled: true,
+		Rules: []AlertRule{
+			{Name: "user-memory", Expr: "sum by (user) (memory_mb) > 1000", Enabled: true},
+			{Name: "busy", Expr: "avg_over_time(cpu_percent[5m]) > 50", Enabled: true},
+		},
+	}, NotifiersConfig{})
+
+	stored := time.Now().Add(-time.Minute)
+	am.SetHistorySource(func(q RecordQuery) ([]ResourceRecord, error) {
+		return []ResourceRecord{{Timestamp: stored, Name: "train", Username: "alice", PID: 20, CPUPercent: 100}}, nil
+	})
+
+	am.Evaluate([]ResourceRecord{
+		{Timestamp: time.Now(), Name: "train", Username: "alice", PID: 20, CPUPercent: 20, MemoryMB: 800},
+		{Timestamp: time.Now(), Name: "eval", Username: "alice", PID: 21, MemoryMB: 400},
+		{Timestamp: time.Now(), Name: "vim", Username: "bob", PID: 30, MemoryMB: 1500},
+	})
+	// The stored window is read in the background and the range rule evaluated again
+	am.waitStoredExprs()
+	alerts := am.activeAlerts()
+	if len(alerts) != 3 {
+		t.Fatalf("Expected train busy and both users over 1000MB, got %+v", alerts)
+	}
+	if alerts[0].Rule != "busy" || alerts[0].Value != 60 || alerts[0].Labels["name"] != "train" {
+		t.Errorf("Expected train averaging 60%% with the stored sample, got %+v", alerts[0])
+	}
+	if alerts[1].Labels["user"] != "alice" || alerts[1].Value != 1200 || alerts[2].Labels["user"] != "bob" {
+		t.Errorf("Expected alice and bob instances, got %+v", alerts[1:])
+	}
+	if alerts[1].Metric != "sum by (user) (memory_mb) > 1000" {
+		t.Errorf("Expected the expression as the metric, got %q", alerts[1].Metric)
+	}
+
+	// alice recovers while bob's instance stays active; train now averages 40%
+	am.Evaluate([]ResourceRecord{
+		{Timestamp: time.Now(), Name: "train", Username: "alice", PID: 20, MemoryMB: 800},
+		{Timestamp: time.Now(), Name: "vim", Username: "bob", PID: 30, MemoryMB: 1500},
+	})
+	alerts = am.activeAlerts()
+	var groups []string
+	for _, alert := range alerts {
+		groups = append(groups, alert.Rule+formatAlertLabels(alert.Labels))
+	}
+	if len(alerts) != 1 || groups[0] != `user-memory{user="bob"}` {
+		t.Errorf("Expected only bob's memory alert left, got %v", groups)
+	}
+}
+
+// TestAlertManager_BackfillInBackground tests that reading the stored window does not hold up
+// the first evaluation
+func TestAlertManager_BackfillInBackground(t *testing.T) {
+	am := NewAlertManager(AlertConfig{
+		Enabled: true,
+		Rules:   []AlertRule{{Name: "busy", Expr: "avg_over_time(cpu_percent[5m]) > 50", Enabled: true}},
+	}, NotifiersConfig{})
+
+	release := make(chan struct{})
+	stored := time.Now().Add(-time.Minute)
+	am.SetHistorySource(func(q RecordQuery) ([]ResourceRecord, error) {
+		<-release
+		return []ResourceRecord{{Timestamp: stored, Name: "train", PID: 20, CPUPercent: 100}}, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		am.Evaluate([]ResourceRecord{{Timestamp: time.Now(), Name: "train", PID: 20, CPUPercent: 20}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Evaluate waited for the stored window")
+	}
+	if alerts := am.activeAlerts(); len(alerts) != 0 {
+		t.Errorf("Expected no alert before the stored window is read, got %+v", alerts)
+	}
+
+	close(release)
+	am.waitStoredExprs()
+	if alerts := am.activeAlerts(); len(alerts) != 1 || alerts[0].Value != 60 {
+		t.Errorf("Expected train averaging 60%% once the stored window is read, got %+v", alerts)
+	}
+}
+
+// TestAlertManager_StoredWindow tests that rules with a window beyond the in-memory history
+// read only the fields and processes they need from storage, in the background
+func TestAlertManager_StoredWindow(t *testing.T) {
+	am := NewAlertManager(AlertConfig{
+		Enabled: true,
+		Rules: []AlertRule{
+			{Name: "pg-day", Expr: `max_over_time(memory_mb{name="pgsql",user!="root"}[1d]) > 1000`, Enabled: true},
+		},
+	}, NotifiersConfig{})
+
+	stored := time.Now().Add(-6 * time.Hour)
+	queries := make(chan RecordQuery, 2)
+	am.SetHistorySource(func(q RecordQuery) ([]ResourceRecord, error) {
+		queries <- q
+		return []ResourceRecord{
+			{Timestamp: stored, Name: "pgsql", Username: "postgres", PID: 10, MemoryMB: 2000},
+			{Timestamp: stored, Name: "pgsql", Username: "root", PID: 11, MemoryMB: 3000},
+		}, nil
+	})
+
+	current := []ResourceRecord{{Timestamp: time.Now(), Name: "pgsql", Username: "postgres", PID: 10, MemoryMB: 500}}
+	am.Evaluate(current)
+	am.Evaluate(current)
+	am.waitStoredExprs()
+
+	if len(queries) != 1 {
+		t.Fatalf("Expected one storage query within a minute, got %d", len(queries))
+	}
+	q := <-queries
+	if q.End.Sub(q.Start) != 24*time.Hour || len(q.Names) != 1 || q.Names[0] != "pgsql" || len(q.Users) != 0 {
+		t.Errorf("Expected the day of pgsql samples, got %+v", q)
+	}
+	if !containsString(q.Fields, "memory_mb") || containsString(q.Fields, "cpu_percent") || containsString(q.Fields, "command") {
+		t.Errorf("Expected only the fields the rule reads, got %v", q.Fields)
+	}
+
+	alerts := am.activeAlerts()
+	if len(alerts) != 1 || alerts[0].Value != 2000 || alerts[0].Labels["pid"] != "10" {
+		t.Errorf("Expected pid 10 at its stored maximum, got %+v", alerts)
+	}
+}
+
+// TestValidateAlertConfig tests that invalid expressions fail configuration validation
+func TestValidateAlertConfig(t *testing.T) {
+	config := GetDefaultConfig()
+	config.Alerts.Rules = []AlertRule{{Name: "pg", Expr: "avg_over_time(cpu_percent{name=~\"pg.*\"}[5m) > 80"}}
+	err := ValidateConfig(config)
+	if err == nil || !strings.Contains(err.Error(), `alerts: rule "pg": invalid expr`) || !strings.Contains(err.Error(), "column 43") {
+		t.Errorf("Expected the rule and position in the error, got %v", err)
+	}
+
+	config.Alerts.Rules = []AlertRule{{Name: "both", Expr: "cpu_percent > 80", Metric: "cpu_percent"}}
+	if err := ValidateConfig(config); err == nil || !strings.Contains(err.Error(), "either expr or metric") {
+		t.Errorf("Expected expr and metric to be exclusive, got %v", err)
+	}
+
+	config.Alerts.Rules = []AlertRule{{Name: "ok", Expr: "sum by (user) (memory_mb) > 8192"}, {Name: "legacy", Metric: "cpu_percent"}}
+	if err := ValidateConfig(config); err != nil {
+		t.Errorf("Expected valid rules to pass, got %v", err)
+	}
+}
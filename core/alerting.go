@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,11 +11,13 @@ import (
 // AlertRule defines an alert rule
 type AlertRule struct {
 	Name        string   `yaml:"name"`
-	Metric      string   `yaml:"metric"`       // cpu_percent, memory_mb
+	Expr        string   `yaml:"expr"`         // Expression, e.g. sum by (user) (memory_mb) > 8192 (replaces metric, threshold, process, user and aggregation)
+	Metric      string   `yaml:"metric"`       // cpu_percent, memory_mb, system_*, host_* (e.g. host_load1, host_psi_memory_some)
 	Threshold   float64  `yaml:"threshold"`    // Threshold value
 	Duration    int      `yaml:"duration"`     // Duration in seconds before alerting
 	Channels    []string `yaml:"channels"`     // List of notifier channels
-	Process     string   `yaml:"process"`      // Optional: specific process name
+	Process     string   `yaml:"process"`      // Optional: specific process name (mountpoint for host_disk_percent)
+	User        string   `yaml:"user"`         // Optional: only consider processes owned by this user
 	Aggregation string   `yaml:"aggregation"`  // Aggregation method: max, avg, sum (default: avg)
 	Enabled     bool     `yaml:"enabled"`      // Whether the rule is enabled
 }
@@ -27,6 +30,7 @@ type AlertState struct {
 	LastNotify  time.Time // Last notification time
 	Suppressed  bool      // Whether alert is suppressed
 	CurrentValue float64  // Current metric value
+	Labels      map[string]string // Group of an expression rule's alert instance
 }
 
 // AlertManager manages alert rules and notifications
@@ -35,6 +39,20 @@ type AlertManager struct {
 	notifiers map[string]Notifier
 	states    map[string]*AlertState
 	mu        sync.RWMutex
+
+	// Latest host-level sample used by host_* metrics
+	systemRecord *SystemRecord
+
+	// Expression rules by name, and the recent collections their range functions read
+	exprs        map[string]*AlertExpr
+	history      []alertSnapshot
+	window       time.Duration // History kept in memory
+	windowFields []string      // Fields read by the rules using the in-memory history
+	source       func(q RecordQuery) ([]ResourceRecord, error)
+	backfilled   bool                 // The stored window before the first collection was requested
+	storageEval  map[string]time.Time // Last evaluation of rules whose window is read from storage
+	storageBusy  map[string]bool      // Rules whose window is being read
+	storageRuns  sync.WaitGroup
 	
 	// Configuration
 	suppressDuration time.Duration // Suppress repeat notifications
@@ -56,9 +74,35 @@ func NewAlertManager(config AlertConfig, notifiersConfig NotifiersConfig) *Alert
 		rules:            config.Rules,
 		notifiers:        make(map[string]Notifier),
 		states:           make(map[string]*AlertState),
+		exprs:            make(map[string]*AlertExpr),
+		storageEval:      make(map[string]time.Time),
+		storageBusy:      make(map[string]bool),
 		suppressDuration: time.Duration(config.SuppressDuration) * time.Minute,
 	}
 
+	// Compile expressions; the configuration was validated, so failures only disable the rule
+	for _, rule := range config.Rules {
+		if rule.Expr == "" {
+			continue
+		}
+		expr, err := ParseAlertExpr(rule.Expr)
+		if err != nil {
+			log.Printf("警告: 告警规则 %s 的表达式无效: %v", rule.Name, err)
+			continue
+		}
+		am.exprs[rule.Name] = expr
+		if window := expr.Window(); window > 0 && window <= alertBufferMaxWindow {
+			if window > am.window {
+				am.window = window
+			}
+			for _, field := range expr.fields() {
+				if !containsString(am.windowFields, field) {
+					am.windowFields = append(am.windowFields, field)
+				}
+			}
+		}
+	}
+
 	// Default suppress duration
 	if am.suppressDuration == 0 {
 		am.suppressDuration = 30 * time.Minute
@@ -80,6 +124,37 @@ func NewAlertManager(config AlertConfig, notifiersConfig NotifiersConfig) *Alert
 	return am
 }
 
+// ValidateAlertConfig checks that every rule has a metric or a valid expression
+func ValidateAlertConfig(config AlertConfig) error {
+	for _, rule := range config.Rules {
+		if rule.Expr == "" {
+			continue
+		}
+		if rule.Metric != "" {
+			return fmt.Errorf("alerts: rule %q: set either expr or metric, not both", rule.Name)
+		}
+		if _, err := ParseAlertExpr(rule.Expr); err != nil {
+			return fmt.Errorf("alerts: rule %q: invalid expr %q: %w", rule.Name, rule.Expr, err)
+		}
+	}
+	return nil
+}
+
+// SetHistorySource sets where range functions read collections from before the daemon started,
+// and windows longer than the in-memory history
+func (am *AlertManager) SetHistorySource(source func(q RecordQuery) ([]ResourceRecord, error)) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.source = source
+}
+
+// SetSystemRecord updates the host-level sample used to evaluate host_* metrics
+func (am *AlertManager) SetSystemRecord(record SystemRecord) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.systemRecord = &record
+}
+
 // Evaluate evaluates alert rules against current metrics
 func (am *AlertManager) Evaluate(records []ResourceRecord) {
 	if len(records) == 0 {
@@ -89,14 +164,27 @@ func (am *AlertManager) Evaluate(records []ResourceRecord) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
 
+	now := time.Now()
+	am.remember(now, records)
+
 	// Evaluate each rule
 	for _, rule := range am.rules {
 		if !rule.Enabled {
 			continue
 		}
+		if rule.Expr != "" {
+			if expr := am.exprs[rule.Name]; expr == nil {
+				continue
+			} else if expr.Window() > am.window && am.source != nil {
+				am.evaluateStoredExpr(rule, expr, now)
+			} else {
+				am.applyExprResults(rule, expr.eval(am.history, now))
+			}
+			continue
+		}
 
-		// Get metric value
-		value := am.getMetricValue(records, rule.Metric, rule.Process, rule.Aggregation)
+		// Get metric value (system_* metrics become the user's share when a user is set)
+		value := am.getMetricValue(filterRecordsByUser(records, rule.User), rule.Metric, rule.Process, rule.Aggregation)
 		
 		// Debug log every 10 evaluations to avoid spam
 		aggType := rule.Aggregation
@@ -109,19 +197,146 @@ func (am *AlertManager) Evaluate(records []ResourceRecord) {
 
 		// Check threshold
 		if value > rule.Threshold {
-			am.handleAlert(rule, value)
+			am.handleAlert(rule.Name, rule, nil, value)
 		} else {
 			am.clearAlert(rule.Name)
 		}
 	}
 }
 
+// remember keeps the collection for range functions, dropping collections older than the window
+// The first collection starts reading the stored window before it, so a restart does not reset
+// averages once the read is done.
+// NOTE: This method must be called while holding am.mu lock
+func (am *AlertManager) remember(now time.Time, records []ResourceRecord) {
+	if !am.backfilled && am.window > 0 && am.source != nil {
+		am.backfilled = true
+		end := now
+		for _, r := range records {
+			if !r.Timestamp.IsZero() && r.Timestamp.Before(end) {
+				end = r.Timestamp
+			}
+		}
+		am.backfillHistory(RecordQuery{Start: now.Add(-am.window), End: end.Add(-time.Millisecond), Fields: am.windowFields})
+	}
+
+	am.history = append(am.history, alertSnapshot{at: now, records: records})
+	am.trimHistory(now)
+}
+
+// trimHistory drops collections older than the window, always keeping the latest
+// NOTE: This method must be called while holding am.mu lock
+func (am *AlertManager) trimHistory(now time.Time) {
+	start := now.Add(-am.window)
+	drop := 0
+	for drop < len(am.history)-1 && !am.history[drop].at.After(start) {
+		drop++
+	}
+	am.history = am.history[drop:]
+}
+
+// backfillHistory reads the stored window in the background, like evaluateStoredExpr, so a
+// long window neither delays the first collection nor holds the lock. The stored collections
+// go before those remembered meanwhile, and the rules using the history are evaluated again.
+// NOTE: This method must be called while holding am.mu lock
+func (am *AlertManager) backfillHistory(q RecordQuery) {
+	source := am.source
+	am.storageRuns.Add(1)
+	go func() {
+		defer am.storageRuns.Done()
+		stored, err := source(q)
+		if err != nil {
+			log.Printf("警告: 读取告警历史数据失败: %v", err)
+			return
+		}
+		snapshots := groupAlertSnapshots(stored)
+		if len(snapshots) == 0 {
+			return
+		}
+
+		am.mu.Lock()
+		defer am.mu.Unlock()
+		now := time.Now()
+		am.history = append(snapshots, am.history...)
+		am.trimHistory(now)
+		for _, rule := range am.rules {
+			expr := am.exprs[rule.Name]
+			if rule.Enabled && expr != nil && expr.Window() > 0 && expr.Window() <= am.window {
+				am.applyExprResults(rule, expr.eval(am.history, now))
+			}
+		}
+	}()
+}
+
+// evaluateStoredExpr evaluates a rule whose window is longer than the in-memory history
+// The window is read from storage at most once a minute, in the background, so the query
+// neither delays the collection nor holds the lock.
+// NOTE: This method must be called while holding am.mu lock
+func (am *AlertManager) evaluateStoredExpr(rule AlertRule, expr *AlertExpr, now time.Time) {
+	if am.storageBusy[rule.Name] || now.Sub(am.storageEval[rule.Name]) < alertStorageInterval {
+		return
+	}
+	am.storageEval[rule.Name] = now
+	am.storageBusy[rule.Name] = true
+
+	source := am.source
+	am.storageRuns.Add(1)
+	go func() {
+		defer am.storageRuns.Done()
+		stored, err := source(expr.query(now.Add(-expr.Window()), now))
+		var results []alertSeries
+		if err == nil {
+			results = expr.eval(groupAlertSnapshots(stored), now)
+		}
+
+		am.mu.Lock()
+		defer am.mu.Unlock()
+		delete(am.storageBusy, rule.Name)
+		if err != nil {
+			log.Printf("告警评估失败: %s: %v", rule.Name, err)
+			return
+		}
+		am.applyExprResults(rule, results)
+	}()
+}
+
+// waitStoredExprs waits for the history backfill and the evaluations reading from storage to finish
+func (am *AlertManager) waitStoredExprs() {
+	am.storageRuns.Wait()
+}
+
+// applyExprResults updates the alert instances of an expression rule; every group that passes
+// the comparison is an instance of its own, keyed by the rule name and the group's labels
+// NOTE: This method must be called while holding am.mu lock
+func (am *AlertManager) applyExprResults(rule AlertRule, results []alertSeries) {
+	active := make(map[string]bool)
+	for _, result := range results {
+		key := rule.Name + formatAlertLabels(result.labels)
+		active[key] = true
+		am.handleAlert(key, rule, result.labels, result.value)
+	}
+	for key, state := range am.states {
+		if state.Rule.Name == rule.Name && !active[key] {
+			am.clearAlert(key)
+		}
+	}
+}
+
 // getMetricValue calculates metric value from records based on aggregation method
 func (am *AlertManager) getMetricValue(records []ResourceRecord, metric, processName, aggregation string) float64 {
 	var total float64
 	var max float64
 	var count int
 
+	// Handle host-level metrics from the latest system sample
+	if strings.HasPrefix(metric, "host_") {
+		if am.systemRecord == nil {
+			return 0
+		}
+		value, _ := am.systemRecord.MetricValue(metric, processName)
+		return value
+	}
+
 	// Handle system-level metrics (ignore aggregation and processName)
 	if metric == "system_cpu_percent" {
 		// Calculate total CPU usage as percentage of system capacity
@@ -197,15 +412,16 @@ func (am *AlertManager) getMetricValue(records []ResourceRecord, metric, process
 	}
 }
 
-// handleAlert handles an alert condition
-func (am *AlertManager) handleAlert(rule AlertRule, value float64) {
-	state, exists := am.states[rule.Name]
+// handleAlert handles an alert condition of the alert instance key
+func (am *AlertManager) handleAlert(key string, rule AlertRule, labels map[string]string, value float64) {
+	state, exists := am.states[key]
 	if !exists {
 		state = &AlertState{
 			Rule:      &rule,
 			StartTime: time.Now(),
+			Labels:    labels,
 		}
-		am.states[rule.Name] = state
+		am.states[key] = state
 	}
 
 	state.Count++
@@ -223,37 +439,51 @@ func (am *AlertManager) handleAlert(rule AlertRule, value float64) {
 	}
 
 	// Send alert
-	am.sendAlert(rule, value, duration)
+	am.sendAlert(state, value, duration)
 	
 	state.LastNotify = time.Now()
 	state.Suppressed = true
 }
 
 // clearAlert clears an alert state
-func (am *AlertManager) clearAlert(ruleName string) {
-	if state, exists := am.states[ruleName]; exists {
+func (am *AlertManager) clearAlert(key string) {
+	if state, exists := am.states[key]; exists {
 		// If was suppressed, send recovery notification
 		if state.Suppressed {
-			am.sendRecovery(state.Rule, state.CurrentValue)
+			am.sendRecovery(state, state.CurrentValue)
 		}
-		delete(am.states, ruleName)
+		delete(am.states, key)
 	}
 }
 
 // sendAlert sends alert notification
-func (am *AlertManager) sendAlert(rule AlertRule, value, duration float64) {
-	title := fmt.Sprintf("🚨 告警: %s", rule.Name)
-	content := fmt.Sprintf(
-		"**指标**: %s\n**当前值**: %.2f\n**阈值**: %.2f\n**持续时长**: %.0f秒",
-		rule.Metric,
-		value,
-		rule.Threshold,
-		duration,
-	)
+func (am *AlertManager) sendAlert(state *AlertState, value, duration float64) {
+	rule := state.Rule
+	title := fmt.Sprintf("🚨 告警: %s%s", rule.Name, formatAlertLabels(state.Labels))
+	var content string
+	if rule.Expr != "" {
+		content = fmt.Sprintf(
+			"**表达式**: %s\n**当前值**: %.2f\n**持续时长**: %.0f秒",
+			rule.Expr,
+			value,
+			duration,
+		)
+	} else {
+		content = fmt.Sprintf(
+			"**指标**: %s\n**当前值**: %.2f\n**阈值**: %.2f\n**持续时长**: %.0f秒",
+			rule.Metric,
+			value,
+			rule.Threshold,
+			duration,
+		)
+	}
 
 	if rule.Process != "" {
 		content += fmt.Sprintf("\n**进程**: %s", rule.Process)
 	}
+	if len(state.Labels) > 0 {
+		content += fmt.Sprintf("\n**分组**: %s", formatAlertLabels(state.Labels))
+	}
 
 	// Send to all configured channels
 	for _, channel := range rule.Channels {
@@ -272,14 +502,24 @@ func (am *AlertManager) sendAlert(rule AlertRule, value, duration float64) {
 }
 
 // sendRecovery sends recovery notification
-func (am *AlertManager) sendRecovery(rule *AlertRule, lastValue float64) {
-	title := fmt.Sprintf("✅ 恢复: %s", rule.Name)
-	content := fmt.Sprintf(
-		"**指标**: %s\n**上次值**: %.2f\n**阈值**: %.2f\n**状态**: 已恢复正常",
-		rule.Metric,
-		lastValue,
-		rule.Threshold,
-	)
+func (am *AlertManager) sendRecovery(state *AlertState, lastValue float64) {
+	rule := state.Rule
+	title := fmt.Sprintf("✅ 恢复: %s%s", rule.Name, formatAlertLabels(state.Labels))
+	var content string
+	if rule.Expr != "" {
+		content = fmt.Sprintf(
+			"**表达式**: %s\n**上次值**: %.2f\n**状态**: 已恢复正常",
+			rule.Expr,
+			lastValue,
+		)
+	} else {
+		content = fmt.Sprintf(
+			"**指标**: %s\n**上次值**: %.2f\n**阈值**: %.2f\n**状态**: 已恢复正常",
+			rule.Metric,
+			lastValue,
+			rule.Threshold,
+		)
+	}
 
 	if rule.Process != "" {
 		content += fmt.Sprintf("\n**进程**: %s", rule.Process)
@@ -1,10 +1,17 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/process"
@@ -26,6 +33,8 @@ type ProcessInfo struct {
 	NetRecvKB   float64
 	CreateTime  int64   // Process start time (Unix timestamp in milliseconds)
 	CPUTime     float64 // Cumulative CPU time in seconds (User + System)
+	UID         int32   // Real user ID of the owner
+	Username    string  // Owner user name
 }
 
 // App represents the simplified application core
@@ -45,6 +54,38 @@ type App struct {
 
 	// Task management
 	taskManager *TaskManager
+
+	// Process include/exclude filters
+	filter *ProcessFilter
+
+	// Category rules
+	categorizer *Categorizer
+
+	// Process lifecycle events
+	eventTracker *ProcessEventTracker
+
+	// Host-level metrics
+	systemCollector  *SystemCollector
+	latestSystem     *SystemRecord
+	latestSystemLock sync.RWMutex
+
+	// Asynchronous record writer (daemon only; nil means synchronous writes)
+	writer *WritePipeline
+
+	// Output sinks receiving every snapshot (daemon only; nil means only the primary store)
+	sinks *SinkFanout
+
+	// Aggregator only: listener for agent batches and the hosts reporting to it
+	ingest *http.Server
+	hosts  *hostRegistry
+
+	// Latest collection, served by the Prometheus exporter
+	latestRecords        []ResourceRecord
+	latestCollection     *CollectorStats
+	latestCollectionLock sync.RWMutex
+
+	// Last time maintenance applied the retention rules
+	lastRetention time.Time
 }
 
 // NewApp creates a new application instance
@@ -66,6 +107,20 @@ func NewApp(dataFile string, interval time.Duration, config Config) *App {
 		log.Printf("Alert manager initialized with %d rules", len(config.Alerts.Rules))
 	}
 
+	// Create process filter; invalid rules are reported by Initialize
+	filter, err := NewProcessFilter(config.Filters)
+	if err != nil {
+		log.Printf("Warning: Invalid process filters, using defaults: %v", err)
+		filter, _ = NewProcessFilter(GetDefaultFilterConfig())
+	}
+
+	// Create categorizer; invalid rules are reported by Initialize
+	categorizer, err := NewCategorizer(config.Categories, config.EnableSmartCategories)
+	if err != nil {
+		log.Printf("Warning: Invalid category rules, using built-in rules: %v", err)
+		categorizer, _ = NewCategorizer(CategoriesConfig{}, config.EnableSmartCategories)
+	}
+
 	// Create task manager
 	taskConfig := TaskConfig{
 		MaxConcurrentTasks: 10,        // Default: max 10 concurrent tasks
@@ -74,16 +129,26 @@ func NewApp(dataFile string, interval time.Duration, config Config) *App {
 		ProcessTreeDepth: 10,           // Track up to 10 levels deep
 	}
 	dataDir := filepath.Dir(dataFile)
-	taskManager := NewTaskManager(dataDir, taskConfig)
+	taskFile := filepath.Join(dataDir, "tasks.json")
+	var taskStorage TaskStorage = NewTaskStorageFile(taskFile)
+	if sqlite, ok := storage.(*SQLiteStorage); ok {
+		// Tasks live in the same database; an existing tasks.json is imported once
+		taskStorage = NewSQLiteTaskStorage(sqlite, taskFile)
+	}
+	taskManager := NewTaskManagerWithStorage(dataDir, taskConfig, taskStorage)
 
 	return &App{
-		DataFile:      dataFile,
-		Interval:      interval,
-		Config:        config,
-		storage:       storage,
-		dockerMonitor: dockerMonitor,
-		alertManager:  alertManager,
-		taskManager:   taskManager,
+		DataFile:        dataFile,
+		Interval:        interval,
+		Config:          config,
+		storage:         storage,
+		dockerMonitor:   dockerMonitor,
+		alertManager:    alertManager,
+		taskManager:     taskManager,
+		filter:          filter,
+		categorizer:     categorizer,
+		eventTracker:    NewProcessEventTracker(),
+		systemCollector: NewSystemCollector(),
 	}
 }
 
@@ -99,6 +164,11 @@ func (a *App) Initialize() error {
 		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
+	// Range functions of alert expressions start from stored collections
+	if a.alertManager != nil {
+		a.alertManager.SetHistorySource(a.alertHistory)
+	}
+
 	// Log storage configuration (simplified)
 	log.Printf("Storage: max=%dMB total, keep=%d days, auto-rotation enabled",
 		a.Config.Storage.MaxSizeMB,
@@ -117,8 +187,85 @@ func (a *App) Initialize() error {
 	return nil
 }
 
+// StartWritePipeline moves record writes off the collection tick onto a bounded queue
+// Queued records are flushed by CloseFile.
+func (a *App) StartWritePipeline() {
+	if a.writer != nil {
+		return
+	}
+	a.writer = NewWritePipeline(a.storage, a.Config.Storage.Write, filepath.Dir(a.DataFile))
+	a.writer.Start()
+}
+
+// StartSinks fans records out to the primary store and every configured sink
+// In agent mode the aggregator is one more sink.
+// Call it after StartWritePipeline so the primary store is written through the pipeline.
+func (a *App) StartSinks() error {
+	statsPath := filepath.Join(filepath.Dir(a.DataFile), sinkStatsFile)
+	agent := a.Config.Cluster.Mode == ClusterAgent
+	if len(a.Config.Sinks) == 0 && !agent {
+		// Don't let `status` show sinks that were removed from the configuration
+		os.Remove(statsPath)
+		return nil
+	}
+	if a.sinks != nil {
+		return nil
+	}
+	fanout := NewSinkFanout(statsPath)
+	kind := "csv"
+	if _, ok := a.storage.(*SQLiteStorage); ok {
+		kind = "sqlite"
+	}
+	fanout.AddInline("storage", kind, &storageSink{writer: a.writer, storage: a.storage})
+	for _, config := range a.Config.Sinks {
+		sink, err := NewSink(config, filepath.Dir(a.DataFile), a.Config.Metrics)
+		if err != nil {
+			return fmt.Errorf("sink %s: %w", config.DisplayName(), err)
+		}
+		fanout.Add(config.DisplayName(), config.Type, sink, config.QueueSize)
+	}
+	if agent {
+		config := a.Config.Cluster.sinkConfig()
+		fanout.Add(config.Name, config.Type, newAgentSink(a.Config.Cluster, a.Interval, filepath.Dir(a.DataFile)), 0)
+	}
+	fanout.Start()
+	a.sinks = fanout
+	return nil
+}
+
+// SinkStats returns the sink counters; ok is false when no sinks are configured
+func (a *App) SinkStats() (stats []SinkStats, ok bool) {
+	if a.sinks == nil {
+		return nil, false
+	}
+	return a.sinks.Stats(), true
+}
+
+// WriteStats returns the write pipeline counters; ok is false when writes are synchronous
+func (a *App) WriteStats() (stats WriteStats, ok bool) {
+	if a.writer == nil {
+		return stats, false
+	}
+	return a.writer.Stats(), true
+}
+
 // CloseFile closes file handles and cleans up resources
 func (a *App) CloseFile() error {
+	// Stop accepting agent batches, deliver what the sinks have queued,
+	// then flush queued records before closing storage
+	a.stopCluster()
+	if a.sinks != nil {
+		a.sinks.Close()
+	}
+	if a.writer != nil {
+		a.writer.Close()
+	}
+
+	// Alert rules reading long windows may still be querying storage
+	if a.alertManager != nil {
+		a.alertManager.waitStoredExprs()
+	}
+
 	// Stop Docker monitoring
 	if a.dockerMonitor != nil {
 		if err := a.dockerMonitor.Stop(); err != nil {
@@ -144,28 +291,120 @@ func (a *App) ReadResourceRecords(filePath string) ([]ResourceRecord, error) {
 	return a.storage.ReadRecords(filePath)
 }
 
+// QueryRecords runs a filtered query against the configured storage and collects the results
+func (a *App) QueryRecords(ctx context.Context, q RecordQuery) ([]ResourceRecord, error) {
+	it, err := a.storage.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return CollectRecords(it)
+}
+
+// GetRecords returns stored process records within a time range from the configured storage
+func (a *App) GetRecords(start, end time.Time) ([]ResourceRecord, error) {
+	return a.QueryRecords(context.Background(), RecordQuery{Start: start, End: end})
+}
+
+// GetRecentRecords returns process records collected within the last window
+func (a *App) GetRecentRecords(window time.Duration) ([]ResourceRecord, error) {
+	end := time.Now()
+	return a.GetRecords(end.Add(-window), end)
+}
+
+// GetLatestProcesses returns the most recent record of each process seen within the last window, ordered by PID
+// host selects one machine; "" returns the processes of every host.
+func (a *App) GetLatestProcesses(window time.Duration, host string) ([]ResourceRecord, error) {
+	end := time.Now()
+	return a.QueryRecords(context.Background(), RecordQuery{
+		Start:      end.Add(-window),
+		End:        end,
+		Hosts:      hostFilter(host),
+		LatestOnly: true,
+		OrderBy:    "pid",
+	})
+}
+
+// hostFilter turns a single host parameter into a query filter ("" means every host)
+func hostFilter(host string) []string {
+	if host == "" {
+		return nil
+	}
+	return []string{host}
+}
+
+// alertHistory reads this machine's records for alert expressions
+func (a *App) alertHistory(q RecordQuery) ([]ResourceRecord, error) {
+	q.Hosts = hostFilter(a.LocalHost())
+	return a.QueryRecords(context.Background(), q)
+}
+
+// LatestByPID keeps the most recent record of each PID per host, ordered by host and PID
+func LatestByPID(records []ResourceRecord) []ResourceRecord {
+	type hostPID struct {
+		host string
+		pid  int32
+	}
+	latest := make(map[hostPID]ResourceRecord)
+	for _, r := range records {
+		key := hostPID{r.Host, r.PID}
+		if existing, ok := latest[key]; !ok || r.Timestamp.After(existing.Timestamp) {
+			latest[key] = r
+		}
+	}
+
+	result := make([]ResourceRecord, 0, len(latest))
+	for _, r := range latest {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		return result[i].PID < result[j].PID
+	})
+	return result
+}
+
 // CalculateResourceStats calculates resource statistics for a given time period
 func (a *App) CalculateResourceStats(period time.Duration) ([]ResourceStats, error) {
+	end := time.Now()
+	return a.ResourceStatsBetween(context.Background(), end.Add(-period), end)
+}
+
+// ResourceStatsBetween streams the records of a time range through the stats engine, so
+// long ranges are aggregated in memory bounded by the number of processes rather than samples
+func (a *App) ResourceStatsBetween(ctx context.Context, start, end time.Time) ([]ResourceStats, error) {
 	// Initialize storage if not already initialized
 	if err := a.storage.Initialize(); err != nil {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	records, err := a.ReadResourceRecords(a.DataFile)
+	it, err := a.storage.Query(ctx, RecordQuery{Start: start, End: end})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read records: %w", err)
 	}
+	engine := NewStatsEngine(StatsOptions{Interval: a.Interval})
+	if err := engine.AddAll(it); err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+	return engine.Results(), nil
+}
 
-	// Filter records by time period
-	cutoff := time.Now().Add(-period)
-	var filteredRecords []ResourceRecord
-	for _, record := range records {
-		if record.Timestamp.After(cutoff) {
-			filteredRecords = append(filteredRecords, record)
-		}
+// CalculateUserStats aggregates resource usage by process owner for a given time period
+// host selects one machine; "" aggregates every host.
+func (a *App) CalculateUserStats(period time.Duration, host string) ([]UserStats, error) {
+	end := time.Now()
+	records, err := a.QueryRecords(context.Background(), RecordQuery{
+		Start:  end.Add(-period),
+		End:    end,
+		Hosts:  hostFilter(host),
+		Fields: []string{"timestamp", "host", "pid", "uid", "username", "cpu_percent", "memory_mb"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
 	}
 
-	return a.storage.CalculateStats(filteredRecords), nil
+	return CalculateUserStats(records), nil
 }
 
 // CompareStats compares statistics between two time periods
@@ -264,29 +503,16 @@ func (a *App) ShowTrends(days int) error {
 		startPeriod := time.Duration(day*24) * time.Hour
 		endPeriod := time.Duration((day+1)*24) * time.Hour
 
-		records, err := a.ReadResourceRecords(a.DataFile)
-		if err != nil {
-			return fmt.Errorf("failed to read records: %w", err)
-		}
-
-		// Filter records for this day
+		// Aggregate this day's records
 		now := time.Now()
-		startTime := now.Add(-endPeriod)
-		endTime := now.Add(-startPeriod)
-
-		var dayRecords []ResourceRecord
-		for _, record := range records {
-			if record.Timestamp.After(startTime) && record.Timestamp.Before(endTime) {
-				dayRecords = append(dayRecords, record)
-			}
+		stats, err := a.ResourceStatsBetween(context.Background(), now.Add(-endPeriod), now.Add(-startPeriod))
+		if err != nil {
+			return err
 		}
-
-		if len(dayRecords) == 0 {
+		if len(stats) == 0 {
 			continue
 		}
 
-		stats := a.storage.CalculateStats(dayRecords)
-
 		// Calculate aggregates
 		var totalCPU, totalMem, totalDisk float64
 		for _, stat := range stats {
@@ -351,11 +577,61 @@ func (a *App) ShowTrends(days int) error {
 	return nil
 }
 
+// retentionInterval is how often maintenance applies keep_days and the retention rules
+const retentionInterval = time.Hour
+
+// RunMaintenance performs periodic storage upkeep: rolling up finished buckets into the
+// long-term tiers, expiring old rollups, applying the retention rules (hourly), pruning the
+// oldest samples to fit max_size_mb (SQLite only) and taking scheduled backups
+// Every step runs even when an earlier one fails, so a failing rollup never stops the size
+// limit or the backups; the errors are logged and returned together.
+func (a *App) RunMaintenance() error {
+	var errs []error
+	step := func(name string, err error) {
+		if err != nil {
+			log.Printf("Warning: storage maintenance: %s failed: %v", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if rs, ok := a.storage.(RollupStorage); ok && a.Config.Storage.Rollups.Enabled {
+		step("rollup", rs.Rollup(time.Now()))
+	}
+	if now := time.Now(); now.Sub(a.lastRetention) >= retentionInterval {
+		_, err := a.ApplyRetention(false)
+		step("retention", err)
+		if err == nil {
+			a.lastRetention = now
+		}
+	}
+	if ss, ok := a.storage.(SizeLimitedStorage); ok && a.Config.Storage.MaxSizeMB > 0 {
+		_, err := ss.EnforceSizeLimit(int64(a.Config.Storage.MaxSizeMB) * 1024 * 1024)
+		step("size limit", err)
+	}
+	_, err := a.RunScheduledBackup(time.Now())
+	step("backup", err)
+	return errors.Join(errs...)
+}
+
 // CleanOldData removes old data files
 func (a *App) CleanOldData(keepDays int) error {
 	return a.storage.CleanOldData(keepDays)
 }
 
+// ApplyRetention applies keep_days and the retention rules to the stored data,
+// or only reports what they would delete when dryRun is set
+func (a *App) ApplyRetention(dryRun bool) (RetentionReport, error) {
+	rs, ok := a.storage.(RetentionStorage)
+	if !ok {
+		return RetentionReport{}, fmt.Errorf("storage does not support retention rules")
+	}
+	policy, err := NewRetentionPolicy(a.Config.Storage.KeepDays, a.Config.Storage.Retention)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	return rs.ApplyRetention(policy, time.Now(), dryRun)
+}
+
 // GetTotalRecords returns the total number of records
 func (a *App) GetTotalRecords() (int, error) {
 	return a.storage.GetRecordCount()
@@ -430,6 +706,12 @@ func (a *App) GetProcessInfo(p *process.Process) (ProcessInfo, error) {
 		info.CPUTime = times.User + times.System
 	}
 
+	// Get owner (real UID)
+	if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+		info.UID = uids[0]
+		info.Username = usernameForUID(uids[0])
+	}
+
 	// Get network statistics (not implemented - always returns 0)
 	info.NetSentKB, info.NetRecvKB = a.getNetworkStats(p)
 
@@ -468,6 +750,9 @@ func (a *App) GetCurrentResources() ([]ResourceRecord, error) {
 	time.Sleep(500 * time.Millisecond)
 
 	// PHASE 3: Collect accurate CPU values
+	// Every record of the collection shares one timestamp, so the snapshot can be told apart
+	// from the next even when reading it crosses a second boundary
+	collectedAt := time.Now()
 	var records []ResourceRecord
 	for _, p := range processMap {
 		info, err := a.GetProcessInfo(p)
@@ -481,10 +766,7 @@ func (a *App) GetCurrentResources() ([]ResourceRecord, error) {
 			continue
 		}
 
-		// Skip system processes
-		if a.isSystemProcess(name) {
-			continue
-		}
+		rawName := name
 
 		// Normalize process name
 		name = a.normalizeProcessName(name)
@@ -492,7 +774,7 @@ func (a *App) GetCurrentResources() ([]ResourceRecord, error) {
 		// Create resource record
 		record := ResourceRecord{
 			Name:                 name,
-			Timestamp:            time.Now(),
+			Timestamp:            collectedAt,
 			CPUPercent:           info.CPUPercent,
 			CPUPercentNormalized: CalculateCPUPercentNormalized(info.CPUPercent),
 			MemoryMB:             info.MemoryMB,
@@ -510,14 +792,21 @@ func (a *App) GetCurrentResources() ([]ResourceRecord, error) {
 			PPID:                 info.Ppid,
 			CreateTime:           info.CreateTime,
 			CPUTime:              info.CPUTime,
+			UID:                  info.UID,
+			Username:             info.Username,
 		}
 
 		// Determine if process is active
 		activityConfig := GetDefaultActivityConfig()
 		record.IsActive = IsActive(record, activityConfig)
 
-		// Set application category
-		record.Category = IdentifyApplication(name, info.Cmdline, a.Config.EnableSmartCategories)
+		// Set application category and labels
+		a.categorize(&record)
+
+		// Apply include/exclude filters
+		if !a.allowProcess(rawName, record) {
+			continue
+		}
 
 		records = append(records, record)
 	}
@@ -525,32 +814,75 @@ func (a *App) GetCurrentResources() ([]ResourceRecord, error) {
 	return records, nil
 }
 
-// isSystemProcess checks if a process is a system process
-func (a *App) isSystemProcess(name string) bool {
-	name = strings.ToLower(name)
-	// Only filter kernel threads and core system daemons
-	// DO NOT filter user shells (bash, sh, zsh) or user programs (ssh, etc)
-	systemPrefixes := []string{
-		"kworker", "ksoftirqd", "migration", "rcu_", "watchdog",
-		"khugepaged", "kthreadd", "kswapd", "cpuhp",
-		"irq/", "kdevtmpfs", "netns", "kauditd",
-		"khungtaskd", "oom_reaper", "writeback", "kcompactd",
-		"md", "jbd2", "ext4-", "xfs-",
+// allowProcess applies the configured include/exclude filters to a process
+func (a *App) allowProcess(name string, record ResourceRecord) bool {
+	if a.filter == nil {
+		return true
 	}
+	return a.filter.Allow(name, record)
+}
 
-	for _, prefix := range systemPrefixes {
-		if strings.HasPrefix(name, prefix) {
-			return true
-		}
+// categorize sets the category and labels of a record using the configured rules
+func (a *App) categorize(record *ResourceRecord) CategoryResult {
+	categorizer := a.categorizer
+	if categorizer == nil {
+		categorizer = defaultCategorizer
+	}
+	result := categorizer.Categorize(CategoryInput{
+		PID:     record.PID,
+		Name:    record.Name,
+		Cmdline: record.Command,
+		Cwd:     record.WorkingDir,
+		User:    record.Username,
+	})
+	record.Category = result.Category
+	record.Labels = result.Labels
+	return result
+}
+
+// ClassifiedProcess is a running process together with the rule that categorized it
+type ClassifiedProcess struct {
+	Record ResourceRecord
+	Rule   string
+}
+
+// ClassifyProcesses categorizes the running processes without storing anything
+// Used by "categorize --dry-run" to preview the effect of category rules
+func (a *App) ClassifyProcesses() ([]ClassifiedProcess, error) {
+	records, err := a.GetCurrentResources()
+	if err != nil {
+		return nil, err
+	}
+
+	classified := make([]ClassifiedProcess, 0, len(records))
+	for _, record := range records {
+		result := a.categorize(&record)
+		classified = append(classified, ClassifiedProcess{Record: record, Rule: result.Rule})
 	}
 
-	// Only truly low-level system processes
-	systemProcesses := map[string]bool{
-		"systemd": true,  // init system (too many instances)
-		"init":    true,  // legacy init
+	sort.Slice(classified, func(i, j int) bool {
+		if classified[i].Record.Category != classified[j].Record.Category {
+			return classified[i].Record.Category < classified[j].Record.Category
+		}
+		return classified[i].Record.PID < classified[j].Record.PID
+	})
+	return classified, nil
+}
+
+// CategoryRules returns the effective category rules in evaluation order
+func (a *App) CategoryRules() []string {
+	if a.categorizer == nil {
+		return defaultCategorizer.Describe()
 	}
+	return a.categorizer.Describe()
+}
 
-	return systemProcesses[name]
+// FilterRules returns the effective process filter rules in human readable form
+func (a *App) FilterRules() []string {
+	if a.filter == nil {
+		return nil
+	}
+	return a.filter.Describe()
 }
 
 // normalizeProcessName normalizes process name
@@ -580,6 +912,8 @@ func (a *App) GetProcessNameWithContext(info ProcessInfo) string {
 
 // CollectAndSaveData collects process data and saves it to storage
 func (a *App) CollectAndSaveData() error {
+	started := time.Now()
+
 	// PHASE 1: Get all processes and establish CPU baseline
 	processes, err := process.Processes()
 	if err != nil {
@@ -597,7 +931,10 @@ func (a *App) CollectAndSaveData() error {
 	time.Sleep(500 * time.Millisecond)
 
 	// PHASE 3: Collect accurate CPU values
-	var records []ResourceRecord
+	// Every record of the collection shares one timestamp, so the snapshot can be told apart
+	// from the next even when reading it crosses a second boundary
+	collectedAt := time.Now()
+	var snapshot, records []ResourceRecord
 	totalProcesses := len(processes)
 	filteredCount := 0
 	errorCount := 0
@@ -609,19 +946,13 @@ func (a *App) CollectAndSaveData() error {
 			continue // Skip processes we can't get info for
 		}
 
-		// Skip system processes
-		if a.isSystemProcess(info.Name) {
-			filteredCount++
-			continue
-		}
-
 		// Normalize process name
 		name := a.normalizeProcessName(info.Name)
 
 		// Create resource record
 		record := ResourceRecord{
 			Name:                 name,
-			Timestamp:            time.Now(),
+			Timestamp:            collectedAt,
 			CPUPercent:           info.CPUPercent,
 			CPUPercentNormalized: CalculateCPUPercentNormalized(info.CPUPercent),
 			MemoryMB:             info.MemoryMB,
@@ -634,46 +965,192 @@ func (a *App) CollectAndSaveData() error {
 			IsActive:             false, // Will be set below
 			Command:              info.Cmdline,
 			WorkingDir:           info.Cwd,
-			Category:             IdentifyApplication(name, info.Cmdline, a.Config.EnableSmartCategories),
+			Category:             "", // Will be set below
 			PID:                  info.Pid,
 			PPID:                 info.Ppid,
 			CreateTime:           info.CreateTime,
 			CPUTime:              info.CPUTime,
+			UID:                  info.UID,
+			Username:             info.Username,
 		}
 
 		// Set active status based on thresholds
 		config := GetDefaultActivityConfig()
 		record.IsActive = IsActive(record, config)
 
+		// Set application category and labels
+		a.categorize(&record)
+
+		// Events and task trees see every process; the include/exclude filters only decide
+		// what is stored and sent to the sinks
+		snapshot = append(snapshot, record)
+		if !a.allowProcess(info.Name, record) {
+			filteredCount++
+			continue
+		}
+
 		records = append(records, record)
 	}
 
+	// Detect process lifecycle events (host processes only; containers are tracked by Docker)
+	a.detectProcessEvents(snapshot)
+
+	// Record the resource usage of running tasks' process trees
+	a.taskManager.UpdateTaskFromProcessTree(snapshot)
+
 	// Add Docker container records
 	dockerRecords := a.collectDockerContainerRecords()
+	for i := range dockerRecords {
+		dockerRecords[i].Timestamp = collectedAt
+	}
 	records = append(records, dockerRecords...)
 
+	// Tag records with this machine when tracking several hosts
+	if host := a.LocalHost(); host != "" {
+		for i := range records {
+			records[i].Host = host
+		}
+		if a.hosts != nil {
+			a.hosts.observe(HostInfo{Host: host, Role: ClusterAggregator, IntervalSeconds: int(a.Interval / time.Second)}, len(records))
+		}
+	}
+
 	// Log collection statistics (every 12 cycles, i.e., every minute at 5s interval)
 	if len(records) == 0 || len(records) < 10 {
 		log.Printf("⚠️  Collected %d processes (total=%d, filtered=%d, errors=%d)", 
 			len(records), totalProcesses, filteredCount, errorCount)
 	}
 
-	// Save all records
+	// Save all records (queued when the write pipeline is running) and hand them to the sinks
 	if len(records) > 0 {
-		if err := a.storage.SaveRecords(records); err != nil {
+		if a.sinks != nil {
+			a.sinks.Enqueue(records)
+		} else if a.writer != nil {
+			a.writer.Enqueue(records)
+		} else if err := a.storage.SaveRecords(records); err != nil {
 			return err
 		}
 	}
 
+	// Collect and save host-level metrics
+	a.collectSystemRecord()
+
 	// Evaluate alert rules if alert manager is enabled
 	if a.alertManager != nil && len(records) > 0 {
 		a.alertManager.Evaluate(records)
 	}
 
+	a.recordCollection(records, CollectorStats{
+		CollectedAt: time.Now(),
+		Duration:    time.Since(started).Seconds(),
+		Processes:   totalProcesses,
+		Recorded:    len(records),
+		Filtered:    filteredCount,
+		Errors:      errorCount,
+	})
 	return nil
 }
 
+// detectProcessEvents diffs the snapshot against the previous one and saves lifecycle events
+func (a *App) detectProcessEvents(records []ResourceRecord) {
+	if a.eventTracker == nil {
+		return
+	}
+
+	events := a.eventTracker.Detect(records, time.Now())
+	if len(events) == 0 {
+		return
+	}
+
+	if err := a.storage.SaveProcessEvents(events); err != nil {
+		log.Printf("Warning: failed to save process events: %v", err)
+	}
+}
+
+// GetProcessEvents returns stored process lifecycle events within a time range
+// process matches a PID exactly or a process name (case-insensitive substring); empty matches all
+func (a *App) GetProcessEvents(processFilter string, start, end time.Time) ([]ProcessEvent, error) {
+	events, err := a.storage.ReadProcessEventsByTimeRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if processFilter == "" {
+		return events, nil
+	}
+
+	pid, pidErr := strconv.ParseInt(processFilter, 10, 32)
+	needle := strings.ToLower(processFilter)
+
+	var filtered []ProcessEvent
+	for _, event := range events {
+		if pidErr == nil && event.PID == int32(pid) {
+			filtered = append(filtered, event)
+			continue
+		}
+		if strings.Contains(strings.ToLower(event.Name), needle) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered, nil
+}
+
+// collectSystemRecord samples host-level metrics and saves them
+// Failures are logged only, so process collection keeps working on hosts
+// where some sources (e.g. PSI) are unavailable
+func (a *App) collectSystemRecord() {
+	if a.systemCollector == nil {
+		return
+	}
+
+	record, err := a.systemCollector.Collect()
+	if err != nil {
+		log.Printf("Warning: failed to collect system metrics: %v", err)
+		return
+	}
+
+	a.latestSystemLock.Lock()
+	a.latestSystem = &record
+	a.latestSystemLock.Unlock()
+
+	if err := a.storage.SaveSystemRecord(record); err != nil {
+		log.Printf("Warning: failed to save system metrics: %v", err)
+	}
+
+	if a.alertManager != nil {
+		a.alertManager.SetSystemRecord(record)
+	}
+}
 
+// GetLatestSystemRecord returns the most recent host-level sample
+// When this process is not the collector (e.g. the web server), it falls back to storage
+func (a *App) GetLatestSystemRecord() (SystemRecord, error) {
+	a.latestSystemLock.RLock()
+	latest := a.latestSystem
+	a.latestSystemLock.RUnlock()
+	if latest != nil {
+		return *latest, nil
+	}
+
+	now := time.Now()
+	records, err := a.storage.ReadSystemRecordsByTimeRange(now.Add(-10*time.Minute), now)
+	if err != nil {
+		return SystemRecord{}, err
+	}
+	if len(records) > 0 {
+		return records[len(records)-1], nil
+	}
+
+	// Nothing stored yet: take a live sample
+	if a.systemCollector == nil {
+		a.systemCollector = NewSystemCollector()
+	}
+	return a.systemCollector.Collect()
+}
+
+// GetSystemRecords returns stored host-level samples within a time range
+func (a *App) GetSystemRecords(start, end time.Time) ([]SystemRecord, error) {
+	return a.storage.ReadSystemRecordsByTimeRange(start, end)
+}
 
 // collectDockerContainerRecords collects Docker container statistics
 func (a *App) collectDockerContainerRecords() []ResourceRecord {
@@ -753,6 +1230,11 @@ func (a *App) DeleteTask(taskID int) error {
 	return a.taskManager.DeleteTask(taskID)
 }
 
+// GetTaskStats returns a task's resource time series with peak and total summaries
+func (a *App) GetTaskStats(taskID int) (*TaskStats, error) {
+	return a.taskManager.GetTaskStats(taskID)
+}
+
 // GetTaskEvents returns the task events channel for monitoring
 func (a *App) GetTaskEvents() <-chan TaskEvent {
 	return a.taskManager.GetTaskEvents()
@@ -0,0 +1,653 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupStorage is implemented by storage backends that can be backed up while the daemon keeps writing
+type BackupStorage interface {
+	// Backup writes a consistent snapshot of the store to path
+	Backup(ctx context.Context, path string) (BackupInfo, error)
+
+	// Restore validates a backup and replaces the store with it, or merges in the data the store is missing
+	Restore(ctx context.Context, path string, merge bool) (RestoreResult, error)
+}
+
+// BackupInfo describes a written backup
+type BackupInfo struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"`    // "sqlite" or "csv"
+	Size      int64     `json:"size"`    // Bytes on disk
+	Records   int       `json:"records"` // Process samples in the backup
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	Merged  bool `json:"merged"`
+	Records int  `json:"records"` // Samples restored, or samples added when merging
+}
+
+// backupFilePrefix names backups written by the scheduler and by "backup" without -o
+const backupFilePrefix = "process-tracker-"
+
+// csvBundleFormat identifies a CSV backup bundle in its manifest
+const csvBundleFormat = "process-tracker-csv"
+
+// csvBundleManifest is stored as the first entry of a CSV backup bundle
+type csvBundleManifest struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	BaseName  string          `json:"base_name"` // Data file name when the backup was taken
+	CreatedAt time.Time       `json:"created_at"`
+	Files     []csvBundleFile `json:"files"`
+}
+
+// csvBundleFile is one file in a CSV backup bundle
+type csvBundleFile struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // "data", "system" or "events"
+	Size int64  `json:"size"`
+}
+
+// csvStoreFile is a file belonging to the CSV store
+type csvStoreFile struct {
+	path string
+	kind string
+}
+
+// storeFiles lists the data file, its rotations and the system and events sidecars that exist
+func (m *Manager) storeFiles() ([]csvStoreFile, error) {
+	logs, err := NewStorageManager(m.dataFile, m.storageConfig).GetLogFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+
+	var files []csvStoreFile
+	for _, f := range logs {
+		files = append(files, csvStoreFile{path: f.Path, kind: "data"})
+	}
+	for _, kind := range []string{"system", "events"} {
+		path := m.sidecarFile(kind)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, csvStoreFile{path: path, kind: kind})
+		}
+	}
+	return files, nil
+}
+
+// Backup writes the data file, its rotations and sidecars to a tar.gz bundle
+// Files are opened together after flushing the buffer and copied up to their size at that
+// point, trimmed to the last complete line, so rows appended during the copy are left out
+func (m *Manager) Backup(ctx context.Context, path string) (BackupInfo, error) {
+	info := BackupInfo{Path: path, Type: "csv", CreatedAt: time.Now()}
+
+	m.mu.Lock()
+	if m.writer != nil || m.storageManager != nil {
+		if err := m.flushBuffer(); err != nil {
+			m.mu.Unlock()
+			return info, err
+		}
+	}
+	if m.writer != nil {
+		if err := m.writer.Flush(); err != nil {
+			m.mu.Unlock()
+			return info, err
+		}
+	}
+	storeFiles, err := m.storeFiles()
+	if err != nil {
+		m.mu.Unlock()
+		return info, err
+	}
+	var opened []*os.File
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+	manifest := csvBundleManifest{
+		Format:    csvBundleFormat,
+		Version:   1,
+		BaseName:  filepath.Base(m.dataFile),
+		CreatedAt: info.CreatedAt,
+	}
+	for _, sf := range storeFiles {
+		f, err := os.Open(sf.path)
+		if err != nil {
+			continue // Rotated away between listing and opening
+		}
+		size, err := completeLinesSize(f, sf.path)
+		if err != nil {
+			f.Close()
+			m.mu.Unlock()
+			return info, err
+		}
+		opened = append(opened, f)
+		manifest.Files = append(manifest.Files, csvBundleFile{Name: filepath.Base(sf.path), Kind: sf.kind, Size: size})
+	}
+	m.mu.Unlock()
+
+	tmp := path + ".tmp"
+	if err := writeCSVBundle(ctx, tmp, manifest, opened); err != nil {
+		os.Remove(tmp)
+		return info, err
+	}
+	count, err := validateCSVBundle(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return info, fmt.Errorf("backup failed validation: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return info, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	info.Records = count
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, nil
+}
+
+// completeLinesSize returns the file size, excluding a trailing partial line for uncompressed files
+func completeLinesSize(f *os.File, path string) (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := stat.Size()
+	if strings.HasSuffix(path, ".gz") {
+		return size, nil
+	}
+
+	const chunk = 64 * 1024
+	buf := make([]byte, chunk)
+	for end := size; end > 0; {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// writeCSVBundle writes the manifest followed by each file's first Size bytes
+func writeCSVBundle(ctx context.Context, path string, manifest csvBundleManifest, files []*os.File) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for i, entry := range manifest.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := &tar.Header{Name: entry.Name, Mode: 0644, Size: entry.Size, ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, io.NewSectionReader(files[i], 0, entry.Size)); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", entry.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// extractCSVBundle unpacks a bundle into dir and checks it against its manifest
+func extractCSVBundle(path, dir string) (csvBundleManifest, error) {
+	var manifest csvBundleManifest
+
+	in, err := os.Open(path)
+	if err != nil {
+		return manifest, err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return manifest, fmt.Errorf("not a CSV backup bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != "manifest.json" {
+		return manifest, fmt.Errorf("not a CSV backup bundle: missing manifest")
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Format != csvBundleFormat {
+		return manifest, fmt.Errorf("unexpected bundle format %q", manifest.Format)
+	}
+	if manifest.Version > 1 {
+		return manifest, fmt.Errorf("bundle version %d is newer than this build supports", manifest.Version)
+	}
+
+	expected := make(map[string]int64, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if f.Name != filepath.Base(f.Name) || f.Name == "." || f.Name == ".." {
+			return manifest, fmt.Errorf("invalid file name %q in manifest", f.Name)
+		}
+		expected[f.Name] = f.Size
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("corrupt bundle: %w", err)
+		}
+		size, ok := expected[header.Name]
+		if !ok {
+			return manifest, fmt.Errorf("unexpected file %q in bundle", header.Name)
+		}
+		out, err := os.Create(filepath.Join(dir, header.Name))
+		if err != nil {
+			return manifest, err
+		}
+		n, err := io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return manifest, fmt.Errorf("corrupt bundle: %w", err)
+		}
+		if n != size {
+			return manifest, fmt.Errorf("%s is %d bytes, manifest says %d", header.Name, n, size)
+		}
+		delete(expected, header.Name)
+	}
+	for name := range expected {
+		return manifest, fmt.Errorf("%s listed in manifest but missing from bundle", name)
+	}
+	return manifest, nil
+}
+
+// validateCSVBundle checks a bundle can be extracted and parsed, returning its record count
+func validateCSVBundle(path string) (int, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".validate-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := extractCSVBundle(path, dir)
+	if err != nil {
+		return 0, err
+	}
+	records, _, _, err := readCSVBundle(dir, manifest)
+	return len(records), err
+}
+
+// readCSVBundle parses the extracted files of a bundle
+func readCSVBundle(dir string, manifest csvBundleManifest) ([]ResourceRecord, []SystemRecord, []ProcessEvent, error) {
+	var records []ResourceRecord
+	var system []SystemRecord
+	var events []ProcessEvent
+	for _, f := range manifest.Files {
+		path := filepath.Join(dir, f.Name)
+		switch f.Kind {
+		case "data":
+			fileRecords, err := readCSVDataFile(path)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			records = append(records, fileRecords...)
+		case "system":
+			fileRecords, err := readSystemRecordsFile(path)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			system = append(system, fileRecords...)
+		case "events":
+			fileEvents, err := readProcessEventsFile(path)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			events = append(events, fileEvents...)
+		default:
+			return nil, nil, nil, fmt.Errorf("unknown file kind %q for %s", f.Kind, f.Name)
+		}
+	}
+	return records, system, events, nil
+}
+
+// readCSVDataFile reads all records from a data file, decompressing rotated .gz files
+func readCSVDataFile(path string) ([]ResourceRecord, error) {
+	var records []ResourceRecord
+	err := scanCSVDataFile(path, func(record ResourceRecord) {
+		records = append(records, record)
+	})
+	return records, err
+}
+
+// Restore replaces the CSV store with a bundle, or appends the records, system samples and
+// events the store does not have yet. The bundle is fully extracted and parsed before any
+// current file is touched.
+func (m *Manager) Restore(ctx context.Context, path string, merge bool) (RestoreResult, error) {
+	result := RestoreResult{Merged: merge}
+
+	if err := os.MkdirAll(filepath.Dir(m.dataFile), 0755); err != nil {
+		return result, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(m.dataFile), ".restore-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := extractCSVBundle(path, dir)
+	if err != nil {
+		return result, fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+	records, system, events, err := readCSVBundle(dir, manifest)
+	if err != nil {
+		return result, fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	if merge {
+		added, err := m.mergeRecords(records, system, events)
+		result.Records = added
+		return result, err
+	}
+
+	// Replace: close the current files, swap in the extracted ones, then reopen
+	if err := m.Close(); err != nil {
+		return result, err
+	}
+	m.mu.Lock()
+	m.file, m.writer, m.storageManager = nil, nil, nil
+	current, err := m.storeFiles()
+	if err == nil {
+		for _, f := range current {
+			if err = os.Remove(f.path); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		for _, f := range manifest.Files {
+			if err = os.Rename(filepath.Join(dir, f.Name), m.restoredPath(manifest, f)); err != nil {
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return result, fmt.Errorf("failed to replace data files: %w", err)
+	}
+	log.Printf("Restored %s from %s", m.dataFile, path)
+
+	result.Records = len(records)
+	return result, m.Initialize()
+}
+
+// restoredPath maps a bundle file to its path in this store, which may use a different data file name
+func (m *Manager) restoredPath(manifest csvBundleManifest, f csvBundleFile) string {
+	if f.Kind != "data" {
+		return m.sidecarFile(f.Kind)
+	}
+	suffix := strings.TrimPrefix(f.Name, manifest.BaseName)
+	return m.dataFile + suffix
+}
+
+// mergeRecords appends the records, system samples and events not already stored
+// Records match on timestamp, PID and name; system samples on timestamp; events on timestamp, type and PID
+func (m *Manager) mergeRecords(records []ResourceRecord, system []SystemRecord, events []ProcessEvent) (int, error) {
+	type recordKey struct {
+		ts   int64
+		pid  int32
+		name string
+	}
+	type eventKey struct {
+		ts  int64
+		typ ProcessEventType
+		pid int32
+	}
+
+	current, err := m.storeFiles()
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[recordKey]bool)
+	for _, f := range current {
+		if f.kind != "data" {
+			continue
+		}
+		existing, err := readCSVDataFile(f.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+		for _, r := range existing {
+			seen[recordKey{r.Timestamp.UnixNano(), r.PID, r.Name}] = true
+		}
+	}
+	m.mu.RLock()
+	for _, r := range m.buffer {
+		seen[recordKey{r.Timestamp.UnixNano(), r.PID, r.Name}] = true
+	}
+	m.mu.RUnlock()
+
+	var missing []ResourceRecord
+	for _, r := range records {
+		key := recordKey{r.Timestamp.UnixNano(), r.PID, r.Name}
+		if !seen[key] {
+			seen[key] = true
+			missing = append(missing, r)
+		}
+	}
+	sort.SliceStable(missing, func(i, j int) bool { return missing[i].Timestamp.Before(missing[j].Timestamp) })
+	if err := m.SaveRecords(missing); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	if m.writer != nil || m.storageManager != nil {
+		err = m.flushBuffer()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	existingSystem, err := readSystemRecordsFile(m.systemDataFile())
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	seenSystem := make(map[int64]bool, len(existingSystem))
+	for _, r := range existingSystem {
+		seenSystem[r.Timestamp.UnixNano()] = true
+	}
+	addedSystem := 0
+	for _, r := range system {
+		if seenSystem[r.Timestamp.UnixNano()] {
+			continue
+		}
+		seenSystem[r.Timestamp.UnixNano()] = true
+		if err := m.SaveSystemRecord(r); err != nil {
+			return 0, err
+		}
+		addedSystem++
+	}
+
+	existingEvents, err := readProcessEventsFile(m.eventsDataFile())
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	seenEvents := make(map[eventKey]bool, len(existingEvents))
+	for _, e := range existingEvents {
+		seenEvents[eventKey{e.Timestamp.UnixNano(), e.Type, e.PID}] = true
+	}
+	var missingEvents []ProcessEvent
+	for _, e := range events {
+		key := eventKey{e.Timestamp.UnixNano(), e.Type, e.PID}
+		if !seenEvents[key] {
+			seenEvents[key] = true
+			missingEvents = append(missingEvents, e)
+		}
+	}
+	if err := m.SaveProcessEvents(missingEvents); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Merged %d records, %d system samples and %d events into %s",
+		len(missing), addedSystem, len(missingEvents), m.dataFile)
+	return len(missing), nil
+}
+
+// BackupDir returns the directory scheduled backups are written to
+func (a *App) BackupDir() string {
+	if a.Config.Backup.Dir != "" {
+		return expandSQLitePath(a.Config.Backup.Dir)
+	}
+	return filepath.Join(filepath.Dir(a.DataFile), "backups")
+}
+
+// DefaultBackupPath returns a timestamped backup file name in dir with the extension for the storage backend
+func (a *App) DefaultBackupPath(dir string, now time.Time) string {
+	ext := ".tar.gz"
+	if _, ok := a.storage.(*SQLiteStorage); ok {
+		ext = ".db"
+	}
+	return filepath.Join(dir, backupFilePrefix+now.Format("20060102-150405")+ext)
+}
+
+// Backup writes a backup of the current store to path
+func (a *App) Backup(ctx context.Context, path string) (BackupInfo, error) {
+	bs, ok := a.storage.(BackupStorage)
+	if !ok {
+		return BackupInfo{}, fmt.Errorf("storage backend does not support backups")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return BackupInfo{}, err
+	}
+	return bs.Backup(ctx, path)
+}
+
+// Restore replaces the current store with a backup, or merges the backup into it
+func (a *App) Restore(ctx context.Context, path string, merge bool) (RestoreResult, error) {
+	bs, ok := a.storage.(BackupStorage)
+	if !ok {
+		return RestoreResult{}, fmt.Errorf("storage backend does not support restore")
+	}
+	return bs.Restore(ctx, path, merge)
+}
+
+// ListBackups returns the backups in dir written by the scheduler or "backup" without -o, newest first
+func ListBackups(dir string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var backups []FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupFilePrefix) {
+			continue
+		}
+		if !strings.HasSuffix(name, ".db") && !strings.HasSuffix(name, ".tar.gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, FileInfo{Path: filepath.Join(dir, name), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ModTime.After(backups[j].ModTime) })
+	return backups, nil
+}
+
+// RunScheduledBackup takes a backup when backups are enabled and the newest one is older than
+// the configured interval, then removes the oldest backups beyond the retention count.
+// It returns nil when no backup was due.
+func (a *App) RunScheduledBackup(now time.Time) (*BackupInfo, error) {
+	config := a.Config.Backup
+	if !config.Enabled {
+		return nil, nil
+	}
+	interval := time.Duration(config.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	dir := a.BackupDir()
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) > 0 && now.Sub(backups[0].ModTime) < interval {
+		return nil, nil
+	}
+
+	info, err := a.Backup(context.Background(), a.DefaultBackupPath(dir, now))
+	if err != nil {
+		return nil, fmt.Errorf("scheduled backup failed: %w", err)
+	}
+	log.Printf("Backup written to %s (%.1f MB, %d records)", info.Path, float64(info.Size)/1024/1024, info.Records)
+
+	if config.Keep > 0 {
+		backups, err := ListBackups(dir)
+		if err != nil {
+			return &info, err
+		}
+		for _, old := range backups[min(config.Keep, len(backups)):] {
+			if err := os.Remove(old.Path); err != nil {
+				log.Printf("Warning: failed to remove old backup %s: %v", old.Path, err)
+			}
+		}
+	}
+	return &info, nil
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCSVManager(t *testing.T, dataFile string) *Manager {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(dataFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(dataFile, 10, true, GetDefaultStorageConfig())
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	return m
+}
+
+// TestManager_BackupRestore tests the CSV bundle round trip: replace under a different
+// data file name, then merge without duplicating records
+func TestManager_BackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestCSVManager(t, filepath.Join(dir, "live", "process-tracker.log"))
+	defer m.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := m.SaveRecords(schemaTestRecords(start, 2, 5)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	m.SaveSystemRecord(SystemRecord{Timestamp: start, Load1: 0.5})
+	m.SaveProcessEvents([]ProcessEvent{{Timestamp: start, Type: ProcessEventStarted, PID: 1000, Name: "worker-0"}})
+
+	// The buffer size is 10, so all records are on disk; a partially written row
+	// at the end of the file is left out of the bundle
+	f, _ := os.OpenFile(m.dataFile, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("2026-01-01 00:00:00,partial")
+	f.Close()
+
+	bundle := filepath.Join(dir, "backup.tar.gz")
+	info, err := m.Backup(context.Background(), bundle)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if info.Records != 10 || info.Type != "csv" {
+		t.Errorf("Expected 10 records in the CSV bundle, got %+v", info)
+	}
+
+	restored := newTestCSVManager(t, filepath.Join(dir, "restored", "tracker.log"))
+	defer restored.Close()
+	result, err := restored.Restore(context.Background(), bundle, false)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	records, err := restored.ReadRecordsByTimeRange(start.Add(-time.Second), time.Now())
+	if err != nil || len(records) != 10 || result.Records != 10 {
+		t.Errorf("Expected 10 restored records, got %d (%v, result %+v)", len(records), err, result)
+	}
+	events, _ := restored.ReadProcessEventsByTimeRange(start, time.Now())
+	system, _ := restored.ReadSystemRecordsByTimeRange(start, time.Now())
+	if len(events) != 1 || len(system) != 1 {
+		t.Errorf("Expected sidecars restored, got %d events and %d system records", len(events), len(system))
+	}
+
+	// Merging the same bundle plus newer data adds nothing twice
+	if err := restored.SaveRecords(schemaTestRecords(start.Add(time.Minute), 3, 2)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	result, err = restored.Restore(context.Background(), bundle, true)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	records, _ = restored.ReadRecordsByTimeRange(start.Add(-time.Second), time.Now())
+	if result.Records != 0 || len(records) != 16 {
+		t.Errorf("Expected merge to add nothing, got %+v and %d records", result, len(records))
+	}
+	events, _ = restored.ReadProcessEventsByTimeRange(start, time.Now())
+	if len(events) != 1 {
+		t.Errorf("Expected events not duplicated, got %d", len(events))
+	}
+
+	bogus := filepath.Join(dir, "bogus.tar.gz")
+	os.WriteFile(bogus, []byte("not a bundle"), 0644)
+	if _, err := restored.Restore(context.Background(), bogus, false); err == nil {
+		t.Error("Expected restoring an invalid bundle to fail")
+	}
+}
+
+// TestApp_RunScheduledBackup tests the backup interval and retention count
+func TestApp_RunScheduledBackup(t *testing.T) {
+	dir := t.TempDir()
+	config := GetDefaultConfig()
+	config.Storage.Type = "sqlite"
+	config.Storage.SQLitePath = filepath.Join(dir, "tracker.db")
+	config.Backup = BackupConfig{Enabled: true, IntervalHours: 24, Keep: 2}
+	app := NewApp(filepath.Join(dir, "process-tracker.log"), time.Second, config)
+	if err := app.storage.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer app.storage.Close()
+
+	now := time.Now()
+	for day := 0; day < 4; day++ {
+		at := now.Add(time.Duration(day-4) * 24 * time.Hour)
+		info, err := app.RunScheduledBackup(at)
+		if err != nil || info == nil {
+			t.Fatalf("Expected a backup on day %d, got %v (%v)", day, info, err)
+		}
+		os.Chtimes(info.Path, at, at)
+	}
+
+	// The newest backup is less than a day old, so nothing is due yet
+	if info, err := app.RunScheduledBackup(now.Add(-time.Hour)); err != nil || info != nil {
+		t.Errorf("Expected no backup before the interval, got %v (%v)", info, err)
+	}
+
+	backups, err := ListBackups(app.BackupDir())
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 retained backups, got %d", len(backups))
+	}
+	if filepath.Ext(backups[0].Path) != ".db" || backups[0].ModTime.Before(backups[1].ModTime) {
+		t.Errorf("Expected newest SQLite backup first, got %+v", backups)
+	}
+}
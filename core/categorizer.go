@@ -0,0 +1,347 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CategoriesConfig configures process categorization
+// User rules are evaluated in order before the built-in rules; the first matching rule wins
+type CategoriesConfig struct {
+	Rules          []CategoryRule `yaml:"rules"`           // User-defined rules, evaluated first
+	DisableBuiltin bool           `yaml:"disable_builtin"` // Do not fall back to the built-in rules
+}
+
+// CategoryRule assigns a category and optional labels to matching processes
+// All patterns set in a rule must match. Patterns are globs ("*" and "?") by default,
+// or regular expressions when Match is "regex". Name globs are case-insensitive
+type CategoryRule struct {
+	Name     string            `yaml:"name"`     // Pattern for the process name
+	Cmdline  string            `yaml:"cmdline"`  // Pattern for the full command line
+	Cwd      string            `yaml:"cwd"`      // Pattern for the working directory
+	User     string            `yaml:"user"`     // Pattern for the owner user name
+	Match    string            `yaml:"match"`    // "glob" (default) or "regex"
+	Category string            `yaml:"category"` // Category to assign
+	Labels   map[string]string `yaml:"labels"`   // Optional labels to attach
+}
+
+// CategoryInput is the process information used for categorization
+type CategoryInput struct {
+	PID     int32
+	Name    string
+	Cmdline string
+	Cwd     string
+	User    string // Owner user name; looked up from the PID when empty
+}
+
+// CategoryResult is the outcome of categorizing a process
+type CategoryResult struct {
+	Category string
+	Labels   map[string]string
+	Rule     string // Description of the matching rule, empty when no rule matched
+}
+
+// builtinCategoryRules are the default rules, matched on the exact process name
+var builtinCategoryRules = []CategoryRule{
+	{Name: "go", Category: "development"},
+	{Name: "gopls", Category: "development"},
+	{Name: "gcc", Category: "development"},
+	{Name: "g++", Category: "development"},
+	{Name: "cc1*", Category: "development"},
+	{Name: "clang*", Category: "development"},
+	{Name: "make", Category: "development"},
+	{Name: "cargo", Category: "development"},
+	{Name: "rustc", Category: "development"},
+	{Name: "rust-analyzer", Category: "development"},
+	{Name: "python", Category: "development"},
+	{Name: `(?i)^python[0-9.]+$`, Match: "regex", Category: "development"},
+	{Name: "node", Category: "development"},
+	{Name: "npm", Category: "development"},
+	{Name: "java", Category: "development"},
+	{Name: "code", Category: "development"},
+	{Name: "code-*", Category: "development"},
+
+	{Name: "chrome", Category: "browser"},
+	{Name: "chromium*", Category: "browser"},
+	{Name: "google-chrome*", Category: "browser"},
+	{Name: "google chrome*", Category: "browser"},
+	{Name: "firefox*", Category: "browser"},
+	{Name: "safari", Category: "browser"},
+	{Name: "msedge", Category: "browser"},
+	{Name: "microsoft-edge*", Category: "browser"},
+	{Name: "opera*", Category: "browser"},
+
+	{Name: "mongod", Category: "database"},
+	{Name: "mongos", Category: "database"},
+	{Name: "postgres", Category: "database"},
+	{Name: "mysqld", Category: "database"},
+	{Name: "mariadbd", Category: "database"},
+	{Name: "redis-server", Category: "database"},
+
+	{Name: "ssh", Category: "system"},
+	{Name: "sshd", Category: "system"},
+	{Name: "bash", Category: "system"},
+	{Name: "zsh", Category: "system"},
+	{Name: "sh", Category: "system"},
+	{Name: "fish", Category: "system"},
+	{Name: "systemd*", Category: "system"},
+	{Name: "docker*", Category: "system"},
+	{Name: "containerd*", Category: "system"},
+
+	{Name: "vlc", Category: "media"},
+	{Name: "mpv", Category: "media"},
+	{Name: "spotify", Category: "media"},
+	{Name: "rhythmbox", Category: "media"},
+
+	{Name: "libreoffice*", Category: "office"},
+	{Name: "soffice*", Category: "office"},
+	{Name: "winword", Category: "office"},
+	{Name: "excel", Category: "office"},
+	{Name: "powerpnt", Category: "office"},
+}
+
+// compiledCategoryRule is a CategoryRule with its patterns compiled
+type compiledCategoryRule struct {
+	rule    CategoryRule
+	builtin bool
+	name    *regexp.Regexp
+	cmdline *regexp.Regexp
+	cwd     *regexp.Regexp
+	user    *regexp.Regexp
+}
+
+// Categorizer assigns categories and labels to processes using an ordered rule list
+type Categorizer struct {
+	rules []compiledCategoryRule
+
+	// lookupUser resolves the owner of a process; only called when a rule needs it
+	lookupUser func(pid int32) string
+}
+
+// defaultCategorizer holds only the built-in rules; used by IdentifyApplication
+var defaultCategorizer = mustBuiltinCategorizer()
+
+func mustBuiltinCategorizer() *Categorizer {
+	c, err := NewCategorizer(CategoriesConfig{}, true)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in category rules: %v", err))
+	}
+	return c
+}
+
+// NewCategorizer compiles user rules followed by the built-in rules
+// Built-in rules are skipped when smart categories are disabled or DisableBuiltin is set
+func NewCategorizer(config CategoriesConfig, useSmartCategories bool) (*Categorizer, error) {
+	c := &Categorizer{lookupUser: processUsername}
+
+	for i, rule := range config.Rules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("category rule %d: category is required", i+1)
+		}
+		compiled, err := compileCategoryRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("category rule %d (%s): %w", i+1, rule.Category, err)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+
+	if useSmartCategories && !config.DisableBuiltin {
+		for _, rule := range builtinCategoryRules {
+			compiled, err := compileCategoryRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			compiled.builtin = true
+			c.rules = append(c.rules, compiled)
+		}
+	}
+
+	return c, nil
+}
+
+// ValidateCategoriesConfig checks that all category rules compile
+func ValidateCategoriesConfig(config CategoriesConfig) error {
+	_, err := NewCategorizer(config, false)
+	return err
+}
+
+func compileCategoryRule(rule CategoryRule) (compiledCategoryRule, error) {
+	compiled := compiledCategoryRule{rule: rule}
+
+	var regex bool
+	switch rule.Match {
+	case "", "glob":
+	case "regex":
+		regex = true
+	default:
+		return compiled, fmt.Errorf("unknown match type %q (use glob or regex)", rule.Match)
+	}
+
+	var err error
+	if compiled.name, err = compilePattern(rule.Name, regex, true); err != nil {
+		return compiled, fmt.Errorf("name: %w", err)
+	}
+	if compiled.cmdline, err = compilePattern(rule.Cmdline, regex, false); err != nil {
+		return compiled, fmt.Errorf("cmdline: %w", err)
+	}
+	if compiled.cwd, err = compilePattern(rule.Cwd, regex, false); err != nil {
+		return compiled, fmt.Errorf("cwd: %w", err)
+	}
+	if compiled.user, err = compilePattern(rule.User, regex, false); err != nil {
+		return compiled, fmt.Errorf("user: %w", err)
+	}
+	return compiled, nil
+}
+
+// compilePattern compiles a glob or regular expression; globs are anchored to the whole value
+func compilePattern(pattern string, regex, ignoreCase bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if regex {
+		return regexp.Compile(pattern)
+	}
+
+	var b strings.Builder
+	if ignoreCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Categorize returns the category and labels of the first matching rule, or "other"
+func (c *Categorizer) Categorize(in CategoryInput) CategoryResult {
+	user := in.User
+	userLoaded := user != ""
+
+	for _, r := range c.rules {
+		if r.name != nil && !r.name.MatchString(in.Name) {
+			continue
+		}
+		if r.cmdline != nil && !r.cmdline.MatchString(in.Cmdline) {
+			continue
+		}
+		if r.cwd != nil && !r.cwd.MatchString(in.Cwd) {
+			continue
+		}
+		if r.user != nil {
+			if !userLoaded && c.lookupUser != nil {
+				user = c.lookupUser(in.PID)
+				userLoaded = true
+			}
+			if !r.user.MatchString(user) {
+				continue
+			}
+		}
+
+		return CategoryResult{
+			Category: r.rule.Category,
+			Labels:   copyLabels(r.rule.Labels),
+			Rule:     r.describe(),
+		}
+	}
+
+	return CategoryResult{Category: "other"}
+}
+
+// Describe returns the effective rules in evaluation order as human readable lines
+func (c *Categorizer) Describe() []string {
+	lines := make([]string, 0, len(c.rules))
+	for _, r := range c.rules {
+		line := r.describe() + " -> " + r.rule.Category
+		if len(r.rule.Labels) > 0 {
+			line += " [" + FormatLabels(r.rule.Labels) + "]"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// describe returns a short description of the rule for dry-run output
+func (r compiledCategoryRule) describe() string {
+	var parts []string
+	if r.rule.Name != "" {
+		parts = append(parts, "name="+r.rule.Name)
+	}
+	if r.rule.Cmdline != "" {
+		parts = append(parts, "cmdline="+r.rule.Cmdline)
+	}
+	if r.rule.Cwd != "" {
+		parts = append(parts, "cwd="+r.rule.Cwd)
+	}
+	if r.rule.User != "" {
+		parts = append(parts, "user="+r.rule.User)
+	}
+	desc := strings.Join(parts, " ")
+	if r.rule.Match == "regex" {
+		desc += " (regex)"
+	}
+	if r.builtin {
+		desc = "builtin: " + desc
+	}
+	return desc
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// FormatLabels encodes labels as "key=value;key=value" with sorted keys
+// Separator characters inside keys and values are replaced with "_"
+func FormatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	clean := strings.NewReplacer(",", "_", ";", "_", "=", "_", "\n", "_")
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, clean.Replace(k)+"="+clean.Replace(labels[k]))
+	}
+	return strings.Join(pairs, ";")
+}
+
+// ParseLabels decodes labels written by FormatLabels
+func ParseLabels(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			continue
+		}
+		labels[k] = v
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
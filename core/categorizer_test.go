@@ -0,0 +1,175 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCategorizer creates a categorizer with a deterministic user lookup
+func newTestCategorizer(t *testing.T, config CategoriesConfig) *Categorizer {
+	t.Helper()
+	c, err := NewCategorizer(config, true)
+	if err != nil {
+		t.Fatalf("Failed to create categorizer: %v", err)
+	}
+	c.lookupUser = func(pid int32) string {
+		if pid == 100 {
+			return "batch"
+		}
+		return "alice"
+	}
+	return c
+}
+
+// TestCategorizer_Builtin tests that built-in rules no longer match on substrings
+func TestCategorizer_Builtin(t *testing.T) {
+	c := newTestCategorizer(t, CategoriesConfig{})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"go", "development"},
+		{"cargo", "development"},
+		{"python3.11", "development"},
+		{"code-insiders", "development"},
+		{"mongod", "database"},
+		{"gocryptfs", "other"},
+		{"firefox-esr", "browser"},
+		{"bash", "system"},
+		{"my-service", "other"},
+	}
+
+	for _, tt := range tests {
+		if got := c.Categorize(CategoryInput{Name: tt.name}).Category; got != tt.want {
+			t.Errorf("Categorize(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if got := IdentifyApplication("mongod", "", true); got != "database" {
+		t.Errorf("IdentifyApplication(mongod) = %s, want database", got)
+	}
+	if got := IdentifyApplication("go", "", false); got != "other" {
+		t.Errorf("IdentifyApplication with smart categories disabled = %s, want other", got)
+	}
+}
+
+// TestCategorizer_UserRules tests that user rules are evaluated in order before built-in rules
+func TestCategorizer_UserRules(t *testing.T) {
+	c := newTestCategorizer(t, CategoriesConfig{
+		Rules: []CategoryRule{
+			{Name: "billing-*", Category: "service", Labels: map[string]string{"team": "payments"}},
+			{Cmdline: `^/opt/jobs/\w+\.py`, Match: "regex", Category: "batch"},
+			{Name: "python*", Cwd: "/srv/*", Category: "service"},
+			{User: "batch", Category: "batch", Labels: map[string]string{"owner": "batch"}},
+			{Name: "go", Category: "toolchain"},
+		},
+	})
+
+	tests := []struct {
+		in       CategoryInput
+		category string
+		labels   string
+	}{
+		{CategoryInput{PID: 1, Name: "Billing-API"}, "service", "team=payments"},
+		{CategoryInput{PID: 2, Name: "python3", Cmdline: "/opt/jobs/report.py --daily"}, "batch", ""},
+		{CategoryInput{PID: 3, Name: "python3", Cwd: "/srv/app"}, "service", ""},
+		{CategoryInput{PID: 4, Name: "python3", Cwd: "/home/alice"}, "development", ""},
+		{CategoryInput{PID: 100, Name: "worker"}, "batch", "owner=batch"},
+		{CategoryInput{PID: 5, Name: "go"}, "toolchain", ""},
+	}
+
+	for _, tt := range tests {
+		got := c.Categorize(tt.in)
+		if got.Category != tt.category {
+			t.Errorf("Categorize(%+v) category = %s, want %s", tt.in, got.Category, tt.category)
+		}
+		if FormatLabels(got.Labels) != tt.labels {
+			t.Errorf("Categorize(%+v) labels = %q, want %q", tt.in, FormatLabels(got.Labels), tt.labels)
+		}
+		if got.Rule == "" {
+			t.Errorf("Categorize(%+v) expected a matching rule description", tt.in)
+		}
+	}
+
+	// Labels returned to callers must not alias the rule's labels
+	result := c.Categorize(CategoryInput{Name: "billing-api"})
+	result.Labels["team"] = "changed"
+	if again := c.Categorize(CategoryInput{Name: "billing-api"}); again.Labels["team"] != "payments" {
+		t.Error("Expected rule labels to be unaffected by callers")
+	}
+}
+
+// TestCategorizer_DisableBuiltin tests that built-in rules can be turned off
+func TestCategorizer_DisableBuiltin(t *testing.T) {
+	c := newTestCategorizer(t, CategoriesConfig{DisableBuiltin: true})
+	if got := c.Categorize(CategoryInput{Name: "bash"}); got.Category != "other" || got.Rule != "" {
+		t.Errorf("Expected other without built-in rules, got %+v", got)
+	}
+}
+
+// TestCategorizer_InvalidRules tests that invalid rules are rejected
+func TestCategorizer_InvalidRules(t *testing.T) {
+	invalid := []CategoryRule{
+		{Name: "foo"},
+		{Name: "(", Match: "regex", Category: "x"},
+		{Name: "foo", Match: "prefix", Category: "x"},
+	}
+	for _, rule := range invalid {
+		if err := ValidateCategoriesConfig(CategoriesConfig{Rules: []CategoryRule{rule}}); err == nil {
+			t.Errorf("Expected error for rule %+v", rule)
+		}
+	}
+
+	config := GetDefaultConfig()
+	config.Categories.Rules = []CategoryRule{{Cmdline: "(", Match: "regex", Category: "x"}}
+	if err := ValidateConfig(config); err == nil {
+		t.Error("Expected ValidateConfig to reject invalid category rules")
+	}
+}
+
+// TestFormatLabels tests label encoding and decoding
+func TestFormatLabels(t *testing.T) {
+	labels := map[string]string{"team": "payments", "env": "prod,eu"}
+	encoded := FormatLabels(labels)
+	if encoded != "env=prod_eu;team=payments" {
+		t.Errorf("Unexpected encoding: %q", encoded)
+	}
+
+	decoded := ParseLabels(encoded)
+	if len(decoded) != 2 || decoded["team"] != "payments" || decoded["env"] != "prod_eu" {
+		t.Errorf("Unexpected decoding: %+v", decoded)
+	}
+
+	if FormatLabels(nil) != "" || ParseLabels("") != nil {
+		t.Error("Expected empty labels to round trip as empty")
+	}
+}
+
+// TestLabelsStorageRoundTrip tests that labels survive the CSV format
+func TestLabelsStorageRoundTrip(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-labels.log")
+	defer os.Remove(tmpFile)
+
+	manager := NewManager(tmpFile, 1, false, StorageConfig{})
+	record := ResourceRecord{
+		Timestamp: time.Unix(1729000000, 0),
+		Name:      "billing-api",
+		Category:  "service",
+		Labels:    map[string]string{"team": "payments"},
+		PID:       4242,
+	}
+	if err := os.WriteFile(tmpFile, []byte(manager.formatRecord(record)), 0644); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+
+	records, err := manager.ReadRecords(tmpFile)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Failed to read records: %v (%d records)", err, len(records))
+	}
+	if records[0].Category != "service" || records[0].Labels["team"] != "payments" {
+		t.Errorf("Unexpected record: category=%s labels=%+v", records[0].Category, records[0].Labels)
+	}
+}
@@ -0,0 +1,527 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster modes
+const (
+	ClusterAgent      = "agent"
+	ClusterAggregator = "aggregator"
+)
+
+const (
+	hostsFile = "hosts.json"
+
+	defaultClusterListen = ":9998"
+	defaultAgentSpoolMB  = 200
+
+	// ingestPath is where the aggregator accepts batches from agents
+	ingestPath = "/v1/ingest"
+
+	// A batch may be at most ingestMaxBodyBytes on the wire and ingestMaxDecodedBytes decompressed
+	ingestMaxBodyBytes    = 32 << 20
+	ingestMaxDecodedBytes = 256 << 20
+
+	// hostsStatsInterval throttles publishing the host registry for the web server and status
+	hostsStatsInterval = 5 * time.Second
+
+	// fleetWindow is how far back the fleet overview looks for each host's latest processes
+	fleetWindow = 5 * time.Minute
+)
+
+// hostNamePattern limits host names to what is safe in URLs, file names and metric labels
+var hostNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,252}$`)
+
+// ValidateHostName checks a host name given by an agent or in a host filter
+func ValidateHostName(host string) error {
+	if !hostNamePattern.MatchString(host) {
+		return fmt.Errorf("invalid host %q (letters, digits, '.', '_', ':' and '-')", host)
+	}
+	return nil
+}
+
+// ClusterConfig configures multi-host tracking
+// Agents collect as usual, keep their local store and ship every snapshot to the aggregator;
+// the aggregator stores the records of all hosts, tagged with the host they came from.
+type ClusterConfig struct {
+	Mode           string `yaml:"mode"`            // "" (standalone), agent or aggregator
+	Host           string `yaml:"host"`            // Name this machine's records are stored under (default: the hostname)
+	Aggregator     string `yaml:"aggregator"`      // agent: aggregator base URL, e.g. https://tracker.example.com:9998
+	Listen         string `yaml:"listen"`          // aggregator: address agents connect to (default: :9998)
+	Token          string `yaml:"token"`           // Shared secret, sent as "Authorization: Bearer <token>"
+	TLSCert        string `yaml:"tls_cert"`        // aggregator: serve agents over HTTPS with this certificate
+	TLSKey         string `yaml:"tls_key"`         // aggregator: private key of tls_cert
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // agent: per request (default: 5)
+	FlushSeconds   int    `yaml:"flush_seconds"`   // agent: snapshots are shipped together at this interval (default: 15)
+	MaxRetries     int    `yaml:"max_retries"`     // agent: attempts before a batch is spooled (default: 5)
+	SpoolPath      string `yaml:"spool_path"`      // agent: spool file (default: push-aggregator.jsonl next to the data file)
+	SpoolMaxMB     int    `yaml:"spool_max_mb"`    // agent: spool size limit; batches beyond it are dropped (default: 200)
+}
+
+// Enabled reports whether the tracker runs as an agent or an aggregator
+func (c ClusterConfig) Enabled() bool {
+	return c.Mode == ClusterAgent || c.Mode == ClusterAggregator
+}
+
+// HostName returns the name records of this machine are stored under
+func (c ClusterConfig) HostName() string {
+	if c.Host != "" {
+		return c.Host
+	}
+	return sinkHostname()
+}
+
+func (c ClusterConfig) listen() string {
+	if c.Listen != "" {
+		return c.Listen
+	}
+	return defaultClusterListen
+}
+
+// sinkConfig describes the agent's shipping as a push sink
+func (c ClusterConfig) sinkConfig() SinkConfig {
+	config := SinkConfig{
+		Name:           "aggregator",
+		Type:           "cluster",
+		URL:            strings.TrimRight(c.Aggregator, "/") + ingestPath,
+		Token:          c.Token,
+		TimeoutSeconds: c.TimeoutSeconds,
+		FlushSeconds:   c.FlushSeconds,
+		MaxRetries:     c.MaxRetries,
+		SpoolPath:      c.SpoolPath,
+		SpoolMaxMB:     c.SpoolMaxMB,
+	}
+	if config.FlushSeconds <= 0 {
+		config.FlushSeconds = defaultPushFlushSeconds
+	}
+	if config.SpoolMaxMB <= 0 {
+		config.SpoolMaxMB = defaultAgentSpoolMB
+	}
+	return config
+}
+
+// ValidateClusterConfig checks the mode and the settings it needs
+func ValidateClusterConfig(c ClusterConfig) error {
+	switch c.Mode {
+	case "":
+		return nil
+	case ClusterAgent:
+		u, err := url.Parse(c.Aggregator)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("cluster: aggregator must be an http(s):// URL of the aggregator")
+		}
+	case ClusterAggregator:
+		if _, _, err := net.SplitHostPort(c.listen()); err != nil {
+			return fmt.Errorf("cluster: listen must be [host]:port: %v", err)
+		}
+		if (c.TLSCert == "") != (c.TLSKey == "") {
+			return fmt.Errorf("cluster: tls_cert and tls_key must be set together")
+		}
+	default:
+		return fmt.Errorf("cluster: unknown mode %q (use agent or aggregator)", c.Mode)
+	}
+	if c.Token == "" {
+		return fmt.Errorf("cluster: token is required in %s mode", c.Mode)
+	}
+	if c.Host != "" {
+		if err := ValidateHostName(c.Host); err != nil {
+			return fmt.Errorf("cluster: %w", err)
+		}
+	}
+	if c.TimeoutSeconds < 0 || c.FlushSeconds < 0 || c.MaxRetries < 0 || c.SpoolMaxMB < 0 {
+		return fmt.Errorf("cluster: timeouts, retries and sizes must be non-negative")
+	}
+	return nil
+}
+
+// LocalHost returns the host this machine's records are stored under, "" when standalone
+func (a *App) LocalHost() string {
+	if !a.Config.Cluster.Enabled() {
+		return ""
+	}
+	return a.Config.Cluster.HostName()
+}
+
+// IsLocalHost reports whether a host filter selects this machine ("" selects every host)
+// Host metrics and process events are only kept for the local machine.
+func (a *App) IsLocalHost(host string) bool {
+	return host == "" || host == a.LocalHost()
+}
+
+// ingestBatch is the body of a POST to the aggregator's ingest endpoint
+type ingestBatch struct {
+	Host            string           `json:"host"`
+	IntervalSeconds int              `json:"interval_seconds,omitempty"`
+	FlushSeconds    int              `json:"flush_seconds,omitempty"`
+	Records         []ResourceRecord `json:"records"`
+}
+
+// agentSink ships snapshots to the aggregator through a spooling write pipeline, so records
+// collected while the aggregator is unreachable are delivered once it is back
+type agentSink struct {
+	pipeline *WritePipeline
+}
+
+func newAgentSink(cluster ClusterConfig, interval time.Duration, dataDir string) *agentSink {
+	config := cluster.sinkConfig()
+	shipper := &agentShipper{
+		target:   newPushTarget(config, MetricsConfig{}),
+		host:     cluster.HostName(),
+		interval: int(interval / time.Second),
+		flush:    config.FlushSeconds,
+	}
+	return &agentSink{pipeline: startPushPipeline(config, shipper, dataDir)}
+}
+
+// Write queues the snapshot without blocking
+func (s *agentSink) Write(records []ResourceRecord) error {
+	s.pipeline.Enqueue(append([]ResourceRecord(nil), records...))
+	return nil
+}
+
+// Close ships what is queued; anything the aggregator does not accept stays in the spool
+func (s *agentSink) Close() error {
+	return s.pipeline.Close()
+}
+
+func (s *agentSink) pipelineStats() WriteStats {
+	return s.pipeline.Stats()
+}
+
+// agentShipper posts batches to the aggregator as gzip-compressed JSON
+type agentShipper struct {
+	target   pushTarget
+	host     string
+	interval int
+	flush    int
+}
+
+func (s *agentShipper) SaveRecords(records []ResourceRecord) error {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	err := json.NewEncoder(zw).Encode(ingestBatch{
+		Host:            s.host,
+		IntervalSeconds: s.interval,
+		FlushSeconds:    s.flush,
+		Records:         records,
+	})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode batch: %w", err)}
+	}
+	return s.target.post(body.Bytes(), map[string]string{
+		"Content-Type":     "application/json",
+		"Content-Encoding": "gzip",
+	})
+}
+
+// StartCluster starts the aggregator's listener for agent batches
+// Agents need no listener: they ship through a sink added by StartSinks.
+func (a *App) StartCluster() error {
+	if a.Config.Cluster.Mode != ClusterAggregator || a.ingest != nil {
+		return nil
+	}
+	cluster := a.Config.Cluster
+	listener, err := net.Listen("tcp", cluster.listen())
+	if err != nil {
+		return fmt.Errorf("failed to listen for agents: %w", err)
+	}
+	server := &http.Server{
+		Handler:           a.ingestHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	go func() {
+		var err error
+		if cluster.TLSCert != "" {
+			err = server.ServeTLS(listener, cluster.TLSCert, cluster.TLSKey)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: agent listener stopped: %v", err)
+		}
+	}()
+	a.ingest = server
+	log.Printf("Aggregator accepting agents on %s as host %s", listener.Addr(), cluster.HostName())
+	return nil
+}
+
+// stopCluster stops accepting agent batches and publishes the host registry
+func (a *App) stopCluster() {
+	if a.ingest != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a.ingest.Shutdown(ctx)
+		cancel()
+		a.ingest = nil
+	}
+	if a.hosts != nil {
+		a.hosts.publish(true)
+	}
+}
+
+// ingestHandler accepts record batches from agents
+// Records are written to the primary store only; the aggregator's sinks carry its own snapshots.
+// Agents resend a batch whose response they did not get, so delivery is at least once; the
+// SQLite store ignores a sample it already has for the same process and timestamp.
+func (a *App) ingestHandler() http.Handler {
+	if a.hosts == nil {
+		a.hosts = newHostRegistry(filepath.Join(filepath.Dir(a.DataFile), hostsFile))
+	}
+	token := []byte(a.Config.Cluster.Token)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ingestPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), token) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		var body io.Reader = http.MaxBytesReader(w, r.Body, ingestMaxBodyBytes)
+		switch r.Header.Get("Content-Encoding") {
+		case "", "identity":
+		case "gzip":
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = io.LimitReader(zr, ingestMaxDecodedBytes)
+		default:
+			http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var batch ingestBatch
+		if err := json.NewDecoder(body).Decode(&batch); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, "invalid batch: "+err.Error(), status)
+			return
+		}
+		if err := ValidateHostName(batch.Host); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if batch.Host == a.LocalHost() {
+			http.Error(w, fmt.Sprintf("host %q is the aggregator itself", batch.Host), http.StatusConflict)
+			return
+		}
+
+		// Every record is stored under the host named by the batch. All agents share one
+		// token, so this only keeps a batch to one host: any agent can claim any host name
+		// except the aggregator's own.
+		for i := range batch.Records {
+			batch.Records[i].Host = batch.Host
+		}
+		if len(batch.Records) > 0 {
+			if err := a.storeRecords(batch.Records); err != nil {
+				log.Printf("Warning: failed to store %d records from %s: %v", len(batch.Records), batch.Host, err)
+				http.Error(w, "failed to store records", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		address, _, _ := net.SplitHostPort(r.RemoteAddr)
+		a.hosts.observe(HostInfo{
+			Host:            batch.Host,
+			Role:            ClusterAgent,
+			Address:         address,
+			IntervalSeconds: batch.IntervalSeconds,
+			FlushSeconds:    batch.FlushSeconds,
+		}, len(batch.Records))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// storeRecords saves records to the primary store, queued when the write pipeline is running
+func (a *App) storeRecords(records []ResourceRecord) error {
+	if a.writer != nil {
+		a.writer.Enqueue(records)
+		return nil
+	}
+	return a.storage.SaveRecords(records)
+}
+
+// HostInfo describes a host known to the aggregator
+type HostInfo struct {
+	Host            string    `json:"host"`
+	Role            string    `json:"role,omitempty"`    // agent, or aggregator for the aggregator itself
+	Address         string    `json:"address,omitempty"` // Address the last batch came from
+	LastSeen        time.Time `json:"last_seen"`
+	IntervalSeconds int       `json:"interval_seconds,omitempty"` // Collection interval
+	FlushSeconds    int       `json:"flush_seconds,omitempty"`    // Shipping interval
+	Batches         int64     `json:"batches"`
+	Records         int64     `json:"records"`
+}
+
+// Online reports whether the host has reported recently
+// A host is stale after missing about three shipments.
+func (h HostInfo) Online(now time.Time) bool {
+	expected := time.Duration(h.IntervalSeconds+h.FlushSeconds) * time.Second
+	if expected < 20*time.Second {
+		expected = 20 * time.Second
+	}
+	return now.Sub(h.LastSeen) <= 3*expected
+}
+
+// hostRegistry tracks the hosts reporting to the aggregator and publishes them to hosts.json
+type hostRegistry struct {
+	mu          sync.Mutex
+	hosts       map[string]*HostInfo
+	path        string
+	lastPublish time.Time
+}
+
+// newHostRegistry starts from the hosts published before a restart
+func newHostRegistry(path string) *hostRegistry {
+	r := &hostRegistry{hosts: make(map[string]*HostInfo), path: path}
+	var hosts []HostInfo
+	if readJSONFile(path, &hosts) == nil {
+		for i := range hosts {
+			r.hosts[hosts[i].Host] = &hosts[i]
+		}
+	}
+	return r
+}
+
+// observe records a batch of records from a host
+func (r *hostRegistry) observe(info HostInfo, records int) {
+	r.mu.Lock()
+	host, ok := r.hosts[info.Host]
+	if !ok {
+		host = &HostInfo{Host: info.Host}
+		r.hosts[info.Host] = host
+	}
+	host.Role = info.Role
+	host.Address = info.Address
+	host.IntervalSeconds = info.IntervalSeconds
+	host.FlushSeconds = info.FlushSeconds
+	host.LastSeen = time.Now()
+	host.Batches++
+	host.Records += int64(records)
+	r.mu.Unlock()
+
+	r.publish(false)
+}
+
+// list returns the known hosts ordered by name
+func (r *hostRegistry) list() []HostInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hosts := make([]HostInfo, 0, len(r.hosts))
+	for _, h := range r.hosts {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts
+}
+
+// publish saves the registry, at most every hostsStatsInterval unless forced
+func (r *hostRegistry) publish(force bool) {
+	r.mu.Lock()
+	if !force && time.Since(r.lastPublish) < hostsStatsInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastPublish = time.Now()
+	r.mu.Unlock()
+	writeJSONAtomic(r.path, r.list())
+}
+
+// ReadHostInfo reads the host registry last published by the aggregator writing dataFile
+func ReadHostInfo(dataFile string) ([]HostInfo, error) {
+	var hosts []HostInfo
+	err := readJSONFile(filepath.Join(filepath.Dir(dataFile), hostsFile), &hosts)
+	return hosts, err
+}
+
+// HostSummary is one row of the fleet overview
+type HostSummary struct {
+	HostInfo
+	Online     bool    `json:"online"`
+	Processes  int     `json:"processes"`   // Processes seen in the last few minutes
+	CPUPercent float64 `json:"cpu_percent"` // Sum over those processes' latest samples
+	MemoryMB   float64 `json:"memory_mb"`
+}
+
+// FleetOverview summarizes every host: registry state plus its latest processes
+// Hosts with stored records but no registry entry (e.g. records from before the aggregator
+// started publishing) are listed with the time of their newest record.
+func (a *App) FleetOverview() ([]HostSummary, error) {
+	known := make(map[string]*HostSummary)
+	hosts, err := a.knownHosts()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, h := range hosts {
+		known[h.Host] = &HostSummary{HostInfo: h}
+	}
+
+	records, err := a.GetLatestProcesses(fleetWindow, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		summary, ok := known[r.Host]
+		if !ok {
+			summary = &HostSummary{HostInfo: HostInfo{Host: r.Host, IntervalSeconds: int(a.Interval / time.Second)}}
+			known[r.Host] = summary
+		}
+		summary.Processes++
+		summary.CPUPercent += r.CPUPercent
+		summary.MemoryMB += r.MemoryMB
+		if summary.Role == "" && summary.Batches == 0 && r.Timestamp.After(summary.LastSeen) {
+			summary.LastSeen = r.Timestamp
+		}
+	}
+
+	now := time.Now()
+	fleet := make([]HostSummary, 0, len(known))
+	for _, summary := range known {
+		summary.Online = summary.HostInfo.Online(now)
+		fleet = append(fleet, *summary)
+	}
+	sort.Slice(fleet, func(i, j int) bool { return fleet[i].Host < fleet[j].Host })
+	return fleet, nil
+}
+
+// knownHosts returns the registry: live in the aggregator daemon, published otherwise
+func (a *App) knownHosts() ([]HostInfo, error) {
+	if a.hosts != nil {
+		return a.hosts.list(), nil
+	}
+	return ReadHostInfo(a.DataFile)
+}
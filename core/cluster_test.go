@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAggregator returns an aggregator app on SQLite and a server for its ingest endpoint
+func newTestAggregator(t *testing.T) (*App, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	config := GetDefaultConfig()
+	config.Storage.Type = "sqlite"
+	config.Storage.SQLitePath = filepath.Join(dir, "aggregator.db")
+	config.Cluster = ClusterConfig{Mode: ClusterAggregator, Host: "hub", Token: "secret"}
+
+	app := NewApp(filepath.Join(dir, "process-tracker.log"), 5*time.Second, config)
+	if err := app.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	server := httptest.NewServer(app.ingestHandler())
+	t.Cleanup(func() {
+		server.Close()
+		app.CloseFile()
+	})
+	return app, server
+}
+
+func postBatch(t *testing.T, url, token string, batch ingestBatch) int {
+	t.Helper()
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	json.NewEncoder(zw).Encode(batch)
+	zw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, url+ingestPath, &body)
+	req.Header.Set("Content-Encoding", "gzip")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestIngestHandler tests authentication, host validation and that records are stored under
+// the host of the batch
+func TestIngestHandler(t *testing.T) {
+	app, server := newTestAggregator(t)
+	now := time.Now().Truncate(time.Second)
+
+	records := sinkTestRecords(now)
+	records[0].Host = "spoofed"
+	batch := ingestBatch{Host: "web-1", IntervalSeconds: 5, FlushSeconds: 15, Records: records}
+
+	if status := postBatch(t, server.URL, "", batch); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", status)
+	}
+	if status := postBatch(t, server.URL, "wrong", batch); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", status)
+	}
+	if status := postBatch(t, server.URL, "secret", ingestBatch{Host: "bad host", Records: records}); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid host, got %d", status)
+	}
+	if status := postBatch(t, server.URL, "secret", ingestBatch{Host: "hub", Records: records}); status != http.StatusConflict {
+		t.Errorf("Expected 409 for the aggregator's own host, got %d", status)
+	}
+	if status := postBatch(t, server.URL, "secret", batch); status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	// A batch resent after a lost response is stored once
+	if status := postBatch(t, server.URL, "secret", batch); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 for a resent batch, got %d", status)
+	}
+
+	got, err := app.QueryRecords(context.Background(), RecordQuery{Hosts: []string{"web-1"}})
+	if err != nil {
+		t.Fatalf("QueryRecords failed: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("Expected %d records for web-1, got %d", len(records), len(got))
+	}
+	for _, r := range got {
+		if r.Host != "web-1" {
+			t.Errorf("Expected every record stored under web-1, got %q", r.Host)
+		}
+	}
+	if spoofed, _ := app.QueryRecords(context.Background(), RecordQuery{Hosts: []string{"spoofed"}}); len(spoofed) != 0 {
+		t.Errorf("Expected no records under the spoofed host, got %d", len(spoofed))
+	}
+
+	fleet, err := app.FleetOverview()
+	if err != nil {
+		t.Fatalf("FleetOverview failed: %v", err)
+	}
+	if len(fleet) != 1 || fleet[0].Host != "web-1" || fleet[0].Role != ClusterAgent || !fleet[0].Online {
+		t.Fatalf("Expected web-1 online in the fleet, got %+v", fleet)
+	}
+	// The registry counts what was received, the resent batch included
+	if fleet[0].Processes != 3 || fleet[0].Records != 6 || fleet[0].Batches != 2 {
+		t.Errorf("Unexpected fleet summary: %+v", fleet[0])
+	}
+
+	// The registry is published for the web process and 'status'
+	app.stopCluster()
+	hosts, err := ReadHostInfo(app.DataFile)
+	if err != nil || len(hosts) != 1 || hosts[0].Host != "web-1" {
+		t.Errorf("Expected web-1 in the published registry, got %+v (%v)", hosts, err)
+	}
+}
+
+// TestAgentSink_SpoolAndDeliver tests that snapshots taken while the aggregator is down are
+// spooled and delivered, in order, once it is reachable
+func TestAgentSink_SpoolAndDeliver(t *testing.T) {
+	app, server := newTestAggregator(t)
+	dir := t.TempDir()
+	first := time.Now().Add(-time.Minute).Truncate(time.Second)
+	second := first.Add(10 * time.Second)
+
+	cluster := ClusterConfig{Mode: ClusterAgent, Host: "web-2", Aggregator: "http://127.0.0.1:1", Token: "secret", MaxRetries: 1}
+	down := newAgentSink(cluster, 5*time.Second, dir)
+	down.Write(sinkTestRecords(first))
+	down.Close()
+	if stats := down.pipelineStats(); stats.JournalRecords != 3 {
+		t.Errorf("Expected 3 spooled records, got %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "push-aggregator.jsonl")); err != nil {
+		t.Fatalf("Expected spool file: %v", err)
+	}
+
+	cluster.Aggregator = server.URL + "/"
+	up := newAgentSink(cluster, 5*time.Second, dir)
+	up.Write(sinkTestRecords(second))
+	up.Close()
+
+	got, err := app.QueryRecords(context.Background(), RecordQuery{Hosts: []string{"web-2"}, Names: []string{"nginx"}, OrderBy: "timestamp"})
+	if err != nil {
+		t.Fatalf("QueryRecords failed: %v", err)
+	}
+	if len(got) != 4 || !got[0].Timestamp.Equal(first) || !got[3].Timestamp.Equal(second) {
+		t.Errorf("Expected both snapshots delivered, got %d records", len(got))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "push-aggregator.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("Expected spool removed after delivery")
+	}
+}
+
+// TestValidateClusterConfig tests the settings each mode requires
+func TestValidateClusterConfig(t *testing.T) {
+	tests := []struct {
+		config ClusterConfig
+		err    string
+	}{
+		{ClusterConfig{}, ""},
+		{ClusterConfig{Mode: ClusterAgent, Aggregator: "https://hub:9998", Token: "t"}, ""},
+		{ClusterConfig{Mode: ClusterAggregator, Token: "t"}, ""},
+		{ClusterConfig{Mode: "leader", Token: "t"}, "unknown mode"},
+		{ClusterConfig{Mode: ClusterAgent, Aggregator: "hub:9998", Token: "t"}, "aggregator must be"},
+		{ClusterConfig{Mode: ClusterAgent, Aggregator: "http://hub:9998"}, "token is required"},
+		{ClusterConfig{Mode: ClusterAggregator, Token: "t", TLSCert: "cert.pem"}, "tls_key"},
+		{ClusterConfig{Mode: ClusterAggregator, Token: "t", Host: "db 1"}, "invalid host"},
+	}
+	for _, tt := range tests {
+		err := ValidateClusterConfig(tt.config)
+		if tt.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.config, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.config, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath returns the default configuration file path (~/.process-tracker/config.yaml)
+func DefaultConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "config.yaml"
+	}
+	return filepath.Join(homeDir, ".process-tracker", "config.yaml")
+}
+
+// LoadConfig reads a YAML configuration file on top of the given defaults
+// Keys missing from the file keep their default values. A missing file is not
+// an error: the defaults are returned unchanged
+func LoadConfig(path string, defaults Config) (Config, error) {
+	config := defaults
+
+	data, err := os.ReadFile(expandHomePath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return defaults, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// expandHomePath expands environment variables and a leading ~ in a path
+func expandHomePath(path string) string {
+	path = os.ExpandEnv(path)
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// FilterConfig controls which processes are recorded
+// A process is recorded when it is not a kernel thread (unless allowed),
+// matches at least one include rule (if any are configured) and matches no exclude rule
+type FilterConfig struct {
+	SkipKernelThreads bool         `yaml:"skip_kernel_threads"` // Drop kernel threads (default: true)
+	Include           []FilterRule `yaml:"include"`             // Keep only processes matching any of these rules
+	Exclude           []FilterRule `yaml:"exclude"`             // Drop processes matching any of these rules
+}
+
+// FilterRule matches processes; all conditions set in a rule must match
+type FilterRule struct {
+	Name        string  `yaml:"name"`          // Process name, exact or glob (e.g. "chrome*"), case-insensitive
+	Cmdline     string  `yaml:"cmdline"`       // Regular expression matched against the full command line
+	User        string  `yaml:"user"`          // Owner user name
+	Cgroup      string  `yaml:"cgroup"`        // Substring of the cgroup path (e.g. "system.slice/nginx.service")
+	MinCPU      float64 `yaml:"min_cpu"`       // Matches when CPU% >= value
+	MinMemoryMB float64 `yaml:"min_memory_mb"` // Matches when memory >= value (MB)
+}
+
+// GetDefaultFilterConfig returns the default filters: kernel threads and the init system are skipped
+func GetDefaultFilterConfig() FilterConfig {
+	return FilterConfig{
+		SkipKernelThreads: true,
+		Exclude: []FilterRule{
+			{Name: "systemd"}, // init system (too many instances)
+			{Name: "init"},    // legacy init
+		},
+	}
+}
+
+// String returns a human readable description of the rule
+func (r FilterRule) String() string {
+	var parts []string
+	if r.Name != "" {
+		parts = append(parts, fmt.Sprintf("name=%s", r.Name))
+	}
+	if r.Cmdline != "" {
+		parts = append(parts, fmt.Sprintf("cmdline=~/%s/", r.Cmdline))
+	}
+	if r.User != "" {
+		parts = append(parts, fmt.Sprintf("user=%s", r.User))
+	}
+	if r.Cgroup != "" {
+		parts = append(parts, fmt.Sprintf("cgroup~%s", r.Cgroup))
+	}
+	if r.MinCPU > 0 {
+		parts = append(parts, fmt.Sprintf("cpu>=%.1f%%", r.MinCPU))
+	}
+	if r.MinMemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("memory>=%.0fMB", r.MinMemoryMB))
+	}
+	if len(parts) == 0 {
+		return "(matches everything)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// compiledRule is a FilterRule with its regular expression compiled
+type compiledRule struct {
+	FilterRule
+	name    string
+	cmdline *regexp.Regexp
+}
+
+// ProcessFilter decides which processes are recorded
+type ProcessFilter struct {
+	config  FilterConfig
+	include []compiledRule
+	exclude []compiledRule
+
+	// Lookups for attributes not present in the record; replaceable in tests
+	isKernelThread func(pid int32) bool
+	lookupUser     func(pid int32) string
+	lookupCgroup   func(pid int32) string
+}
+
+// NewProcessFilter compiles the filter configuration
+func NewProcessFilter(config FilterConfig) (*ProcessFilter, error) {
+	f := &ProcessFilter{
+		config:         config,
+		isKernelThread: isKernelThread,
+		lookupUser:     processUsername,
+		lookupCgroup:   processCgroup,
+	}
+
+	var err error
+	if f.include, err = compileRules(config.Include); err != nil {
+		return nil, fmt.Errorf("invalid include rule: %w", err)
+	}
+	if f.exclude, err = compileRules(config.Exclude); err != nil {
+		return nil, fmt.Errorf("invalid exclude rule: %w", err)
+	}
+	return f, nil
+}
+
+// ValidateFilterConfig checks that all filter rules compile
+func ValidateFilterConfig(config FilterConfig) error {
+	_, err := NewProcessFilter(config)
+	return err
+}
+
+func compileRules(rules []FilterRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{FilterRule: rule, name: strings.ToLower(rule.Name)}
+		if c.name != "" {
+			if _, err := path.Match(c.name, ""); err != nil {
+				return nil, fmt.Errorf("name pattern %q: %w", rule.Name, err)
+			}
+		}
+		if rule.Cmdline != "" {
+			re, err := regexp.Compile(rule.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("cmdline pattern %q: %w", rule.Cmdline, err)
+			}
+			c.cmdline = re
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// Allow reports whether a process should be recorded
+// name is the raw process name as reported by the OS
+func (f *ProcessFilter) Allow(name string, record ResourceRecord) bool {
+	if f.config.SkipKernelThreads && f.isKernelThread != nil && f.isKernelThread(record.PID) {
+		return false
+	}
+
+	subject := &filterSubject{filter: f, name: strings.ToLower(name), record: record}
+	if record.Username != "" {
+		subject.user = record.Username
+		subject.userLoaded = true
+	}
+
+	if len(f.include) > 0 {
+		included := false
+		for _, rule := range f.include {
+			if subject.matches(rule) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, rule := range f.exclude {
+		if subject.matches(rule) {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe returns the effective rules as human readable lines
+func (f *ProcessFilter) Describe() []string {
+	var lines []string
+	if f.config.SkipKernelThreads {
+		lines = append(lines, "skip kernel threads")
+	}
+	for _, rule := range f.config.Include {
+		lines = append(lines, "include: "+rule.String())
+	}
+	for _, rule := range f.config.Exclude {
+		lines = append(lines, "exclude: "+rule.String())
+	}
+	return lines
+}
+
+// filterSubject caches lazily looked-up attributes of a process while rules are evaluated
+type filterSubject struct {
+	filter *ProcessFilter
+	name   string
+	record ResourceRecord
+
+	user       string
+	userLoaded bool
+	cgroup     string
+	cgroupRead bool
+}
+
+func (s *filterSubject) matches(rule compiledRule) bool {
+	if rule.name != "" {
+		if ok, _ := path.Match(rule.name, s.name); !ok {
+			return false
+		}
+	}
+	if rule.cmdline != nil && !rule.cmdline.MatchString(s.record.Command) {
+		return false
+	}
+	if rule.MinCPU > 0 && s.record.CPUPercent < rule.MinCPU {
+		return false
+	}
+	if rule.MinMemoryMB > 0 && s.record.MemoryMB < rule.MinMemoryMB {
+		return false
+	}
+	if rule.User != "" {
+		if !s.userLoaded {
+			s.user = s.filter.lookupUser(s.record.PID)
+			s.userLoaded = true
+		}
+		if s.user != rule.User {
+			return false
+		}
+	}
+	if rule.Cgroup != "" {
+		if !s.cgroupRead {
+			s.cgroup = s.filter.lookupCgroup(s.record.PID)
+			s.cgroupRead = true
+		}
+		if !strings.Contains(s.cgroup, rule.Cgroup) {
+			return false
+		}
+	}
+	return true
+}
+
+// pfKthread is the PF_KTHREAD flag in /proc/[pid]/stat
+const pfKthread = 0x00200000
+
+// isKernelThread reports whether a PID is a kernel thread, using the PF_KTHREAD flag
+func isKernelThread(pid int32) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	return statHasKthreadFlag(string(data))
+}
+
+// statHasKthreadFlag parses the flags field (9th) of a /proc/[pid]/stat line
+// The command name (2nd field) may contain spaces, so fields are counted after the closing parenthesis
+func statHasKthreadFlag(stat string) bool {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return false
+	}
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] is state (3rd field); flags is the 9th field
+	if len(fields) < 7 {
+		return false
+	}
+	flags, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return false
+	}
+	return flags&pfKthread != 0
+}
+
+// processUsername returns the owner of a process
+func processUsername(pid int32) string {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return ""
+	}
+	uids, err := p.Uids()
+	if err != nil || len(uids) == 0 {
+		return ""
+	}
+	return usernameForUID(uids[0])
+}
+
+// processCgroup returns the cgroup paths of a process joined by newlines
+func processCgroup(pid int32) string {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) == 3 {
+			paths = append(paths, parts[2])
+		}
+	}
+	return strings.Join(paths, "\n")
+}
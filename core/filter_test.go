@@ -0,0 +1,152 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestFilter creates a filter with deterministic lookups
+func newTestFilter(t *testing.T, config FilterConfig) *ProcessFilter {
+	t.Helper()
+	f, err := NewProcessFilter(config)
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+	f.isKernelThread = func(pid int32) bool { return pid == 2 }
+	f.lookupUser = func(pid int32) string {
+		if pid == 100 {
+			return "postgres"
+		}
+		return "alice"
+	}
+	f.lookupCgroup = func(pid int32) string {
+		if pid == 100 {
+			return "/system.slice/postgresql.service"
+		}
+		return "/user.slice/user-1000.slice"
+	}
+	return f
+}
+
+// TestProcessFilter_Defaults tests that default filters no longer drop "md*" user programs
+func TestProcessFilter_Defaults(t *testing.T) {
+	f := newTestFilter(t, GetDefaultFilterConfig())
+
+	if !f.Allow("mdbook", ResourceRecord{PID: 10}) {
+		t.Error("Expected mdbook to be recorded")
+	}
+	if !f.Allow("mdadm", ResourceRecord{PID: 11}) {
+		t.Error("Expected mdadm to be recorded")
+	}
+	if f.Allow("kworker/0:1", ResourceRecord{PID: 2}) {
+		t.Error("Expected kernel thread to be skipped")
+	}
+	if f.Allow("systemd", ResourceRecord{PID: 12}) {
+		t.Error("Expected systemd to be skipped by default exclude rule")
+	}
+}
+
+// TestProcessFilter_IncludeExclude tests include and exclude rule evaluation
+func TestProcessFilter_IncludeExclude(t *testing.T) {
+	f := newTestFilter(t, FilterConfig{
+		Include: []FilterRule{
+			{Name: "python*"},
+			{User: "postgres"},
+			{MinMemoryMB: 500},
+		},
+		Exclude: []FilterRule{
+			{Cmdline: `--type=(renderer|gpu-process)`},
+			{Name: "python*", MinCPU: 0, Cgroup: "system.slice"},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		record ResourceRecord
+		want   bool
+	}{
+		{"python3", ResourceRecord{PID: 20, Command: "python3 train.py"}, true},
+		{"Python3", ResourceRecord{PID: 21, Command: "python3 app.py"}, true},
+		{"postgres", ResourceRecord{PID: 100, Command: "postgres -D /data"}, true},
+		{"chrome", ResourceRecord{PID: 22, MemoryMB: 800, Command: "chrome --type=renderer"}, false},
+		{"chrome", ResourceRecord{PID: 23, MemoryMB: 800, Command: "chrome"}, true},
+		{"bash", ResourceRecord{PID: 24, MemoryMB: 5}, false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Allow(tt.name, tt.record); got != tt.want {
+			t.Errorf("Allow(%s, pid=%d) = %v, want %v", tt.name, tt.record.PID, got, tt.want)
+		}
+	}
+}
+
+// TestProcessFilter_InvalidRules tests that invalid patterns are rejected
+func TestProcessFilter_InvalidRules(t *testing.T) {
+	if _, err := NewProcessFilter(FilterConfig{Exclude: []FilterRule{{Cmdline: "("}}}); err == nil {
+		t.Error("Expected error for invalid cmdline regex")
+	}
+	if _, err := NewProcessFilter(FilterConfig{Include: []FilterRule{{Name: "["}}}); err == nil {
+		t.Error("Expected error for invalid name glob")
+	}
+
+	config := GetDefaultConfig()
+	config.Filters.Exclude = []FilterRule{{Cmdline: "("}}
+	if err := ValidateConfig(config); err == nil {
+		t.Error("Expected ValidateConfig to reject invalid filters")
+	}
+}
+
+// TestStatHasKthreadFlag tests PF_KTHREAD detection from /proc/[pid]/stat
+func TestStatHasKthreadFlag(t *testing.T) {
+	kthread := "2 (kthreadd) S 0 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 20 0 1 0 3 0 0"
+	user := "1234 (my (odd) prog) S 1 1234 1234 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 100 0 0"
+
+	if !statHasKthreadFlag(kthread) {
+		t.Error("Expected kthreadd to be detected as kernel thread")
+	}
+	if statHasKthreadFlag(user) {
+		t.Error("Expected user process not to be detected as kernel thread")
+	}
+}
+
+// TestLoadConfig tests YAML loading on top of defaults
+func TestLoadConfig(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-config.yaml")
+	defer os.Remove(tmpFile)
+
+	content := `
+storage:
+  keep_days: 3
+filters:
+  exclude:
+    - name: "chrome*"
+    - cmdline: "--type=renderer"
+`
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(tmpFile, GetDefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Storage.KeepDays != 3 {
+		t.Errorf("Expected keep_days 3, got %d", config.Storage.KeepDays)
+	}
+	if config.Storage.MaxSizeMB != 100 {
+		t.Errorf("Expected default max_size_mb to be kept, got %d", config.Storage.MaxSizeMB)
+	}
+	if !config.Filters.SkipKernelThreads {
+		t.Error("Expected skip_kernel_threads default to be kept")
+	}
+	if len(config.Filters.Exclude) != 2 || config.Filters.Exclude[0].Name != "chrome*" {
+		t.Errorf("Unexpected exclude rules: %+v", config.Filters.Exclude)
+	}
+
+	// Missing file returns defaults
+	config, err = LoadConfig(filepath.Join(os.TempDir(), "nonexistent-config.yaml"), GetDefaultConfig())
+	if err != nil || config.Storage.KeepDays != 7 {
+		t.Errorf("Expected defaults for missing file, got err=%v keep_days=%d", err, config.Storage.KeepDays)
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphiteSink sends per-process-name aggregates in the Graphite plaintext protocol
+// (`prefix.host.name.metric value timestamp`) over a TCP connection kept open between
+// snapshots and re-dialed after an error
+type GraphiteSink struct {
+	config SinkConfig
+	host   string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGraphiteSink creates a sink for config.Address; it connects on the first write
+func NewGraphiteSink(config SinkConfig) *GraphiteSink {
+	return &GraphiteSink{config: config, host: sinkHostname()}
+}
+
+// Write sends one line per process name and metric
+func (s *GraphiteSink) Write(records []ResourceRecord) error {
+	var b strings.Builder
+	prefix := s.config.prefix() + "." + graphiteComponent(s.host)
+	for _, agg := range aggregateByName(records) {
+		path := prefix + "." + graphiteComponent(agg.Name)
+		ts := strconv.FormatInt(agg.Timestamp.Unix(), 10)
+		for _, m := range agg.metrics() {
+			b.WriteString(path + "." + m.name + " " + strconv.FormatFloat(m.value, 'f', -1, 64) + " " + ts + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.config.Address, s.config.timeout())
+		if err != nil {
+			return fmt.Errorf("failed to connect to graphite at %s: %w", s.config.Address, err)
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.timeout()))
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to send to graphite at %s: %w", s.config.Address, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (s *GraphiteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// graphiteComponent makes a name safe as one component of a dotted metric path
+func graphiteComponent(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// HistoryPoint is the average usage across all process samples in one history bucket
+type HistoryPoint struct {
+	Timestamp time.Time // Bucket start
+	CPU       float64   // Average normalized CPU percent per sample
+	MemoryMB  float64   // Average memory per sample
+	Samples   int       // Number of process samples in the bucket
+}
+
+// History returns usage averaged into step-sized buckets over [start, end]
+// With SQLite rollups enabled the coarsest tier that fits the step and still covers start is
+// read up to its watermark; the rest of the range comes from finer tiers and raw records.
+// It also reports where the bulk of the data came from ("raw" or a tier name).
+// host selects one machine; "" averages over every host.
+func (a *App) History(ctx context.Context, start, end time.Time, step time.Duration, host string) ([]HistoryPoint, string, error) {
+	if step <= 0 {
+		step = time.Hour
+	}
+	buckets := make(map[int64]*historyBucket)
+
+	source := "raw"
+	cursor := start
+	if rs, ok := a.storage.(RollupStorage); ok && a.Config.Storage.Rollups.Enabled {
+		tierIndex := selectRollupTier(a.Config.Storage, time.Now(), start, step)
+		if tierIndex >= 0 {
+			source = RollupTiers[tierIndex].Name
+		}
+		// Walk from the chosen tier down to the finest, each covering up to its watermark
+		for i := tierIndex; i >= 0; i-- {
+			tier := RollupTiers[i]
+			mark := rs.RollupWatermark(tier)
+			if mark.After(end) {
+				mark = end
+			}
+			if !mark.After(cursor) {
+				continue
+			}
+			points, err := rs.ReadRollups(ctx, tier, cursor, mark, false, host)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, p := range points {
+				addHistorySample(buckets, p.Bucket, step, p.CPUNormalizedAvg*float64(p.Samples), p.MemoryAvgMB*float64(p.Samples), p.Samples)
+			}
+			cursor = mark
+		}
+	}
+
+	if cursor.Before(end) {
+		records, err := a.QueryRecords(ctx, RecordQuery{
+			Start:  cursor,
+			End:    end,
+			Hosts:  hostFilter(host),
+			Fields: []string{"timestamp", "cpu_percent_normalized", "memory_mb"},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, r := range records {
+			addHistorySample(buckets, r.Timestamp, step, r.CPUPercentNormalized, r.MemoryMB, 1)
+		}
+	}
+
+	history := make([]HistoryPoint, 0, len(buckets))
+	for key, b := range buckets {
+		history = append(history, HistoryPoint{
+			Timestamp: time.Unix(key, 0),
+			CPU:       b.cpuSum / float64(b.samples),
+			MemoryMB:  b.memorySum / float64(b.samples),
+			Samples:   b.samples,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+	return history, source, nil
+}
+
+type historyBucket struct {
+	cpuSum, memorySum float64
+	samples           int
+}
+
+func addHistorySample(buckets map[int64]*historyBucket, ts time.Time, step time.Duration, cpuSum, memorySum float64, samples int) {
+	if samples == 0 {
+		return
+	}
+	key := ts.Truncate(step).Unix()
+	b, ok := buckets[key]
+	if !ok {
+		b = &historyBucket{}
+		buckets[key] = b
+	}
+	b.cpuSum += cpuSum
+	b.memorySum += memorySum
+	b.samples += samples
+}
+
+// selectRollupTier picks the rollup tier for a history query, or -1 for raw records
+// Prefers the coarsest tier no coarser than step whose retention still reaches start;
+// when none fits, the finest tier that reaches start, then the longest-lived tier
+func selectRollupTier(config StorageConfig, now, start time.Time, step time.Duration) int {
+	reaches := func(keepDays int) bool {
+		return keepDays == 0 || !start.Before(now.AddDate(0, 0, -keepDays))
+	}
+
+	if step < RollupTiers[0].Resolution && reaches(config.KeepDays) {
+		return -1
+	}
+
+	best, finest := -1, -1
+	for i, tier := range RollupTiers {
+		if !reaches(config.Rollups.KeepDays(tier)) {
+			continue
+		}
+		if finest < 0 {
+			finest = i
+		}
+		if tier.Resolution <= step {
+			best = i
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+	if finest >= 0 {
+		return finest
+	}
+	return len(RollupTiers) - 1
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDatagramSize keeps UDP payloads under a typical MTU
+const maxDatagramSize = 1400
+
+// InfluxDBSink writes per-process-name aggregates in InfluxDB line protocol, either to an
+// HTTP write endpoint (v1 /write or v2 /api/v2/write) or as UDP datagrams
+type InfluxDBSink struct {
+	config      SinkConfig
+	url         *url.URL
+	client      *http.Client
+	host        string
+	measurement string
+}
+
+// NewInfluxDBSink creates a sink for config.URL
+func NewInfluxDBSink(config SinkConfig) (*InfluxDBSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid influxdb url: %w", err)
+	}
+	measurement := config.Measurement
+	if measurement == "" {
+		measurement = "process"
+	}
+	return &InfluxDBSink{
+		config:      config,
+		url:         u,
+		client:      &http.Client{Timeout: config.timeout()},
+		host:        sinkHostname(),
+		measurement: measurement,
+	}, nil
+}
+
+// Write sends one line per process name
+func (s *InfluxDBSink) Write(records []ResourceRecord) error {
+	lines := s.lines(records)
+	if len(lines) == 0 {
+		return nil
+	}
+	if s.url.Scheme == "udp" {
+		return writeDatagrams(s.url.Host, lines, s.config.timeout())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url.String(), strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to influxdb: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Close releases idle HTTP connections
+func (s *InfluxDBSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// lines formats e.g. `process,host=web1,name=nginx,category=web processes=4i,cpu_percent=1.5,... 1700000000000000000`
+func (s *InfluxDBSink) lines(records []ResourceRecord) []string {
+	var lines []string
+	for _, agg := range aggregateByName(records) {
+		var b strings.Builder
+		b.WriteString(escapeInfluxKey(s.measurement, false))
+		b.WriteString(",host=" + escapeInfluxKey(s.host, true))
+		b.WriteString(",name=" + escapeInfluxKey(agg.Name, true))
+		if agg.Category != "" {
+			b.WriteString(",category=" + escapeInfluxKey(agg.Category, true))
+		}
+		for i, m := range agg.metrics() {
+			if i == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(m.name + "=")
+			if m.name == "processes" || m.name == "threads" {
+				b.WriteString(strconv.FormatInt(int64(m.value), 10) + "i")
+			} else {
+				b.WriteString(strconv.FormatFloat(m.value, 'f', -1, 64))
+			}
+		}
+		b.WriteString(" " + strconv.FormatInt(agg.Timestamp.UnixNano(), 10))
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// escapeInfluxKey escapes commas and spaces (and equals signs in tags) as line protocol requires
+func escapeInfluxKey(s string, tag bool) string {
+	if s == "" {
+		return "unknown"
+	}
+	replacements := []string{`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\n`}
+	if tag {
+		replacements = append(replacements, "=", `\=`)
+	}
+	return strings.NewReplacer(replacements...).Replace(s)
+}
+
+// writeDatagrams sends newline-separated lines to a UDP address, packing as many lines
+// into each datagram as fit in maxDatagramSize
+func writeDatagrams(address string, lines []string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", address, err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(buf.Bytes())
+		buf.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to send to %s: %w", address, err)
+		}
+		return nil
+	}
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxDatagramSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	return flush()
+}
@@ -0,0 +1,484 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsContentType is the Prometheus text exposition format served by the exporter
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const collectorStatsFile = "collector-stats.json"
+
+// metricLabels are the optional per-process labels, in output order
+var metricLabels = []string{"pid", "cmdline_hash", "user", "container"}
+
+// MetricsConfig controls the per-process series of the Prometheus exporter
+// Processes with identical labels are summed into one series, so with the default (no
+// optional labels) there is one series per process name and category.
+type MetricsConfig struct {
+	Labels          []string `yaml:"labels"`            // Optional labels: pid, cmdline_hash, user, container
+	AggregateByName bool     `yaml:"aggregate_by_name"` // Ignore the optional labels and sum per process name
+	TopN            int      `yaml:"top_n"`             // Keep the N series using the most CPU (then memory), sum the rest as name="other"; 0 = all
+}
+
+// ValidateMetricsConfig checks the label allowlist and top_n
+func ValidateMetricsConfig(config MetricsConfig) error {
+	for _, label := range config.Labels {
+		if !containsString(metricLabels, label) {
+			return fmt.Errorf("metrics: unknown label %q (use %s)", label, strings.Join(metricLabels, ", "))
+		}
+	}
+	if config.TopN < 0 {
+		return fmt.Errorf("metrics: top_n must be non-negative")
+	}
+	return nil
+}
+
+// enabledLabels returns the optional labels to export, in output order
+func (c MetricsConfig) enabledLabels() []string {
+	if c.AggregateByName {
+		return nil
+	}
+	var labels []string
+	for _, label := range metricLabels {
+		if containsString(c.Labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// CollectorStats describes the latest collection
+// The daemon publishes it next to the data file so the exporter in the web server, which
+// does not collect, can report on the collector.
+type CollectorStats struct {
+	CollectedAt time.Time     `json:"collected_at"`
+	Duration    float64       `json:"duration_seconds"`
+	Processes   int           `json:"processes"` // Processes seen
+	Recorded    int           `json:"recorded"`  // Records saved, including containers
+	Filtered    int           `json:"filtered"`  // Processes excluded by filters
+	Errors      int           `json:"errors"`    // Processes that could not be read
+	Alerts      []ActiveAlert `json:"alerts"`
+}
+
+// ActiveAlert is an alert rule whose threshold is currently exceeded
+// An expression rule has one active alert per group that passes its comparison.
+type ActiveAlert struct {
+	Rule   string            `json:"rule"`
+	Metric string            `json:"metric"` // Metric, or the rule's expression
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+	Since  time.Time         `json:"since"`
+	Firing bool              `json:"firing"` // The rule's duration has passed and notifications were sent
+}
+
+// activeAlerts converts the alert manager's states, ordered by rule name and labels
+func (am *AlertManager) activeAlerts() []ActiveAlert {
+	var alerts []ActiveAlert
+	for _, state := range am.GetActiveAlerts() {
+		metric := state.Rule.Metric
+		if state.Rule.Expr != "" {
+			metric = state.Rule.Expr
+		}
+		alerts = append(alerts, ActiveAlert{
+			Rule:   state.Rule.Name,
+			Metric: metric,
+			Labels: state.Labels,
+			Value:  state.CurrentValue,
+			Since:  state.StartTime,
+			Firing: state.Suppressed,
+		})
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return formatAlertLabels(alerts[i].Labels) < formatAlertLabels(alerts[j].Labels)
+	})
+	return alerts
+}
+
+// recordCollection keeps the snapshot for the exporter and publishes the collector state
+func (a *App) recordCollection(records []ResourceRecord, stats CollectorStats) {
+	if a.alertManager != nil {
+		stats.Alerts = a.alertManager.activeAlerts()
+	}
+
+	a.latestCollectionLock.Lock()
+	a.latestRecords = records
+	a.latestCollection = &stats
+	a.latestCollectionLock.Unlock()
+
+	if err := writeJSONAtomic(filepath.Join(filepath.Dir(a.DataFile), collectorStatsFile), stats); err != nil {
+		log.Printf("Warning: failed to publish collector stats: %v", err)
+	}
+}
+
+// ReadCollectorStats reads the collector state last published by the daemon writing dataFile
+func ReadCollectorStats(dataFile string) (CollectorStats, error) {
+	var stats CollectorStats
+	err := readJSONFile(filepath.Join(filepath.Dir(dataFile), collectorStatsFile), &stats)
+	return stats, err
+}
+
+// latestSnapshot returns the records and state of the latest collection
+// Outside the collector the records come from storage: the newest record of each local process
+// stored within the last minute, keeping only those from the newest collection.
+func (a *App) latestSnapshot() ([]ResourceRecord, *CollectorStats, error) {
+	a.latestCollectionLock.RLock()
+	records, stats := a.latestRecords, a.latestCollection
+	a.latestCollectionLock.RUnlock()
+	if stats != nil {
+		return records, stats, nil
+	}
+
+	if published, err := ReadCollectorStats(a.DataFile); err == nil {
+		stats = &published
+	}
+	window := 3*a.Interval + time.Duration(a.Config.Storage.Write.FlushSeconds)*time.Second
+	if window < time.Minute {
+		window = time.Minute
+	}
+	records, err := a.GetLatestProcesses(window, a.LocalHost())
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var newest time.Time
+	for _, r := range records {
+		if r.Timestamp.After(newest) {
+			newest = r.Timestamp
+		}
+	}
+	spread := a.Interval / 2
+	if spread < time.Second {
+		spread = time.Second
+	}
+	current := records[:0]
+	for _, r := range records {
+		if !r.Timestamp.Before(newest.Add(-spread)) {
+			current = append(current, r)
+		}
+	}
+	return current, stats, nil
+}
+
+// metricSeries is one per-process series: the sum of the processes sharing its labels
+type metricSeries struct {
+	labels      []string // Values of name, category and the enabled optional labels
+	processes   int
+	cpuPercent  float64
+	memoryBytes float64
+	threads     float64
+	cpuSeconds  float64
+	diskRead    float64
+	diskWrite   float64
+}
+
+func (s *metricSeries) add(r ResourceRecord) {
+	s.processes++
+	s.cpuPercent += r.CPUPercent
+	s.memoryBytes += r.MemoryMB * 1024 * 1024
+	s.threads += float64(r.Threads)
+	s.cpuSeconds += r.CPUTime
+	s.diskRead += r.DiskReadMB * 1024 * 1024
+	s.diskWrite += r.DiskWriteMB * 1024 * 1024
+}
+
+func (s *metricSeries) merge(o *metricSeries) {
+	s.processes += o.processes
+	s.cpuPercent += o.cpuPercent
+	s.memoryBytes += o.memoryBytes
+	s.threads += o.threads
+	s.cpuSeconds += o.cpuSeconds
+	s.diskRead += o.diskRead
+	s.diskWrite += o.diskWrite
+}
+
+// labelValue returns the value of an optional label for a record
+func labelValue(label string, r ResourceRecord) string {
+	switch label {
+	case "pid":
+		return strconv.Itoa(int(r.PID))
+	case "cmdline_hash":
+		if r.Command == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(r.Command))
+		return hex.EncodeToString(sum[:6])
+	case "user":
+		return r.Username
+	case "container":
+		if r.Category == "docker" {
+			return strings.TrimPrefix(r.Name, "docker:")
+		}
+	}
+	return ""
+}
+
+// buildProcessSeries groups records by their labels and applies top_n
+func buildProcessSeries(records []ResourceRecord, config MetricsConfig) []*metricSeries {
+	optional := config.enabledLabels()
+	index := make(map[string]*metricSeries)
+	var series []*metricSeries
+	for _, r := range records {
+		labels := []string{r.Name, r.Category}
+		for _, label := range optional {
+			labels = append(labels, labelValue(label, r))
+		}
+		key := strings.Join(labels, "\x00")
+		s, ok := index[key]
+		if !ok {
+			s = &metricSeries{labels: labels}
+			index[key] = s
+			series = append(series, s)
+		}
+		s.add(r)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].cpuPercent != series[j].cpuPercent {
+			return series[i].cpuPercent > series[j].cpuPercent
+		}
+		if series[i].memoryBytes != series[j].memoryBytes {
+			return series[i].memoryBytes > series[j].memoryBytes
+		}
+		return strings.Join(series[i].labels, "\x00") < strings.Join(series[j].labels, "\x00")
+	})
+	if config.TopN > 0 && len(series) > config.TopN {
+		other := &metricSeries{labels: make([]string, 2+len(optional))}
+		other.labels[0] = "other"
+		for _, s := range series[config.TopN:] {
+			other.merge(s)
+		}
+		series = append(series[:config.TopN], other)
+	}
+	return series
+}
+
+// metricsWriter writes metric families in the Prometheus text format
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (m *metricsWriter) family(name, kind, help string) {
+	m.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample; labels alternate names and values
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	m.printf("%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *metricsWriter) printf(format string, args ...interface{}) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+// escapeLabelValue escapes backslashes, quotes and newlines in a label value
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// WriteMetrics writes the latest collection, host metrics, task counts, active alerts,
+// collector and storage state in the Prometheus text exposition format
+func (a *App) WriteMetrics(w io.Writer) error {
+	m := &metricsWriter{w: w}
+
+	records, collector, err := a.latestSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to read latest collection: %w", err)
+	}
+	a.writeProcessMetrics(m, records)
+
+	if record, err := a.GetLatestSystemRecord(); err == nil {
+		writeSystemMetrics(m, record)
+	}
+
+	if tasks, err := a.ListTasks(""); err == nil {
+		counts := make(map[TaskStatus]int)
+		for _, task := range tasks {
+			counts[task.Status]++
+		}
+		m.family("process_tracker_tasks", "gauge", "Managed tasks by status.")
+		for _, status := range []TaskStatus{StatusPending, StatusRunning, StatusCompleted, StatusFailed, StatusStopped, StatusUnknown} {
+			m.sample("process_tracker_tasks", float64(counts[status]), "status", string(status))
+		}
+	}
+
+	if collector != nil {
+		writeCollectorMetrics(m, *collector)
+	}
+
+	if size, kind := storageSizeBytes(a.storage); size >= 0 {
+		m.family("process_tracker_storage_size_bytes", "gauge", "Size of the data files on disk.")
+		m.sample("process_tracker_storage_size_bytes", float64(size), "type", kind)
+	}
+	return m.err
+}
+
+// processMetricFamilies are the per-process metrics served by the exporter and pushed to
+// remote_write and OTLP targets; unit is the OTLP unit
+// CPU time and disk bytes are totals of the processes running now and drop when one exits,
+// so they are gauges rather than counters.
+var processMetricFamilies = []struct {
+	name, kind, unit, help string
+	value                  func(*metricSeries) float64
+}{
+	{"process_tracker_process_count", "gauge", "{process}", "Processes summed into the series.", func(s *metricSeries) float64 { return float64(s.processes) }},
+	{"process_tracker_process_cpu_percent", "gauge", "%", "CPU usage in percent of one core.", func(s *metricSeries) float64 { return s.cpuPercent }},
+	{"process_tracker_process_memory_bytes", "gauge", "By", "Resident memory.", func(s *metricSeries) float64 { return s.memoryBytes }},
+	{"process_tracker_process_threads", "gauge", "{thread}", "Threads.", func(s *metricSeries) float64 { return s.threads }},
+	{"process_tracker_process_cpu_seconds", "gauge", "s", "User and system CPU time used so far by the running processes.", func(s *metricSeries) float64 { return s.cpuSeconds }},
+	{"process_tracker_process_disk_read_bytes", "gauge", "By", "Bytes read from storage so far by the running processes.", func(s *metricSeries) float64 { return s.diskRead }},
+	{"process_tracker_process_disk_write_bytes", "gauge", "By", "Bytes written to storage so far by the running processes.", func(s *metricSeries) float64 { return s.diskWrite }},
+}
+
+// processLabelNames returns the label names of the per-process series, matching metricSeries.labels
+func (c MetricsConfig) processLabelNames() []string {
+	return append([]string{"name", "category"}, c.enabledLabels()...)
+}
+
+func (a *App) writeProcessMetrics(m *metricsWriter, records []ResourceRecord) {
+	labelNames := a.Config.Metrics.processLabelNames()
+	series := buildProcessSeries(records, a.Config.Metrics)
+
+	for _, f := range processMetricFamilies {
+		m.family(f.name, f.kind, f.help)
+		for _, s := range series {
+			labels := make([]string, 0, 2*len(labelNames))
+			for i, name := range labelNames {
+				labels = append(labels, name, s.labels[i])
+			}
+			m.sample(f.name, f.value(s), labels...)
+		}
+	}
+}
+
+func writeSystemMetrics(m *metricsWriter, r SystemRecord) {
+	const mb = 1024 * 1024
+	for _, load := range []struct {
+		name  string
+		value float64
+	}{{"load1", r.Load1}, {"load5", r.Load5}, {"load15", r.Load15}} {
+		name := "process_tracker_system_" + load.name
+		m.family(name, "gauge", "Load average.")
+		m.sample(name, load.value)
+	}
+
+	m.family("process_tracker_system_cpu_percent", "gauge", "Host CPU time by mode since the previous sample.")
+	for _, mode := range []struct {
+		name  string
+		value float64
+	}{{"user", r.CPUUser}, {"system", r.CPUSystem}, {"nice", r.CPUNice}, {"iowait", r.CPUIOWait},
+		{"irq", r.CPUIRQ}, {"steal", r.CPUSteal}, {"idle", r.CPUIdle}} {
+		m.sample("process_tracker_system_cpu_percent", mode.value, "mode", mode.name)
+	}
+
+	m.family("process_tracker_system_memory_bytes", "gauge", "Host memory by type.")
+	for _, mem := range []struct {
+		name  string
+		value float64
+	}{{"total", r.MemoryTotalMB}, {"used", r.MemoryUsedMB}, {"available", r.MemoryAvailableMB},
+		{"cached", r.MemoryCachedMB}, {"buffers", r.MemoryBuffersMB}, {"swap_total", r.SwapTotalMB}, {"swap_used", r.SwapUsedMB}} {
+		m.sample("process_tracker_system_memory_bytes", mem.value*mb, "type", mem.name)
+	}
+
+	m.family("process_tracker_system_pressure_percent", "gauge", "Pressure stall information, 10 second average.")
+	for _, psi := range []struct {
+		resource, kind string
+		value          float64
+	}{{"cpu", "some", r.PSICPUSome}, {"memory", "some", r.PSIMemorySome}, {"memory", "full", r.PSIMemoryFull},
+		{"io", "some", r.PSIIOSome}, {"io", "full", r.PSIIOFull}} {
+		m.sample("process_tracker_system_pressure_percent", psi.value, "resource", psi.resource, "kind", psi.kind)
+	}
+
+	m.family("process_tracker_system_disk_size_bytes", "gauge", "Size of mounted filesystems.")
+	for _, d := range r.Disks {
+		m.sample("process_tracker_system_disk_size_bytes", d.TotalMB*mb, "mountpoint", d.Mountpoint, "device", d.Device, "fstype", d.Fstype)
+	}
+	m.family("process_tracker_system_disk_used_bytes", "gauge", "Used space of mounted filesystems.")
+	for _, d := range r.Disks {
+		m.sample("process_tracker_system_disk_used_bytes", d.UsedMB*mb, "mountpoint", d.Mountpoint, "device", d.Device, "fstype", d.Fstype)
+	}
+}
+
+func writeCollectorMetrics(m *metricsWriter, c CollectorStats) {
+	m.family("process_tracker_collector_duration_seconds", "gauge", "Duration of the latest collection.")
+	m.sample("process_tracker_collector_duration_seconds", c.Duration)
+	m.family("process_tracker_collector_last_run_timestamp_seconds", "gauge", "Unix time the latest collection finished.")
+	m.sample("process_tracker_collector_last_run_timestamp_seconds", float64(c.CollectedAt.UnixMilli())/1000)
+	m.family("process_tracker_collector_processes", "gauge", "Processes seen by the latest collection by result.")
+	m.sample("process_tracker_collector_processes", float64(c.Recorded), "result", "recorded")
+	m.sample("process_tracker_collector_processes", float64(c.Filtered), "result", "filtered")
+	m.sample("process_tracker_collector_processes", float64(c.Errors), "result", "error")
+
+	m.family("process_tracker_alerts_active", "gauge", "Alert rules whose threshold is exceeded.")
+	m.sample("process_tracker_alerts_active", float64(len(c.Alerts)))
+	m.family("process_tracker_alert_value", "gauge", "Current value of each active alert; state is pending until the rule's duration passes.")
+	for _, alert := range c.Alerts {
+		state := "pending"
+		if alert.Firing {
+			state = "firing"
+		}
+		labels := []string{"rule", alert.Rule, "metric", alert.Metric, "state", state}
+		if len(alert.Labels) > 0 {
+			labels = append(labels, "group", strings.Trim(formatAlertLabels(alert.Labels), "{}"))
+		}
+		m.sample("process_tracker_alert_value", alert.Value, labels...)
+	}
+}
+
+// storageSizeBytes returns the size of the store's files on disk, or -1 when unknown
+func storageSizeBytes(storage Storage) (int64, string) {
+	switch s := storage.(type) {
+	case *SQLiteStorage:
+		var size int64 = -1
+		for _, path := range []string{s.sqlitePath, s.sqlitePath + "-wal"} {
+			if info, err := os.Stat(path); err == nil {
+				if size < 0 {
+					size = 0
+				}
+				size += info.Size()
+			}
+		}
+		return size, "sqlite"
+	case *Manager:
+		files, err := s.storeFiles()
+		if err != nil {
+			return -1, "csv"
+		}
+		var size int64
+		for _, f := range files {
+			if info, err := os.Stat(f.path); err == nil {
+				size += info.Size()
+			}
+		}
+		return size, "csv"
+	}
+	return -1, ""
+}
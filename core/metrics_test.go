@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// metricsTestRecords returns one collection: three nginx workers of two users, a database
+// and a container
+func metricsTestRecords(ts time.Time) []ResourceRecord {
+	return []ResourceRecord{
+		{Timestamp: ts, Name: "nginx", Category: "web", PID: 10, Username: "www", Command: "nginx: worker", CPUPercent: 5, MemoryMB: 10, Threads: 1, CPUTime: 2},
+		{Timestamp: ts, Name: "nginx", Category: "web", PID: 11, Username: "www", Command: "nginx: worker", CPUPercent: 5, MemoryMB: 10, Threads: 1, CPUTime: 3},
+		{Timestamp: ts, Name: "nginx", Category: "web", PID: 1, Username: "root", Command: "nginx: master", CPUPercent: 0, MemoryMB: 5, Threads: 1},
+		{Timestamp: ts, Name: "postgres", Category: "database", PID: 20, Username: "postgres", Command: "postgres -D /var/lib/pg", CPUPercent: 50, MemoryMB: 512, Threads: 4},
+		{Timestamp: ts, Name: "docker:api \"v2\"", Category: "docker", PID: 30, CPUPercent: 1, MemoryMB: 64},
+	}
+}
+
+// TestBuildProcessSeries tests grouping by labels, the label allowlist and top_n
+func TestBuildProcessSeries(t *testing.T) {
+	records := metricsTestRecords(time.Now())
+
+	series := buildProcessSeries(records, MetricsConfig{})
+	if len(series) != 3 || series[0].labels[0] != "postgres" {
+		t.Fatalf("Expected 3 series ordered by CPU, got %+v", series)
+	}
+	if nginx := series[1]; nginx.labels[0] != "nginx" || nginx.processes != 3 || nginx.memoryBytes != 25*1024*1024 {
+		t.Errorf("Expected the nginx processes summed, got %+v", nginx)
+	}
+
+	series = buildProcessSeries(records, MetricsConfig{Labels: []string{"user", "container"}})
+	if len(series) != 4 {
+		t.Fatalf("Expected nginx split by user, got %d series", len(series))
+	}
+	for _, s := range series {
+		if s.labels[0] == "docker:api \"v2\"" && s.labels[3] != "api \"v2\"" {
+			t.Errorf("Expected the container label, got %v", s.labels)
+		}
+	}
+
+	if series = buildProcessSeries(records, MetricsConfig{Labels: []string{"pid"}, AggregateByName: true}); len(series) != 3 {
+		t.Errorf("Expected aggregate_by_name to ignore the pid label, got %d series", len(series))
+	}
+
+	series = buildProcessSeries(records, MetricsConfig{Labels: []string{"pid"}, TopN: 2})
+	if len(series) != 3 {
+		t.Fatalf("Expected 2 series and other, got %d", len(series))
+	}
+	if other := series[2]; other.labels[0] != "other" || other.labels[2] != "" || other.processes != 3 {
+		t.Errorf("Expected the remaining 3 processes summed as other, got %+v", other)
+	}
+}
+
+// TestWriteMetrics tests the exposition of the collector's latest snapshot
+func TestWriteMetrics(t *testing.T) {
+	config := GetDefaultConfig()
+	config.Docker.Enabled = false
+	config.Metrics.Labels = []string{"cmdline_hash"}
+	dataFile := filepath.Join(t.TempDir(), "process-tracker.log")
+	app := NewApp(dataFile, 5*time.Second, config)
+	if err := app.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer app.CloseFile()
+
+	now := time.Now()
+	app.recordCollection(metricsTestRecords(now), CollectorStats{CollectedAt: now, Duration: 0.75, Processes: 8, Recorded: 5, Filtered: 2, Errors: 1})
+
+	var buf bytes.Buffer
+	if err := app.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	out := buf.String()
+	hash := labelValue("cmdline_hash", ResourceRecord{Command: "postgres -D /var/lib/pg"})
+	for _, want := range []string{
+		`process_tracker_process_memory_bytes{name="postgres",category="database",cmdline_hash="` + hash + `"} 5.36870912e+08`,
+		`process_tracker_process_count{name="nginx",category="web",cmdline_hash="` + labelValue("cmdline_hash", ResourceRecord{Command: "nginx: worker"}) + `"} 2`,
+		`process_tracker_process_cpu_seconds{name="docker:api \"v2\"",category="docker",cmdline_hash=""} 0`,
+		"# TYPE process_tracker_process_cpu_seconds gauge",
+		`process_tracker_tasks{status="running"} 0`,
+		"process_tracker_collector_duration_seconds 0.75",
+		`process_tracker_collector_processes{result="filtered"} 2`,
+		"process_tracker_alerts_active 0",
+		`process_tracker_storage_size_bytes{type="csv"}`,
+		`process_tracker_system_memory_bytes{type="total"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+
+	// Every sample belongs to a family declared before it
+	declared := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			declared[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+		if !declared[name] {
+			t.Errorf("Sample without a TYPE line: %s", line)
+		}
+	}
+
+	if published, err := ReadCollectorStats(dataFile); err != nil || published.Recorded != 5 {
+		t.Errorf("Expected the collector stats published, got %+v (%v)", published, err)
+	}
+}
+
+// TestValidateMetricsConfig tests metrics configuration errors
+func TestValidateMetricsConfig(t *testing.T) {
+	if err := ValidateMetricsConfig(MetricsConfig{Labels: []string{"pid", "user"}, TopN: 20}); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+	if err := ValidateMetricsConfig(MetricsConfig{Labels: []string{"cmdline"}}); err == nil {
+		t.Error("Expected an unknown label to be rejected")
+	}
+	if err := ValidateMetricsConfig(MetricsConfig{TopN: -1}); err == nil {
+		t.Error("Expected a negative top_n to be rejected")
+	}
+}
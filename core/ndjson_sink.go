@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// NDJSONSink writes one JSON object per record and line, for log shippers such as
+// Filebeat, Vector or Fluent Bit
+// The file is opened for every snapshot so that a rotated file is picked up without a
+// restart; the path "-" writes to stdout.
+type NDJSONSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewNDJSONSink creates a sink appending to path
+func NewNDJSONSink(path string) *NDJSONSink {
+	return &NDJSONSink{path: path}
+}
+
+// Write appends the records, one per line
+func (s *NDJSONSink) Write(records []ResourceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "-" {
+		return writeNDJSON(os.Stdout, records)
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	if err := writeNDJSON(f, records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close is a no-op; the file is closed after every write
+func (s *NDJSONSink) Close() error { return nil }
+
+func writeNDJSON(w io.Writer, records []ResourceRecord) error {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// OTLP/HTTP JSON encoding of an ExportMetricsServiceRequest (only the fields used here)
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unit        string     `json:"unit"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"` // 2 = cumulative
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpExporter pushes batches to an OTLP/HTTP metrics endpoint (gzip-compressed JSON)
+type otlpExporter struct {
+	pushTarget
+}
+
+// NewOTLPSink creates a sink pushing to config.URL (e.g. http://collector:4318/v1/metrics)
+func NewOTLPSink(config SinkConfig, dataDir string, metrics MetricsConfig) Sink {
+	return newPushSink(config, &otlpExporter{newPushTarget(config, metrics)}, dataDir)
+}
+
+// SaveRecords encodes and pushes one batch
+func (e *otlpExporter) SaveRecords(records []ResourceRecord) error {
+	data, err := json.Marshal(e.encode(records))
+	if err != nil {
+		return &permanentError{err}
+	}
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(data)
+	gz.Close()
+	return e.post(body.Bytes(), map[string]string{
+		"Content-Type":     "application/json",
+		"Content-Encoding": "gzip",
+	})
+}
+
+// encode builds one metric per family with a data point per series and snapshot
+func (e *otlpExporter) encode(records []ResourceRecord) otlpRequest {
+	resource := []otlpAttribute{
+		{"service.name", otlpValue{"process-tracker"}},
+		{"host.name", otlpValue{e.host}},
+	}
+	var extra []string
+	for name := range e.config.Labels {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		resource = append(resource, otlpAttribute{name, otlpValue{e.config.Labels[name]}})
+	}
+
+	metrics := make([]otlpMetric, len(processMetricFamilies))
+	points := make([][]otlpDataPoint, len(processMetricFamilies))
+	labelNames := e.metrics.processLabelNames()
+	for _, snapshot := range splitSnapshots(records) {
+		timestamp := strconv.FormatInt(snapshot.time.UnixNano(), 10)
+		for _, s := range buildProcessSeries(snapshot.records, e.metrics) {
+			var attributes []otlpAttribute
+			for _, l := range seriesLabels(labelNames, s) {
+				attributes = append(attributes, otlpAttribute{l.name, otlpValue{l.value}})
+			}
+			for i, family := range processMetricFamilies {
+				points[i] = append(points[i], otlpDataPoint{Attributes: attributes, TimeUnixNano: timestamp, AsDouble: family.value(s)})
+			}
+		}
+	}
+	for i, family := range processMetricFamilies {
+		metrics[i] = otlpMetric{Name: family.name, Description: family.help, Unit: family.unit}
+		if family.kind == "counter" {
+			metrics[i].Sum = &otlpSum{DataPoints: points[i], AggregationTemporality: 2, IsMonotonic: true}
+		} else {
+			metrics[i].Gauge = &otlpGauge{DataPoints: points[i]}
+		}
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: resource},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "process-tracker"}, Metrics: metrics}},
+	}}}
+}
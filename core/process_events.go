@@ -0,0 +1,161 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessEventType represents a process lifecycle event type
+type ProcessEventType string
+
+const (
+	ProcessEventStarted        ProcessEventType = "process_started"
+	ProcessEventExited         ProcessEventType = "process_exited"
+	ProcessEventCmdlineChanged ProcessEventType = "cmdline_changed"
+)
+
+// ProcessEvent represents a process lifecycle event detected between two snapshots
+type ProcessEvent struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	Type            ProcessEventType `json:"type"`
+	PID             int32            `json:"pid"`
+	PPID            int32            `json:"ppid"`
+	Name            string           `json:"name"`
+	Command         string           `json:"command"`
+	PreviousCommand string           `json:"previous_command,omitempty"` // cmdline_changed only
+	Category        string           `json:"category"`
+	CreateTime      int64            `json:"create_time"`         // Process start time (ms)
+	LastSeen        time.Time        `json:"last_seen,omitempty"` // process_exited only
+	LifetimeSeconds float64          `json:"lifetime_seconds"`
+
+	// Last-seen resources (process_exited) or first-seen resources (process_started)
+	CPUPercent float64 `json:"cpu_percent"`
+	MemoryMB   float64 `json:"memory_mb"`
+	Threads    int32   `json:"threads"`
+	CPUTime    float64 `json:"cpu_time"`
+}
+
+// processKey identifies a process instance; PIDs are reused, so the start time is part of the key
+// and records from several hosts (see ClusterConfig) are told apart by their host
+type processKey struct {
+	Host       string
+	PID        int32
+	CreateTime int64
+}
+
+func recordProcessKey(r ResourceRecord) processKey {
+	return processKey{Host: r.Host, PID: r.PID, CreateTime: r.CreateTime}
+}
+
+// ProcessEventTracker detects lifecycle events by diffing consecutive snapshots
+type ProcessEventTracker struct {
+	mu       sync.Mutex
+	previous map[processKey]ResourceRecord
+	primed   bool
+
+	// isAlive reports whether a process instance still exists; used to avoid
+	// reporting exits for processes that were only skipped in a snapshot
+	isAlive func(pid int32, createTime int64) bool
+}
+
+// NewProcessEventTracker creates a new process event tracker
+func NewProcessEventTracker() *ProcessEventTracker {
+	return &ProcessEventTracker{
+		previous: make(map[processKey]ResourceRecord),
+		isAlive:  processAlive,
+	}
+}
+
+// Detect compares a snapshot with the previous one and returns the lifecycle events
+// The first snapshot only establishes the baseline, so existing processes are not
+// reported as started when the collector starts
+func (t *ProcessEventTracker) Detect(records []ResourceRecord, now time.Time) []ProcessEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := make(map[processKey]ResourceRecord, len(records))
+	for _, r := range records {
+		if r.PID <= 0 {
+			continue
+		}
+		current[recordProcessKey(r)] = r
+	}
+
+	if !t.primed {
+		t.previous = current
+		t.primed = true
+		return nil
+	}
+
+	var events []ProcessEvent
+
+	for key, r := range current {
+		prev, existed := t.previous[key]
+		if !existed {
+			events = append(events, newProcessEvent(ProcessEventStarted, r, now))
+			continue
+		}
+		if prev.Command != "" && r.Command != "" && prev.Command != r.Command {
+			event := newProcessEvent(ProcessEventCmdlineChanged, r, now)
+			event.PreviousCommand = prev.Command
+			events = append(events, event)
+		}
+	}
+
+	for key, prev := range t.previous {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		// The process may only have been unreadable in this snapshot; keep tracking it
+		if t.isAlive != nil && t.isAlive(key.PID, key.CreateTime) {
+			current[key] = prev
+			continue
+		}
+		event := newProcessEvent(ProcessEventExited, prev, now)
+		event.LastSeen = prev.Timestamp
+		if prev.CreateTime > 0 {
+			event.LifetimeSeconds = prev.Timestamp.Sub(time.UnixMilli(prev.CreateTime)).Seconds()
+		}
+		events = append(events, event)
+	}
+
+	t.previous = current
+	return events
+}
+
+// newProcessEvent builds an event from a resource record
+func newProcessEvent(eventType ProcessEventType, r ResourceRecord, now time.Time) ProcessEvent {
+	event := ProcessEvent{
+		Timestamp:  now,
+		Type:       eventType,
+		PID:        r.PID,
+		PPID:       r.PPID,
+		Name:       r.Name,
+		Command:    r.Command,
+		Category:   r.Category,
+		CreateTime: r.CreateTime,
+		CPUPercent: r.CPUPercent,
+		MemoryMB:   r.MemoryMB,
+		Threads:    r.Threads,
+		CPUTime:    r.CPUTime,
+	}
+	if r.CreateTime > 0 {
+		event.LifetimeSeconds = now.Sub(time.UnixMilli(r.CreateTime)).Seconds()
+	}
+	return event
+}
+
+// processAlive checks whether the process instance (PID + start time) still exists
+func processAlive(pid int32, createTime int64) bool {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return false
+	}
+	ct, err := p.CreateTime()
+	if err != nil {
+		return false
+	}
+	return ct == createTime
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProcessEventTracker_Detect tests start, exit and exec detection between snapshots
+func TestProcessEventTracker_Detect(t *testing.T) {
+	tracker := NewProcessEventTracker()
+	tracker.isAlive = func(pid int32, createTime int64) bool { return false }
+
+	base := time.Now().Truncate(time.Second)
+	createTime := base.Add(-time.Hour).UnixMilli()
+
+	first := []ResourceRecord{
+		{Timestamp: base, Name: "worker", PID: 100, CreateTime: createTime, Command: "worker --a", MemoryMB: 64},
+		{Timestamp: base, Name: "shell", PID: 200, CreateTime: createTime, Command: "bash"},
+	}
+	if events := tracker.Detect(first, base); len(events) != 0 {
+		t.Fatalf("Expected baseline snapshot to produce no events, got %d", len(events))
+	}
+
+	// worker exits, shell execs into vim, and a new process appears
+	second := []ResourceRecord{
+		{Timestamp: base.Add(5 * time.Second), Name: "shell", PID: 200, CreateTime: createTime, Command: "vim notes.txt"},
+		{Timestamp: base.Add(5 * time.Second), Name: "job", PID: 300, CreateTime: base.UnixMilli(), Command: "job"},
+	}
+	events := tracker.Detect(second, base.Add(5*time.Second))
+
+	byType := make(map[ProcessEventType]ProcessEvent)
+	for _, e := range events {
+		byType[e.Type] = e
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %+v", len(events), events)
+	}
+
+	exited := byType[ProcessEventExited]
+	if exited.PID != 100 || exited.MemoryMB != 64 || !exited.LastSeen.Equal(base) {
+		t.Errorf("Unexpected exit event: %+v", exited)
+	}
+	if exited.LifetimeSeconds != 3600 {
+		t.Errorf("Expected lifetime 3600s, got %.0f", exited.LifetimeSeconds)
+	}
+
+	changed := byType[ProcessEventCmdlineChanged]
+	if changed.PID != 200 || changed.PreviousCommand != "bash" || changed.Command != "vim notes.txt" {
+		t.Errorf("Unexpected cmdline_changed event: %+v", changed)
+	}
+
+	if started := byType[ProcessEventStarted]; started.PID != 300 {
+		t.Errorf("Unexpected start event: %+v", started)
+	}
+}
+
+// TestProcessEventTracker_PIDReuse tests that a reused PID is reported as exit plus start
+func TestProcessEventTracker_PIDReuse(t *testing.T) {
+	tracker := NewProcessEventTracker()
+	tracker.isAlive = func(pid int32, createTime int64) bool { return false }
+
+	now := time.Now()
+	tracker.Detect([]ResourceRecord{{PID: 42, CreateTime: 1000, Name: "old"}}, now)
+	events := tracker.Detect([]ResourceRecord{{PID: 42, CreateTime: 2000, Name: "new"}}, now.Add(time.Second))
+
+	if len(events) != 2 {
+		t.Fatalf("Expected exit and start events for reused PID, got %d", len(events))
+	}
+}
+
+// TestProcessEventTracker_SkippedProcess tests that a still-running process missing from a snapshot is not reported as exited
+func TestProcessEventTracker_SkippedProcess(t *testing.T) {
+	tracker := NewProcessEventTracker()
+	tracker.isAlive = func(pid int32, createTime int64) bool { return true }
+
+	now := time.Now()
+	tracker.Detect([]ResourceRecord{{PID: 7, CreateTime: 1000, Name: "flaky"}}, now)
+	if events := tracker.Detect(nil, now.Add(time.Second)); len(events) != 0 {
+		t.Fatalf("Expected no events for skipped process, got %+v", events)
+	}
+
+	// Reappearing in the next snapshot must not produce a start event
+	events := tracker.Detect([]ResourceRecord{{PID: 7, CreateTime: 1000, Name: "flaky"}}, now.Add(2*time.Second))
+	if len(events) != 0 {
+		t.Fatalf("Expected no events when process reappears, got %+v", events)
+	}
+}
+
+// TestManager_ProcessEvents tests saving and reading process events with CSV storage
+func TestManager_ProcessEvents(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-events.log")
+	manager := NewManager(tmpFile, 10, false, GetDefaultStorageConfig())
+	defer os.Remove(tmpFile)
+	defer os.Remove(manager.eventsDataFile())
+
+	now := time.Now().Truncate(time.Second)
+	events := []ProcessEvent{
+		{Timestamp: now.Add(-48 * time.Hour), Type: ProcessEventStarted, PID: 1, Name: "old"},
+		{
+			Timestamp:       now,
+			Type:            ProcessEventExited,
+			PID:             321,
+			Name:            "backup",
+			Command:         `backup --target "/mnt/a,b"`,
+			LastSeen:        now.Add(-5 * time.Second),
+			LifetimeSeconds: 120,
+			MemoryMB:        512.5,
+		},
+	}
+	if err := manager.SaveProcessEvents(events); err != nil {
+		t.Fatalf("Failed to save events: %v", err)
+	}
+
+	got, err := manager.ReadProcessEventsByTimeRange(now.Add(-time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 event in range, got %d", len(got))
+	}
+	e := got[0]
+	if e.Type != ProcessEventExited || e.Command != events[1].Command || e.MemoryMB != 512.5 || !e.LastSeen.Equal(events[1].LastSeen) {
+		t.Errorf("Unexpected event after round trip: %+v", e)
+	}
+
+	if err := manager.pruneProcessEvents(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("Failed to prune events: %v", err)
+	}
+	all, _ := manager.ReadProcessEventsByTimeRange(time.Time{}, now.Add(time.Minute))
+	if len(all) != 1 {
+		t.Errorf("Expected 1 event after pruning, got %d", len(all))
+	}
+}
@@ -2,14 +2,19 @@ package core
 
 // BuildProcessTree builds a hierarchical tree from a flat list of process records
 // Processes with PPID=0 or PPID not found in the list are treated as root processes
+// Records of different hosts form separate trees.
 func BuildProcessTree(records []ResourceRecord) []*ProcessTreeNode {
 	if len(records) == 0 {
 		return []*ProcessTreeNode{}
 	}
 
 	// Build lookup maps
-	nodeMap := make(map[int32]*ProcessTreeNode)    // PID -> Node
-	pidExists := make(map[int32]bool)              // Track which PIDs exist
+	type hostPID struct {
+		host string
+		pid  int32
+	}
+	nodeMap := make(map[hostPID]*ProcessTreeNode)  // (host, PID) -> Node
+	pidExists := make(map[hostPID]bool)            // Track which PIDs exist
 
 	// First pass: Create all nodes and track existing PIDs
 	for _, record := range records {
@@ -18,24 +23,26 @@ func BuildProcessTree(records []ResourceRecord) []*ProcessTreeNode {
 			Children:   []*ProcessTreeNode{},
 			IsExpanded: true, // Default expanded for UI
 		}
-		nodeMap[record.PID] = node
-		pidExists[record.PID] = true
+		key := hostPID{record.Host, record.PID}
+		nodeMap[key] = node
+		pidExists[key] = true
 	}
 
 	// Second pass: Build parent-child relationships
 	var rootNodes []*ProcessTreeNode
 	for _, node := range nodeMap {
 		ppid := node.Process.PPID
+		parentKey := hostPID{node.Process.Host, ppid}
 		
 		// Treat as root if:
 		// - PPID is 0 (no parent)
 		// - PPID is 1 (init/systemd - but this is filtered out)
 		// - Parent doesn't exist in our list (orphaned)
-		if ppid == 0 || ppid == 1 || !pidExists[ppid] {
+		if ppid == 0 || ppid == 1 || !pidExists[parentKey] {
 			rootNodes = append(rootNodes, node)
 		} else {
 			// Add to parent's children
-			if parent, exists := nodeMap[ppid]; exists {
+			if parent, exists := nodeMap[parentKey]; exists {
 				parent.Children = append(parent.Children, node)
 			} else {
 				// Parent not found, treat as root
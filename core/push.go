@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPushFlushSeconds = 15
+	defaultPushSpoolMB      = 50
+
+	// pushBatchSize caps the records in one push; a busy host sends several per flush
+	pushBatchSize = 20000
+)
+
+// pushSink sends per-process series to a remote metrics endpoint (Prometheus remote_write
+// or OTLP/HTTP) through its own write pipeline, which batches snapshots, retries failed
+// pushes and spools them to disk while the endpoint is unreachable
+type pushSink struct {
+	pipeline *WritePipeline
+}
+
+// newPushSink starts a pipeline delivering to saver; the spool defaults to dataDir
+func newPushSink(config SinkConfig, saver RecordSaver, dataDir string) *pushSink {
+	return &pushSink{pipeline: startPushPipeline(config, saver, dataDir)}
+}
+
+// startPushPipeline starts a write pipeline that batches, retries and spools pushes to saver
+func startPushPipeline(config SinkConfig, saver RecordSaver, dataDir string) *WritePipeline {
+	spool := config.SpoolPath
+	if spool == "" {
+		spool = filepath.Join(dataDir, "push-"+graphiteComponent(config.DisplayName())+".jsonl")
+	}
+	write := WriteConfig{
+		BatchSize:    pushBatchSize,
+		FlushSeconds: config.FlushSeconds,
+		MaxRetries:   config.MaxRetries,
+		JournalPath:  spool,
+		JournalMaxMB: config.SpoolMaxMB,
+	}
+	if write.FlushSeconds <= 0 {
+		write.FlushSeconds = defaultPushFlushSeconds
+	}
+	if write.JournalMaxMB <= 0 {
+		write.JournalMaxMB = defaultPushSpoolMB
+	}
+	pipeline := newWritePipeline(saver, write, "")
+	pipeline.Start()
+	return pipeline
+}
+
+// Write queues the snapshot without blocking
+// Every record gets the snapshot's time so batches can be split back into snapshots.
+func (s *pushSink) Write(records []ResourceRecord) error {
+	var collected time.Time
+	for _, r := range records {
+		if r.Timestamp.After(collected) {
+			collected = r.Timestamp
+		}
+	}
+	snapshot := make([]ResourceRecord, len(records))
+	for i, r := range records {
+		r.Timestamp = collected
+		snapshot[i] = r
+	}
+	s.pipeline.Enqueue(snapshot)
+	return nil
+}
+
+// Close pushes what is queued; anything the endpoint does not accept stays in the spool
+func (s *pushSink) Close() error {
+	return s.pipeline.Close()
+}
+
+func (s *pushSink) pipelineStats() WriteStats {
+	return s.pipeline.Stats()
+}
+
+// pushSnapshot is the records of one collection
+type pushSnapshot struct {
+	time    time.Time
+	records []ResourceRecord
+}
+
+// splitSnapshots groups a batch by collection time, oldest first
+func splitSnapshots(records []ResourceRecord) []pushSnapshot {
+	index := make(map[int64]int)
+	var snapshots []pushSnapshot
+	for _, r := range records {
+		key := r.Timestamp.UnixNano()
+		i, ok := index[key]
+		if !ok {
+			i = len(snapshots)
+			index[key] = i
+			snapshots = append(snapshots, pushSnapshot{time: r.Timestamp})
+		}
+		snapshots[i].records = append(snapshots[i].records, r)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].time.Before(snapshots[j].time) })
+	return snapshots
+}
+
+// pushLabel is one label or attribute of a pushed series
+type pushLabel struct {
+	name, value string
+}
+
+// seriesLabels returns the non-empty labels of a process series
+// Empty values are left out: Prometheus treats them as absent and some receivers reject them.
+func seriesLabels(names []string, s *metricSeries) []pushLabel {
+	var labels []pushLabel
+	for i, name := range names {
+		if s.labels[i] != "" {
+			labels = append(labels, pushLabel{name, s.labels[i]})
+		}
+	}
+	return labels
+}
+
+// pushTarget holds the HTTP settings shared by the remote_write and OTLP encoders
+type pushTarget struct {
+	config  SinkConfig
+	metrics MetricsConfig
+	client  *http.Client
+	host    string
+}
+
+func newPushTarget(config SinkConfig, metrics MetricsConfig) pushTarget {
+	return pushTarget{
+		config:  config,
+		metrics: metrics,
+		client:  &http.Client{Timeout: config.timeout()},
+		host:    sinkHostname(),
+	}
+}
+
+// post sends an encoded batch
+// Rejections other than 408 and 429 are permanent: retrying or spooling the same batch
+// cannot succeed, so the pipeline drops it.
+func (t pushTarget) post(body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, t.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", "process-tracker")
+	if t.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.config.Token)
+	}
+	for name, value := range t.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push to %s failed: %w", t.config.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("push to %s returned %s: %s", t.config.URL, resp.Status, strings.TrimSpace(string(message)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// protoFields splits a protobuf message into its fields; varints and doubles are returned
+// as 8 little-endian bytes
+func protoFields(t *testing.T, msg []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		var value []byte
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			value = binary.LittleEndian.AppendUint64(nil, v)
+			msg = msg[n:]
+		case 1:
+			value, msg = msg[:8], msg[8:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			value, msg = msg[n:n+int(size)], msg[n+int(size):]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
+
+// remoteSample is one decoded remote_write sample
+type remoteSample struct {
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest returns the samples of each series keyed by its sorted labels
+func decodeWriteRequest(t *testing.T, body []byte) (map[string][]remoteSample, int) {
+	t.Helper()
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("Body is not snappy: %v", err)
+	}
+	request := protoFields(t, data)
+	series := make(map[string][]remoteSample)
+	for _, ts := range request[pbWriteRequestTimeseries] {
+		fields := protoFields(t, ts)
+		var labels []string
+		for _, l := range fields[pbTimeSeriesLabels] {
+			lf := protoFields(t, l)
+			labels = append(labels, fmt.Sprintf("%s=%s", lf[pbLabelName][0], lf[pbLabelValue][0]))
+		}
+		if !sort.StringsAreSorted(labels) {
+			t.Errorf("Labels not sorted: %v", labels)
+		}
+		key := strings.Join(labels, ",")
+		if _, ok := series[key]; ok {
+			t.Errorf("Series %s sent twice", key)
+		}
+		for _, s := range fields[pbTimeSeriesSamples] {
+			sf := protoFields(t, s)
+			series[key] = append(series[key], remoteSample{
+				value:     math.Float64frombits(binary.LittleEndian.Uint64(sf[pbSampleValue][0])),
+				timestamp: int64(binary.LittleEndian.Uint64(sf[pbSampleTimestamp][0])),
+			})
+		}
+	}
+	return series, len(request[pbWriteRequestMetadata])
+}
+
+// pushReceiver is a stand-in remote_write/OTLP endpoint answering with status
+type pushReceiver struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  int
+	bodies  [][]byte
+	headers []http.Header
+}
+
+func newPushReceiver(t *testing.T) *pushReceiver {
+	r := &pushReceiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.status < 300 {
+			r.bodies = append(r.bodies, body)
+			r.headers = append(r.headers, req.Header.Clone())
+		}
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *pushReceiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *pushReceiver) received() ([][]byte, []http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bodies, r.headers
+}
+
+// TestRemoteWriteSink tests the encoded series, one sample per snapshot, and the headers
+func TestRemoteWriteSink(t *testing.T) {
+	receiver := newPushReceiver(t)
+	sink := NewRemoteWriteSink(SinkConfig{
+		Type:    "remote_write",
+		URL:     receiver.URL + "/api/v1/write",
+		Token:   "secret",
+		Headers: map[string]string{"X-Scope-OrgID": "team-a"},
+		Labels:  map[string]string{"env": "test"},
+	}, t.TempDir(), MetricsConfig{AggregateByName: true})
+
+	first := time.Unix(1700000000, 0)
+	sink.Write(sinkTestRecords(first))
+	sink.Write(sinkTestRecords(first.Add(5 * time.Second)))
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	bodies, headers := receiver.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected both snapshots in one push, got %d", len(bodies))
+	}
+	h := headers[0]
+	if h.Get("Content-Encoding") != "snappy" || h.Get("Content-Type") != "application/x-protobuf" ||
+		h.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("Unexpected remote_write headers: %v", h)
+	}
+	if h.Get("Authorization") != "Bearer secret" || h.Get("X-Scope-OrgID") != "team-a" {
+		t.Errorf("Expected token and extra header, got %v", h)
+	}
+
+	series, metadata := decodeWriteRequest(t, bodies[0])
+	if metadata != len(processMetricFamilies) {
+		t.Errorf("Expected metadata for %d families, got %d", len(processMetricFamilies), metadata)
+	}
+	if len(series) != 2*len(processMetricFamilies) {
+		t.Errorf("Expected %d series, got %d", 2*len(processMetricFamilies), len(series))
+	}
+	key := "__name__=process_tracker_process_cpu_percent,category=web,env=test,instance=" + sinkHostname() + ",job=process-tracker,name=nginx"
+	samples, ok := series[key]
+	if !ok {
+		t.Fatalf("Missing series %s in %v", key, series)
+	}
+	if len(samples) != 2 || samples[0].value != 4 || samples[0].timestamp != first.UnixMilli() ||
+		samples[1].timestamp != first.Add(5*time.Second).UnixMilli() {
+		t.Errorf("Expected one sample of 4 per snapshot, got %+v", samples)
+	}
+}
+
+// TestOTLPSink tests the gzip JSON request with resource attributes and gauges
+func TestOTLPSink(t *testing.T) {
+	receiver := newPushReceiver(t)
+	sink := NewOTLPSink(SinkConfig{
+		Type:   "otlp",
+		URL:    receiver.URL + "/v1/metrics",
+		Labels: map[string]string{"deployment.environment": "test"},
+	}, t.TempDir(), MetricsConfig{AggregateByName: true})
+
+	now := time.Unix(1700000000, 0)
+	sink.Write(sinkTestRecords(now))
+	sink.Close()
+
+	bodies, headers := receiver.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected one push, got %d", len(bodies))
+	}
+	if headers[0].Get("Content-Encoding") != "gzip" || headers[0].Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected OTLP headers: %v", headers[0])
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(bodies[0]))
+	if err != nil {
+		t.Fatalf("Body is not gzip: %v", err)
+	}
+	var request otlpRequest
+	if err := json.NewDecoder(gz).Decode(&request); err != nil {
+		t.Fatalf("Body is not OTLP JSON: %v", err)
+	}
+
+	rm := request.ResourceMetrics[0]
+	attributes := map[string]string{}
+	for _, a := range rm.Resource.Attributes {
+		attributes[a.Key] = a.Value.StringValue
+	}
+	if attributes["service.name"] != "process-tracker" || attributes["deployment.environment"] != "test" {
+		t.Errorf("Unexpected resource attributes: %v", attributes)
+	}
+	metrics := map[string]otlpMetric{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	cpu := metrics["process_tracker_process_cpu_percent"]
+	if cpu.Gauge == nil || len(cpu.Gauge.DataPoints) != 2 {
+		t.Fatalf("Expected a gauge with 2 points, got %+v", cpu)
+	}
+	// Totals of the running processes drop when one exits, so they are not monotonic sums
+	if seconds := metrics["process_tracker_process_cpu_seconds"]; seconds.Gauge == nil || seconds.Sum != nil {
+		t.Errorf("Expected CPU seconds as a gauge, got %+v", seconds)
+	}
+	point := cpu.Gauge.DataPoints[0]
+	if point.TimeUnixNano != fmt.Sprint(now.UnixNano()) {
+		t.Errorf("Expected time %d, got %s", now.UnixNano(), point.TimeUnixNano)
+	}
+}
+
+// TestPushSink_SpoolAndReplay tests that pushes are spooled while the endpoint is down and
+// replayed in order, across a restart, once it recovers
+func TestPushSink_SpoolAndReplay(t *testing.T) {
+	receiver := newPushReceiver(t)
+	receiver.setStatus(http.StatusServiceUnavailable)
+	dir := t.TempDir()
+	config := SinkConfig{Name: "mimir", Type: "remote_write", URL: receiver.URL, MaxRetries: 1}
+
+	first := time.Unix(1700000000, 0)
+	sink := NewRemoteWriteSink(config, dir, MetricsConfig{})
+	sink.Write(sinkTestRecords(first))
+	sink.Close()
+
+	stats := sink.(pipelineSink).pipelineStats()
+	if stats.JournalRecords != 3 || stats.Written != 0 {
+		t.Errorf("Expected 3 spooled records, got %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "push-mimir.jsonl")); err != nil {
+		t.Fatalf("Expected spool file: %v", err)
+	}
+
+	// Endpoint down entirely: the spool grows
+	receiver.setStatus(http.StatusNoContent)
+	down := NewRemoteWriteSink(SinkConfig{Name: "mimir", Type: "remote_write", URL: "http://127.0.0.1:1", MaxRetries: 1}, dir, MetricsConfig{})
+	down.Write(sinkTestRecords(first.Add(5 * time.Second)))
+	down.Close()
+
+	second := time.Unix(1700000010, 0)
+	sink = NewRemoteWriteSink(config, dir, MetricsConfig{})
+	sink.Write(sinkTestRecords(second))
+	sink.Close()
+
+	bodies, _ := receiver.received()
+	var timestamps []int64
+	for _, body := range bodies {
+		series, _ := decodeWriteRequest(t, body)
+		for key, samples := range series {
+			if strings.HasPrefix(key, "__name__=process_tracker_process_cpu_percent,") && strings.HasSuffix(key, ",name=nginx") {
+				for _, s := range samples {
+					timestamps = append(timestamps, s.timestamp)
+				}
+			}
+		}
+	}
+	want := []int64{first.UnixMilli(), first.Add(5 * time.Second).UnixMilli(), second.UnixMilli()}
+	if fmt.Sprint(timestamps) != fmt.Sprint(want) {
+		t.Errorf("Expected spooled snapshots replayed in order %v, got %v", want, timestamps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "push-mimir.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("Expected spool removed after replay")
+	}
+}
+
+// TestPushSink_RejectedDropped tests that a batch the endpoint rejects is dropped, not spooled
+func TestPushSink_RejectedDropped(t *testing.T) {
+	receiver := newPushReceiver(t)
+	receiver.setStatus(http.StatusBadRequest)
+	dir := t.TempDir()
+
+	sink := NewOTLPSink(SinkConfig{Type: "otlp", URL: receiver.URL}, dir, MetricsConfig{})
+	sink.Write(sinkTestRecords(time.Now()))
+	sink.Close()
+
+	stats := sink.(pipelineSink).pipelineStats()
+	if stats.Dropped != 3 || stats.JournalRecords != 0 || stats.Retries != 0 {
+		t.Errorf("Expected the batch dropped without retries, got %+v", stats)
+	}
+	if !strings.Contains(stats.LastError, "400") {
+		t.Errorf("Expected the rejection in LastError, got %q", stats.LastError)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "push-otlp.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("Expected no spool file for a rejected batch")
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// sketchExactValues is how many values a quantile sketch keeps before it switches to buckets
+const sketchExactValues = 2048
+
+// sketchRelativeAccuracy bounds the relative error of percentiles once values are bucketed
+const sketchRelativeAccuracy = 0.01
+
+// sketchMinValue is the smallest value given a bucket of its own; smaller values count as zero
+const sketchMinValue = 1e-9
+
+// sketchGamma is the ratio between the bounds of consecutive buckets
+var sketchGamma = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+
+// quantileSketch summarizes non-negative values in bounded memory
+// Percentiles are exact while it holds at most sketchExactValues values. Beyond that the values
+// are counted in logarithmic buckets (as in DDSketch), so every percentile is within 1% of a
+// value of the data and the memory no longer grows with the number of samples.
+type quantileSketch struct {
+	values  []float64      // Every value, until the sketch switches to buckets
+	buckets map[int]uint64 // Counts by bucket index; nil while values are kept
+	zeros   uint64         // Values too small for a bucket
+	count   uint64
+	max     float64
+	mean    float64 // Running mean and sum of squared deviations (Welford)
+	m2      float64
+}
+
+// Add adds a value
+func (s *quantileSketch) Add(v float64) {
+	s.count++
+	if s.count == 1 || v > s.max {
+		s.max = v
+	}
+	delta := v - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (v - s.mean)
+
+	if s.buckets == nil {
+		s.values = append(s.values, v)
+		if len(s.values) <= sketchExactValues {
+			return
+		}
+		s.buckets = make(map[int]uint64)
+		for _, value := range s.values {
+			s.addBucket(value)
+		}
+		s.values = nil
+		return
+	}
+	s.addBucket(v)
+}
+
+func (s *quantileSketch) addBucket(v float64) {
+	if v < sketchMinValue {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(v)/math.Log(sketchGamma)))]++
+}
+
+// Count returns the number of values added
+func (s *quantileSketch) Count() int {
+	return int(s.count)
+}
+
+// Max returns the largest value
+func (s *quantileSketch) Max() float64 {
+	return s.max
+}
+
+// MeanStdDev returns the mean and population standard deviation
+func (s *quantileSketch) MeanStdDev() (float64, float64) {
+	if s.buckets == nil {
+		return meanStdDev(s.values)
+	}
+	return s.mean, math.Sqrt(s.m2 / float64(s.count))
+}
+
+// Percentiles returns the p-th percentile (0-100) of the values for each p
+func (s *quantileSketch) Percentiles(ps ...float64) []float64 {
+	results := make([]float64, len(ps))
+	if s.count == 0 {
+		return results
+	}
+	if s.buckets == nil {
+		sort.Float64s(s.values)
+		for i, p := range ps {
+			results[i] = Percentile(s.values, p)
+		}
+		return results
+	}
+
+	indexes := make([]int, 0, len(s.buckets))
+	for index := range s.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for i, p := range ps {
+		rank := uint64(math.Round(p / 100 * float64(s.count-1)))
+		seen := s.zeros
+		if rank < seen {
+			continue // Among the zeros
+		}
+		for _, index := range indexes {
+			seen += s.buckets[index]
+			if rank < seen {
+				// The middle of the bucket, in relative terms
+				results[i] = math.Min(2*math.Pow(sketchGamma, float64(index))/(sketchGamma+1), s.max)
+				break
+			}
+		}
+	}
+	return results
+}
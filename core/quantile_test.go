@@ -0,0 +1,50 @@
+package core
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+// TestQuantileSketch tests that percentiles are exact for few values and within the relative
+// accuracy once the sketch switches to buckets
+func TestQuantileSketch(t *testing.T) {
+	var small quantileSketch
+	for _, v := range []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100} {
+		small.Add(v)
+	}
+	if p := small.Percentiles(50, 90); !approxEqual(p[0], 55) || !approxEqual(p[1], 91) {
+		t.Errorf("Expected exact percentiles 55 and 91, got %v", p)
+	}
+
+	// A tenth of the samples idle, the rest spread over 1..1000
+	var large quantileSketch
+	var values []float64
+	for i := 0; i < 50*sketchExactValues; i++ {
+		v := 0.0
+		if i%10 != 0 {
+			v = float64(i%1000) + 1
+		}
+		large.Add(v)
+		values = append(values, v)
+	}
+	if large.values != nil || len(large.buckets) > 1000 {
+		t.Fatalf("Expected a bounded number of buckets, got %d values and %d buckets", len(large.values), len(large.buckets))
+	}
+	if large.Count() != len(values) || large.Max() != 1000 {
+		t.Errorf("Expected %d values up to 1000, got %d up to %v", len(values), large.Count(), large.Max())
+	}
+
+	sort.Float64s(values)
+	ps := []float64{5, 50, 90, 99, 100}
+	for i, got := range large.Percentiles(ps...) {
+		want := Percentile(values, ps[i])
+		if math.Abs(got-want) > want*sketchRelativeAccuracy {
+			t.Errorf("p%v: expected %v within 1%%, got %v", ps[i], want, got)
+		}
+	}
+	wantMean, wantStdDev := meanStdDev(values)
+	if mean, stdDev := large.MeanStdDev(); !approxEqual(mean, wantMean) || math.Abs(stdDev-wantStdDev) > 1e-6*wantStdDev {
+		t.Errorf("Expected mean %v and stddev %v, got %v and %v", wantMean, wantStdDev, mean, stdDev)
+	}
+}
@@ -0,0 +1,334 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordQuery describes a filtered read of resource records
+// Zero values mean "no restriction"; storage backends push as much of it down as they can
+type RecordQuery struct {
+	Start      time.Time // Inclusive lower bound on the timestamp
+	End        time.Time // Inclusive upper bound on the timestamp
+	Names      []string  // Exact process names
+	Categories []string  // Exact categories
+	PIDs       []int32   // Process IDs
+	Users      []string  // Owner user names
+	Hosts      []string  // Hosts the records were collected on (see ResourceRecord.Host)
+	Text       string    // Words that must all appear in the command line or working directory (see SearchCommands)
+
+	// LatestOnly keeps only the most recent record of each PID (per host) matching the other filters
+	LatestOnly bool
+
+	Fields     []string // Fields to populate (see RecordFields); empty means all
+	OrderBy    string   // Field to order by (default: timestamp)
+	Descending bool
+	Limit      int // Maximum number of records; 0 means unlimited
+	Offset     int
+}
+
+// RecordFields lists the field names accepted by RecordQuery.Fields and RecordQuery.OrderBy
+var RecordFields = []string{
+	"timestamp", "name", "cpu_percent", "cpu_percent_normalized", "memory_mb", "memory_percent",
+	"threads", "disk_read_mb", "disk_write_mb", "net_sent_kb", "net_recv_kb", "is_active",
+	"command", "working_dir", "category", "pid", "ppid", "create_time", "cpu_time",
+	"labels", "uid", "username", "host",
+}
+
+// orderableFields are the fields records can be ordered by
+var orderableFields = map[string]bool{
+	"timestamp": true, "name": true, "cpu_percent": true, "cpu_percent_normalized": true,
+	"memory_mb": true, "memory_percent": true, "is_active": true, "category": true,
+	"pid": true, "username": true, "host": true,
+}
+
+// Validate checks field and ordering names
+func (q RecordQuery) Validate() error {
+	for _, field := range q.Fields {
+		if !isRecordField(field) {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	if q.OrderBy != "" && !orderableFields[q.OrderBy] {
+		return fmt.Errorf("cannot order by %q", q.OrderBy)
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	if q.Text != "" {
+		if err := ValidateSearchText(q.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isRecordField(name string) bool {
+	for _, field := range RecordFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a record satisfies the query filters (ordering and paging are ignored)
+func (q RecordQuery) Matches(r ResourceRecord) bool {
+	if !q.Start.IsZero() && r.Timestamp.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && r.Timestamp.After(q.End) {
+		return false
+	}
+	if len(q.Names) > 0 && !containsString(q.Names, r.Name) {
+		return false
+	}
+	if len(q.Categories) > 0 && !containsString(q.Categories, r.Category) {
+		return false
+	}
+	if len(q.Users) > 0 && !containsString(q.Users, r.Username) {
+		return false
+	}
+	if len(q.Hosts) > 0 && !containsString(q.Hosts, r.Host) {
+		return false
+	}
+	if q.Text != "" && !matchesText(parseSearchText(q.Text), r.Command, r.WorkingDir) {
+		return false
+	}
+	if len(q.PIDs) > 0 {
+		found := false
+		for _, pid := range q.PIDs {
+			if pid == r.PID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// naturalOrder reports whether the query wants records in storage order (oldest first)
+func (q RecordQuery) naturalOrder() bool {
+	return (q.OrderBy == "" || q.OrderBy == "timestamp") && !q.Descending
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordIterator iterates over query results
+//
+//	it, err := storage.Query(ctx, query)
+//	...
+//	defer it.Close()
+//	for it.Next() {
+//		record := it.Record()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type RecordIterator interface {
+	Next() bool
+	Record() ResourceRecord
+	Err() error
+	Close() error
+}
+
+// CollectRecords drains an iterator into a slice and closes it
+func CollectRecords(it RecordIterator) ([]ResourceRecord, error) {
+	defer it.Close()
+	var records []ResourceRecord
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	return records, it.Err()
+}
+
+// sliceIterator iterates over records already held in memory
+type sliceIterator struct {
+	records []ResourceRecord
+	pos     int
+}
+
+func newSliceIterator(records []ResourceRecord) *sliceIterator {
+	return &sliceIterator{records: records, pos: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos+1 >= len(it.records) {
+		it.pos = len(it.records)
+		return false
+	}
+	it.pos++
+	return true
+}
+
+func (it *sliceIterator) Record() ResourceRecord { return it.records[it.pos] }
+func (it *sliceIterator) Err() error             { return nil }
+func (it *sliceIterator) Close() error           { return nil }
+
+// applyQuery filters, orders, pages and projects records held in memory
+// Used by backends that cannot push the query down
+func applyQuery(records []ResourceRecord, q RecordQuery) []ResourceRecord {
+	var matched []ResourceRecord
+	for _, r := range records {
+		if q.Matches(r) {
+			matched = append(matched, r)
+		}
+	}
+	if q.LatestOnly {
+		matched = LatestByPID(matched)
+	}
+
+	sortRecords(matched, q.OrderBy, q.Descending)
+	matched = pageRecords(matched, q.Limit, q.Offset)
+
+	for i := range matched {
+		matched[i] = projectRecord(matched[i], q.Fields)
+	}
+	return matched
+}
+
+// sortRecords orders records by a field (see orderableFields); ties keep timestamp order
+func sortRecords(records []ResourceRecord, orderBy string, descending bool) {
+	less := func(a, b ResourceRecord) bool {
+		switch orderBy {
+		case "name":
+			return a.Name < b.Name
+		case "cpu_percent":
+			return a.CPUPercent < b.CPUPercent
+		case "cpu_percent_normalized":
+			return a.CPUPercentNormalized < b.CPUPercentNormalized
+		case "memory_mb":
+			return a.MemoryMB < b.MemoryMB
+		case "memory_percent":
+			return a.MemoryPercent < b.MemoryPercent
+		case "is_active":
+			return !a.IsActive && b.IsActive
+		case "category":
+			return a.Category < b.Category
+		case "pid":
+			return a.PID < b.PID
+		case "username":
+			return a.Username < b.Username
+		case "host":
+			return a.Host < b.Host
+		default:
+			return a.Timestamp.Before(b.Timestamp)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if descending {
+			return less(records[j], records[i])
+		}
+		return less(records[i], records[j])
+	})
+}
+
+func pageRecords(records []ResourceRecord, limit, offset int) []ResourceRecord {
+	if offset >= len(records) {
+		return nil
+	}
+	records = records[offset:]
+	if limit > 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+// projectRecord clears the fields not requested by a query; no fields means all fields
+func projectRecord(r ResourceRecord, fields []string) ResourceRecord {
+	if len(fields) == 0 {
+		return r
+	}
+	var p ResourceRecord
+	for _, field := range fields {
+		switch field {
+		case "timestamp":
+			p.Timestamp = r.Timestamp
+		case "name":
+			p.Name = r.Name
+		case "cpu_percent":
+			p.CPUPercent = r.CPUPercent
+		case "cpu_percent_normalized":
+			p.CPUPercentNormalized = r.CPUPercentNormalized
+		case "memory_mb":
+			p.MemoryMB = r.MemoryMB
+		case "memory_percent":
+			p.MemoryPercent = r.MemoryPercent
+		case "threads":
+			p.Threads = r.Threads
+		case "disk_read_mb":
+			p.DiskReadMB = r.DiskReadMB
+		case "disk_write_mb":
+			p.DiskWriteMB = r.DiskWriteMB
+		case "net_sent_kb":
+			p.NetSentKB = r.NetSentKB
+		case "net_recv_kb":
+			p.NetRecvKB = r.NetRecvKB
+		case "is_active":
+			p.IsActive = r.IsActive
+		case "command":
+			p.Command = r.Command
+		case "working_dir":
+			p.WorkingDir = r.WorkingDir
+		case "category":
+			p.Category = r.Category
+		case "pid":
+			p.PID = r.PID
+		case "ppid":
+			p.PPID = r.PPID
+		case "create_time":
+			p.CreateTime = r.CreateTime
+		case "cpu_time":
+			p.CPUTime = r.CPUTime
+		case "labels":
+			p.Labels = r.Labels
+		case "uid":
+			p.UID = r.UID
+		case "username":
+			p.Username = r.Username
+		case "host":
+			p.Host = r.Host
+		}
+	}
+	return p
+}
+
+// ParseQueryTime parses an absolute time (RFC3339, "2006-01-02 15:04[:05]", unix seconds)
+// or a relative duration before now (e.g. "12h" or "30d")
+func ParseQueryTime(value string, fallback, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") {
+		return now.AddDate(0, 0, -days), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format %q (use RFC3339, '2006-01-02 15:04', unix seconds or a duration like '12h' or '30d')", value)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// queryTestRecords returns three collection cycles of three processes owned by two users
+func queryTestRecords(base time.Time) []ResourceRecord {
+	var records []ResourceRecord
+	for i := 0; i < 3; i++ {
+		ts := base.Add(time.Duration(i) * 10 * time.Second)
+		records = append(records,
+			ResourceRecord{Timestamp: ts, Name: "bash", PID: 100, CPUPercent: 1, MemoryMB: 10, Category: "system", Username: "alice"},
+			ResourceRecord{Timestamp: ts, Name: "train", PID: 200, CPUPercent: 50 + float64(i)*10, MemoryMB: 512, IsActive: true, Category: "development", Username: "alice"},
+			ResourceRecord{Timestamp: ts, Name: "vim", PID: 300, CPUPercent: 2, MemoryMB: 20, Category: "other", Username: "bob"},
+		)
+	}
+	return records
+}
+
+// checkStorageQuery runs the same queries against a storage holding queryTestRecords(base)
+func checkStorageQuery(t *testing.T, storage Storage, base time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	query := func(q RecordQuery) []ResourceRecord {
+		t.Helper()
+		it, err := storage.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("Query %+v failed: %v", q, err)
+		}
+		records, err := CollectRecords(it)
+		if err != nil {
+			t.Fatalf("Query %+v failed: %v", q, err)
+		}
+		return records
+	}
+
+	if got := query(RecordQuery{}); len(got) != 9 {
+		t.Errorf("Expected 9 records, got %d", len(got))
+	}
+
+	// Time range bounds are inclusive
+	got := query(RecordQuery{Start: base.Add(10 * time.Second), End: base.Add(20 * time.Second)})
+	if len(got) != 6 {
+		t.Errorf("Expected 6 records in range, got %d", len(got))
+	}
+
+	got = query(RecordQuery{Users: []string{"alice"}, Categories: []string{"development"}})
+	if len(got) != 3 || got[0].Name != "train" {
+		t.Errorf("Expected 3 train records, got %+v", got)
+	}
+
+	got = query(RecordQuery{Names: []string{"vim", "bash"}, PIDs: []int32{300}})
+	if len(got) != 3 || got[0].PID != 300 {
+		t.Errorf("Expected 3 vim records, got %+v", got)
+	}
+
+	got = query(RecordQuery{LatestOnly: true, OrderBy: "pid"})
+	if len(got) != 3 || got[0].PID != 100 || got[2].PID != 300 {
+		t.Fatalf("Expected latest record of 3 processes, got %+v", got)
+	}
+	if !got[1].Timestamp.Equal(base.Add(20*time.Second)) || got[1].CPUPercent != 70 {
+		t.Errorf("Expected latest train record, got %+v", got[1])
+	}
+
+	got = query(RecordQuery{OrderBy: "cpu_percent", Descending: true, Limit: 2, Offset: 1})
+	if len(got) != 2 || got[0].CPUPercent != 60 || got[1].CPUPercent != 50 {
+		t.Errorf("Expected CPU 60, 50, got %+v", got)
+	}
+
+	got = query(RecordQuery{Offset: 8})
+	if len(got) != 1 || got[0].Name != "vim" {
+		t.Errorf("Expected last record only, got %+v", got)
+	}
+
+	got = query(RecordQuery{PIDs: []int32{200}, Fields: []string{"pid", "cpu_percent"}, Limit: 1})
+	if len(got) != 1 || got[0].PID != 200 || got[0].CPUPercent != 50 {
+		t.Fatalf("Unexpected projected record: %+v", got)
+	}
+	if got[0].Name != "" || got[0].MemoryMB != 0 || !got[0].Timestamp.IsZero() {
+		t.Errorf("Expected unrequested fields to be empty, got %+v", got[0])
+	}
+
+	if _, err := storage.Query(ctx, RecordQuery{OrderBy: "command"}); err == nil {
+		t.Error("Expected error ordering by an unsupported field")
+	}
+	if _, err := storage.Query(ctx, RecordQuery{Fields: []string{"bogus"}}); err == nil {
+		t.Error("Expected error for an unknown field")
+	}
+}
+
+// TestManager_Query tests filtered queries against CSV storage
+func TestManager_Query(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-query.log")
+	defer os.Remove(tmpFile)
+
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	manager := NewManager(tmpFile, 100, false, GetDefaultStorageConfig())
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer manager.Close()
+
+	if err := manager.SaveRecords(queryTestRecords(base)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	if err := manager.flushBuffer(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	checkStorageQuery(t, manager, base)
+}
+
+// TestSQLiteStorage_Query tests filtered queries against SQLite storage
+func TestSQLiteStorage_Query(t *testing.T) {
+	tmpDB := filepath.Join(os.TempDir(), "test-query.db")
+	os.Remove(tmpDB)
+	defer os.Remove(tmpDB)
+
+	config := GetDefaultStorageConfig()
+	config.Type = "sqlite"
+	config.SQLitePath = tmpDB
+	storage := NewSQLiteStorage(tmpDB, 100, config)
+	if err := storage.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer storage.Close()
+
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := storage.SaveRecords(queryTestRecords(base)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+
+	checkStorageQuery(t, storage, base)
+}
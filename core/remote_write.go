@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/golang/snappy"
+)
+
+// Prometheus remote_write 1.0 message fields (prompb.WriteRequest)
+const (
+	pbWriteRequestTimeseries = 1
+	pbWriteRequestMetadata   = 3
+	pbTimeSeriesLabels       = 1
+	pbTimeSeriesSamples      = 2
+	pbLabelName              = 1
+	pbLabelValue             = 2
+	pbSampleValue            = 1
+	pbSampleTimestamp        = 2
+	pbMetadataType           = 1
+	pbMetadataFamilyName     = 2
+	pbMetadataHelp           = 4
+
+	pbMetricTypeCounter = 1
+	pbMetricTypeGauge   = 2
+)
+
+// protoBuffer appends protobuf fields to a message
+type protoBuffer []byte
+
+func (b *protoBuffer) tag(field, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field<<3|wireType))
+}
+
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.tag(field, 0)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *protoBuffer) double(field int, v float64) {
+	b.tag(field, 1)
+	*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.tag(field, 2)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuffer) string(field int, v string) {
+	b.bytes(field, []byte(v))
+}
+
+// remoteWriter pushes batches to a Prometheus remote_write endpoint (snappy-compressed protobuf)
+type remoteWriter struct {
+	pushTarget
+}
+
+// NewRemoteWriteSink creates a sink pushing to config.URL; the spool defaults to dataDir
+func NewRemoteWriteSink(config SinkConfig, dataDir string, metrics MetricsConfig) Sink {
+	return newPushSink(config, &remoteWriter{newPushTarget(config, metrics)}, dataDir)
+}
+
+// SaveRecords encodes and pushes one batch
+func (w *remoteWriter) SaveRecords(records []ResourceRecord) error {
+	body := snappy.Encode(nil, w.encode(records))
+	return w.post(body, map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+// remoteSeries is one time series of a remote_write request
+type remoteSeries struct {
+	labels  []pushLabel
+	samples []protoBuffer
+}
+
+// encode builds a WriteRequest holding each series once with a sample per snapshot
+func (w *remoteWriter) encode(records []ResourceRecord) []byte {
+	common := []pushLabel{{"job", "process-tracker"}, {"instance", w.host}}
+	for name, value := range w.config.Labels {
+		common = append(common, pushLabel{name, value})
+	}
+	labelNames := w.metrics.processLabelNames()
+
+	index := make(map[string]*remoteSeries)
+	var order []string
+	for _, snapshot := range splitSnapshots(records) {
+		timestamp := snapshot.time.UnixMilli()
+		for _, s := range buildProcessSeries(snapshot.records, w.metrics) {
+			labels := append(seriesLabels(labelNames, s), common...)
+			for _, family := range processMetricFamilies {
+				all := append([]pushLabel{{"__name__", family.name}}, labels...)
+				sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+				key := ""
+				for _, l := range all {
+					key += l.name + "\x00" + l.value + "\x00"
+				}
+				series, ok := index[key]
+				if !ok {
+					series = &remoteSeries{labels: all}
+					index[key] = series
+					order = append(order, key)
+				}
+				var sample protoBuffer
+				sample.double(pbSampleValue, family.value(s))
+				sample.varint(pbSampleTimestamp, uint64(timestamp))
+				series.samples = append(series.samples, sample)
+			}
+		}
+	}
+
+	var request protoBuffer
+	for _, key := range order {
+		series := index[key]
+		var ts protoBuffer
+		for _, l := range series.labels {
+			var label protoBuffer
+			label.string(pbLabelName, l.name)
+			label.string(pbLabelValue, l.value)
+			ts.bytes(pbTimeSeriesLabels, label)
+		}
+		for _, sample := range series.samples {
+			ts.bytes(pbTimeSeriesSamples, sample)
+		}
+		request.bytes(pbWriteRequestTimeseries, ts)
+	}
+	for _, family := range processMetricFamilies {
+		var metadata protoBuffer
+		kind := pbMetricTypeGauge
+		if family.kind == "counter" {
+			kind = pbMetricTypeCounter
+		}
+		metadata.varint(pbMetadataType, uint64(kind))
+		metadata.string(pbMetadataFamilyName, family.name)
+		metadata.string(pbMetadataHelp, family.help)
+		request.bytes(pbWriteRequestMetadata, metadata)
+	}
+	return request
+}
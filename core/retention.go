@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// RetentionRule keeps the samples of matching processes for its own period instead of keep_days
+// All conditions set in a rule must match. Rules are checked in order and the first match
+// decides; samples matching no rule are kept for keep_days.
+type RetentionRule struct {
+	Name      string `yaml:"name"`       // Process name, exact or glob (e.g. "docker:*"), case-insensitive
+	Category  string `yaml:"category"`   // Process category (e.g. "database")
+	Inactive  bool   `yaml:"inactive"`   // Only samples taken while the process was inactive
+	KeepDays  int    `yaml:"keep_days"`  // Days to keep matching samples
+	KeepHours int    `yaml:"keep_hours"` // Hours to keep, added to keep_days; both 0 means forever
+}
+
+// Keep returns how long matching samples are kept; 0 means forever
+func (r RetentionRule) Keep() time.Duration {
+	return time.Duration(r.KeepDays)*24*time.Hour + time.Duration(r.KeepHours)*time.Hour
+}
+
+// String returns a human readable description of the rule
+func (r RetentionRule) String() string {
+	var parts []string
+	if r.Name != "" {
+		parts = append(parts, fmt.Sprintf("name=%s", r.Name))
+	}
+	if r.Category != "" {
+		parts = append(parts, fmt.Sprintf("category=%s", r.Category))
+	}
+	if r.Inactive {
+		parts = append(parts, "inactive")
+	}
+	return strings.Join(parts, " ")
+}
+
+// RetentionStorage is implemented by storage backends that apply retention rules to process samples
+type RetentionStorage interface {
+	// ApplyRetention deletes expired samples, or only counts them when dryRun is set.
+	// System records and process events expire after keep_days.
+	ApplyRetention(policy *RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error)
+}
+
+// RetentionReport describes what a retention pass deleted, or would delete in a dry run
+type RetentionReport struct {
+	DryRun        bool              `json:"dry_run"`
+	Rules         []RetentionResult `json:"rules"` // Configured rules in order, then keep_days for all other samples
+	Samples       int64             `json:"samples"`
+	SystemRecords int64             `json:"system_records"`
+	ProcessEvents int64             `json:"process_events"`
+	Malformed     int64             `json:"malformed,omitempty"` // Unparseable CSV rows, kept as they are
+}
+
+// RetentionResult is the outcome of one retention rule
+type RetentionResult struct {
+	Rule    string     `json:"rule"`
+	Keep    string     `json:"keep"`             // e.g. "90d", "6h" or "forever"
+	Cutoff  *time.Time `json:"cutoff,omitempty"` // Samples before this are expired; nil when kept forever
+	Samples int64      `json:"samples"`
+}
+
+// add records expired samples under the rule at index
+func (r *RetentionReport) add(index int, samples int64) {
+	r.Rules[index].Samples += samples
+	r.Samples += samples
+}
+
+// RetentionPolicy matches samples against retention rules
+type RetentionPolicy struct {
+	rules []RetentionRule
+	names []string        // Lower-cased name patterns
+	keep  []time.Duration // Per rule, then keep_days; 0 means forever
+}
+
+// NewRetentionPolicy compiles retention rules, with keepDays applying to samples that match none
+func NewRetentionPolicy(keepDays int, rules []RetentionRule) (*RetentionPolicy, error) {
+	p := &RetentionPolicy{rules: rules}
+	for i, rule := range rules {
+		if rule.Name == "" && rule.Category == "" && !rule.Inactive {
+			return nil, fmt.Errorf("retention rule %d must set name, category or inactive", i+1)
+		}
+		if rule.KeepDays < 0 || rule.KeepHours < 0 {
+			return nil, fmt.Errorf("retention rule %d (%s): keep_days and keep_hours must be non-negative", i+1, rule)
+		}
+		name := strings.ToLower(rule.Name)
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("retention rule %d: name pattern %q: %w", i+1, rule.Name, err)
+		}
+		p.names = append(p.names, name)
+		p.keep = append(p.keep, rule.Keep())
+	}
+	p.keep = append(p.keep, time.Duration(keepDays)*24*time.Hour)
+	return p, nil
+}
+
+// ValidateRetentionRules checks that all retention rules compile
+func ValidateRetentionRules(rules []RetentionRule) error {
+	_, err := NewRetentionPolicy(0, rules)
+	return err
+}
+
+// Match returns the index of the first rule matching a process sample, or the index of the
+// keep_days default (the number of rules) when none does
+func (p *RetentionPolicy) Match(name, category string, active bool) int {
+	lower := strings.ToLower(name)
+	for i, rule := range p.rules {
+		if rule.Inactive && active {
+			continue
+		}
+		if p.names[i] != "" {
+			if ok, _ := path.Match(p.names[i], lower); !ok {
+				continue
+			}
+		}
+		if rule.Category != "" && !strings.EqualFold(rule.Category, category) {
+			continue
+		}
+		return i
+	}
+	return len(p.rules)
+}
+
+// Cutoff returns the time before which samples under rule index are expired; zero means kept forever
+func (p *RetentionPolicy) Cutoff(index int, now time.Time) time.Time {
+	if p.keep[index] <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-p.keep[index])
+}
+
+// Expired reports whether a record is past the retention of the rule it matches
+func (p *RetentionPolicy) Expired(record ResourceRecord, now time.Time) (int, bool) {
+	index := p.Match(record.Name, record.Category, record.IsActive)
+	cutoff := p.Cutoff(index, now)
+	return index, !cutoff.IsZero() && record.Timestamp.Before(cutoff)
+}
+
+// DefaultCutoff returns the keep_days cutoff; zero means kept forever
+func (p *RetentionPolicy) DefaultCutoff(now time.Time) time.Time {
+	return p.Cutoff(len(p.rules), now)
+}
+
+// Longest returns the longest retention of any rule or keep_days; 0 means something is kept forever
+func (p *RetentionPolicy) Longest() time.Duration {
+	var longest time.Duration
+	for _, keep := range p.keep {
+		if keep <= 0 {
+			return 0
+		}
+		if keep > longest {
+			longest = keep
+		}
+	}
+	return longest
+}
+
+// newReport returns an empty report listing every rule and its cutoff
+func (p *RetentionPolicy) newReport(now time.Time, dryRun bool) RetentionReport {
+	report := RetentionReport{DryRun: dryRun}
+	for i := range p.keep {
+		result := RetentionResult{Rule: "keep_days", Keep: formatRetention(p.keep[i])}
+		if i < len(p.rules) {
+			result.Rule = p.rules[i].String()
+		}
+		if cutoff := p.Cutoff(i, now); !cutoff.IsZero() {
+			result.Cutoff = &cutoff
+		}
+		report.Rules = append(report.Rules, result)
+	}
+	return report
+}
+
+// formatRetention formats a retention period as days and hours
+func formatRetention(keep time.Duration) string {
+	if keep <= 0 {
+		return "forever"
+	}
+	days := int(keep / (24 * time.Hour))
+	hours := int(keep % (24 * time.Hour) / time.Hour)
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dd", days)
+	case days == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	}
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// retentionTestRules keeps containers and databases for 90 days, browsers for a day and
+// inactive samples for 6 hours
+func retentionTestRules() []RetentionRule {
+	return []RetentionRule{
+		{Name: "docker:*", KeepDays: 90},
+		{Category: "database", KeepDays: 90},
+		{Category: "browser", KeepDays: 1},
+		{Inactive: true, KeepHours: 6},
+	}
+}
+
+// TestRetentionPolicy tests rule order, case-insensitive names and the keep_days fallback
+func TestRetentionPolicy(t *testing.T) {
+	policy, err := NewRetentionPolicy(7, retentionTestRules())
+	if err != nil {
+		t.Fatalf("NewRetentionPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name, category string
+		active         bool
+		want           int
+	}{
+		{"Docker:Redis", "container", false, 0},
+		{"postgres", "database", false, 1}, // An earlier rule wins over the inactive rule
+		{"chrome", "browser", true, 2},
+		{"worker", "python", false, 3},
+		{"worker", "python", true, 4}, // keep_days
+	}
+	for _, tt := range tests {
+		if got := policy.Match(tt.name, tt.category, tt.active); got != tt.want {
+			t.Errorf("Match(%s, %s, %v) = %d, want %d", tt.name, tt.category, tt.active, got, tt.want)
+		}
+	}
+
+	if policy.Longest() != 90*24*time.Hour {
+		t.Errorf("Expected the longest retention to be 90 days, got %v", policy.Longest())
+	}
+	if forever, _ := NewRetentionPolicy(0, retentionTestRules()); forever.Longest() != 0 {
+		t.Errorf("Expected keep_days 0 to keep files forever, got %v", forever.Longest())
+	}
+
+	for _, invalid := range [][]RetentionRule{{{KeepDays: 1}}, {{Name: "[", KeepDays: 1}}, {{Category: "x", KeepHours: -1}}} {
+		if err := ValidateRetentionRules(invalid); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+// TestApplyRetention_Backends tests that both backends count the same expired samples in a
+// dry run, delete exactly those, and keep accepting writes afterwards
+func TestApplyRetention_Backends(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	day := 24 * time.Hour
+	records := []ResourceRecord{
+		{Name: "docker:nginx", Category: "container", PID: 10, CreateTime: 1, Timestamp: now.Add(-30 * day), IsActive: true},
+		{Name: "Docker:Redis", Category: "container", PID: 11, CreateTime: 1, Timestamp: now.Add(-100 * day), IsActive: true},
+		{Name: "postgres", Category: "database", PID: 12, CreateTime: 1, Timestamp: now.Add(-30 * day)},
+		{Name: "chrome", Category: "browser", PID: 13, CreateTime: 1, Timestamp: now.Add(-2 * day), IsActive: true},
+		{Name: "worker", Category: "python", PID: 14, CreateTime: 1, Timestamp: now.Add(-12 * time.Hour)},
+		{Name: "worker", Category: "python", PID: 14, CreateTime: 1, Timestamp: now.Add(-11 * time.Hour), IsActive: true},
+		{Name: "worker", Category: "python", PID: 14, CreateTime: 1, Timestamp: now.Add(-10 * day), IsActive: true},
+	}
+	// Expired per rule: docker:* 1, database 0, browser 1, inactive 1, keep_days 1
+	want := []int64{1, 0, 1, 1, 1}
+
+	config := GetDefaultStorageConfig()
+	config.Retention = retentionTestRules()
+	csv := NewManager(filepath.Join(dir, "process-tracker.log"), 10, true, config)
+	if err := csv.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize CSV storage: %v", err)
+	}
+	defer csv.Close()
+	sqlite := openTestSQLite(t, filepath.Join(dir, "tracker.db"))
+	sqlite.config.Retention = config.Retention
+	defer sqlite.Close()
+
+	policy, err := NewRetentionPolicy(7, config.Retention)
+	if err != nil {
+		t.Fatalf("NewRetentionPolicy failed: %v", err)
+	}
+
+	for _, backend := range []struct {
+		name    string
+		storage interface {
+			Storage
+			RetentionStorage
+		}
+	}{{"csv", csv}, {"sqlite", sqlite}} {
+		s := backend.storage
+		if err := s.SaveRecords(records); err != nil {
+			t.Fatalf("%s: failed to save records: %v", backend.name, err)
+		}
+		s.SaveSystemRecord(SystemRecord{Timestamp: now.Add(-10 * day)})
+		s.SaveSystemRecord(SystemRecord{Timestamp: now})
+
+		dry, err := s.ApplyRetention(policy, now, true)
+		if err != nil {
+			t.Fatalf("%s: dry run failed: %v", backend.name, err)
+		}
+		if dry.Samples != 4 || dry.SystemRecords != 1 || len(dry.Rules) != len(want) {
+			t.Errorf("%s: unexpected dry run: %+v", backend.name, dry)
+		}
+		for i, n := range want {
+			if i < len(dry.Rules) && dry.Rules[i].Samples != n {
+				t.Errorf("%s: rule %q: expected %d expired samples, got %d", backend.name, dry.Rules[i].Rule, n, dry.Rules[i].Samples)
+			}
+		}
+		if count, _ := s.GetRecordCount(); count != len(records) {
+			t.Errorf("%s: dry run deleted samples: %d left", backend.name, count)
+		}
+
+		if err := s.CleanOldData(7); err != nil {
+			t.Fatalf("%s: CleanOldData failed: %v", backend.name, err)
+		}
+		again, _ := s.ApplyRetention(policy, now, true)
+		if again.Samples != 0 || again.SystemRecords != 0 {
+			t.Errorf("%s: expected nothing left to expire, got %+v", backend.name, again)
+		}
+
+		if err := s.SaveRecords([]ResourceRecord{{Name: "worker", PID: 14, CreateTime: 1, Timestamp: now, IsActive: true}}); err != nil {
+			t.Fatalf("%s: failed to save after cleanup: %v", backend.name, err)
+		}
+		it, err := s.Query(context.Background(), RecordQuery{})
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", backend.name, err)
+		}
+		left, err := CollectRecords(it)
+		if err != nil {
+			t.Fatalf("%s: collect failed: %v", backend.name, err)
+		}
+		if len(left) != len(records)-4+1 {
+			t.Errorf("%s: expected %d records after cleanup, got %d", backend.name, len(records)-4+1, len(left))
+		}
+	}
+}
+
+// TestApplyRetention_SQLiteBatches tests that SQLite retention deletes more than one batch of
+// expired samples and keeps the recent ones
+func TestApplyRetention_SQLiteBatches(t *testing.T) {
+	storage := openTestSQLite(t, filepath.Join(t.TempDir(), "tracker.db"))
+	defer storage.Close()
+
+	now := time.Now().Truncate(time.Second)
+	expired := 2*pruneBatchSize + 10
+	var records []ResourceRecord
+	for i := 0; i < expired; i++ {
+		records = append(records, ResourceRecord{Name: "worker", PID: 14, CreateTime: 1, IsActive: true,
+			Timestamp: now.AddDate(0, 0, -30).Add(time.Duration(i) * time.Second)})
+	}
+	records = append(records, ResourceRecord{Name: "worker", PID: 14, CreateTime: 1, IsActive: true, Timestamp: now})
+	if err := storage.SaveRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+
+	policy, err := NewRetentionPolicy(7, nil)
+	if err != nil {
+		t.Fatalf("NewRetentionPolicy failed: %v", err)
+	}
+	report, err := storage.ApplyRetention(policy, now, false)
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if report.Samples != int64(expired) {
+		t.Errorf("Expected %d expired samples, got %d", expired, report.Samples)
+	}
+	if count, _ := storage.GetRecordCount(); count != 1 {
+		t.Errorf("Expected the recent sample kept, got %d samples", count)
+	}
+}
+
+// TestApplyRetention_KeepsMalformedRows tests that rewriting a CSV file for retention keeps rows
+// it cannot parse and reports them
+func TestApplyRetention_KeepsMalformedRows(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "process-tracker.log")
+	now := time.Now().Truncate(time.Second)
+	csv := NewManager(dataFile, 10, true, GetDefaultStorageConfig())
+	if err := csv.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize CSV storage: %v", err)
+	}
+	defer csv.Close()
+
+	if err := csv.SaveRecords([]ResourceRecord{
+		{Name: "old", PID: 1, CreateTime: 1, Timestamp: now.Add(-10 * 24 * time.Hour)},
+		{Name: "new", PID: 2, CreateTime: 1, Timestamp: now},
+	}); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	csv.mu.Lock()
+	csv.flushBuffer()
+	csv.mu.Unlock()
+	f, err := os.OpenFile(dataFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	f.WriteString("not,a,record\n")
+	f.Close()
+
+	policy, _ := NewRetentionPolicy(7, nil)
+	for _, dryRun := range []bool{true, false} {
+		report, err := csv.ApplyRetention(policy, now, dryRun)
+		if err != nil {
+			t.Fatalf("ApplyRetention failed: %v", err)
+		}
+		if report.Samples != 1 || report.Malformed != 1 {
+			t.Errorf("dry run %v: expected 1 expired and 1 malformed row, got %+v", dryRun, report)
+		}
+	}
+
+	data, _ := os.ReadFile(dataFile)
+	if !strings.Contains(string(data), "not,a,record\n") {
+		t.Errorf("Expected the malformed row kept, got:\n%s", data)
+	}
+	if count, _ := csv.GetRecordCount(); count != 1 {
+		t.Errorf("Expected 1 record left, got %d", count)
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// searchWord is one whitespace-separated word of a search, split into the same tokens
+// SQLite's unicode61 tokenizer produces (runs of letters and digits, lower-cased)
+type searchWord struct {
+	text   string
+	tokens []string
+}
+
+// parseSearchText splits search text into words; words without letters or digits are dropped
+func parseSearchText(text string) []searchWord {
+	var words []searchWord
+	for _, field := range strings.Fields(text) {
+		if tokens := searchTokens(field); len(tokens) > 0 {
+			words = append(words, searchWord{text: field, tokens: tokens})
+		}
+	}
+	return words
+}
+
+// searchTokens splits text into lower-cased runs of letters and digits
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ValidateSearchText checks that search text has at least one word to match
+func ValidateSearchText(text string) error {
+	if len(parseSearchText(text)) == 0 {
+		return fmt.Errorf("search text must contain letters or digits")
+	}
+	return nil
+}
+
+// matchesText reports whether every word appears as a phrase in the command line or working directory,
+// e.g. "/data/backup" matches "rsync -a /srv /data/backup" but not "/data/old/backup"
+func matchesText(words []searchWord, command, workingDir string) bool {
+	commandTokens := searchTokens(command)
+	dirTokens := searchTokens(workingDir)
+	for _, w := range words {
+		if !containsPhrase(commandTokens, w.tokens) && !containsPhrase(dirTokens, w.tokens) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase reports whether phrase occurs as consecutive tokens
+func containsPhrase(tokens, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		match := true
+		for j, token := range phrase {
+			if tokens[i+j] != token {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// minRunGap is the shortest gap in observations that ends a command run
+const minRunGap = time.Minute
+
+// SearchQuery describes a search over historical command lines
+type SearchQuery struct {
+	Text  string    // Words to find in the command line or working directory
+	Start time.Time // Inclusive; zero means no lower bound
+	End   time.Time // Inclusive; zero means no upper bound
+	Limit int       // Maximum number of runs, newest first; 0 means unlimited
+	Host  string    // Only this machine's records; empty searches every host
+}
+
+// CommandRun is one run of a command found by a search: the processes with the same name,
+// command line, working directory and user, observed without a gap
+type CommandRun struct {
+	ResourceStats
+	Username string `json:"username"`
+	Host     string `json:"host,omitempty"`
+}
+
+// openRun is a run still receiving records
+type openRun struct {
+	engine    *StatsEngine
+	last      time.Time
+	instances map[processKey]bool
+	username  string
+	host      string
+}
+
+// SearchCommands finds the records whose command line or working directory contain every word
+// of the query and groups them into runs, newest first. Processes with the same command belong
+// to one run while any of them is observed at least every few collection intervals, so a nightly
+// job shows up once per night and parallel workers of one job share a run.
+func (a *App) SearchCommands(ctx context.Context, q SearchQuery) ([]CommandRun, error) {
+	if err := ValidateSearchText(q.Text); err != nil {
+		return nil, err
+	}
+	if err := a.storage.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	it, err := a.storage.Query(ctx, RecordQuery{Start: q.Start, End: q.End, Text: q.Text, Hosts: hostFilter(q.Host)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search records: %w", err)
+	}
+	defer it.Close()
+
+	gap := 3 * a.Interval
+	if gap < minRunGap {
+		gap = minRunGap
+	}
+
+	var runs []CommandRun
+	finish := func(run *openRun) {
+		for _, stats := range run.engine.Results() {
+			runs = append(runs, CommandRun{ResourceStats: stats, Username: run.username, Host: run.host})
+		}
+	}
+
+	open := make(map[string]*openRun)
+	for it.Next() {
+		r := it.Record()
+		key := strings.Join([]string{r.Host, r.Name, r.Command, r.WorkingDir, r.Username}, "\x00")
+		instance := recordProcessKey(r)
+
+		run := open[key]
+		if run != nil && r.Timestamp.Sub(run.last) > gap && !run.instances[instance] {
+			finish(run)
+			run = nil
+		}
+		if run == nil {
+			run = &openRun{
+				engine:    NewStatsEngine(StatsOptions{Interval: a.Interval}),
+				instances: make(map[processKey]bool),
+				username:  r.Username,
+				host:      r.Host,
+			}
+			open[key] = run
+		}
+		run.engine.Add(r)
+		run.instances[instance] = true
+		if r.Timestamp.After(run.last) {
+			run.last = r.Timestamp
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search records: %w", err)
+	}
+	for _, run := range open {
+		finish(run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].LastSeen.Equal(runs[j].LastSeen) {
+			return runs[i].LastSeen.After(runs[j].LastSeen)
+		}
+		return runs[i].Command < runs[j].Command
+	})
+	if q.Limit > 0 && len(runs) > q.Limit {
+		runs = runs[:q.Limit]
+	}
+	return runs, nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// searchTestRecords returns two parallel rsync workers, the same job a day later, a similar
+// command to another directory and an unrelated process running in the searched directory
+func searchTestRecords(start time.Time) []ResourceRecord {
+	const backup = "rsync -a /srv/files /data/backup"
+	var records []ResourceRecord
+	add := func(pid int32, command, dir string, from time.Time, samples int, cpu float64) {
+		for i := 0; i < samples; i++ {
+			records = append(records, ResourceRecord{
+				Timestamp:  from.Add(time.Duration(i) * 5 * time.Second),
+				Name:       "rsync",
+				PID:        pid,
+				CreateTime: from.UnixMilli(),
+				Command:    command,
+				WorkingDir: dir,
+				Username:   "backup",
+				CPUPercent: cpu,
+				MemoryMB:   float64(10 * (i + 1)),
+				IsActive:   true,
+			})
+		}
+	}
+	add(100, backup, "/root", start, 12, 20)
+	add(101, backup, "/root", start.Add(10*time.Second), 6, 40)
+	add(200, backup, "/root", start.Add(24*time.Hour), 4, 10)
+	add(300, "rsync -a /srv/files /data/old/backup", "/root", start, 4, 10)
+	add(400, "tar czf files.tgz .", "/data/backup", start, 4, 10)
+	return records
+}
+
+// TestMatchesText tests that each word matches as a phrase of whole words
+func TestMatchesText(t *testing.T) {
+	tests := []struct {
+		text, command, dir string
+		want               bool
+	}{
+		{"rsync /data/backup", "rsync -a /srv /data/backup", "", true},
+		{"RSYNC", "/usr/bin/rsync -a", "", true},
+		{"/data/backup", "rsync /data/old/backup", "", false},
+		{"/data/backup", "tar czf x.tgz .", "/data/backup", true},
+		{"rsync /data/backup", "tar czf x.tgz .", "/data/backup", false},
+		{"sync", "rsync -a", "", false},
+	}
+	for _, tt := range tests {
+		if got := matchesText(parseSearchText(tt.text), tt.command, tt.dir); got != tt.want {
+			t.Errorf("matchesText(%q, %q, %q) = %v, want %v", tt.text, tt.command, tt.dir, got, tt.want)
+		}
+	}
+	if err := ValidateSearchText(" / -- "); err == nil {
+		t.Error("Expected search text without words to be rejected")
+	}
+}
+
+// TestSearchCommands_Backends tests that both backends find the same runs: parallel workers
+// share a run, the next day's job is a run of its own and similar commands are left out
+func TestSearchCommands_Backends(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+
+	sqliteConfig := GetDefaultConfig()
+	sqliteConfig.Storage.Type = "sqlite"
+	sqliteConfig.Storage.SQLitePath = filepath.Join(dir, "search.db")
+
+	for _, backend := range []struct {
+		name   string
+		config Config
+	}{{"csv", GetDefaultConfig()}, {"sqlite", sqliteConfig}} {
+		app := NewApp(filepath.Join(dir, backend.name, "process-tracker.log"), 5*time.Second, backend.config)
+		if err := app.Initialize(); err != nil {
+			t.Fatalf("%s: failed to initialize: %v", backend.name, err)
+		}
+		if err := app.SaveResourceRecords(searchTestRecords(start)); err != nil {
+			t.Fatalf("%s: failed to save records: %v", backend.name, err)
+		}
+		if sqlite, ok := app.storage.(*SQLiteStorage); ok && !sqlite.searchIndex {
+			t.Errorf("%s: expected the full-text index to be available", backend.name)
+		}
+
+		runs, err := app.SearchCommands(context.Background(), SearchQuery{Text: "rsync /data/backup"})
+		if err != nil {
+			t.Fatalf("%s: search failed: %v", backend.name, err)
+		}
+		if len(runs) != 2 {
+			t.Fatalf("%s: expected 2 runs, got %d: %+v", backend.name, len(runs), runs)
+		}
+		latest, first := runs[0], runs[1]
+		if len(latest.PIDs) != 1 || latest.PIDs[0] != 200 || latest.Samples != 4 {
+			t.Errorf("%s: expected the later run to be PID 200, got %v (%d samples)", backend.name, latest.PIDs, latest.Samples)
+		}
+		if len(first.PIDs) != 2 || first.Samples != 18 || first.CPUMax != 40 || first.MemoryMax != 120 {
+			t.Errorf("%s: expected both workers in the first run, got PIDs %v, %d samples, peak CPU %.0f, peak memory %.0f",
+				backend.name, first.PIDs, first.Samples, first.CPUMax, first.MemoryMax)
+		}
+		if first.Username != "backup" || !first.FirstSeen.Equal(start) || first.TotalUptime != 55*time.Second {
+			t.Errorf("%s: unexpected run details: user %q, first seen %v, duration %v",
+				backend.name, first.Username, first.FirstSeen, first.TotalUptime)
+		}
+
+		// The time range and the working directory are searched too
+		runs, _ = app.SearchCommands(context.Background(), SearchQuery{Text: "rsync", Start: start.Add(time.Hour)})
+		if len(runs) != 1 {
+			t.Errorf("%s: expected 1 run after the first day, got %d", backend.name, len(runs))
+		}
+		runs, _ = app.SearchCommands(context.Background(), SearchQuery{Text: "/data/backup", Limit: 10})
+		if len(runs) != 3 {
+			t.Errorf("%s: expected the tar process found by its working directory, got %d runs", backend.name, len(runs))
+		}
+		app.CloseFile()
+	}
+}
+
+// TestSQLiteStorage_SearchIndex tests that the index keeps the first-seen command line and that
+// the LIKE fallback finds the same processes
+func TestSQLiteStorage_SearchIndex(t *testing.T) {
+	storage := openTestSQLite(t, filepath.Join(t.TempDir(), "search.db"))
+	defer storage.Close()
+
+	now := time.Now().Truncate(time.Second)
+	record := ResourceRecord{Timestamp: now, Name: "python", PID: 10, CreateTime: 1, Command: "python worker.py --queue=mail"}
+	storage.SaveRecords([]ResourceRecord{record})
+	record.Timestamp = now.Add(time.Second)
+	record.Command = "python worker.py --queue=reports"
+	storage.SaveRecords([]ResourceRecord{record})
+
+	count := func(text string) int {
+		it, err := storage.Query(context.Background(), RecordQuery{Text: text})
+		if err != nil {
+			t.Fatalf("Query(%q) failed: %v", text, err)
+		}
+		records, _ := CollectRecords(it)
+		return len(records)
+	}
+	for _, indexed := range []bool{true, false} {
+		storage.searchIndex = indexed
+		if count("queue=mail") != 2 || count("reports") != 0 || count("worker.py nothing") != 0 {
+			t.Errorf("indexed=%v: expected only the first-seen command line to match", indexed)
+		}
+	}
+
+	storage.searchIndex = true
+	if _, err := storage.db.Exec("DELETE FROM samples"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.deleteOrphanProcesses(); err != nil {
+		t.Fatal(err)
+	}
+	var indexed int
+	storage.db.QueryRow("SELECT COUNT(*) FROM process_search WHERE process_search MATCH 'worker'").Scan(&indexed)
+	if indexed != 0 {
+		t.Errorf("Expected deleted processes removed from the index, %d left", indexed)
+	}
+}
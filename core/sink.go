@@ -0,0 +1,459 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sinkStatsFile = "sink-stats.json"
+
+	defaultSinkQueueSize = 16
+	defaultSinkTimeout   = 5 * time.Second
+
+	// A failed write is retried with a doubling backoff, then the snapshot is dropped
+	sinkMaxAttempts = 3
+	sinkRetryBase   = time.Second
+
+	// sinkCloseTimeout bounds how long Close waits for each sink to drain its queue
+	sinkCloseTimeout = 5 * time.Second
+
+	// sinkStatsInterval throttles publishing the sink counters for `process-tracker status`
+	sinkStatsInterval = 5 * time.Second
+)
+
+// Sink receives the process records of every collection tick
+// Each sink runs on its own goroutine behind a bounded queue (see SinkFanout), so Write may
+// block on a slow destination without delaying collection or the other sinks.
+type Sink interface {
+	// Write delivers one snapshot of records
+	Write(records []ResourceRecord) error
+	// Close releases connections and files
+	Close() error
+}
+
+// SinkConfig configures an output sink that receives a copy of every snapshot
+// The primary store is always the first sink; these are added after it.
+type SinkConfig struct {
+	Name           string `yaml:"name"`            // Shown in status and logs (default: the type)
+	Type           string `yaml:"type"`            // ndjson, influxdb, graphite, statsd, remote_write or otlp
+	Path           string `yaml:"path"`            // ndjson: file to append to; "-" writes to stdout
+	URL            string `yaml:"url"`             // influxdb: HTTP write endpoint (e.g. http://localhost:8086/write?db=pt) or udp://host:8089; remote_write, otlp: push endpoint
+	Token          string `yaml:"token"`           // influxdb: sent as "Authorization: Token <token>"; remote_write, otlp: as "Authorization: Bearer <token>"
+	Measurement    string `yaml:"measurement"`     // influxdb: measurement name (default: process)
+	Address        string `yaml:"address"`         // graphite: host:port over TCP; statsd: host:port over UDP
+	Prefix         string `yaml:"prefix"`          // graphite and statsd: metric path prefix (default: process_tracker)
+	QueueSize      int    `yaml:"queue_size"`      // Snapshots buffered before new ones are dropped (default: 16)
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // Per write (default: 5)
+
+	// remote_write and otlp push through their own write pipeline, spooling while the endpoint is down
+	Headers      map[string]string `yaml:"headers"`       // Extra HTTP headers (e.g. X-Scope-OrgID)
+	Labels       map[string]string `yaml:"labels"`        // Added to every series (remote_write) or as resource attributes (otlp)
+	FlushSeconds int               `yaml:"flush_seconds"` // Snapshots are pushed together at this interval (default: 15)
+	MaxRetries   int               `yaml:"max_retries"`   // Push attempts before a batch is spooled (default: 5)
+	SpoolPath    string            `yaml:"spool_path"`    // Spool file (default: push-<name>.jsonl next to the data file)
+	SpoolMaxMB   int               `yaml:"spool_max_mb"`  // Spool size limit; snapshots beyond it are dropped (default: 50)
+}
+
+// DisplayName returns the configured name or the type
+func (c SinkConfig) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+func (c SinkConfig) timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return defaultSinkTimeout
+}
+
+func (c SinkConfig) prefix() string {
+	if c.Prefix != "" {
+		return c.Prefix
+	}
+	return "process_tracker"
+}
+
+// ValidateSinkConfigs checks sink types, their destinations and that names are unique
+func ValidateSinkConfigs(configs []SinkConfig) error {
+	names := map[string]bool{"storage": true}
+	for i, c := range configs {
+		switch c.Type {
+		case "ndjson":
+			if c.Path == "" {
+				return fmt.Errorf("sink %d (ndjson): path is required (\"-\" for stdout)", i+1)
+			}
+		case "influxdb":
+			u, err := url.Parse(c.URL)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "udp") {
+				return fmt.Errorf("sink %d (influxdb): url must be an http(s):// write endpoint or udp://host:port", i+1)
+			}
+		case "graphite", "statsd":
+			if !strings.Contains(c.Address, ":") {
+				return fmt.Errorf("sink %d (%s): address must be host:port", i+1, c.Type)
+			}
+		case "remote_write", "otlp":
+			u, err := url.Parse(c.URL)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("sink %d (%s): url must be an http(s):// endpoint", i+1, c.Type)
+			}
+		default:
+			return fmt.Errorf("sink %d: unknown type %q (use ndjson, influxdb, graphite, statsd, remote_write or otlp)", i+1, c.Type)
+		}
+		if c.QueueSize < 0 || c.TimeoutSeconds < 0 || c.FlushSeconds < 0 || c.MaxRetries < 0 || c.SpoolMaxMB < 0 {
+			return fmt.Errorf("sink %d (%s): sizes, timeouts and retries must be non-negative", i+1, c.Type)
+		}
+		name := c.DisplayName()
+		if names[name] {
+			return fmt.Errorf("sink %d: duplicate name %q, set a distinct name", i+1, name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// NewSink creates a sink from its configuration; connections are opened on the first write
+// Push sinks spool to dataDir and label series as the exporter does with metrics.
+func NewSink(config SinkConfig, dataDir string, metrics MetricsConfig) (Sink, error) {
+	switch config.Type {
+	case "ndjson":
+		return NewNDJSONSink(config.Path), nil
+	case "influxdb":
+		return NewInfluxDBSink(config)
+	case "graphite":
+		return NewGraphiteSink(config), nil
+	case "statsd":
+		return NewStatsDSink(config), nil
+	case "remote_write":
+		return NewRemoteWriteSink(config, dataDir, metrics), nil
+	case "otlp":
+		return NewOTLPSink(config, dataDir, metrics), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", config.Type)
+	}
+}
+
+// SinkStats reports the state of one sink
+// Counts are records, except QueueDepth and QueueCapacity which count snapshots.
+type SinkStats struct {
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	QueueDepth    int       `json:"queue_depth"`
+	QueueCapacity int       `json:"queue_capacity"`
+	Sent          int64     `json:"sent"`     // Records delivered
+	Dropped       int64     `json:"dropped"`  // Records lost (queue full or writes kept failing)
+	Failures      int64     `json:"failures"` // Failed write attempts
+	Spooled       int64     `json:"spooled"`  // Records waiting in a push sink's spool
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitempty"`
+}
+
+// pipelineSink is a sink delivering through its own write pipeline
+type pipelineSink interface {
+	pipelineStats() WriteStats
+}
+
+// sinkWorker feeds one sink from its queue
+type sinkWorker struct {
+	sink   Sink
+	inline bool // Written on the collector's goroutine instead of through the queue
+	queue  chan []ResourceRecord
+
+	mu    sync.Mutex // Guards stats
+	stats SinkStats
+}
+
+// SinkFanout hands every snapshot to a list of sinks
+// A full queue drops the snapshot for that sink only, and write errors are retried and
+// counted per sink, so one slow or unreachable destination cannot affect the others.
+type SinkFanout struct {
+	workers   []*sinkWorker
+	statsPath string
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	publishMu   sync.Mutex
+	lastPublish time.Time
+}
+
+// NewSinkFanout creates an empty fanout; its counters are published to statsPath
+func NewSinkFanout(statsPath string) *SinkFanout {
+	return &SinkFanout{statsPath: statsPath, done: make(chan struct{})}
+}
+
+// Add registers a sink with its own queue of queueSize snapshots
+func (f *SinkFanout) Add(name, kind string, sink Sink, queueSize int) {
+	if queueSize <= 0 {
+		queueSize = defaultSinkQueueSize
+	}
+	f.workers = append(f.workers, &sinkWorker{
+		sink:  sink,
+		queue: make(chan []ResourceRecord, queueSize),
+		stats: SinkStats{Name: name, Type: kind, QueueCapacity: queueSize},
+	})
+}
+
+// AddInline registers a sink that never blocks (such as the primary store, whose write
+// pipeline queues and journals on its own) and is written on the caller's goroutine
+func (f *SinkFanout) AddInline(name, kind string, sink Sink) {
+	f.workers = append(f.workers, &sinkWorker{
+		sink:   sink,
+		inline: true,
+		stats:  SinkStats{Name: name, Type: kind},
+	})
+}
+
+// Start runs a goroutine per queued sink
+func (f *SinkFanout) Start() {
+	for _, w := range f.workers {
+		if w.inline {
+			continue
+		}
+		f.wg.Add(1)
+		go f.run(w)
+	}
+}
+
+// Enqueue hands a snapshot to every sink without blocking
+func (f *SinkFanout) Enqueue(records []ResourceRecord) {
+	if len(records) == 0 {
+		return
+	}
+	for _, w := range f.workers {
+		if w.inline {
+			f.deliver(w, records)
+			continue
+		}
+		select {
+		case w.queue <- records:
+		default:
+			w.drop(len(records), fmt.Errorf("queue full (%d snapshots)", cap(w.queue)))
+		}
+	}
+}
+
+// Close delivers what is queued, waiting up to sinkCloseTimeout, and closes the sinks
+func (f *SinkFanout) Close() error {
+	select {
+	case <-f.done:
+		return nil
+	default:
+	}
+	close(f.done)
+	f.wg.Wait()
+	for _, w := range f.workers {
+		if err := w.sink.Close(); err != nil {
+			log.Printf("Warning: failed to close sink %s: %v", w.stats.Name, err)
+		}
+	}
+	f.publish(true)
+	return nil
+}
+
+// Stats returns a snapshot of every sink's counters, in configuration order
+func (f *SinkFanout) Stats() []SinkStats {
+	stats := make([]SinkStats, 0, len(f.workers))
+	for _, w := range f.workers {
+		w.mu.Lock()
+		s := w.stats
+		w.mu.Unlock()
+		s.QueueDepth = len(w.queue)
+		if ps, ok := w.sink.(pipelineSink); ok {
+			// Handing a snapshot to the pipeline is not delivery; report the pipeline's counts
+			p := ps.pipelineStats()
+			s.QueueDepth, s.QueueCapacity = p.QueueDepth, p.QueueCapacity
+			s.Sent = p.Written
+			s.Dropped += p.Dropped
+			s.Failures += p.Retries
+			s.Spooled = p.JournalRecords
+			if p.LastErrorAt.After(s.LastErrorAt) {
+				s.LastError, s.LastErrorAt = p.LastError, p.LastErrorAt
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (f *SinkFanout) run(w *sinkWorker) {
+	defer f.wg.Done()
+	for {
+		select {
+		case records := <-w.queue:
+			f.deliver(w, records)
+		case <-f.done:
+			deadline := time.After(sinkCloseTimeout)
+			for {
+				select {
+				case records := <-w.queue:
+					f.deliver(w, records)
+				case <-deadline:
+					for len(w.queue) > 0 {
+						w.drop(len(<-w.queue), fmt.Errorf("not delivered before shutdown"))
+					}
+					return
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver writes one snapshot, retrying with backoff until the fanout closes
+func (f *SinkFanout) deliver(w *sinkWorker, records []ResourceRecord) {
+	defer f.publish(false)
+
+	backoff := sinkRetryBase
+	for attempt := 1; ; attempt++ {
+		err := w.sink.Write(records)
+		if err == nil {
+			w.mu.Lock()
+			w.stats.Sent += int64(len(records))
+			w.mu.Unlock()
+			return
+		}
+
+		w.mu.Lock()
+		w.stats.Failures++
+		w.mu.Unlock()
+		if attempt >= sinkMaxAttempts || w.inline {
+			w.drop(len(records), err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-f.done:
+			w.drop(len(records), err)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (w *sinkWorker) drop(n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Dropped += int64(n)
+	w.stats.LastError = err.Error()
+	w.stats.LastErrorAt = time.Now()
+	log.Printf("Warning: sink %s dropped %d records (%d in total): %v", w.stats.Name, n, w.stats.Dropped, err)
+}
+
+// publish saves the counters for `process-tracker status`, at most every sinkStatsInterval
+func (f *SinkFanout) publish(force bool) {
+	if f.statsPath == "" {
+		return
+	}
+	f.publishMu.Lock()
+	defer f.publishMu.Unlock()
+	if !force && time.Since(f.lastPublish) < sinkStatsInterval {
+		return
+	}
+	f.lastPublish = time.Now()
+	writeJSONAtomic(f.statsPath, f.Stats())
+}
+
+// ReadSinkStats reads the sink counters last published by the daemon writing dataFile
+func ReadSinkStats(dataFile string) ([]SinkStats, error) {
+	var stats []SinkStats
+	err := readJSONFile(filepath.Join(filepath.Dir(dataFile), sinkStatsFile), &stats)
+	return stats, err
+}
+
+// storageSink writes to the primary store, through the write pipeline when it is running
+type storageSink struct {
+	writer  *WritePipeline
+	storage Storage
+}
+
+func (s *storageSink) Write(records []ResourceRecord) error {
+	if s.writer != nil {
+		s.writer.Enqueue(records)
+		return nil
+	}
+	return s.storage.SaveRecords(records)
+}
+
+// Close is a no-op; the App closes the write pipeline and storage
+func (s *storageSink) Close() error { return nil }
+
+// processAggregate sums one snapshot's records of a process name, for metric sinks where a
+// series per PID would grow without bound
+type processAggregate struct {
+	Name        string
+	Category    string
+	Timestamp   time.Time
+	Processes   int
+	CPUPercent  float64
+	MemoryMB    float64
+	Threads     int64
+	DiskReadMB  float64
+	DiskWriteMB float64
+	NetSentKB   float64
+	NetRecvKB   float64
+}
+
+// aggregateByName sums records per process name, in order of first appearance
+func aggregateByName(records []ResourceRecord) []*processAggregate {
+	index := make(map[string]*processAggregate)
+	var result []*processAggregate
+	for _, r := range records {
+		agg, ok := index[r.Name]
+		if !ok {
+			agg = &processAggregate{Name: r.Name, Category: r.Category, Timestamp: r.Timestamp}
+			index[r.Name] = agg
+			result = append(result, agg)
+		}
+		if r.Timestamp.After(agg.Timestamp) {
+			agg.Timestamp = r.Timestamp
+		}
+		agg.Processes++
+		agg.CPUPercent += r.CPUPercent
+		agg.MemoryMB += r.MemoryMB
+		agg.Threads += int64(r.Threads)
+		agg.DiskReadMB += r.DiskReadMB
+		agg.DiskWriteMB += r.DiskWriteMB
+		agg.NetSentKB += r.NetSentKB
+		agg.NetRecvKB += r.NetRecvKB
+	}
+	return result
+}
+
+// metrics lists the aggregate's values by metric name, in a fixed order
+func (a *processAggregate) metrics() []sinkMetric {
+	return []sinkMetric{
+		{"processes", float64(a.Processes)},
+		{"cpu_percent", a.CPUPercent},
+		{"memory_mb", a.MemoryMB},
+		{"threads", float64(a.Threads)},
+		{"disk_read_mb", a.DiskReadMB},
+		{"disk_write_mb", a.DiskWriteMB},
+		{"net_sent_kb", a.NetSentKB},
+		{"net_recv_kb", a.NetRecvKB},
+	}
+}
+
+type sinkMetric struct {
+	name  string
+	value float64
+}
+
+// sinkHostname returns the host name used in metric names and tags
+func sinkHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
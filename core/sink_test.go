@@ -0,0 +1,314 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sinkTestRecords returns one snapshot with two nginx workers and a process whose name
+// needs escaping
+func sinkTestRecords(ts time.Time) []ResourceRecord {
+	return []ResourceRecord{
+		{Timestamp: ts, Name: "nginx", Category: "web", PID: 10, CPUPercent: 1.5, MemoryMB: 20, Threads: 2},
+		{Timestamp: ts, Name: "nginx", Category: "web", PID: 11, CPUPercent: 2.5, MemoryMB: 30, Threads: 3},
+		{Timestamp: ts, Name: "my app.py", PID: 12, CPUPercent: 10, MemoryMB: 100, Threads: 1},
+	}
+}
+
+// readDatagrams collects lines from UDP datagrams until none arrive for a moment
+func readDatagrams(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		if n > maxDatagramSize {
+			t.Errorf("Datagram of %d bytes exceeds %d", n, maxDatagramSize)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+// TestNDJSONSink tests that every record is appended as one JSON line
+func TestNDJSONSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.ndjson")
+	sink := NewNDJSONSink(path)
+	records := sinkTestRecords(time.Now().Truncate(time.Second))
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(records); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r ResourceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Line %d is not a record: %v", lines+1, err)
+		}
+		if r.PID != records[lines%3].PID {
+			t.Errorf("Line %d: expected PID %d, got %d", lines+1, records[lines%3].PID, r.PID)
+		}
+		lines++
+	}
+	if lines != 6 {
+		t.Errorf("Expected 6 lines, got %d", lines)
+	}
+}
+
+// TestInfluxDBSink_HTTP tests the line protocol and token sent to an HTTP write endpoint
+func TestInfluxDBSink_HTTP(t *testing.T) {
+	var body, auth string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewInfluxDBSink(SinkConfig{Type: "influxdb", URL: server.URL + "/write?db=pt", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	ts := time.Unix(1700000000, 0)
+	if err := sink.Write(sinkTestRecords(ts)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if auth != "Token secret" {
+		t.Errorf("Expected the token in the Authorization header, got %q", auth)
+	}
+	host := escapeInfluxKey(sinkHostname(), true)
+	wantNginx := "process,host=" + host + ",name=nginx,category=web processes=2i,cpu_percent=4,memory_mb=50,threads=5i," +
+		"disk_read_mb=0,disk_write_mb=0,net_sent_kb=0,net_recv_kb=0 1700000000000000000"
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 2 || lines[0] != wantNginx {
+		t.Fatalf("Unexpected line protocol:\n%s\nwant first line:\n%s", body, wantNginx)
+	}
+	if !strings.HasPrefix(lines[1], "process,host="+host+`,name=my\ app.py processes=1i,`) {
+		t.Errorf("Expected the space in the name escaped, got %s", lines[1])
+	}
+
+	status = http.StatusBadRequest
+	if err := sink.Write(sinkTestRecords(ts)); err == nil {
+		t.Error("Expected an error for a non-2xx response")
+	}
+}
+
+// TestInfluxDBSink_UDP tests that lines are sent as datagrams
+func TestInfluxDBSink_UDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, _ := NewInfluxDBSink(SinkConfig{Type: "influxdb", URL: "udp://" + listener.LocalAddr().String(), Measurement: "proc"})
+	// Enough process names to need several datagrams
+	var records []ResourceRecord
+	for i := 0; i < 40; i++ {
+		records = append(records, ResourceRecord{Timestamp: time.Now(), Name: "worker-" + string(rune('a'+i%26)) + string(rune('a'+i/26))})
+	}
+	if err := sink.Write(records); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	lines := readDatagrams(t, listener)
+	if len(lines) != 40 || !strings.HasPrefix(lines[0], "proc,host=") {
+		t.Errorf("Expected 40 lines of measurement proc, got %d: %v", len(lines), lines)
+	}
+}
+
+// TestGraphiteSink tests the plaintext protocol over one persistent connection
+func TestGraphiteSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 100)
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					received <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	sink := NewGraphiteSink(SinkConfig{Type: "graphite", Address: listener.Addr().String(), Prefix: "pt"})
+	defer sink.Close()
+	ts := time.Unix(1700000000, 0)
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(sinkTestRecords(ts)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	var lines []string
+	timeout := time.After(2 * time.Second)
+	for len(lines) < 32 {
+		select {
+		case line := <-received:
+			lines = append(lines, line)
+		case <-timeout:
+			t.Fatalf("Expected 32 lines, got %d: %v", len(lines), lines)
+		}
+	}
+	host := graphiteComponent(sinkHostname())
+	if want := "pt." + host + ".nginx.cpu_percent 4 1700000000"; lines[1] != want {
+		t.Errorf("Expected %q, got %q", want, lines[1])
+	}
+	if want := "pt." + host + ".my_app_py.processes 1 1700000000"; lines[8] != want {
+		t.Errorf("Expected %q, got %q", want, lines[8])
+	}
+	if len(accepted) != 1 {
+		t.Errorf("Expected one connection for both writes, got %d", len(accepted))
+	}
+}
+
+// TestStatsDSink tests that aggregates are sent as gauges
+func TestStatsDSink(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink := NewStatsDSink(SinkConfig{Type: "statsd", Address: listener.LocalAddr().String()})
+	if err := sink.Write(sinkTestRecords(time.Now())); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	lines := readDatagrams(t, listener)
+	want := "process_tracker." + graphiteComponent(sinkHostname()) + ".nginx.memory_mb:50|g"
+	if len(lines) != 16 || lines[2] != want {
+		t.Errorf("Expected 16 gauges with %q, got %v", want, lines)
+	}
+}
+
+// blockingSink records writes and blocks each one until released
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	records int
+}
+
+func (s *blockingSink) Write(records []ResourceRecord) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	s.records += len(records)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+// TestSinkFanout_Isolation tests that a stalled sink neither delays the caller nor the
+// other sinks, and only loses its own snapshots
+func TestSinkFanout_Isolation(t *testing.T) {
+	statsPath := filepath.Join(t.TempDir(), sinkStatsFile)
+	fanout := NewSinkFanout(statsPath)
+	primary, healthy := &blockingSink{}, &blockingSink{}
+	stalled := &blockingSink{release: make(chan struct{})}
+	fanout.AddInline("storage", "csv", primary)
+	fanout.Add("healthy", "ndjson", healthy, 16)
+	fanout.Add("stalled", "graphite", stalled, 1)
+	fanout.Start()
+
+	// The stalled sink takes the first snapshot, queues the second and drops the rest
+	fanout.Enqueue(sinkTestRecords(time.Now()))
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 9; i++ {
+		fanout.Enqueue(sinkTestRecords(time.Now()))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Enqueue blocked on the stalled sink for %v", elapsed)
+	}
+
+	stats := fanout.Stats()
+	if stats[0].Sent != 30 || stats[0].Dropped != 0 {
+		t.Errorf("Expected every record written to the primary store, got %+v", stats[0])
+	}
+	if stats[2].Dropped != 24 || stats[2].QueueDepth != 1 || stats[2].LastError == "" {
+		t.Errorf("Expected the stalled sink to drop all but two snapshots, got %+v", stats[2])
+	}
+
+	close(stalled.release)
+	fanout.Close()
+	if healthy.records != 30 {
+		t.Errorf("Expected the healthy sink to receive all 30 records, got %d", healthy.records)
+	}
+	if got := fanout.Stats()[2]; got.Sent+got.Dropped != 30 {
+		t.Errorf("Expected the stalled sink's records sent or dropped, got %+v", got)
+	}
+
+	// The daemon's counters are published for `process-tracker status`
+	published, err := ReadSinkStats(filepath.Join(filepath.Dir(statsPath), "process-tracker.log"))
+	if err != nil || len(published) != 3 || published[1].Sent != 30 {
+		t.Errorf("Expected the final counters published, got %+v (%v)", published, err)
+	}
+}
+
+// TestValidateSinkConfigs tests sink configuration errors
+func TestValidateSinkConfigs(t *testing.T) {
+	valid := []SinkConfig{
+		{Type: "ndjson", Path: "-"},
+		{Type: "influxdb", URL: "http://localhost:8086/write?db=pt"},
+		{Name: "udp-influx", Type: "influxdb", URL: "udp://localhost:8089"},
+		{Type: "graphite", Address: "localhost:2003"},
+		{Type: "statsd", Address: "localhost:8125"},
+	}
+	if err := ValidateSinkConfigs(valid); err != nil {
+		t.Errorf("Expected valid sinks, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		sinks []SinkConfig
+	}{
+		{"unknown type", []SinkConfig{{Type: "kafka"}}},
+		{"missing path", []SinkConfig{{Type: "ndjson"}}},
+		{"bad url", []SinkConfig{{Type: "influxdb", URL: "localhost:8086"}}},
+		{"missing port", []SinkConfig{{Type: "statsd", Address: "localhost"}}},
+		{"duplicate name", []SinkConfig{{Type: "ndjson", Path: "a"}, {Type: "ndjson", Path: "b"}}},
+		{"reserved name", []SinkConfig{{Name: "storage", Type: "ndjson", Path: "a"}}},
+		{"negative queue", []SinkConfig{{Type: "ndjson", Path: "a", QueueSize: -1}}},
+	}
+	for _, tt := range tests {
+		if err := ValidateSinkConfigs(tt.sinks); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultStatsInterval is assumed between samples when the interval is not configured
+// and cannot be estimated from the records
+const defaultStatsInterval = 5 * time.Second
+
+// maxIntervalEstimateGaps bounds the gaps kept for estimating the collection interval
+const maxIntervalEstimateGaps = 10000
+
+// StatsOptions controls how the stats engine aggregates records
+type StatsOptions struct {
+	Interval      time.Duration // Collection interval; estimated from the records when zero
+	NormalizedCPU bool          // Aggregate CPUPercentNormalized instead of CPUPercent
+}
+
+// StatsEngine aggregates resource records per process name in a single pass.
+// Records are expected in timestamp order, as storage queries return them.
+// Memory grows with the number of process names and instances, not with the number of
+// samples: CPU and memory percentiles come from quantile sketches, which are exact up to
+// sketchExactValues samples per name and within 1% beyond.
+type StatsEngine struct {
+	opts   StatsOptions
+	groups map[string]*statsGroup
+	gaps   []float64 // Sample gaps in seconds, for estimating the interval
+}
+
+// statsGroup accumulates the records of one process name
+type statsGroup struct {
+	name        string
+	cpu         quantileSketch
+	memory      quantileSketch
+	activeGaps  map[float64]int // Active samples by the gap before them in seconds; -1 for the first sample of a process
+	diskRead    float64
+	diskWrite   float64
+	netSent     float64
+	netRecv     float64
+	cpuSeconds  float64
+	first, last time.Time
+	earliest    int64 // Earliest CreateTime (Unix milliseconds)
+	pids        map[int32]bool
+	categories  map[string]int
+	commands    map[string]int
+	workingDirs map[string]int
+	instances   map[processKey]*instanceState
+	latest      ResourceRecord
+}
+
+// instanceState tracks the previous sample of one process instance
+type instanceState struct {
+	timestamp time.Time
+	cpuTime   float64
+}
+
+// NewStatsEngine creates an empty stats engine
+func NewStatsEngine(opts StatsOptions) *StatsEngine {
+	return &StatsEngine{opts: opts, groups: make(map[string]*statsGroup)}
+}
+
+// ComputeResourceStats aggregates records held in memory, in any order
+func ComputeResourceStats(records []ResourceRecord, opts StatsOptions) []ResourceStats {
+	sorted := make([]ResourceRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	engine := NewStatsEngine(opts)
+	for _, r := range sorted {
+		engine.Add(r)
+	}
+	return engine.Results()
+}
+
+// AddAll adds every record of an iterator and closes it
+func (e *StatsEngine) AddAll(it RecordIterator) error {
+	defer it.Close()
+	for it.Next() {
+		e.Add(it.Record())
+	}
+	return it.Err()
+}
+
+// Add adds one record
+func (e *StatsEngine) Add(r ResourceRecord) {
+	g, exists := e.groups[r.Name]
+	if !exists {
+		g = &statsGroup{
+			name:        r.Name,
+			first:       r.Timestamp,
+			pids:        make(map[int32]bool),
+			categories:  make(map[string]int),
+			commands:    make(map[string]int),
+			workingDirs: make(map[string]int),
+			instances:   make(map[processKey]*instanceState),
+			activeGaps:  make(map[float64]int),
+		}
+		e.groups[r.Name] = g
+	}
+
+	cpu := r.CPUPercent
+	if e.opts.NormalizedCPU {
+		cpu = r.CPUPercentNormalized
+	}
+	g.cpu.Add(cpu)
+	g.memory.Add(r.MemoryMB)
+	g.diskRead += r.DiskReadMB
+	g.diskWrite += r.DiskWriteMB
+	g.netSent += r.NetSentKB
+	g.netRecv += r.NetRecvKB
+
+	if r.Timestamp.Before(g.first) {
+		g.first = r.Timestamp
+	}
+	if !r.Timestamp.Before(g.last) {
+		g.last = r.Timestamp
+		g.latest = r
+	}
+	if r.CreateTime > 0 && (g.earliest == 0 || r.CreateTime < g.earliest) {
+		g.earliest = r.CreateTime
+	}
+	if r.PID > 0 {
+		g.pids[r.PID] = true
+	}
+	if r.Category != "" {
+		g.categories[r.Category]++
+	}
+	if r.Command != "" {
+		g.commands[r.Command]++
+	}
+	if r.WorkingDir != "" {
+		g.workingDirs[r.WorkingDir]++
+	}
+
+	// The gap to the previous sample of the same process instance drives the active
+	// time; CPUTime is cumulative, so CPU seconds are the sum of its increases
+	gap := -1.0
+	key := recordProcessKey(r)
+	prev, seen := g.instances[key]
+	if !seen {
+		g.instances[key] = &instanceState{timestamp: r.Timestamp, cpuTime: r.CPUTime}
+	} else if r.Timestamp.After(prev.timestamp) {
+		gap = r.Timestamp.Sub(prev.timestamp).Seconds()
+		// A CPUTime of zero means it was not recorded
+		if r.CPUTime > 0 {
+			if r.CPUTime >= prev.cpuTime {
+				g.cpuSeconds += r.CPUTime - prev.cpuTime
+			}
+			prev.cpuTime = r.CPUTime
+		}
+		if len(e.gaps) < maxIntervalEstimateGaps {
+			e.gaps = append(e.gaps, gap)
+		}
+		prev.timestamp = r.Timestamp
+	}
+	if r.IsActive {
+		// Collections repeat at the same interval, so few distinct gaps are kept
+		g.activeGaps[math.Round(gap*1000)/1000]++
+	}
+}
+
+// interval returns the configured collection interval, or the median gap between samples
+func (e *StatsEngine) interval() float64 {
+	if e.opts.Interval > 0 {
+		return e.opts.Interval.Seconds()
+	}
+	if len(e.gaps) == 0 {
+		return defaultStatsInterval.Seconds()
+	}
+	sorted := append([]float64(nil), e.gaps...)
+	sort.Float64s(sorted)
+	return Percentile(sorted, 50)
+}
+
+// Results returns the statistics of every process name, most active first
+func (e *StatsEngine) Results() []ResourceStats {
+	interval := e.interval()
+
+	stats := make([]ResourceStats, 0, len(e.groups))
+	for _, g := range e.groups {
+		n := float64(g.cpu.Count())
+		stat := ResourceStats{
+			Name:         g.name,
+			Category:     mostCommon(g.categories),
+			Command:      mostCommon(g.commands),
+			WorkingDir:   mostCommon(g.workingDirs),
+			Samples:      g.cpu.Count(),
+			DiskReadAvg:  g.diskRead / n,
+			DiskWriteAvg: g.diskWrite / n,
+			NetSentAvg:   g.netSent / n,
+			NetRecvAvg:   g.netRecv / n,
+			FirstSeen:    g.first,
+			LastSeen:     g.last,
+			TotalUptime:  g.last.Sub(g.first),
+			TotalCPUTime: time.Duration(g.cpuSeconds * float64(time.Second)),
+			AvgCPUTime:   g.cpuSeconds / n,
+			Latest:       g.latest,
+		}
+
+		stat.CPUAvg, stat.CPUStdDev = g.cpu.MeanStdDev()
+		stat.MemoryAvg, stat.MemoryStdDev = g.memory.MeanStdDev()
+		stat.CPUMax = g.cpu.Max()
+		stat.MemoryMax = g.memory.Max()
+		cpu := g.cpu.Percentiles(50, 90, 95, 99)
+		stat.CPUP50, stat.CPUP90, stat.CPUP95, stat.CPUP99 = cpu[0], cpu[1], cpu[2], cpu[3]
+		memory := g.memory.Percentiles(50, 90, 95, 99)
+		stat.MemoryP50, stat.MemoryP90, stat.MemoryP95, stat.MemoryP99 = memory[0], memory[1], memory[2], memory[3]
+
+		// Each active sample stands for the time since the previous sample. A gap longer
+		// than two intervals means the process or the collector was not observed in
+		// between, so it counts as a single interval.
+		var active float64
+		for gap, samples := range g.activeGaps {
+			if gap < 0 || gap > 2*interval {
+				gap = interval
+			}
+			active += gap * float64(samples)
+			stat.ActiveSamples += samples
+		}
+		stat.ActiveTime = time.Duration(active * float64(time.Second))
+
+		stat.PIDs = make([]int32, 0, len(g.pids))
+		for pid := range g.pids {
+			stat.PIDs = append(stat.PIDs, pid)
+		}
+		sort.Slice(stat.PIDs, func(i, j int) bool { return stat.PIDs[i] < stat.PIDs[j] })
+		if g.earliest > 0 {
+			stat.ProcessStartTime = time.UnixMilli(g.earliest)
+		}
+
+		stats = append(stats, stat)
+	}
+
+	// Sort by active time (descending)
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ActiveTime != stats[j].ActiveTime {
+			return stats[i].ActiveTime > stats[j].ActiveTime
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Percentile returns the p-th percentile (0-100) of sorted values, interpolating
+// linearly between the closest ranks
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower < 0 {
+		return sorted[0]
+	}
+	if upper >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// mostCommon returns the most frequent key, preferring the smallest on ties
+func mostCommon(counts map[string]int) string {
+	var best string
+	bestCount := 0
+	for item, count := range counts {
+		if count > bestCount || (count == bestCount && item < best) {
+			best = item
+			bestCount = count
+		}
+	}
+	return best
+}
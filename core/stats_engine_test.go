@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// TestStatsEngine tests percentiles, standard deviation, CPU seconds from CPUTime deltas
+// and active time across a gap in the samples
+func TestStatsEngine(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var records []ResourceRecord
+	// Ten samples 5s apart with CPU 10..100, then a 10 minute gap and two more samples
+	for i := 0; i < 10; i++ {
+		records = append(records, ResourceRecord{
+			Name: "worker", PID: 100, CreateTime: 1, Timestamp: start.Add(time.Duration(i) * 5 * time.Second),
+			CPUPercent: float64(i+1) * 10, MemoryMB: 100, CPUTime: float64(i), IsActive: true,
+		})
+	}
+	resume := start.Add(45*time.Second + 10*time.Minute)
+	records = append(records,
+		ResourceRecord{Name: "worker", PID: 100, CreateTime: 1, Timestamp: resume, CPUPercent: 50, MemoryMB: 100, CPUTime: 20, IsActive: true},
+		// The process restarted under a new PID: its CPUTime starts over
+		ResourceRecord{Name: "worker", PID: 101, CreateTime: 2, Timestamp: resume, CPUPercent: 50, MemoryMB: 300, CPUTime: 1},
+		ResourceRecord{Name: "worker", PID: 101, CreateTime: 2, Timestamp: resume.Add(5 * time.Second), CPUPercent: 50, MemoryMB: 300, CPUTime: 3},
+	)
+	// Passed out of order: the engine sorts records held in memory
+	records[0], records[len(records)-1] = records[len(records)-1], records[0]
+
+	stats := ComputeResourceStats(records, StatsOptions{})
+	if len(stats) != 1 {
+		t.Fatalf("Expected 1 process, got %d", len(stats))
+	}
+	s := stats[0]
+	if s.Samples != 13 || s.ActiveSamples != 11 || len(s.PIDs) != 2 {
+		t.Errorf("Unexpected counts: %+v", s)
+	}
+	if s.CPUMax != 100 || !approxEqual(s.CPUP50, 50) || !approxEqual(s.CPUP90, 88) {
+		t.Errorf("Unexpected CPU percentiles: max %v p50 %v p90 %v", s.CPUMax, s.CPUP50, s.CPUP90)
+	}
+	if !approxEqual(s.MemoryP95, 300) || !approxEqual(s.MemoryP50, 100) {
+		t.Errorf("Unexpected memory percentiles: p50 %v p95 %v", s.MemoryP50, s.MemoryP95)
+	}
+	_, wantStdDev := meanStdDev([]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 50, 50, 50})
+	if !approxEqual(s.CPUStdDev, wantStdDev) || s.CPUStdDev == 0 {
+		t.Errorf("Expected CPU stddev %v, got %v", wantStdDev, s.CPUStdDev)
+	}
+
+	// PID 100 used 9s before the gap and 11s across it; PID 101 used 2s after its first sample
+	if s.TotalCPUTime != 22*time.Second {
+		t.Errorf("Expected 22s of CPU time, got %v", s.TotalCPUTime)
+	}
+
+	// The interval is estimated as 5s: nine 5s gaps, plus one interval each for the
+	// first sample and the sample after the 10 minute gap
+	if s.ActiveTime != 55*time.Second {
+		t.Errorf("Expected 55s active time, got %v", s.ActiveTime)
+	}
+	if s.Latest.PID != 101 || !s.LastSeen.Equal(resume.Add(5*time.Second)) {
+		t.Errorf("Expected the latest record of PID 101, got %+v", s.Latest)
+	}
+}
+
+// TestStatsEngine_Backends tests that both storage backends and the streaming path
+// produce the same statistics
+func TestStatsEngine_Backends(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	records := schemaTestRecords(start, 3, 20)
+
+	csv := newTestCSVManager(t, filepath.Join(dir, "csv", "process-tracker.log"))
+	defer csv.Close()
+	sqlite := openTestSQLite(t, filepath.Join(dir, "tracker.db"))
+	defer sqlite.Close()
+
+	want := csv.CalculateStats(records)
+	got := sqlite.CalculateStats(records)
+	if len(want) != 3 || len(got) != len(want) {
+		t.Fatalf("Expected 3 processes from both backends, got %d and %d", len(want), len(got))
+	}
+
+	if err := sqlite.SaveRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	config := GetDefaultConfig()
+	config.Storage.Type = "sqlite"
+	config.Storage.SQLitePath = filepath.Join(dir, "tracker.db")
+	app := NewApp(filepath.Join(dir, "process-tracker.log"), 0, config)
+	defer app.storage.Close()
+	streamed, err := app.ResourceStatsBetween(context.Background(), start.Add(-time.Second), time.Now())
+	if err != nil {
+		t.Fatalf("ResourceStatsBetween failed: %v", err)
+	}
+
+	for i := range want {
+		for _, other := range [][]ResourceStats{got, streamed} {
+			if len(other) != len(want) {
+				t.Fatalf("Expected %d processes, got %d", len(want), len(other))
+			}
+			o := other[i]
+			if o.Name != want[i].Name || o.Samples != want[i].Samples || !approxEqual(o.CPUP95, want[i].CPUP95) ||
+				!approxEqual(o.MemoryAvg, want[i].MemoryAvg) || o.ActiveTime != want[i].ActiveTime ||
+				o.TotalCPUTime != want[i].TotalCPUTime {
+				t.Errorf("Backends disagree for %s: %+v vs %+v", want[i].Name, o, want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"strconv"
+)
+
+// StatsDSink sends per-process-name aggregates as StatsD gauges
+// (`prefix.host.name.metric:value|g`) over UDP
+type StatsDSink struct {
+	config SinkConfig
+	host   string
+}
+
+// NewStatsDSink creates a sink for config.Address
+func NewStatsDSink(config SinkConfig) *StatsDSink {
+	return &StatsDSink{config: config, host: sinkHostname()}
+}
+
+// Write sends one gauge per process name and metric
+func (s *StatsDSink) Write(records []ResourceRecord) error {
+	var lines []string
+	prefix := s.config.prefix() + "." + graphiteComponent(s.host)
+	for _, agg := range aggregateByName(records) {
+		path := prefix + "." + graphiteComponent(agg.Name)
+		for _, m := range agg.metrics() {
+			lines = append(lines, path+"."+m.name+":"+strconv.FormatFloat(m.value, 'f', -1, 64)+"|g")
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return writeDatagrams(s.config.Address, lines, s.config.timeout())
+}
+
+// Close is a no-op; each snapshot uses its own socket
+func (s *StatsDSink) Close() error { return nil }
@@ -2,10 +2,14 @@ package core
 
 import (
 	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,6 +26,7 @@ type Manager struct {
 	storageManager *StorageManager
 	useStorageMgr  bool
 	storageConfig  StorageConfig
+	headerPending  bool         // Write a format header before the next row
 	mu             sync.RWMutex // Protects buffer from concurrent access
 }
 
@@ -41,6 +46,7 @@ func (m *Manager) Initialize() error {
 	if m.useStorageMgr {
 		// Use StorageManager for file management
 		sm := NewStorageManager(m.dataFile, m.storageConfig)
+		sm.SetHeader(strings.TrimSuffix(csvHeaderLine(), "\n"))
 		m.storageManager = sm
 	} else {
 		// Only initialize file directly when not using StorageManager
@@ -57,14 +63,21 @@ func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.writer != nil {
+	if m.writer != nil || m.storageManager != nil {
 		if err := m.flushBuffer(); err != nil {
 			return err
 		}
+	}
+	if m.writer != nil {
 		if err := m.writer.Flush(); err != nil {
 			return err
 		}
 	}
+	if m.storageManager != nil {
+		if err := m.storageManager.Close(); err != nil {
+			return err
+		}
+	}
 	if m.file != nil {
 		if err := m.file.Close(); err != nil {
 			return err
@@ -130,27 +143,299 @@ func (m *Manager) readSingleFile(filePath string) ([]ResourceRecord, error) {
 	defer file.Close()
 
 	var records []ResourceRecord
-	scanner := bufio.NewScanner(file)
+	reader := newRecordReader(file)
+	for reader.Next() {
+		records = append(records, reader.Record())
+	}
+
+	return records, reader.Err()
+}
+
+// parseRecord parses a single line into ResourceRecord
+// Lines without a preceding header are v8 rows in the default column order or one of
+// the legacy comma-joined layouts: v7.2 (21 fields with owner), v7.1 (19 fields with labels),
+// v7 (18 fields with CPUPercentNormalized), v6 (17 fields with MemoryPercent), and v5 (16 fields)
+func (m *Manager) parseRecord(line string) (ResourceRecord, error) {
+	return parseHeaderlessLine(line)
+}
+
+// csvFormatVersion is written at the start of every header line
+const csvFormatVersion = "v8"
+
+// csvColumns is the v8 column order; every queryable record field is stored
+var csvColumns = RecordFields
+
+// csvHeaderLine returns the header written before the first v8 row of each write session, e.g.
+// #v8,timestamp,name,cpu_percent,...
+func csvHeaderLine() string {
+	return "#" + csvFormatVersion + "," + strings.Join(csvColumns, ",") + "\n"
+}
+
+// maxRecordLines bounds how many physical lines a quoted v8 row may span
+const maxRecordLines = 64
+
+// recordReader reads resource records from a data file
+// Rows following a header line are parsed by the header's column names, so files may mix
+// legacy rows, older v8 layouts and the current layout
+type recordReader struct {
+	scanner *bufio.Scanner
+	columns []string // Columns from the most recent header; nil before the first header
+	lines   int
+	raw     string // Physical lines of the current row
+	current ResourceRecord
+	err     error
+
+	malformed func(raw string) // Called with each skipped row; nil to skip silently
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &recordReader{scanner: scanner}
+}
+
+// Next advances to the next well-formed record; malformed rows are skipped
+func (r *recordReader) Next() bool {
+	for r.scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			continue
+		}
+		r.raw = line
+		if strings.HasPrefix(line, "#") {
+			if fields, err := parseCSVLine(line); err == nil && len(fields) > 1 {
+				r.columns = fields[1:]
+			}
+			continue
+		}
 
-	for scanner.Scan() {
-		record, err := m.parseRecord(scanner.Text())
+		var record ResourceRecord
+		var err error
+		if r.columns == nil {
+			record, err = parseHeaderlessLine(line)
+		} else {
+			record, err = r.parseRow(line)
+		}
 		if err != nil {
+			if r.malformed != nil {
+				r.malformed(r.raw)
+			}
 			continue // Skip malformed records
 		}
-		records = append(records, record)
+		r.current = record
+		return true
 	}
+	return false
+}
 
-	return records, nil
+// parseRow parses a row following a header, joining physical lines while a quoted field is open
+func (r *recordReader) parseRow(line string) (ResourceRecord, error) {
+	for n := 1; strings.Count(line, `"`)%2 == 1; n++ {
+		if n >= maxRecordLines || !r.scan() {
+			return ResourceRecord{}, fmt.Errorf("unterminated quoted field")
+		}
+		line += "\n" + r.scanner.Text()
+		r.raw = line
+	}
+
+	fields, err := parseCSVLine(line)
+	if err != nil {
+		return ResourceRecord{}, err
+	}
+	if len(fields) != len(r.columns) {
+		// Rows appended by an older version after a newer one started the file
+		return parseRecordLine(line)
+	}
+	return parseRecordColumns(fields, r.columns)
 }
 
-// parseRecord parses a single line into ResourceRecord
-// Supports v7 (18 fields with CPUPercentNormalized), v6 (17 fields with MemoryPercent), and v5 (16 fields) formats
-func (m *Manager) parseRecord(line string) (ResourceRecord, error) {
+func (r *recordReader) scan() bool {
+	if !r.scanner.Scan() {
+		r.err = r.scanner.Err()
+		return false
+	}
+	r.lines++
+	return true
+}
+
+func (r *recordReader) Record() ResourceRecord { return r.current }
+func (r *recordReader) Err() error             { return r.err }
+
+// parseCSVLine splits a single RFC 4180 record
+func parseCSVLine(line string) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
+
+// parseHeaderlessLine parses a row that is not preceded by a header
+// v8 rows written in the default column order are recognised by their field count; rows
+// written before the host column was appended have one field less
+func parseHeaderlessLine(line string) (ResourceRecord, error) {
+	if n := strings.Count(line, ",") + 1; n == len(csvColumns) || n == len(csvColumns)-1 || strings.Contains(line, `"`) {
+		if fields, err := parseCSVLine(line); err == nil && (len(fields) == len(csvColumns) || len(fields) == len(csvColumns)-1) {
+			return parseRecordColumns(fields, csvColumns[:len(fields)])
+		}
+	}
+	return parseRecordLine(line)
+}
+
+// parseRecordColumns parses a v8 row; unknown columns are ignored so newer files stay readable
+func parseRecordColumns(fields, columns []string) (ResourceRecord, error) {
+	var record ResourceRecord
+	hasTimestamp := false
+	for i, column := range columns {
+		if column == "timestamp" {
+			timestamp, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				return record, fmt.Errorf("invalid timestamp: %w", err)
+			}
+			record.Timestamp = time.Unix(timestamp, 0)
+			hasTimestamp = true
+			continue
+		}
+		setRecordField(&record, column, fields[i])
+	}
+	if !hasTimestamp {
+		return record, fmt.Errorf("missing timestamp column")
+	}
+	return record, nil
+}
+
+// setRecordField parses a stored value into the named record field
+func setRecordField(r *ResourceRecord, field, value string) {
+	parseFloat := func() float64 {
+		v, _ := strconv.ParseFloat(value, 64)
+		return v
+	}
+	parseInt32 := func() int32 {
+		v, _ := strconv.ParseInt(value, 10, 32)
+		return int32(v)
+	}
+
+	switch field {
+	case "timestamp":
+		timestamp, _ := strconv.ParseInt(value, 10, 64)
+		r.Timestamp = time.Unix(timestamp, 0)
+	case "name":
+		r.Name = value
+	case "cpu_percent":
+		r.CPUPercent = parseFloat()
+	case "cpu_percent_normalized":
+		r.CPUPercentNormalized = parseFloat()
+	case "memory_mb":
+		r.MemoryMB = parseFloat()
+	case "memory_percent":
+		r.MemoryPercent = parseFloat()
+	case "threads":
+		r.Threads = parseInt32()
+	case "disk_read_mb":
+		r.DiskReadMB = parseFloat()
+	case "disk_write_mb":
+		r.DiskWriteMB = parseFloat()
+	case "net_sent_kb":
+		r.NetSentKB = parseFloat()
+	case "net_recv_kb":
+		r.NetRecvKB = parseFloat()
+	case "is_active":
+		r.IsActive, _ = strconv.ParseBool(value)
+	case "command":
+		r.Command = value
+	case "working_dir":
+		r.WorkingDir = value
+	case "category":
+		r.Category = value
+	case "pid":
+		r.PID = parseInt32()
+	case "ppid":
+		r.PPID = parseInt32()
+	case "create_time":
+		r.CreateTime, _ = strconv.ParseInt(value, 10, 64)
+	case "cpu_time":
+		r.CPUTime = parseFloat()
+	case "labels":
+		r.Labels = ParseLabels(value)
+	case "uid":
+		r.UID = parseInt32()
+	case "username":
+		r.Username = value
+	case "host":
+		r.Host = value
+	}
+}
+
+// recordFieldString formats the named record field for storage
+func recordFieldString(r ResourceRecord, field string) string {
+	switch field {
+	case "timestamp":
+		return strconv.FormatInt(r.Timestamp.Unix(), 10)
+	case "name":
+		return r.Name
+	case "cpu_percent":
+		return strconv.FormatFloat(r.CPUPercent, 'f', 2, 64)
+	case "cpu_percent_normalized":
+		return strconv.FormatFloat(r.CPUPercentNormalized, 'f', 3, 64)
+	case "memory_mb":
+		return strconv.FormatFloat(r.MemoryMB, 'f', 2, 64)
+	case "memory_percent":
+		return strconv.FormatFloat(r.MemoryPercent, 'f', 2, 64)
+	case "threads":
+		return strconv.FormatInt(int64(r.Threads), 10)
+	case "disk_read_mb":
+		return strconv.FormatFloat(r.DiskReadMB, 'f', 2, 64)
+	case "disk_write_mb":
+		return strconv.FormatFloat(r.DiskWriteMB, 'f', 2, 64)
+	case "net_sent_kb":
+		return strconv.FormatFloat(r.NetSentKB, 'f', 2, 64)
+	case "net_recv_kb":
+		return strconv.FormatFloat(r.NetRecvKB, 'f', 2, 64)
+	case "is_active":
+		return strconv.FormatBool(r.IsActive)
+	case "command":
+		return r.Command
+	case "working_dir":
+		return r.WorkingDir
+	case "category":
+		return r.Category
+	case "pid":
+		return strconv.FormatInt(int64(r.PID), 10)
+	case "ppid":
+		return strconv.FormatInt(int64(r.PPID), 10)
+	case "create_time":
+		return strconv.FormatInt(r.CreateTime, 10)
+	case "cpu_time":
+		return strconv.FormatFloat(r.CPUTime, 'f', 2, 64)
+	case "labels":
+		return FormatLabels(r.Labels)
+	case "uid":
+		return strconv.FormatInt(int64(r.UID), 10)
+	case "username":
+		return r.Username
+	case "host":
+		return r.Host
+	}
+	return ""
+}
+
+// parseRecordLine parses a legacy comma-joined line (v5 to v7.2)
+func parseRecordLine(line string) (ResourceRecord, error) {
 	fields := strings.Split(line, ",")
 	
+	// v7.1 appends labels, v7.2 appends labels, uid and username to the v7 layout
+	var labels, uid, username string
+	switch len(fields) {
+	case 21:
+		uid = fields[19]
+		username = fields[20]
+		fallthrough
+	case 19:
+		labels = fields[18]
+		fields = fields[:18]
+	}
+
 	// Support v5 (16), v6 (17), and v7 (18) formats
 	if len(fields) != 16 && len(fields) != 17 && len(fields) != 18 {
-		return ResourceRecord{}, fmt.Errorf("invalid format: expected 16, 17, or 18 fields, got %d", len(fields))
+		return ResourceRecord{}, fmt.Errorf("invalid format: expected 16, 17, 18, 19, or 21 fields, got %d", len(fields))
 	}
 
 	record := ResourceRecord{}
@@ -198,178 +483,298 @@ func (m *Manager) parseRecord(line string) (ResourceRecord, error) {
 	record.PID = int32(pid)
 	record.CreateTime, _ = strconv.ParseInt(fields[14+fieldOffset], 10, 64)
 	record.CPUTime, _ = strconv.ParseFloat(fields[15+fieldOffset], 64)
+	record.Labels = ParseLabels(labels)
+	if uid != "" {
+		parsedUID, _ := strconv.ParseInt(uid, 10, 32)
+		record.UID = int32(parsedUID)
+		record.Username = username
+	}
 
 	return record, nil
 }
 
 // CalculateStats calculates resource statistics from records
 func (m *Manager) CalculateStats(records []ResourceRecord) []ResourceStats {
-	// Group records by process name
-	processMap := make(map[string][]ResourceRecord)
-	for _, record := range records {
-		processMap[record.Name] = append(processMap[record.Name], record)
+	return ComputeResourceStats(records, StatsOptions{})
+}
+
+// CleanOldData applies keep_days and the retention rules to the data files and sidecars
+func (m *Manager) CleanOldData(keepDays int) error {
+	policy, err := NewRetentionPolicy(keepDays, m.storageConfig.Retention)
+	if err != nil {
+		return err
+	}
+	if _, err := m.ApplyRetention(policy, time.Now(), false); err != nil {
+		return err
 	}
 
-	// Calculate statistics for each process
-	var stats []ResourceStats
-	for name, processRecords := range processMap {
-		if len(processRecords) == 0 {
-			continue
-		}
+	if m.storageManager != nil {
+		// Storage manager handles its own cleanup
+		return nil
+	}
 
-		stat := ResourceStats{
-			Name:       name,
-			Category:   m.getMostCommonCategory(processRecords),
-			Command:    m.getMostCommonCommand(processRecords),
-			WorkingDir: m.getMostCommonWorkingDir(processRecords),
-			Samples:    len(processRecords),
-		}
+	// Simple file cleanup for backward compatibility; files outlive the longest retention
+	longest := policy.Longest()
+	if longest == 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-longest)
 
-		// Calculate averages and maximums
-		var totalCPU, totalMemory, totalDiskRead, totalDiskWrite, totalNetSent, totalNetRecv float64
-		var activeSamples int
-		var maxCPU, maxMemory float64
+	dir := filepath.Dir(m.dataFile)
+	base := filepath.Base(m.dataFile)
 
-		for _, record := range processRecords {
-			totalCPU += record.CPUPercent
-			totalMemory += record.MemoryMB
-			totalDiskRead += record.DiskReadMB
-			totalDiskWrite += record.DiskWriteMB
-			totalNetSent += record.NetSentKB
-			totalNetRecv += record.NetRecvKB
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
 
-			if record.CPUPercent > maxCPU {
-				maxCPU = record.CPUPercent
-			}
-			if record.MemoryMB > maxMemory {
-				maxMemory = record.MemoryMB
-			}
-			if record.IsActive {
-				activeSamples++
-			}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
 		}
 
-		stat.CPUAvg = totalCPU / float64(len(processRecords))
-		stat.MemoryAvg = totalMemory / float64(len(processRecords))
-		stat.DiskReadAvg = totalDiskRead / float64(len(processRecords))
-		stat.DiskWriteAvg = totalDiskWrite / float64(len(processRecords))
-		stat.NetSentAvg = totalNetSent / float64(len(processRecords))
-		stat.NetRecvAvg = totalNetRecv / float64(len(processRecords))
-		stat.CPUMax = maxCPU
-		stat.MemoryMax = maxMemory
-		stat.ActiveSamples = activeSamples
-
-		// Calculate active time
-		stat.ActiveTime = m.calculateActiveTime(processRecords)
-
-		// Calculate new statistics
-		pidSet := make(map[int32]bool)
-		var firstSeen, lastSeen time.Time
-		var earliestCreateTime int64
-		var totalCPUTime float64
-
-		for i, record := range processRecords {
-			// Collect PIDs
-			if record.PID > 0 {
-				pidSet[record.PID] = true
+		// Check if file matches our pattern
+		if strings.HasPrefix(file.Name(), base) {
+			info, err := file.Info()
+			if err != nil {
+				continue
 			}
 
-			// Track observation times
-			if i == 0 || record.Timestamp.Before(firstSeen) {
-				firstSeen = record.Timestamp
-			}
-			if i == 0 || record.Timestamp.After(lastSeen) {
-				lastSeen = record.Timestamp
+			if info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(dir, file.Name()))
 			}
+		}
+	}
 
-			// Find earliest process start time (CreateTime is Unix milliseconds)
-			if record.CreateTime > 0 {
-				if earliestCreateTime == 0 || record.CreateTime < earliestCreateTime {
-					earliestCreateTime = record.CreateTime
-				}
-			}
+	return nil
+}
+
+// ApplyRetention drops expired rows from the data file and its rotations, and prunes the
+// system and events sidecars by keep_days. Only files holding expired rows are rewritten;
+// the file being written is closed first so writing resumes in the rewritten file.
+func (m *Manager) ApplyRetention(policy *RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error) {
+	report := policy.newReport(now, dryRun)
 
-			// Sum CPU time
-			if record.CPUTime > 0 {
-				totalCPUTime += record.CPUTime
+	if cutoff := policy.DefaultCutoff(now); !cutoff.IsZero() {
+		system, err := readSystemRecordsFile(m.systemDataFile())
+		if err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+		for _, record := range system {
+			if record.Timestamp.Before(cutoff) {
+				report.SystemRecords++
+			}
+		}
+		events, err := readProcessEventsFile(m.eventsDataFile())
+		if err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+		for _, event := range events {
+			if event.Timestamp.Before(cutoff) {
+				report.ProcessEvents++
 			}
 		}
 
-		// Convert PID set to slice
-		pids := make([]int32, 0, len(pidSet))
-		for pid := range pidSet {
-			pids = append(pids, pid)
+		if !dryRun && report.SystemRecords > 0 {
+			if err := m.pruneSystemRecords(cutoff); err != nil {
+				return report, fmt.Errorf("failed to prune system records: %w", err)
+			}
 		}
-		stat.PIDs = pids
+		if !dryRun && report.ProcessEvents > 0 {
+			if err := m.pruneProcessEvents(cutoff); err != nil {
+				return report, fmt.Errorf("failed to prune process events: %w", err)
+			}
+		}
+	}
 
-		// Set observation times
-		stat.FirstSeen = firstSeen
-		stat.LastSeen = lastSeen
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		// Calculate observation duration (monitoring time span)
-		if !firstSeen.IsZero() && !lastSeen.IsZero() {
-			stat.TotalUptime = lastSeen.Sub(firstSeen)
+	// Buffered rows are written first so they are counted like the rest
+	if m.writer != nil || m.storageManager != nil {
+		if err := m.flushBuffer(); err != nil {
+			return report, err
 		}
-
-		// Set process actual start time
-		if earliestCreateTime > 0 {
-			stat.ProcessStartTime = time.Unix(earliestCreateTime/1000, (earliestCreateTime%1000)*1000000)
+	}
+	files, err := NewStorageManager(m.dataFile, m.storageConfig).GetLogFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, f := range files {
+		counts, malformed, err := m.expireDataFile(f.Path, policy, now, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("failed to apply retention to %s: %w", f.Path, err)
 		}
+		for i, n := range counts {
+			report.add(i, n)
+		}
+		report.Malformed += malformed
+	}
+	return report, nil
+}
 
-		// Calculate CPU time statistics
-		stat.TotalCPUTime = time.Duration(totalCPUTime * float64(time.Second))
-		if len(processRecords) > 0 {
-			stat.AvgCPUTime = totalCPUTime / float64(len(processRecords))
+// expireDataFile counts the expired rows of a data file per retention rule and, unless dryRun
+// is set, rewrites the file without them
+// Rows that cannot be parsed are counted and copied through unchanged; removing them is left
+// to 'db repair', which quarantines them
+// NOTE: This method must be called while holding m.mu lock
+func (m *Manager) expireDataFile(path string, policy *RetentionPolicy, now time.Time, dryRun bool) ([]int64, int64, error) {
+	counts := make([]int64, len(policy.keep))
+	var expired, malformed int64
+	err := scanCSVDataFileRows(path, func(record ResourceRecord) {
+		if index, ok := policy.Expired(record, now); ok {
+			counts[index]++
+			expired++
 		}
+	}, func(string) {
+		malformed++
+	})
+	if err != nil || dryRun || expired == 0 {
+		return counts, malformed, err
+	}
 
-		stats = append(stats, stat)
+	info, err := os.Stat(path)
+	if err != nil {
+		return counts, malformed, err
+	}
+	if err := m.closeDataFile(); err != nil {
+		return counts, malformed, err
 	}
 
-	// Sort by active time (descending)
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].ActiveTime > stats[j].ActiveTime
+	rw, err := newFileRewriter(path)
+	if err != nil {
+		return counts, malformed, err
+	}
+	rw.WriteString(csvHeaderLine())
+	err = scanCSVDataFileRows(path, func(record ResourceRecord) {
+		if _, ok := policy.Expired(record, now); !ok {
+			rw.WriteString(m.formatRecord(record))
+		}
+	}, func(raw string) {
+		rw.WriteString(raw + "\n")
 	})
+	if err != nil {
+		rw.Abort()
+		return counts, malformed, err
+	}
+	return counts, malformed, rw.Commit(info.ModTime())
+}
 
-	return stats
+// fileRewriter writes a replacement for a file next to it, gzip-compressed when the original is
+type fileRewriter struct {
+	path    string
+	tmpPath string
+	file    *os.File
+	gz      *gzip.Writer
+	w       *bufio.Writer
 }
 
-// CleanOldData removes old data files
-func (m *Manager) CleanOldData(keepDays int) error {
-	if m.storageManager != nil {
-		// Storage manager handles its own cleanup
-		return nil
+func newFileRewriter(path string) (*fileRewriter, error) {
+	rw := &fileRewriter{path: path, tmpPath: path + ".tmp"}
+	file, err := os.Create(rw.tmpPath)
+	if err != nil {
+		return nil, err
 	}
+	rw.file = file
+	var out io.Writer = file
+	if strings.HasSuffix(path, ".gz") {
+		rw.gz = gzip.NewWriter(file)
+		out = rw.gz
+	}
+	rw.w = bufio.NewWriter(out)
+	return rw, nil
+}
 
-	// Simple file cleanup for backward compatibility
-	cutoff := time.Now().AddDate(0, 0, -keepDays)
-
-	dir := filepath.Dir(m.dataFile)
-	base := filepath.Base(m.dataFile)
+// WriteString writes to the replacement; errors are reported by Commit
+func (rw *fileRewriter) WriteString(s string) {
+	rw.w.WriteString(s)
+}
 
-	files, err := os.ReadDir(dir)
+// Commit replaces the original file, keeping modTime so age-based compression and cleanup are unaffected
+func (rw *fileRewriter) Commit(modTime time.Time) error {
+	err := rw.w.Flush()
+	if err == nil && rw.gz != nil {
+		err = rw.gz.Close()
+	}
+	if closeErr := rw.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(rw.tmpPath, modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(rw.tmpPath, rw.path)
+	}
 	if err != nil {
-		return err
+		os.Remove(rw.tmpPath)
 	}
+	return err
+}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+// Abort discards the replacement
+func (rw *fileRewriter) Abort() {
+	rw.file.Close()
+	os.Remove(rw.tmpPath)
+}
+
+// closeDataFile flushes the buffer and closes the file being written; the next write reopens it
+// NOTE: This method must be called while holding m.mu lock
+func (m *Manager) closeDataFile() error {
+	if m.writer != nil || m.storageManager != nil {
+		if err := m.flushBuffer(); err != nil {
+			return err
 		}
+	}
+	if m.writer != nil {
+		if err := m.writer.Flush(); err != nil {
+			return err
+		}
+		m.writer = nil
+	}
+	if m.file != nil {
+		if err := m.file.Close(); err != nil {
+			return err
+		}
+		m.file = nil
+	}
+	if m.storageManager != nil {
+		if err := m.storageManager.Close(); err != nil {
+			return err
+		}
+		m.storageManager.currentFile = nil
+	}
+	return nil
+}
 
-		// Check if file matches our pattern
-		if strings.HasPrefix(file.Name(), base) {
-			info, err := file.Info()
-			if err != nil {
-				continue
-			}
+// scanCSVDataFile calls fn for every record of a data file, which may be gzip-compressed
+func scanCSVDataFile(path string, fn func(ResourceRecord)) error {
+	return scanCSVDataFileRows(path, fn, nil)
+}
 
-			if info.ModTime().Before(cutoff) {
-				os.Remove(filepath.Join(dir, file.Name()))
-			}
+// scanCSVDataFileRows is scanCSVDataFile, also passing the raw text of malformed rows to malformed
+func scanCSVDataFileRows(path string, fn func(ResourceRecord), malformed func(raw string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
 		}
+		defer gz.Close()
+		r = gz
 	}
 
-	return nil
+	reader := newRecordReader(r)
+	reader.malformed = malformed
+	for reader.Next() {
+		fn(reader.Record())
+	}
+	return reader.Err()
 }
 
 // GetTotalRecords returns the total number of records in the data file
@@ -381,12 +786,12 @@ func (m *Manager) GetTotalRecords() (int, error) {
 	defer file.Close()
 
 	count := 0
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	reader := newRecordReader(file)
+	for reader.Next() {
 		count++
 	}
 
-	return count, scanner.Err()
+	return count, reader.Err()
 }
 
 // GetRecordCount returns the total number of records (alias for GetTotalRecords for interface compatibility)
@@ -422,12 +827,20 @@ func (m *Manager) GetStorageInfo() StorageInfo {
 
 // ReadRecordsByTimeRange 按时间范围读取记录 (CSV实现)
 func (m *Manager) ReadRecordsByTimeRange(start, end time.Time) ([]ResourceRecord, error) {
-	// 读取所有记录，然后过滤
+	// 读取所有记录，然后过滤（数据文件尚未创建时视为没有记录）
 	allRecords, err := m.ReadRecords(m.dataFile)
 	if err != nil {
-		return nil, err
+		if _, statErr := os.Stat(m.dataFile); !os.IsNotExist(statErr) {
+			return nil, err
+		}
+		allRecords = nil
 	}
 
+	// 包含尚未写入文件的缓冲记录
+	m.mu.RLock()
+	allRecords = append(allRecords, m.buffer...)
+	m.mu.RUnlock()
+
 	var filteredRecords []ResourceRecord
 	for _, record := range allRecords {
 		if record.Timestamp.After(start) && record.Timestamp.Before(end) {
@@ -438,6 +851,372 @@ func (m *Manager) ReadRecordsByTimeRange(start, end time.Time) ([]ResourceRecord
 	return filteredRecords, nil
 }
 
+// SaveSystemRecord appends a host-level metrics sample to the system data file
+// System samples are written once per interval, so they bypass the record buffer
+func (m *Manager) SaveSystemRecord(record SystemRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := m.systemDataFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open system data file: %w", err)
+	}
+	defer file.Close()
+
+	fields, err := formatSystemRecord(record)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	if err := w.Write(fields); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ReadSystemRecordsByTimeRange reads host-level metrics samples within a time range
+func (m *Manager) ReadSystemRecordsByTimeRange(start, end time.Time) ([]SystemRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all, err := readSystemRecordsFile(m.systemDataFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SystemRecord{}, nil
+		}
+		return nil, err
+	}
+
+	records := make([]SystemRecord, 0, len(all))
+	for _, record := range all {
+		if !record.Timestamp.Before(start) && !record.Timestamp.After(end) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// SaveProcessEvents appends process lifecycle events to the events file
+func (m *Manager) SaveProcessEvents(events []ProcessEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := m.eventsDataFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	for _, event := range events {
+		if err := w.Write(formatProcessEvent(event)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ReadProcessEventsByTimeRange reads process lifecycle events within a time range
+func (m *Manager) ReadProcessEventsByTimeRange(start, end time.Time) ([]ProcessEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all, err := readProcessEventsFile(m.eventsDataFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ProcessEvent{}, nil
+		}
+		return nil, err
+	}
+
+	events := make([]ProcessEvent, 0, len(all))
+	for _, event := range all {
+		if !event.Timestamp.Before(start) && !event.Timestamp.After(end) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// systemDataFile returns the path of the host-level metrics file next to the process data file
+// e.g. process-tracker.log -> process-tracker-system.log
+func (m *Manager) systemDataFile() string {
+	return m.sidecarFile("system")
+}
+
+// eventsDataFile returns the path of the process lifecycle events file
+// e.g. process-tracker.log -> process-tracker-events.log
+func (m *Manager) eventsDataFile() string {
+	return m.sidecarFile("events")
+}
+
+// sidecarFile returns the path of a companion data file next to the process data file
+func (m *Manager) sidecarFile(kind string) string {
+	ext := filepath.Ext(m.dataFile)
+	return strings.TrimSuffix(m.dataFile, ext) + "-" + kind + ext
+}
+
+// pruneProcessEvents rewrites the events file keeping only events newer than cutoff
+func (m *Manager) pruneProcessEvents(cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := m.eventsDataFile()
+	events, err := readProcessEventsFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var lines [][]string
+	for _, event := range events {
+		if !event.Timestamp.Before(cutoff) {
+			lines = append(lines, formatProcessEvent(event))
+		}
+	}
+	return rewriteCSVFile(path, lines)
+}
+
+// rewriteCSVFile atomically replaces a CSV file with the given lines
+func rewriteCSVFile(path string, lines [][]string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.WriteAll(lines)
+	if err := w.Error(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// formatProcessEvent converts a process event into CSV fields
+func formatProcessEvent(event ProcessEvent) []string {
+	var lastSeen int64
+	if !event.LastSeen.IsZero() {
+		lastSeen = event.LastSeen.Unix()
+	}
+	return []string{
+		strconv.FormatInt(event.Timestamp.Unix(), 10),
+		string(event.Type),
+		strconv.FormatInt(int64(event.PID), 10),
+		strconv.FormatInt(int64(event.PPID), 10),
+		event.Name,
+		event.Command,
+		event.PreviousCommand,
+		event.Category,
+		strconv.FormatInt(event.CreateTime, 10),
+		strconv.FormatInt(lastSeen, 10),
+		strconv.FormatFloat(event.LifetimeSeconds, 'f', 0, 64),
+		strconv.FormatFloat(event.CPUPercent, 'f', 2, 64),
+		strconv.FormatFloat(event.MemoryMB, 'f', 2, 64),
+		strconv.FormatInt(int64(event.Threads), 10),
+		strconv.FormatFloat(event.CPUTime, 'f', 2, 64),
+	}
+}
+
+// parseProcessEvent parses CSV fields written by formatProcessEvent
+func parseProcessEvent(fields []string) (ProcessEvent, error) {
+	if len(fields) != 15 {
+		return ProcessEvent{}, fmt.Errorf("invalid process event: expected 15 fields, got %d", len(fields))
+	}
+
+	timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return ProcessEvent{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	event := ProcessEvent{
+		Timestamp:       time.Unix(timestamp, 0),
+		Type:            ProcessEventType(fields[1]),
+		Name:            fields[4],
+		Command:         fields[5],
+		PreviousCommand: fields[6],
+		Category:        fields[7],
+	}
+	pid, _ := strconv.ParseInt(fields[2], 10, 32)
+	ppid, _ := strconv.ParseInt(fields[3], 10, 32)
+	event.PID = int32(pid)
+	event.PPID = int32(ppid)
+	event.CreateTime, _ = strconv.ParseInt(fields[8], 10, 64)
+	if lastSeen, _ := strconv.ParseInt(fields[9], 10, 64); lastSeen > 0 {
+		event.LastSeen = time.Unix(lastSeen, 0)
+	}
+	event.LifetimeSeconds, _ = strconv.ParseFloat(fields[10], 64)
+	event.CPUPercent, _ = strconv.ParseFloat(fields[11], 64)
+	event.MemoryMB, _ = strconv.ParseFloat(fields[12], 64)
+	threads, _ := strconv.ParseInt(fields[13], 10, 32)
+	event.Threads = int32(threads)
+	event.CPUTime, _ = strconv.ParseFloat(fields[14], 64)
+
+	return event, nil
+}
+
+// readProcessEventsFile reads all process events from a file, skipping malformed lines
+func readProcessEventsFile(path string) ([]ProcessEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var events []ProcessEvent
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		event, err := parseProcessEvent(fields)
+		if err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// pruneSystemRecords rewrites the system data file keeping only samples newer than cutoff
+func (m *Manager) pruneSystemRecords(cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := m.systemDataFile()
+	records, err := readSystemRecordsFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var lines [][]string
+	for _, record := range records {
+		if record.Timestamp.Before(cutoff) {
+			continue
+		}
+		fields, err := formatSystemRecord(record)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fields)
+	}
+	return rewriteCSVFile(path, lines)
+}
+
+// formatSystemRecord converts a system record into CSV fields (disks are stored as JSON)
+func formatSystemRecord(record SystemRecord) ([]string, error) {
+	disks, err := json.Marshal(record.Disks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode disks: %w", err)
+	}
+
+	fields := []string{strconv.FormatInt(record.Timestamp.Unix(), 10)}
+	for _, v := range systemRecordValues(&record) {
+		fields = append(fields, strconv.FormatFloat(*v, 'f', 2, 64))
+	}
+	return append(fields, string(disks)), nil
+}
+
+// parseSystemRecord parses CSV fields written by formatSystemRecord
+func parseSystemRecord(fields []string) (SystemRecord, error) {
+	var record SystemRecord
+	values := systemRecordValues(&record)
+	if len(fields) != len(values)+2 {
+		return record, fmt.Errorf("invalid system record: expected %d fields, got %d", len(values)+2, len(fields))
+	}
+
+	timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return record, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	record.Timestamp = time.Unix(timestamp, 0)
+
+	for i, v := range values {
+		*v, _ = strconv.ParseFloat(fields[i+1], 64)
+	}
+
+	if disks := fields[len(fields)-1]; disks != "" && disks != "null" {
+		if err := json.Unmarshal([]byte(disks), &record.Disks); err != nil {
+			return record, fmt.Errorf("invalid disks: %w", err)
+		}
+	}
+	return record, nil
+}
+
+// systemRecordValues lists the numeric fields of a system record in file column order
+func systemRecordValues(r *SystemRecord) []*float64 {
+	return []*float64{
+		&r.Load1, &r.Load5, &r.Load15,
+		&r.CPUPercent, &r.CPUUser, &r.CPUSystem, &r.CPUNice, &r.CPUIdle, &r.CPUIOWait, &r.CPUIRQ, &r.CPUSteal,
+		&r.MemoryTotalMB, &r.MemoryUsedMB, &r.MemoryAvailableMB, &r.MemoryCachedMB, &r.MemoryBuffersMB,
+		&r.MemoryPercent, &r.SwapTotalMB, &r.SwapUsedMB,
+		&r.PSICPUSome, &r.PSIMemorySome, &r.PSIMemoryFull, &r.PSIIOSome, &r.PSIIOFull,
+	}
+}
+
+// readSystemRecordsFile reads all system records from a file, skipping malformed lines
+func readSystemRecordsFile(path string) ([]SystemRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var records []SystemRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		record, err := parseSystemRecord(fields)
+		if err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
 // Private helper methods
 
 func (m *Manager) initializeFile() error {
@@ -457,6 +1236,7 @@ func (m *Manager) initializeFile() error {
 
 	m.file = file
 	m.writer = bufio.NewWriter(file)
+	m.headerPending = true
 	return nil
 }
 
@@ -470,7 +1250,7 @@ func (m *Manager) flushBuffer() error {
 	// Use storage manager if enabled (handles rotation)
 	if m.useStorageMgr && m.storageManager != nil {
 		for _, record := range m.buffer {
-			line := m.formatRecord(record)
+			line := strings.TrimSuffix(m.formatRecord(record), "\n")
 			if err := m.storageManager.WriteRecord(line); err != nil {
 				return err
 			}
@@ -486,6 +1266,14 @@ func (m *Manager) flushBuffer() error {
 		}
 	}
 
+	// Each write session starts with a header so readers can tell the layout of the rows that follow
+	if m.headerPending {
+		if _, err := m.writer.WriteString(csvHeaderLine()); err != nil {
+			return err
+		}
+		m.headerPending = false
+	}
+
 	for _, record := range m.buffer {
 		line := m.formatRecord(record)
 		if _, err := m.writer.WriteString(line); err != nil {
@@ -497,101 +1285,161 @@ func (m *Manager) flushBuffer() error {
 	return m.writer.Flush()
 }
 
+// formatRecord formats a record as a v8 row in csvColumns order, quoting fields as needed
 func (m *Manager) formatRecord(record ResourceRecord) string {
-	fields := []string{
-		strconv.FormatInt(record.Timestamp.Unix(), 10),
-		record.Name,
-		strconv.FormatFloat(record.CPUPercent, 'f', 2, 64),
-		strconv.FormatFloat(record.CPUPercentNormalized, 'f', 3, 64), // v7: normalized CPU percentage
-		strconv.FormatFloat(record.MemoryMB, 'f', 2, 64),
-		strconv.FormatFloat(record.MemoryPercent, 'f', 2, 64), // v6: memory percentage
-		strconv.FormatInt(int64(record.Threads), 10),
-		strconv.FormatFloat(record.DiskReadMB, 'f', 2, 64),
-		strconv.FormatFloat(record.DiskWriteMB, 'f', 2, 64),
-		strconv.FormatFloat(record.NetSentKB, 'f', 2, 64),
-		strconv.FormatFloat(record.NetRecvKB, 'f', 2, 64),
-		strconv.FormatBool(record.IsActive),
-		record.Command,
-		record.WorkingDir,
-		record.Category,
-		strconv.FormatInt(int64(record.PID), 10),
-		strconv.FormatInt(record.CreateTime, 10),
-		strconv.FormatFloat(record.CPUTime, 'f', 2, 64),
-	}
-	return strings.Join(fields, ",") + "\n"
-}
-
-func (m *Manager) calculateActiveTime(records []ResourceRecord) time.Duration {
-	if len(records) == 0 {
-		return 0
-	}
-
-	// Simple heuristic: if more than 50% of samples are active, consider the process active
-	activeCount := 0
-	for _, record := range records {
-		if record.IsActive {
-			activeCount++
-		}
+	fields := make([]string, len(csvColumns))
+	for i, column := range csvColumns {
+		fields[i] = recordFieldString(record, column)
 	}
 
-	if float64(activeCount)/float64(len(records)) > 0.5 {
-		// Estimate active time based on record timestamps
-		if len(records) > 1 {
-			timeSpan := records[len(records)-1].Timestamp.Sub(records[0].Timestamp)
-			return time.Duration(float64(timeSpan) * float64(activeCount) / float64(len(records)))
-		}
-		return 5 * time.Minute // Default assumption
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(fields)
+	w.Flush()
+	return sb.String()
+}
+
+// Query streams records matching a query from the data file (CSV实现)
+// Filters, offset and limit are applied while streaming when records are wanted in file
+// order; other orderings and LatestOnly need the whole matching set in memory
+func (m *Manager) Query(ctx context.Context, q RecordQuery) (RecordIterator, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
 	}
 
-	return 0
+	if q.naturalOrder() && !q.LatestOnly {
+		return m.newCSVRecordIterator(ctx, q)
+	}
+
+	filterOnly := RecordQuery{
+		Start:      q.Start,
+		End:        q.End,
+		Names:      q.Names,
+		Categories: q.Categories,
+		PIDs:       q.PIDs,
+		Users:      q.Users,
+		Text:       q.Text,
+	}
+	it, err := m.newCSVRecordIterator(ctx, filterOnly)
+	if err != nil {
+		return nil, err
+	}
+	records, err := CollectRecords(it)
+	if err != nil {
+		return nil, err
+	}
+	return newSliceIterator(applyQuery(records, q)), nil
 }
 
-func (m *Manager) getMostCommonCategory(records []ResourceRecord) string {
-	categoryCount := make(map[string]int)
-	for _, record := range records {
-		if record.Category != "" {
-			categoryCount[record.Category]++
+// csvRecordIterator parses and filters the data file line by line, followed by
+// records still waiting in the write buffer
+type csvRecordIterator struct {
+	ctx     context.Context
+	query   RecordQuery
+	file    *os.File
+	reader  *recordReader
+	pending []ResourceRecord
+	read    int
+	skipped int
+	emitted int
+	current ResourceRecord
+	err     error
+}
+
+func (m *Manager) newCSVRecordIterator(ctx context.Context, q RecordQuery) (*csvRecordIterator, error) {
+	it := &csvRecordIterator{ctx: ctx, query: q}
+
+	// Same file selection as ReadRecords: main file, or the first readable rotated file
+	filesToTry := []string{m.dataFile}
+	if _, err := os.Stat(m.dataFile); os.IsNotExist(err) {
+		matches, _ := filepath.Glob(m.dataFile + ".*")
+		filesToTry = matches
+	}
+	for _, path := range filesToTry {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
 		}
+		it.file = file
+		it.reader = newRecordReader(file)
+		break
 	}
 
-	return m.getMostCommon(categoryCount)
+	// 包含尚未写入文件的缓冲记录
+	m.mu.RLock()
+	it.pending = append([]ResourceRecord(nil), m.buffer...)
+	m.mu.RUnlock()
+
+	return it, nil
 }
 
-func (m *Manager) getMostCommonCommand(records []ResourceRecord) string {
-	commandCount := make(map[string]int)
-	for _, record := range records {
-		if record.Command != "" {
-			commandCount[record.Command]++
-		}
+func (it *csvRecordIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.query.Limit > 0 && it.emitted >= it.query.Limit {
+		return false
 	}
 
-	return m.getMostCommon(commandCount)
+	for {
+		record, ok := it.nextCandidate()
+		if !ok {
+			return false
+		}
+		if !it.query.Matches(record) {
+			continue
+		}
+		if it.skipped < it.query.Offset {
+			it.skipped++
+			continue
+		}
+		it.current = projectRecord(record, it.query.Fields)
+		it.emitted++
+		return true
+	}
 }
 
-func (m *Manager) getMostCommonWorkingDir(records []ResourceRecord) string {
-	dirCount := make(map[string]int)
-	for _, record := range records {
-		if record.WorkingDir != "" {
-			dirCount[record.WorkingDir]++
+// nextCandidate returns the next parsable record from the file, then from the write buffer
+func (it *csvRecordIterator) nextCandidate() (ResourceRecord, bool) {
+	if it.reader != nil {
+		if it.read%1024 == 0 {
+			if err := it.ctx.Err(); err != nil {
+				it.err = err
+				return ResourceRecord{}, false
+			}
+		}
+		if it.reader.Next() {
+			it.read++
+			return it.reader.Record(), true
+		}
+		it.err = it.reader.Err()
+		it.closeFile()
+		if it.err != nil {
+			return ResourceRecord{}, false
 		}
 	}
 
-	return m.getMostCommon(dirCount)
+	if len(it.pending) == 0 {
+		return ResourceRecord{}, false
+	}
+	record := it.pending[0]
+	it.pending = it.pending[1:]
+	return record, true
 }
 
-func (m *Manager) getMostCommon(countMap map[string]int) string {
-	if len(countMap) == 0 {
-		return ""
+func (it *csvRecordIterator) closeFile() {
+	if it.file != nil {
+		it.file.Close()
+		it.file = nil
 	}
+	it.reader = nil
+}
 
-	var mostCommon string
-	maxCount := 0
-	for item, count := range countMap {
-		if count > maxCount {
-			maxCount = count
-			mostCommon = item
-		}
-	}
+func (it *csvRecordIterator) Record() ResourceRecord { return it.current }
+func (it *csvRecordIterator) Err() error             { return it.err }
 
-	return mostCommon
+func (it *csvRecordIterator) Close() error {
+	it.closeFile()
+	it.pending = nil
+	return nil
 }
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IntegrityStorage is implemented by storage backends that can check their files and repair them
+type IntegrityStorage interface {
+	// CheckIntegrity checks the store. With repair set it also fixes what it can, moving
+	// data it cannot recover aside instead of deleting it.
+	CheckIntegrity(repair bool) (IntegrityReport, error)
+}
+
+// IntegrityReport describes a check or repair of the store
+type IntegrityReport struct {
+	Type     string      `json:"type"` // "sqlite" or "csv"
+	Repair   bool        `json:"repair"`
+	OK       bool        `json:"ok"`       // No problems were found
+	Repaired bool        `json:"repaired"` // Problems were found and fixed
+	Files    []FileCheck `json:"files"`
+}
+
+// FileCheck is the result for one file of the store
+type FileCheck struct {
+	Path       string           `json:"path"`
+	Kind       string           `json:"kind"`                 // "data", "system", "events" or "database"
+	Records    int64            `json:"records"`              // Readable records, or rows for a database
+	Malformed  int64            `json:"malformed"`            // Unparsable lines, or database rows that could not be salvaged
+	Truncated  bool             `json:"truncated,omitempty"`  // The gzip stream ends early or is damaged
+	Tables     map[string]int64 `json:"tables,omitempty"`     // Rows per table (SQLite)
+	Problems   []string         `json:"problems,omitempty"`   // The first problems found
+	Repaired   bool             `json:"repaired,omitempty"`   // The file was rewritten or rebuilt
+	Quarantine string           `json:"quarantine,omitempty"` // Where removed lines or the damaged database were moved
+}
+
+// maxReportedProblems bounds the problems listed per file
+const maxReportedProblems = 20
+
+// problem records a problem, listing only the first few
+func (f *FileCheck) problem(format string, args ...interface{}) {
+	if len(f.Problems) < maxReportedProblems {
+		f.Problems = append(f.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// addFile adds a file's result to the report
+func (r *IntegrityReport) addFile(f FileCheck) {
+	if len(f.Problems) > 0 {
+		r.OK = false
+	}
+	if f.Repaired {
+		r.Repaired = true
+	}
+	r.Files = append(r.Files, f)
+}
+
+// quarantineDir returns the directory holding lines removed by a repair
+func (m *Manager) quarantineDir() string {
+	return filepath.Join(filepath.Dir(m.dataFile), "quarantine")
+}
+
+// CheckIntegrity scans the data file, its rotations (gzipped ones included) and the system and
+// events sidecars. Malformed lines are counted and, when repairing, moved to a file in the
+// quarantine directory; gzipped files that end early are rewritten from what could be read.
+func (m *Manager) CheckIntegrity(repair bool) (IntegrityReport, error) {
+	report := IntegrityReport{Type: "csv", Repair: repair, OK: true}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Buffered rows are written first; a repair closes the file being written
+	if m.writer != nil || m.storageManager != nil {
+		if err := m.flushBuffer(); err != nil {
+			return report, err
+		}
+	}
+	if repair {
+		if err := m.closeDataFile(); err != nil {
+			return report, err
+		}
+	}
+
+	files, err := m.storeFiles()
+	if err != nil {
+		return report, err
+	}
+	stamp := time.Now().Format("20060102-150405")
+	for _, f := range files {
+		check, err := m.checkCSVFile(f.path, f.kind, repair, stamp)
+		if err != nil {
+			return report, fmt.Errorf("failed to check %s: %w", f.path, err)
+		}
+		report.addFile(check)
+	}
+	return report, nil
+}
+
+// checkCSVFile checks one file of the CSV store and, when repairing, rewrites it without its
+// malformed lines
+func (m *Manager) checkCSVFile(path, kind string, repair bool, stamp string) (FileCheck, error) {
+	check := FileCheck{Path: path, Kind: kind}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return check, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return check, err
+	}
+	defer file.Close()
+
+	compressed := strings.HasSuffix(path, ".gz")
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			// Nothing is readable; a repair moves the whole file aside
+			check.Truncated = true
+			check.problem("unreadable gzip file: %v", err)
+			if repair {
+				file.Close()
+				check.Quarantine, err = moveToQuarantine(path, m.quarantineDir(), stamp)
+				check.Repaired = err == nil
+			}
+			return check, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var rw *fileRewriter
+	if repair {
+		if rw, err = newFileRewriter(path); err != nil {
+			return check, err
+		}
+	}
+	var malformed []string
+
+	switch kind {
+	case "data":
+		if rw != nil {
+			rw.WriteString(csvHeaderLine())
+		}
+		reader := newRecordReader(r)
+		reader.malformed = func(raw string) {
+			check.Malformed++
+			check.problem("line %d: malformed record", reader.lines)
+			malformed = append(malformed, raw)
+		}
+		for reader.Next() {
+			check.Records++
+			if rw != nil {
+				rw.WriteString(m.formatRecord(reader.Record()))
+			}
+		}
+		err = reader.Err()
+	default:
+		line := 0
+		err = scanCSVRows(r, func(raw string, lines int) {
+			line += lines
+			if parseErr := parseSidecarRow(kind, raw); parseErr != nil {
+				check.Malformed++
+				check.problem("line %d: %v", line, parseErr)
+				malformed = append(malformed, raw)
+				return
+			}
+			check.Records++
+			if rw != nil {
+				rw.WriteString(raw + "\n")
+			}
+		})
+	}
+
+	if err != nil {
+		if !compressed {
+			// The rest of a plain file cannot be skipped safely (e.g. an overlong line)
+			check.problem("read stopped after %d records: %v (not repaired)", check.Records, err)
+			if rw != nil {
+				rw.Abort()
+			}
+			return check, nil
+		}
+		check.Truncated = true
+		check.problem("gzip stream damaged after %d records: %v", check.Records, err)
+	}
+
+	if rw == nil {
+		return check, nil
+	}
+	if check.Malformed == 0 && !check.Truncated {
+		rw.Abort()
+		return check, nil
+	}
+	if len(malformed) > 0 {
+		if check.Quarantine, err = writeQuarantine(path, m.quarantineDir(), stamp, malformed); err != nil {
+			rw.Abort()
+			return check, err
+		}
+	}
+	if err := rw.Commit(info.ModTime()); err != nil {
+		return check, err
+	}
+	check.Repaired = true
+	return check, nil
+}
+
+// scanCSVRows calls fn with each row of a CSV file and the number of physical lines it spans,
+// joining lines while a quoted field is open
+func scanCSVRows(r io.Reader, fn func(raw string, lines int)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		row, lines := scanner.Text(), 1
+		for strings.Count(row, `"`)%2 == 1 && lines < maxRecordLines && scanner.Scan() {
+			row += "\n" + scanner.Text()
+			lines++
+		}
+		if row == "" {
+			continue
+		}
+		fn(row, lines)
+	}
+	return scanner.Err()
+}
+
+// parseSidecarRow checks that a row of the system or events file parses
+func parseSidecarRow(kind, raw string) error {
+	fields, err := parseCSVLine(raw)
+	if err != nil {
+		return err
+	}
+	if kind == "system" {
+		_, err = parseSystemRecord(fields)
+	} else {
+		_, err = parseProcessEvent(fields)
+	}
+	return err
+}
+
+// writeQuarantine saves the malformed rows of a file to the quarantine directory
+func writeQuarantine(path, dir, stamp string, rows []string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, fmt.Sprintf("%s-%s.txt", filepath.Base(path), stamp))
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(file)
+	for _, row := range rows {
+		w.WriteString(row + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return "", err
+	}
+	return target, file.Close()
+}
+
+// moveToQuarantine moves a whole file to the quarantine directory
+func moveToQuarantine(path, dir, stamp string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, fmt.Sprintf("%s-%s", filepath.Base(path), stamp))
+	return target, os.Rename(path, target)
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestManager_CheckIntegrity tests that malformed lines and a truncated rotation are reported
+// per file, and that a repair quarantines the bad lines and keeps every readable record
+func TestManager_CheckIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestCSVManager(t, filepath.Join(dir, "process-tracker.log"))
+	defer m.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := m.SaveRecords(schemaTestRecords(start, 2, 5)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	m.SaveProcessEvents([]ProcessEvent{{Timestamp: start, Type: ProcessEventStarted, PID: 1000, Name: "worker-0"}})
+
+	// A garbled row in the middle and a row cut off by power loss at the end
+	f, _ := os.OpenFile(m.dataFile, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("\x00\x00\x00garbage\n")
+	f.WriteString(m.formatRecord(schemaTestRecords(start.Add(time.Minute), 1, 1)[0]))
+	f.WriteString("2026-01-01 00:00:00,partial")
+	f.Close()
+	events, _ := os.OpenFile(m.eventsDataFile(), os.O_WRONLY|os.O_APPEND, 0644)
+	events.WriteString("not,an,event\n")
+	events.Close()
+
+	// A rotation whose gzip stream ends early
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(csvHeaderLine()))
+	for _, record := range schemaTestRecords(start.Add(-time.Hour), 2, 50) {
+		gz.Write([]byte(m.formatRecord(record)))
+	}
+	gz.Close()
+	rotated := m.dataFile + ".1.gz"
+	os.WriteFile(rotated, buf.Bytes()[:buf.Len()*2/3], 0644)
+
+	report, err := m.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if report.OK || report.Repaired || len(report.Files) != 3 {
+		t.Fatalf("Expected problems in 3 files, got %+v", report)
+	}
+	files := make(map[string]FileCheck)
+	for _, f := range report.Files {
+		files[filepath.Base(f.Path)] = f
+	}
+	if data := files["process-tracker.log"]; data.Records != 11 || data.Malformed != 2 {
+		t.Errorf("Expected 11 records and 2 malformed lines in the data file, got %+v", data)
+	}
+	rotation := files["process-tracker.log.1.gz"]
+	if !rotation.Truncated || rotation.Records == 0 || rotation.Records >= 100 {
+		t.Errorf("Expected a truncated rotation with some records, got %+v", rotation)
+	}
+	if ev := files["process-tracker-events.log"]; ev.Records != 1 || ev.Malformed != 1 {
+		t.Errorf("Expected 1 event and 1 malformed line, got %+v", ev)
+	}
+
+	report, err = m.CheckIntegrity(true)
+	if err != nil || !report.Repaired {
+		t.Fatalf("Expected repair to succeed, got %+v (%v)", report, err)
+	}
+	for _, f := range report.Files {
+		if filepath.Base(f.Path) != "process-tracker.log" {
+			continue
+		}
+		content, err := os.ReadFile(f.Quarantine)
+		if err != nil || !strings.Contains(string(content), "garbage") || !strings.Contains(string(content), "partial") {
+			t.Errorf("Expected the malformed lines in quarantine, got %q (%v)", content, err)
+		}
+	}
+
+	report, err = m.CheckIntegrity(false)
+	if err != nil || !report.OK {
+		t.Fatalf("Expected a clean store after repair, got %+v (%v)", report, err)
+	}
+	var total int64
+	for _, f := range report.Files {
+		total += f.Records
+	}
+	if want := 11 + rotation.Records + 1; total != want {
+		t.Errorf("Expected %d records kept, got %d", want, total)
+	}
+
+	// Writing continues after the repair closed the data file
+	if err := m.SaveRecords(schemaTestRecords(time.Now(), 10, 1)); err != nil {
+		t.Fatalf("Failed to save after repair: %v", err)
+	}
+	if count, _ := m.GetRecordCount(); count < 21 {
+		t.Errorf("Expected the new records to be readable, got %d", count)
+	}
+}
+
+// TestSQLiteStorage_CheckIntegrity tests that a missing index is recreated in place
+func TestSQLiteStorage_CheckIntegrity(t *testing.T) {
+	storage := openTestSQLite(t, filepath.Join(t.TempDir(), "check.db"))
+	defer storage.Close()
+	if err := storage.SaveRecords(schemaTestRecords(time.Now().Add(-time.Hour), 5, 10)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+
+	report, err := storage.CheckIntegrity(false)
+	if err != nil || !report.OK || report.Files[0].Records != 50 {
+		t.Fatalf("Expected a clean database with 50 samples, got %+v (%v)", report, err)
+	}
+
+	var index string
+	storage.db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'samples' AND sql IS NOT NULL`).Scan(&index)
+	if _, err := storage.db.Exec("DROP INDEX " + index); err != nil {
+		t.Fatalf("Failed to drop index %q: %v", index, err)
+	}
+	if report, _ = storage.CheckIntegrity(false); report.OK {
+		t.Fatalf("Expected the missing index %s to be reported", index)
+	}
+	if report, err = storage.CheckIntegrity(true); err != nil || !report.Repaired || report.Files[0].Quarantine != "" {
+		t.Fatalf("Expected the index to be recreated in place, got %+v (%v)", report, err)
+	}
+	if report, _ = storage.CheckIntegrity(false); !report.OK {
+		t.Errorf("Expected a clean database after repair, got %+v", report)
+	}
+}
+
+// TestSQLiteStorage_Salvage tests that a damaged table page is salvaged into a new database,
+// losing only the rows on that page, and that the damaged file is kept
+func TestSQLiteStorage_Salvage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "damaged.db")
+	storage := openTestSQLite(t, path)
+	if err := storage.SaveRecords(schemaTestRecords(time.Now().Add(-time.Hour), 10, 300)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	storage.Close()
+
+	// Overwrite a table leaf page that holds only samples
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageSize := int(binary.BigEndian.Uint16(content[16:18]))
+	var leaves []int
+	for offset := pageSize; offset+pageSize <= len(content); offset += pageSize {
+		page := content[offset : offset+pageSize]
+		if page[0] == 0x0d && !bytes.Contains(page, []byte("worker")) && !bytes.Contains(page, []byte("schema")) {
+			leaves = append(leaves, offset)
+		}
+	}
+	if len(leaves) < 3 {
+		t.Fatalf("Expected several sample pages, found %d", len(leaves))
+	}
+	damaged := leaves[len(leaves)/2]
+	copy(content[damaged:damaged+pageSize], bytes.Repeat([]byte{0xff}, pageSize))
+	os.WriteFile(path, content, 0644)
+
+	config := GetDefaultStorageConfig()
+	config.Type = "sqlite"
+	config.SQLitePath = path
+	checker := NewSQLiteStorage(path, 100, config)
+	report, err := checker.CheckIntegrity(false)
+	if err != nil || report.OK {
+		t.Fatalf("Expected the damaged page to be reported, got %+v (%v)", report, err)
+	}
+
+	report, err = checker.CheckIntegrity(true)
+	if err != nil || !report.Repaired {
+		t.Fatalf("Expected salvage to succeed, got %+v (%v)", report, err)
+	}
+	result := report.Files[0]
+	if result.Malformed == 0 || result.Records == 0 || result.Records+result.Malformed != 3000 {
+		t.Errorf("Expected only the rows of one page lost, got %d copied and %d lost", result.Records, result.Malformed)
+	}
+	if result.Tables["processes"] != 10 {
+		t.Errorf("Expected all processes salvaged, got %d", result.Tables["processes"])
+	}
+	if _, err := os.Stat(result.Quarantine); err != nil {
+		t.Errorf("Expected the damaged database kept at %s: %v", result.Quarantine, err)
+	}
+
+	rebuilt := openTestSQLite(t, path)
+	defer rebuilt.Close()
+	if count, _ := rebuilt.GetRecordCount(); int64(count) != result.Records {
+		t.Errorf("Expected %d samples in the rebuilt database, got %d", result.Records, count)
+	}
+	if report, _ = rebuilt.CheckIntegrity(false); !report.OK {
+		t.Errorf("Expected the rebuilt database to be clean, got %+v", report)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"time"
 )
 
@@ -25,12 +26,27 @@ type Storage interface {
 	// ReadRecordsByTimeRange 按时间范围读取记录
 	ReadRecordsByTimeRange(start, end time.Time) ([]ResourceRecord, error)
 
+	// Query 按条件查询资源记录，返回迭代器（调用方负责Close）
+	Query(ctx context.Context, q RecordQuery) (RecordIterator, error)
+
 	// GetRecordCount 获取记录总数
 	GetRecordCount() (int, error)
 
 	// CalculateStats 计算资源统计信息
 	CalculateStats(records []ResourceRecord) []ResourceStats
 
+	// SaveSystemRecord 保存一条主机级指标记录
+	SaveSystemRecord(record SystemRecord) error
+
+	// ReadSystemRecordsByTimeRange 按时间范围读取主机级指标记录
+	ReadSystemRecordsByTimeRange(start, end time.Time) ([]SystemRecord, error)
+
+	// SaveProcessEvents 保存进程生命周期事件
+	SaveProcessEvents(events []ProcessEvent) error
+
+	// ReadProcessEventsByTimeRange 按时间范围读取进程生命周期事件
+	ReadProcessEventsByTimeRange(start, end time.Time) ([]ProcessEvent, error)
+
 	// CleanOldData 清理旧数据
 	CleanOldData(keepDays int) error
 
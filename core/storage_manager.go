@@ -22,12 +22,14 @@ type FileInfo struct {
 // StorageManager handles file rotation, compression, and cleanup
 // Uses simplified configuration with smart defaults
 type StorageManager struct {
-	basePath     string
-	baseName     string
-	config       StorageConfig
-	currentFile  *os.File
-	currentSize  int64
-	currentIndex int
+	basePath      string
+	baseName      string
+	config        StorageConfig
+	currentFile   *os.File
+	currentSize   int64
+	currentIndex  int
+	header        string // Written before the first record of each opened file
+	headerPending bool
 }
 
 // NewStorageManager creates a new storage manager instance
@@ -42,6 +44,12 @@ func NewStorageManager(basePath string, config StorageConfig) *StorageManager {
 	}
 }
 
+// SetHeader sets a line written before the first record of every file this manager opens
+func (sm *StorageManager) SetHeader(header string) {
+	sm.header = header
+	sm.headerPending = header != "" && sm.currentFile != nil
+}
+
 // getMaxFileSizeMB returns the maximum file size for rotation (derived from total size)
 func (sm *StorageManager) getMaxFileSizeMB() int {
 	// Use 1/5 of total size for each file, allowing for 5 rotation files
@@ -60,11 +68,17 @@ func (sm *StorageManager) shouldCompress(modTime time.Time) bool {
 }
 
 // shouldCleanup returns whether a file should be deleted based on age and config
+// Whole files expire after the longest retention so rows kept by retention rules survive;
+// shorter retention is applied row by row (see Manager.ApplyRetention)
 func (sm *StorageManager) shouldCleanup(modTime time.Time) bool {
-	if sm.config.KeepDays == 0 {
+	keep := time.Duration(sm.config.KeepDays) * 24 * time.Hour
+	if policy, err := NewRetentionPolicy(sm.config.KeepDays, sm.config.Retention); err == nil {
+		keep = policy.Longest()
+	}
+	if keep == 0 {
 		return false // 0 means keep forever
 	}
-	return time.Since(modTime) > time.Duration(sm.config.KeepDays)*24*time.Hour
+	return time.Since(modTime) > keep
 }
 
 // Initialize sets up the storage manager and checks existing files
@@ -108,6 +122,15 @@ func (sm *StorageManager) WriteRecord(record string) error {
 		}
 	}
 
+	if sm.headerPending {
+		n, err := sm.currentFile.WriteString(sm.header + "\n")
+		if err != nil {
+			return err
+		}
+		sm.currentSize += int64(n)
+		sm.headerPending = false
+	}
+
 	n, err := sm.currentFile.WriteString(record + "\n")
 	if err != nil {
 		return err
@@ -194,6 +217,7 @@ func (sm *StorageManager) openCurrentFile() error {
 		file, err := os.OpenFile(sm.basePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err == nil {
 			sm.currentFile = file
+			sm.headerPending = sm.header != ""
 			// Get current size
 			if info, err := file.Stat(); err == nil {
 				sm.currentSize = info.Size()
@@ -211,6 +235,7 @@ func (sm *StorageManager) openCurrentFile() error {
 	}
 
 	sm.currentFile = file
+	sm.headerPending = sm.header != ""
 	sm.currentSize = 0 // Start fresh for new indexed files
 	return nil
 }
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// schemaMigration 一个有序的结构迁移步骤
+// 每个迁移在独立事务中执行，成功后 storage_meta 中的 schema_version 更新为其版本号。
+// 新增列或表时在列表末尾追加迁移，不要修改已发布的迁移。
+type schemaMigration struct {
+	Version        int
+	Name           string
+	Destructive    bool // 会删除或重写已有数据，执行前先备份数据库
+	RebuildsParent bool // 重建被外键引用的表，执行期间关闭外键约束并在提交前检查
+	Up             func(tx *sql.Tx) error
+}
+
+// schemaMigrations 按版本号排列的全部迁移
+// 1-4 是引入版本号之前的结构，均可在已有的旧数据库上重复执行
+var schemaMigrations = []schemaMigration{
+	{Version: 1, Name: "create base tables", Up: createBaseTables},
+	{Version: 2, Name: "add labels, uid and username to legacy records", Up: addLegacyRecordColumns},
+	{Version: 3, Name: "split records into processes and samples", Destructive: true, Up: normalizeRecords},
+	{Version: 4, Name: "create indexes", Up: createIndexes},
+	{Version: 5, Name: "create task tables", Up: createTaskTables},
+	{Version: 6, Name: "create task sample table", Up: createTaskSampleTable},
+	{Version: 7, Name: "create command search index", Up: createSearchIndex},
+	{Version: 8, Name: "add host to processes and rollups", Destructive: true, RebuildsParent: true, Up: addRecordHost},
+	{Version: 9, Name: "make samples unique per process and timestamp", Destructive: true, Up: uniqueSamples},
+}
+
+// LatestSchemaVersion 当前程序支持的最新结构版本
+func LatestSchemaVersion() int {
+	return schemaMigrations[len(schemaMigrations)-1].Version
+}
+
+// SchemaMigrationStatus 单个迁移的状态
+type SchemaMigrationStatus struct {
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Destructive bool      `json:"destructive"`
+	Applied     bool      `json:"applied"`
+	AppliedAt   time.Time `json:"applied_at,omitempty"`
+}
+
+// SchemaStatus 数据库结构版本状态
+type SchemaStatus struct {
+	Path           string                  `json:"path"`
+	Exists         bool                    `json:"exists"`
+	CurrentVersion int                     `json:"current_version"`
+	LatestVersion  int                     `json:"latest_version"`
+	LastBackup     string                  `json:"last_backup,omitempty"`
+	Migrations     []SchemaMigrationStatus `json:"migrations"`
+}
+
+// Pending 返回未应用的迁移数量
+func (st SchemaStatus) Pending() int {
+	pending := 0
+	for _, m := range st.Migrations {
+		if !m.Applied {
+			pending++
+		}
+	}
+	return pending
+}
+
+// migrate 按顺序执行未应用的迁移
+func (s *SQLiteStorage) migrate() error {
+	if err := s.createMetaTable(); err != nil {
+		return err
+	}
+
+	current, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// 只有已有数据的数据库才需要在破坏性迁移前备份
+	hasData, err := s.hasDataTables()
+	if err != nil {
+		return err
+	}
+
+	backedUp := false
+	for _, m := range schemaMigrations {
+		if m.Version <= current {
+			continue
+		}
+
+		if m.Destructive && hasData && !backedUp {
+			if _, err := s.backupBeforeMigration(current); err != nil {
+				return err
+			}
+			backedUp = true
+		}
+
+		if err := s.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied schema migration %d: %s", m.Version, m.Name)
+
+		// 破坏性迁移后回收空间
+		if m.Destructive && hasData {
+			if _, err := s.db.Exec("VACUUM"); err != nil {
+				log.Printf("Warning: failed to vacuum database: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyMigration 在一个事务中执行迁移并记录版本号
+func (s *SQLiteStorage) applyMigration(m schemaMigration) error {
+	// foreign_keys 只对当前连接有效，且不能在事务中修改
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	if m.RebuildsParent {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return fmt.Errorf("failed to disable foreign keys: %w", err)
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if m.RebuildsParent {
+		var violations int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&violations); err != nil {
+			return fmt.Errorf("failed to check foreign keys: %w", err)
+		}
+		if violations > 0 {
+			return fmt.Errorf("rebuilt tables leave %d rows without their referenced row", violations)
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO storage_meta (key, value, updated_at) VALUES ('schema_version', ?, CURRENT_TIMESTAMP)",
+		strconv.Itoa(m.Version),
+	); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO storage_meta (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+		migrationMetaKey(m.Version), now,
+	); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// backupBeforeMigration 将数据库完整复制到同目录下的备份文件
+func (s *SQLiteStorage) backupBeforeMigration(version int) (string, error) {
+	path := fmt.Sprintf("%s.v%d-%s.bak", s.sqlitePath, version, time.Now().Format("20060102-150405"))
+	if _, err := s.db.Exec("VACUUM INTO ?", path); err != nil {
+		return "", fmt.Errorf("failed to back up database before migration: %w", err)
+	}
+	if _, err := s.db.Exec(
+		"INSERT OR REPLACE INTO storage_meta (key, value, updated_at) VALUES ('schema_backup', ?, CURRENT_TIMESTAMP)", path,
+	); err != nil {
+		log.Printf("Warning: failed to record backup path: %v", err)
+	}
+	log.Printf("Backed up database to %s before schema migration", path)
+	return path, nil
+}
+
+// schemaVersion 读取当前结构版本，未记录时为0
+func (s *SQLiteStorage) schemaVersion() (int, error) {
+	value, err := s.metaValue("schema_version")
+	if err != nil || value == "" {
+		return 0, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+	return version, nil
+}
+
+// metaValue 读取元数据，不存在时返回空字符串
+func (s *SQLiteStorage) metaValue(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM storage_meta WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// hasDataTables 判断数据库中是否已有元数据表以外的表
+func (s *SQLiteStorage) hasDataTables() (bool, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name NOT IN ('storage_meta', 'sqlite_sequence')`).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	return count > 0, nil
+}
+
+func migrationMetaKey(version int) string {
+	return fmt.Sprintf("schema_migration_%03d", version)
+}
+
+// SchemaStatus 报告数据库结构版本和各迁移的应用情况，不执行迁移
+func (s *SQLiteStorage) SchemaStatus() (SchemaStatus, error) {
+	status := SchemaStatus{
+		Path:          expandSQLitePath(s.sqlitePath),
+		LatestVersion: LatestSchemaVersion(),
+	}
+	for _, m := range schemaMigrations {
+		status.Migrations = append(status.Migrations, SchemaMigrationStatus{
+			Version:     m.Version,
+			Name:        m.Name,
+			Destructive: m.Destructive,
+		})
+	}
+
+	if s.db == nil {
+		// 数据库文件不存在时不创建
+		if _, err := os.Stat(status.Path); os.IsNotExist(err) {
+			return status, nil
+		}
+		if err := s.open(); err != nil {
+			return status, err
+		}
+		// 只读查看，之后的 Initialize 仍需执行迁移
+		defer s.closeDB()
+	}
+	status.Exists = true
+
+	var metaTables int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'storage_meta'").Scan(&metaTables); err != nil {
+		return status, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if metaTables == 0 {
+		return status, nil
+	}
+
+	current, err := s.schemaVersion()
+	if err != nil {
+		return status, err
+	}
+	status.CurrentVersion = current
+	if status.LastBackup, err = s.metaValue("schema_backup"); err != nil {
+		return status, err
+	}
+
+	for i := range status.Migrations {
+		m := &status.Migrations[i]
+		m.Applied = m.Version <= current
+		if value, _ := s.metaValue(migrationMetaKey(m.Version)); value != "" {
+			m.AppliedAt, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,326 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pruneBatchSize 每批删除的最旧采样数（每批一个事务，避免长时间持有写锁）
+const pruneBatchSize = 5000
+
+// SizeLimitedStorage 支持按数据库大小清理的存储
+type SizeLimitedStorage interface {
+	// EnforceSizeLimit 从最旧的数据开始分批清理，直到占用空间不超过 maxBytes
+	EnforceSizeLimit(maxBytes int64) (PruneResult, error)
+}
+
+// PruneResult 一次按大小清理的结果
+type PruneResult struct {
+	SizeBefore     int64     // 清理前占用的字节数（不含空闲页）
+	SizeAfter      int64     // 清理后占用的字节数
+	DeletedSamples int64     // 删除的采样数
+	Batches        int       // 执行的批次数
+	Oldest         time.Time // 清理后最早的采样时间
+}
+
+// usedBytes 返回数据库实际占用的字节数（总页数减去空闲页）
+func (s *SQLiteStorage) usedBytes() (int64, error) {
+	var pageCount, freePages, pageSize int64
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to read page_count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return 0, fmt.Errorf("failed to read freelist_count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page_size: %w", err)
+	}
+	return (pageCount - freePages) * pageSize, nil
+}
+
+// EnforceSizeLimit 从最旧的原始采样开始分批删除，直到数据库不超过 maxBytes
+// 主机指标和进程事件随最旧采样一并清理；汇总表不受影响。每批之后增量回收空闲页。
+func (s *SQLiteStorage) EnforceSizeLimit(maxBytes int64) (PruneResult, error) {
+	var result PruneResult
+	if maxBytes <= 0 {
+		return result, nil
+	}
+
+	used, err := s.usedBytes()
+	if err != nil {
+		return result, err
+	}
+	result.SizeBefore, result.SizeAfter = used, used
+	if used <= maxBytes {
+		return result, nil
+	}
+
+	log.Printf("Database uses %.1f MB, over the %.1f MB budget; pruning oldest samples",
+		float64(used)/1024/1024, float64(maxBytes)/1024/1024)
+
+	for used > maxBytes {
+		deleted, oldest, err := s.pruneOldestBatch()
+		if err != nil {
+			return result, err
+		}
+		if deleted == 0 {
+			log.Printf("Warning: no samples left to prune; database still uses %.1f MB (rollups and metadata)",
+				float64(used)/1024/1024)
+			break
+		}
+		result.DeletedSamples += deleted
+		result.Batches++
+		result.Oldest = oldest
+
+		if err := s.incrementalVacuum(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		if used, err = s.usedBytes(); err != nil {
+			return result, err
+		}
+		result.SizeAfter = used
+
+		log.Printf("Pruned %d samples (batch %d), oldest sample now %s, database %.1f MB",
+			result.DeletedSamples, result.Batches, oldest.Format("2006-01-02 15:04:05"), float64(used)/1024/1024)
+	}
+
+	if err := s.deleteOrphanProcesses(); err != nil {
+		return result, err
+	}
+	if err := s.incrementalVacuum(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if used, err := s.usedBytes(); err == nil {
+		result.SizeAfter = used
+	}
+	return result, nil
+}
+
+// pruneOldestBatch 删除一批最旧的采样以及更早的主机指标和进程事件
+// 返回删除的采样数和剩余最早的采样时间
+func (s *SQLiteStorage) pruneOldestBatch() (int64, time.Time, error) {
+	var oldest time.Time
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, oldest, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		DELETE FROM samples WHERE id IN (
+			SELECT id FROM samples ORDER BY timestamp, id LIMIT ?
+		)`, pruneBatchSize)
+	if err != nil {
+		return 0, oldest, fmt.Errorf("failed to prune samples: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+
+	// 剩余最早的采样时间作为其他表的清理边界；采样已全部删除时清理到当前
+	err = tx.QueryRow("SELECT timestamp FROM samples ORDER BY timestamp LIMIT 1").Scan(&oldest)
+	if err != nil {
+		oldest = time.Now()
+	}
+	if _, err := tx.Exec("DELETE FROM system_records WHERE timestamp < ?", oldest); err != nil {
+		return 0, oldest, fmt.Errorf("failed to prune system records: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM process_events WHERE timestamp < ?", oldest); err != nil {
+		return 0, oldest, fmt.Errorf("failed to prune process events: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, oldest, fmt.Errorf("failed to commit prune: %w", err)
+	}
+	return deleted, oldest, nil
+}
+
+// ApplyRetention 按保留规则删除过期的原始采样（dryRun 时只统计），主机指标和进程事件按 keep_days 清理
+// 规则在 Go 中逐个进程匹配（与 CSV 后端相同），匹配结果写入临时表，再按规则的截止时间删除
+// 与 EnforceSizeLimit 一样分批删除，每批单独提交，清理大量历史时不会长时间阻塞写入
+func (s *SQLiteStorage) ApplyRetention(policy *RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error) {
+	report := policy.newReport(now, dryRun)
+	ctx := context.Background()
+
+	// 临时表只对当前连接可见，整个过程使用同一个连接
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return report, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := s.planRetention(tx, policy); err != nil {
+		tx.Rollback()
+		return report, err
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed to commit retention plan: %w", err)
+	}
+	defer conn.ExecContext(ctx, "DROP TABLE IF EXISTS retention_plan")
+
+	for i := range report.Rules {
+		cutoff := policy.Cutoff(i, now)
+		if cutoff.IsZero() {
+			continue
+		}
+		// 活跃和不活跃的采样可能匹配不同的规则
+		where := `timestamp < ? AND (
+			(is_active AND process_id IN (SELECT process_id FROM retention_plan WHERE active_rule = ?)) OR
+			(NOT is_active AND process_id IN (SELECT process_id FROM retention_plan WHERE inactive_rule = ?)))`
+		var n int64
+		if dryRun {
+			err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM samples WHERE "+where, cutoff, i, i).Scan(&n)
+		} else {
+			n, err = deleteInBatches(ctx, conn, "samples", where, cutoff, i, i)
+		}
+		report.add(i, n)
+		if err != nil {
+			return report, fmt.Errorf("failed to apply retention rule %q: %w", report.Rules[i].Rule, err)
+		}
+	}
+
+	// 主机指标和进程事件不属于某个进程，按 keep_days 清理
+	if cutoff := policy.DefaultCutoff(now); !cutoff.IsZero() {
+		for _, t := range []struct {
+			table string
+			count *int64
+		}{{"system_records", &report.SystemRecords}, {"process_events", &report.ProcessEvents}} {
+			if dryRun {
+				err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+t.table+" WHERE timestamp < ?", cutoff).Scan(t.count)
+			} else {
+				*t.count, err = deleteInBatches(ctx, conn, t.table, "timestamp < ?", cutoff)
+			}
+			if err != nil {
+				return report, fmt.Errorf("failed to prune %s: %w", t.table, err)
+			}
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	if report.Samples > 0 {
+		log.Printf("Retention removed %d samples, %d system records and %d process events",
+			report.Samples, report.SystemRecords, report.ProcessEvents)
+		if err := s.deleteOrphanProcesses(); err != nil {
+			return report, err
+		}
+	}
+	// 回收空闲页（增量进行，不阻塞写入）
+	if err := s.incrementalVacuum(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return report, nil
+}
+
+// deleteInBatches 分批删除 table 中满足 where 的行，每批最多 pruneBatchSize 行、单独提交
+// 返回删除的总行数；出错时已提交的批次保留
+func deleteInBatches(ctx context.Context, conn *sql.Conn, table, where string, args ...interface{}) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE %s LIMIT %d)",
+		table, table, where, pruneBatchSize)
+	var total int64
+	for {
+		res, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// planRetention 为每个进程记录活跃和不活跃采样分别匹配的规则序号
+func (s *SQLiteStorage) planRetention(tx *sql.Tx, policy *RetentionPolicy) error {
+	if _, err := tx.Exec(`CREATE TEMP TABLE IF NOT EXISTS retention_plan (
+		process_id INTEGER PRIMARY KEY,
+		active_rule INTEGER NOT NULL,
+		inactive_rule INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create retention plan: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM retention_plan"); err != nil {
+		return fmt.Errorf("failed to reset retention plan: %w", err)
+	}
+
+	type process struct {
+		id             int64
+		name, category string
+	}
+	rows, err := tx.Query("SELECT id, name, COALESCE(category, '') FROM processes")
+	if err != nil {
+		return fmt.Errorf("failed to read processes: %w", err)
+	}
+	var processes []process
+	for rows.Next() {
+		var p process
+		if err := rows.Scan(&p.id, &p.name, &p.category); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan process: %w", err)
+		}
+		processes = append(processes, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read processes: %w", err)
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO retention_plan (process_id, active_rule, inactive_rule) VALUES (?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare retention plan: %w", err)
+	}
+	defer stmt.Close()
+	for _, p := range processes {
+		active := policy.Match(p.name, p.category, true)
+		inactive := policy.Match(p.name, p.category, false)
+		if _, err := stmt.Exec(p.id, active, inactive); err != nil {
+			return fmt.Errorf("failed to write retention plan: %w", err)
+		}
+	}
+	return nil
+}
+
+// incrementalVacuum 将空闲页归还给文件系统（需要 auto_vacuum=INCREMENTAL）
+func (s *SQLiteStorage) incrementalVacuum() error {
+	if _, err := s.db.Exec("PRAGMA incremental_vacuum"); err != nil {
+		return fmt.Errorf("failed to run incremental vacuum: %w", err)
+	}
+	return nil
+}
+
+// ensureIncrementalVacuum 确保数据库使用增量回收模式
+// 新数据库在建表前已设置；旧数据库需要执行一次完整 VACUUM 才能切换
+func (s *SQLiteStorage) ensureIncrementalVacuum() error {
+	var mode int
+	if err := s.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return fmt.Errorf("failed to read auto_vacuum: %w", err)
+	}
+	if mode == 2 {
+		return nil
+	}
+
+	// PRAGMA 只对当前连接生效，需与 VACUUM 使用同一连接
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	log.Printf("Switching database to incremental auto-vacuum (one-time full VACUUM)")
+	if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return fmt.Errorf("failed to set auto_vacuum: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RollupTier 汇总层级
+type RollupTier struct {
+	Name       string        // 层级名称: "1m", "1h", "1d"
+	Table      string        // 汇总表名
+	Resolution time.Duration // 时间桶大小
+}
+
+// RollupTiers 按精度从细到粗排列的汇总层级；每一层由上一层（第一层由原始记录）汇总而来
+var RollupTiers = []RollupTier{
+	{Name: "1m", Table: "rollup_1m", Resolution: time.Minute},
+	{Name: "1h", Table: "rollup_1h", Resolution: time.Hour},
+	{Name: "1d", Table: "rollup_1d", Resolution: 24 * time.Hour},
+}
+
+// KeepDays 返回层级的保留天数，0表示永久保留
+func (c RollupConfig) KeepDays(tier RollupTier) int {
+	switch tier.Name {
+	case "1m":
+		return c.MinuteKeepDays
+	case "1h":
+		return c.HourKeepDays
+	case "1d":
+		return c.DayKeepDays
+	}
+	return 0
+}
+
+// RollupPoint 一个进程在一个时间桶内的汇总数据
+// 按进程合计读取时PID为0、Name为空，平均值为所有样本的平均
+type RollupPoint struct {
+	Bucket           time.Time `json:"bucket"` // 时间桶起点（1天层级按UTC日期对齐）
+	Host             string    `json:"host,omitempty"`
+	PID              int32     `json:"pid"`
+	Name             string    `json:"name"`
+	Category         string    `json:"category"`
+	Username         string    `json:"username"`
+	Samples          int       `json:"samples"`
+	ActiveSamples    int       `json:"active_samples"`
+	CPUAvg           float64   `json:"cpu_avg"`
+	CPUMax           float64   `json:"cpu_max"`
+	CPUMin           float64   `json:"cpu_min"`
+	CPUNormalizedAvg float64   `json:"cpu_normalized_avg"`
+	CPUNormalizedMax float64   `json:"cpu_normalized_max"`
+	CPUNormalizedMin float64   `json:"cpu_normalized_min"`
+	MemoryAvgMB      float64   `json:"memory_avg_mb"`
+	MemoryMaxMB      float64   `json:"memory_max_mb"`
+	MemoryMinMB      float64   `json:"memory_min_mb"`
+	DiskReadMB       float64   `json:"disk_read_mb"`  // 桶内最大的累计读取量
+	DiskWriteMB      float64   `json:"disk_write_mb"` // 桶内最大的累计写入量
+	NetSentKB        float64   `json:"net_sent_kb"`
+	NetRecvKB        float64   `json:"net_recv_kb"`
+}
+
+// RollupStorage 由支持分级汇总的存储实现
+type RollupStorage interface {
+	// Rollup 把已结束的时间桶汇总到各层级，并按各层级保留期限清理
+	Rollup(now time.Time) error
+
+	// ReadRollups 读取某层级中时间桶起点在[start, end)内的汇总数据
+	// perProcess为false时每个时间桶只返回一条所有进程的合计；host非空时只读取该主机的数据
+	ReadRollups(ctx context.Context, tier RollupTier, start, end time.Time, perProcess bool, host string) ([]RollupPoint, error)
+
+	// RollupWatermark 返回层级已汇总到的时间，之后的数据只存在于更细的层级或原始记录中
+	RollupWatermark(tier RollupTier) time.Time
+}
+
+// rollupGrace 原始记录在时间桶结束后等待写入的时间
+const rollupGrace = 30 * time.Second
+
+// rollupChunkBuckets 每个事务最多汇总的时间桶数，避免首次回填时事务过大
+const rollupChunkBuckets = 1440
+
+// createRollupTableSQL 返回汇总表的建表语句
+// 迁移8之前的表没有 host 列，主键为 (bucket, pid, name)；之后按主机区分
+func createRollupTableSQL(table string, withHost bool) string {
+	host, key := "", "bucket, pid, name"
+	if withHost {
+		host, key = "\n\t\thost TEXT NOT NULL DEFAULT '',", "bucket, host, pid, name"
+	}
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		bucket INTEGER NOT NULL,%s
+		pid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		category TEXT,
+		username TEXT,
+		samples INTEGER NOT NULL,
+		active_samples INTEGER NOT NULL,
+		cpu_sum REAL NOT NULL,
+		cpu_max REAL NOT NULL,
+		cpu_min REAL NOT NULL,
+		cpu_normalized_sum REAL NOT NULL,
+		cpu_normalized_max REAL NOT NULL,
+		cpu_normalized_min REAL NOT NULL,
+		memory_sum REAL NOT NULL,
+		memory_max REAL NOT NULL,
+		memory_min REAL NOT NULL,
+		disk_read_mb REAL NOT NULL,
+		disk_write_mb REAL NOT NULL,
+		net_sent_kb REAL NOT NULL,
+		net_recv_kb REAL NOT NULL,
+		PRIMARY KEY (%s)
+	);`, table, host, key)
+}
+
+// createRollupTables 创建各层级汇总表（迁移1）
+func createRollupTables(tx *sql.Tx) error {
+	for _, tier := range RollupTiers {
+		createSQL := createRollupTableSQL(tier.Table, false)
+
+		if _, err := tx.Exec(createSQL); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", tier.Table, err)
+		}
+	}
+	return nil
+}
+
+// Rollup 汇总已结束的时间桶并清理过期的汇总数据
+func (s *SQLiteStorage) Rollup(now time.Time) error {
+	for i, tier := range RollupTiers {
+		// 只汇总已结束、且来源层级已完整汇总的时间桶
+		cutoff := now.Add(-rollupGrace).Truncate(tier.Resolution)
+		if i > 0 {
+			if sourceMark := s.RollupWatermark(RollupTiers[i-1]); sourceMark.Before(cutoff) {
+				cutoff = sourceMark.Truncate(tier.Resolution)
+			}
+		}
+
+		from := s.RollupWatermark(tier)
+		if from.IsZero() {
+			earliest, ok, err := s.earliestRollupSource(i)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			from = earliest.Truncate(tier.Resolution)
+		}
+
+		chunk := tier.Resolution * rollupChunkBuckets
+		for start := from; start.Before(cutoff); start = start.Add(chunk) {
+			end := start.Add(chunk)
+			if end.After(cutoff) {
+				end = cutoff
+			}
+			if err := s.rollupRange(i, start, end); err != nil {
+				return fmt.Errorf("failed to roll up %s: %w", tier.Name, err)
+			}
+		}
+	}
+
+	// 清理过期汇总，但不删除下一层级尚未汇总的数据
+	for i, tier := range RollupTiers {
+		keepDays := s.config.Rollups.KeepDays(tier)
+		if keepDays <= 0 {
+			continue
+		}
+		expired := now.AddDate(0, 0, -keepDays)
+		if i+1 < len(RollupTiers) {
+			if nextMark := s.RollupWatermark(RollupTiers[i+1]); nextMark.Before(expired) {
+				expired = nextMark
+			}
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE bucket < ?", tier.Table), expired.Unix()); err != nil {
+			return fmt.Errorf("failed to delete expired %s rollups: %w", tier.Name, err)
+		}
+	}
+	return nil
+}
+
+// earliestRollupSource 返回层级来源数据中最早的时间
+func (s *SQLiteStorage) earliestRollupSource(tierIndex int) (time.Time, bool, error) {
+	if tierIndex == 0 {
+		var earliest time.Time
+		err := s.db.QueryRow("SELECT timestamp FROM resource_records ORDER BY timestamp LIMIT 1").Scan(&earliest)
+		if err == sql.ErrNoRows {
+			return time.Time{}, false, nil
+		}
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to find earliest record: %w", err)
+		}
+		return earliest, true, nil
+	}
+
+	var earliest sql.NullInt64
+	source := RollupTiers[tierIndex-1]
+	if err := s.db.QueryRow(fmt.Sprintf("SELECT MIN(bucket) FROM %s", source.Table)).Scan(&earliest); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to find earliest %s rollup: %w", source.Name, err)
+	}
+	return time.Unix(earliest.Int64, 0), earliest.Valid, nil
+}
+
+// rollupRange 在一个事务中汇总[start, end)并推进水位
+func (s *SQLiteStorage) rollupRange(tierIndex int, start, end time.Time) error {
+	tier := RollupTiers[tierIndex]
+	seconds := int64(tier.Resolution / time.Second)
+
+	var selectSQL string
+	var args []interface{}
+	if tierIndex == 0 {
+		// 由原始记录汇总（IO为累计计数，取桶内最大值）
+		selectSQL = fmt.Sprintf(`
+		SELECT (CAST(strftime('%%s', timestamp) AS INTEGER) / %[1]d) * %[1]d AS b, host, pid, name,
+			MAX(category), MAX(username), COUNT(*), SUM(is_active),
+			SUM(cpu_percent), MAX(cpu_percent), MIN(cpu_percent),
+			SUM(cpu_percent_normalized), MAX(cpu_percent_normalized), MIN(cpu_percent_normalized),
+			SUM(memory_mb), MAX(memory_mb), MIN(memory_mb),
+			MAX(disk_read_mb), MAX(disk_write_mb), MAX(net_sent_kb), MAX(net_recv_kb)
+		FROM resource_records
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY b, host, pid, name`, seconds)
+		args = []interface{}{start, end}
+	} else {
+		// 由更细的层级汇总
+		selectSQL = fmt.Sprintf(`
+		SELECT (bucket / %[1]d) * %[1]d AS b, host, pid, name,
+			MAX(category), MAX(username), SUM(samples), SUM(active_samples),
+			SUM(cpu_sum), MAX(cpu_max), MIN(cpu_min),
+			SUM(cpu_normalized_sum), MAX(cpu_normalized_max), MIN(cpu_normalized_min),
+			SUM(memory_sum), MAX(memory_max), MIN(memory_min),
+			MAX(disk_read_mb), MAX(disk_write_mb), MAX(net_sent_kb), MAX(net_recv_kb)
+		FROM %[2]s
+		WHERE bucket >= ? AND bucket < ?
+		GROUP BY b, host, pid, name`, seconds, RollupTiers[tierIndex-1].Table)
+		args = []interface{}{start.Unix(), end.Unix()}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertSQL := fmt.Sprintf(`
+	INSERT OR REPLACE INTO %s (
+		bucket, host, pid, name, category, username, samples, active_samples,
+		cpu_sum, cpu_max, cpu_min, cpu_normalized_sum, cpu_normalized_max, cpu_normalized_min,
+		memory_sum, memory_max, memory_min, disk_read_mb, disk_write_mb, net_sent_kb, net_recv_kb
+	)`, tier.Table) + selectSQL
+
+	if _, err := tx.Exec(insertSQL, args...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO storage_meta (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+		rollupWatermarkKey(tier), strconv.FormatInt(end.Unix(), 10)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func rollupWatermarkKey(tier RollupTier) string {
+	return "rollup_watermark_" + tier.Name
+}
+
+// RollupWatermark 返回层级已汇总到的时间，尚未汇总时返回零值
+func (s *SQLiteStorage) RollupWatermark(tier RollupTier) time.Time {
+	var value string
+	if err := s.db.QueryRow("SELECT value FROM storage_meta WHERE key = ?", rollupWatermarkKey(tier)).Scan(&value); err != nil {
+		return time.Time{}
+	}
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
+
+// ReadRollups 读取某层级的汇总数据
+func (s *SQLiteStorage) ReadRollups(ctx context.Context, tier RollupTier, start, end time.Time, perProcess bool, host string) ([]RollupPoint, error) {
+	columns := `bucket, host, pid, name, category, username, samples, active_samples,
+		cpu_sum, cpu_max, cpu_min, cpu_normalized_sum, cpu_normalized_max, cpu_normalized_min,
+		memory_sum, memory_max, memory_min, disk_read_mb, disk_write_mb, net_sent_kb, net_recv_kb`
+	groupBy := ""
+	if !perProcess {
+		columns = `bucket, '', 0, '', '', '', SUM(samples), SUM(active_samples),
+		SUM(cpu_sum), MAX(cpu_max), MIN(cpu_min), SUM(cpu_normalized_sum), MAX(cpu_normalized_max), MIN(cpu_normalized_min),
+		SUM(memory_sum), MAX(memory_max), MIN(memory_min), SUM(disk_read_mb), SUM(disk_write_mb), SUM(net_sent_kb), SUM(net_recv_kb)`
+		groupBy = " GROUP BY bucket"
+	}
+
+	where := "bucket >= ? AND bucket < ?"
+	args := []interface{}{start.Unix(), end.Unix()}
+	if host != "" {
+		where += " AND host = ?"
+		args = append(args, host)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s%s ORDER BY bucket", columns, tier.Table, where, groupBy)
+	if perProcess {
+		query += ", host, pid"
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s rollups: %w", tier.Name, err)
+	}
+	defer rows.Close()
+
+	var points []RollupPoint
+	for rows.Next() {
+		var (
+			p                                RollupPoint
+			bucket                           int64
+			category, username               sql.NullString
+			cpuSum, cpuNormalizedSum, memSum float64
+		)
+		if err := rows.Scan(&bucket, &p.Host, &p.PID, &p.Name, &category, &username, &p.Samples, &p.ActiveSamples,
+			&cpuSum, &p.CPUMax, &p.CPUMin, &cpuNormalizedSum, &p.CPUNormalizedMax, &p.CPUNormalizedMin,
+			&memSum, &p.MemoryMaxMB, &p.MemoryMinMB, &p.DiskReadMB, &p.DiskWriteMB, &p.NetSentKB, &p.NetRecvKB); err != nil {
+			return nil, fmt.Errorf("failed to scan %s rollup: %w", tier.Name, err)
+		}
+		p.Bucket = time.Unix(bucket, 0)
+		p.Category = category.String
+		p.Username = username.String
+		if p.Samples > 0 {
+			p.CPUAvg = cpuSum / float64(p.Samples)
+			p.CPUNormalizedAvg = cpuNormalizedSum / float64(p.Samples)
+			p.MemoryAvgMB = memSum / float64(p.Samples)
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRollupTestStorage opens an empty SQLite database holding two days of samples
+// of two processes every 20 seconds, ending an hour before now
+func newRollupTestStorage(t *testing.T, config StorageConfig, now time.Time) *SQLiteStorage {
+	t.Helper()
+	config.Type = "sqlite"
+	config.SQLitePath = filepath.Join(t.TempDir(), "rollup.db")
+	storage := NewSQLiteStorage(config.SQLitePath, 100, config)
+	if err := storage.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	start := now.Add(-49 * time.Hour).Truncate(24 * time.Hour)
+	var records []ResourceRecord
+	for ts := start; ts.Before(start.Add(48 * time.Hour)); ts = ts.Add(20 * time.Second) {
+		records = append(records,
+			ResourceRecord{Timestamp: ts, Name: "train", PID: 200, CPUPercent: 80, CPUPercentNormalized: 20, MemoryMB: 500, IsActive: true, Username: "alice"},
+			ResourceRecord{Timestamp: ts, Name: "vim", PID: 300, CPUPercent: 4, CPUPercentNormalized: 1, MemoryMB: 100, Username: "bob"},
+		)
+	}
+	if err := storage.SaveRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	return storage
+}
+
+// TestSQLiteStorage_Rollup tests that raw samples roll up into minute, hour and day tiers
+func TestSQLiteStorage_Rollup(t *testing.T) {
+	now := time.Now()
+	storage := newRollupTestStorage(t, GetDefaultStorageConfig(), now)
+
+	if err := storage.Rollup(now); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+
+	ctx := context.Background()
+	start := now.Add(-49 * time.Hour).Truncate(24 * time.Hour)
+
+	minutes, err := storage.ReadRollups(ctx, RollupTiers[0], start, start.Add(time.Minute), true, "")
+	if err != nil {
+		t.Fatalf("ReadRollups failed: %v", err)
+	}
+	if len(minutes) != 2 {
+		t.Fatalf("Expected one minute rollup per process, got %+v", minutes)
+	}
+	train := minutes[0]
+	if train.PID != 200 || train.Samples != 3 || train.ActiveSamples != 3 || train.CPUAvg != 80 || train.MemoryAvgMB != 500 || train.Username != "alice" {
+		t.Errorf("Unexpected minute rollup: %+v", train)
+	}
+
+	hours, err := storage.ReadRollups(ctx, RollupTiers[1], start, start.Add(time.Hour), false, "")
+	if err != nil || len(hours) != 1 {
+		t.Fatalf("Expected one hourly total, got %+v (%v)", hours, err)
+	}
+	if hours[0].Samples != 360 || hours[0].CPUNormalizedAvg != 10.5 || hours[0].MemoryAvgMB != 300 {
+		t.Errorf("Unexpected hourly total: %+v", hours[0])
+	}
+
+	days, err := storage.ReadRollups(ctx, RollupTiers[2], start, start.Add(48*time.Hour), true, "")
+	if err != nil {
+		t.Fatalf("ReadRollups failed: %v", err)
+	}
+	if len(days) != 4 || days[0].Samples != 4320 || days[0].CPUMax != 80 || days[0].CPUMin != 80 {
+		t.Errorf("Unexpected daily rollups: %+v", days)
+	}
+
+	if mark := storage.RollupWatermark(RollupTiers[2]); !mark.Equal(start.Add(48 * time.Hour)) {
+		t.Errorf("Expected day watermark at %v, got %v", start.Add(48*time.Hour), mark)
+	}
+
+	// A second pass has nothing new to roll up
+	if err := storage.Rollup(now); err != nil {
+		t.Fatalf("Second rollup failed: %v", err)
+	}
+	hours, _ = storage.ReadRollups(ctx, RollupTiers[1], start, start.Add(time.Hour), false, "")
+	if len(hours) != 1 || hours[0].Samples != 360 {
+		t.Errorf("Expected second rollup to leave totals unchanged, got %+v", hours)
+	}
+}
+
+// TestSQLiteStorage_RollupRetention tests that each tier expires with its own retention
+func TestSQLiteStorage_RollupRetention(t *testing.T) {
+	now := time.Now()
+	config := GetDefaultStorageConfig()
+	config.Rollups.MinuteKeepDays = 1
+	storage := newRollupTestStorage(t, config, now)
+
+	if err := storage.Rollup(now); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+
+	ctx := context.Background()
+	all := now.Add(-72 * time.Hour)
+	minutes, _ := storage.ReadRollups(ctx, RollupTiers[0], all, now, false, "")
+	for _, p := range minutes {
+		if p.Bucket.Before(now.AddDate(0, 0, -1)) {
+			t.Fatalf("Expected minute rollups older than a day to expire, found %v", p.Bucket)
+		}
+	}
+	if len(minutes) == 0 {
+		t.Error("Expected recent minute rollups to be kept")
+	}
+	if hours, _ := storage.ReadRollups(ctx, RollupTiers[1], all, now, false, ""); len(hours) != 48 {
+		t.Errorf("Expected 48 hourly rollups, got %d", len(hours))
+	}
+}
+
+// TestSelectRollupTier tests tier selection by range and granularity
+func TestSelectRollupTier(t *testing.T) {
+	now := time.Now()
+	config := GetDefaultStorageConfig()
+
+	tests := []struct {
+		name  string
+		start time.Time
+		step  time.Duration
+		want  int
+	}{
+		{"recent fine-grained", now.Add(-time.Hour), 10 * time.Second, -1},
+		{"recent by minute", now.Add(-time.Hour), time.Minute, 0},
+		{"week by hour", now.AddDate(0, 0, -7), time.Hour, 1},
+		{"year by hour", now.AddDate(-1, 0, 0), time.Hour, 1},
+		{"year by minute falls back to hours", now.AddDate(-1, 0, 0), time.Minute, 1},
+		{"year by day", now.AddDate(-1, 0, 0), 24 * time.Hour, 2},
+		{"beyond every tier", now.AddDate(-10, 0, 0), time.Hour, 2},
+	}
+	for _, tt := range tests {
+		if got := selectRollupTier(config, now, tt.start, tt.step); got != tt.want {
+			t.Errorf("%s: expected tier %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestAppHistory_Rollups tests that history combines rollup tiers with recent raw records
+func TestAppHistory_Rollups(t *testing.T) {
+	dir := t.TempDir()
+	config := GetDefaultConfig()
+	config.Docker.Enabled = false
+	config.Storage.Type = "sqlite"
+	config.Storage.SQLitePath = filepath.Join(dir, "history.db")
+
+	app := NewApp(filepath.Join(dir, "history.log"), time.Second, config)
+	if err := app.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer app.CloseFile()
+
+	now := time.Now()
+	var records []ResourceRecord
+	for ts := now.Add(-3 * time.Hour); ts.Before(now); ts = ts.Add(time.Minute) {
+		records = append(records, ResourceRecord{Timestamp: ts, Name: "train", PID: 200, CPUPercentNormalized: 20, MemoryMB: 500})
+	}
+	if err := app.SaveResourceRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	if err := app.RunMaintenance(); err != nil {
+		t.Fatalf("Maintenance failed: %v", err)
+	}
+
+	history, source, err := app.History(context.Background(), now.AddDate(0, 0, -30), now, time.Hour, "")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if source != "1h" {
+		t.Errorf("Expected hourly tier for a 30 day range, got %s", source)
+	}
+	samples := 0
+	for _, p := range history {
+		samples += p.Samples
+		if p.CPU != 20 || p.MemoryMB != 500 {
+			t.Errorf("Unexpected history point: %+v", p)
+		}
+	}
+	if samples != len(records) {
+		t.Errorf("Expected every sample exactly once, got %d of %d", samples, len(records))
+	}
+}
+
+// failingRollupStorage fails every rollup and records whether the size limit was enforced
+type failingRollupStorage struct {
+	*SQLiteStorage
+	sizeLimited bool
+}
+
+func (s *failingRollupStorage) Rollup(now time.Time) error {
+	return errors.New("rollup tables locked")
+}
+
+func (s *failingRollupStorage) EnforceSizeLimit(maxBytes int64) (PruneResult, error) {
+	s.sizeLimited = true
+	return s.SQLiteStorage.EnforceSizeLimit(maxBytes)
+}
+
+// TestAppRunMaintenance_FailedStep tests that a failing step does not skip the later ones
+func TestAppRunMaintenance_FailedStep(t *testing.T) {
+	dir := t.TempDir()
+	config := GetDefaultConfig()
+	config.Docker.Enabled = false
+	config.Storage.Type = "sqlite"
+	config.Storage.SQLitePath = filepath.Join(dir, "maintenance.db")
+	config.Storage.Rollups.Enabled = true
+	config.Storage.MaxSizeMB = 100
+
+	app := NewApp(filepath.Join(dir, "maintenance.log"), time.Second, config)
+	if err := app.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	defer app.CloseFile()
+	storage := &failingRollupStorage{SQLiteStorage: app.storage.(*SQLiteStorage)}
+	app.storage = storage
+
+	err := app.RunMaintenance()
+	if err == nil || !strings.Contains(err.Error(), "rollup tables locked") {
+		t.Errorf("Expected the rollup error, got %v", err)
+	}
+	if !storage.sizeLimited {
+		t.Error("Expected the size limit enforced after the failed rollup")
+	}
+	if app.lastRetention.IsZero() {
+		t.Error("Expected retention applied after the failed rollup")
+	}
+}
@@ -1,12 +1,15 @@
 package core
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -20,6 +23,14 @@ type SQLiteStorage struct {
 	config     StorageConfig
 	lastFlush  time.Time
 	sqlitePath string
+
+	searchIndex bool // 全文索引可用，见 detectSearchIndex
+
+	connMu sync.Mutex // 保护 db 连接的打开和关闭
+	closed bool       // 已调用 Close；任务存储等不再隐式打开数据库
+
+	mu        sync.Mutex                    // 保护 processes 缓存
+	processes map[processKey]cachedProcess // 已写入维度表的进程
 }
 
 // NewSQLiteStorage 创建新的SQLite存储实例
@@ -39,20 +50,66 @@ func NewSQLiteStorage(dataFile string, bufferSize int, config StorageConfig) *SQ
 		bufferSize: bufferSize,
 		config:     config,
 		sqlitePath: sqlitePath,
+		processes:  make(map[processKey]cachedProcess),
 	}
 }
 
-// Initialize 初始化SQLite存储
+// Initialize 初始化SQLite存储；已打开时直接返回
+// 显式调用可以重新打开已关闭的存储
 func (s *SQLiteStorage) Initialize() error {
-	// 展开环境变量路径和~符号
-	expandedPath := os.ExpandEnv(s.sqlitePath)
-	if strings.HasPrefix(expandedPath, "~/") {
-		home := os.Getenv("HOME")
-		if home != "" {
-			expandedPath = filepath.Join(home, expandedPath[2:])
-		}
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	s.closed = false
+	return s.initialize()
+}
+
+// openedDB 返回已打开的连接，尚未打开时打开；Close 之后返回错误而不是重新打开
+func (s *SQLiteStorage) openedDB() (*sql.DB, error) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("sqlite storage %s is closed", s.sqlitePath)
+	}
+	if err := s.initialize(); err != nil {
+		return nil, err
+	}
+	return s.db, nil
+}
+
+// initialize 打开数据库并执行迁移，调用方需持有 s.connMu
+func (s *SQLiteStorage) initialize() error {
+	if s.db != nil {
+		return nil
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	// 执行未应用的结构迁移
+	if err := s.migrate(); err != nil {
+		s.closeDB()
+		return fmt.Errorf("failed to migrate schema: %w", err)
 	}
-	s.sqlitePath = expandedPath
+
+	s.detectSearchIndex()
+
+	// 按大小清理依赖增量回收
+	if err := s.ensureIncrementalVacuum(); err != nil {
+		s.closeDB()
+		return err
+	}
+
+	// 初始化元数据
+	s.initMeta()
+
+	return nil
+}
+
+// open 打开并配置数据库连接，不修改表结构
+func (s *SQLiteStorage) open() error {
+	s.sqlitePath = expandSQLitePath(s.sqlitePath)
 
 	// 确保目录存在
 	dir := filepath.Dir(s.sqlitePath)
@@ -69,20 +126,23 @@ func (s *SQLiteStorage) Initialize() error {
 
 	// 配置SQLite连接
 	if err := s.configureSQLite(); err != nil {
+		s.closeDB()
 		return fmt.Errorf("failed to configure sqlite: %w", err)
 	}
 
-	// 创建表结构
-	if err := s.createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
-	}
+	return nil
+}
 
-	// 创建索引
-	if err := s.createIndexes(); err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+// expandSQLitePath 展开环境变量路径和~符号
+func expandSQLitePath(path string) string {
+	expandedPath := os.ExpandEnv(path)
+	if strings.HasPrefix(expandedPath, "~/") {
+		home := os.Getenv("HOME")
+		if home != "" {
+			expandedPath = filepath.Join(home, expandedPath[2:])
+		}
 	}
-
-	return nil
+	return expandedPath
 }
 
 // configureSQLite 配置SQLite连接
@@ -92,6 +152,11 @@ func (s *SQLiteStorage) configureSQLite() error {
 		return err
 	}
 
+	// 增量回收空闲页（只对尚未建表的新数据库生效，旧数据库见 ensureIncrementalVacuum）
+	if _, err := s.db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return err
+	}
+
 	// 配置WAL模式（提高并发性能）
 	if s.config.SQLiteWAL {
 		if _, err := s.db.Exec("PRAGMA journal_mode = WAL"); err != nil {
@@ -119,67 +184,142 @@ func (s *SQLiteStorage) configureSQLite() error {
 	return nil
 }
 
-// createTables 创建数据库表
-func (s *SQLiteStorage) createTables() error {
-	// 创建资源记录表
-	createRecordsSQL := `
-	CREATE TABLE IF NOT EXISTS resource_records (
+// createMetaTable 创建元数据表（存储信息、结构版本、汇总水位等）
+func (s *SQLiteStorage) createMetaTable() error {
+	createMetaSQL := `
+	CREATE TABLE IF NOT EXISTS storage_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := s.db.Exec(createMetaSQL); err != nil {
+		return fmt.Errorf("failed to create storage_meta table: %w", err)
+	}
+	return nil
+}
+
+// createBaseTables 创建数据库表
+func createBaseTables(tx *sql.Tx) error {
+	// 创建进程维度表和采样表
+	if err := createRecordTables(tx); err != nil {
+		return err
+	}
+
+	// 创建主机级指标表（磁盘使用情况以JSON存储）
+	createSystemSQL := `
+	CREATE TABLE IF NOT EXISTS system_records (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		timestamp DATETIME NOT NULL,
-		name TEXT NOT NULL,
+		load1 REAL NOT NULL,
+		load5 REAL NOT NULL,
+		load15 REAL NOT NULL,
 		cpu_percent REAL NOT NULL,
-		cpu_percent_normalized REAL NOT NULL,
-		memory_mb REAL NOT NULL,
+		cpu_user REAL NOT NULL,
+		cpu_system REAL NOT NULL,
+		cpu_nice REAL NOT NULL,
+		cpu_idle REAL NOT NULL,
+		cpu_iowait REAL NOT NULL,
+		cpu_irq REAL NOT NULL,
+		cpu_steal REAL NOT NULL,
+		memory_total_mb REAL NOT NULL,
+		memory_used_mb REAL NOT NULL,
+		memory_available_mb REAL NOT NULL,
+		memory_cached_mb REAL NOT NULL,
+		memory_buffers_mb REAL NOT NULL,
 		memory_percent REAL NOT NULL,
-		threads INTEGER NOT NULL,
-		disk_read_mb REAL NOT NULL,
-		disk_write_mb REAL NOT NULL,
-		net_sent_kb REAL NOT NULL,
-		net_recv_kb REAL NOT NULL,
-		is_active BOOLEAN NOT NULL,
-		command TEXT,
-		working_dir TEXT,
-		category TEXT,
+		swap_total_mb REAL NOT NULL,
+		swap_used_mb REAL NOT NULL,
+		psi_cpu_some REAL NOT NULL,
+		psi_memory_some REAL NOT NULL,
+		psi_memory_full REAL NOT NULL,
+		psi_io_some REAL NOT NULL,
+		psi_io_full REAL NOT NULL,
+		disks TEXT
+	);`
+
+	if _, err := tx.Exec(createSystemSQL); err != nil {
+		return fmt.Errorf("failed to create system_records table: %w", err)
+	}
+
+	// 创建进程生命周期事件表
+	createEventsSQL := `
+	CREATE TABLE IF NOT EXISTS process_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		type TEXT NOT NULL,
 		pid INTEGER NOT NULL,
 		ppid INTEGER,
+		name TEXT NOT NULL,
+		command TEXT,
+		previous_command TEXT,
+		category TEXT,
 		create_time INTEGER,
-		cpu_time REAL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		last_seen DATETIME,
+		lifetime_seconds REAL,
+		cpu_percent REAL,
+		memory_mb REAL,
+		threads INTEGER,
+		cpu_time REAL
 	);`
 
-	if _, err := s.db.Exec(createRecordsSQL); err != nil {
-		return fmt.Errorf("failed to create resource_records table: %w", err)
+	if _, err := tx.Exec(createEventsSQL); err != nil {
+		return fmt.Errorf("failed to create process_events table: %w", err)
 	}
 
-	// 创建元数据表（用于存储存储信息）
-	createMetaSQL := `
-	CREATE TABLE IF NOT EXISTS storage_meta (
-		key TEXT PRIMARY KEY,
-		value TEXT NOT NULL,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+	// 创建分级汇总表
+	return createRollupTables(tx)
+}
 
-	if _, err := s.db.Exec(createMetaSQL); err != nil {
-		return fmt.Errorf("failed to create storage_meta table: %w", err)
+// ensureColumn 如果列不存在则添加（用于升级旧数据库）
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
 	}
+	defer rows.Close()
 
-	// 初始化元数据
-	s.initMeta()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	rows.Close()
 
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
 // createIndexes 创建索引
-func (s *SQLiteStorage) createIndexes() error {
+func createIndexes(tx *sql.Tx) error {
 	indexes := []string{
-		"CREATE INDEX IF NOT EXISTS idx_resource_records_timestamp ON resource_records(timestamp)",
-		"CREATE INDEX IF NOT EXISTS idx_resource_records_name ON resource_records(name)",
-		"CREATE INDEX IF NOT EXISTS idx_resource_records_pid ON resource_records(pid)",
-		"CREATE INDEX IF NOT EXISTS idx_resource_records_created_at ON resource_records(created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_samples_timestamp ON samples(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_samples_process_id ON samples(process_id, timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_processes_name ON processes(name)",
+		"CREATE INDEX IF NOT EXISTS idx_processes_username ON processes(username)",
+		"CREATE INDEX IF NOT EXISTS idx_system_records_timestamp ON system_records(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_process_events_timestamp ON process_events(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_process_events_name ON process_events(name)",
 	}
 
 	for _, indexSQL := range indexes {
-		if _, err := s.db.Exec(indexSQL); err != nil {
+		if _, err := tx.Exec(indexSQL); err != nil {
 			return fmt.Errorf("failed to create index: %w", err)
 		}
 	}
@@ -204,6 +344,9 @@ func (s *SQLiteStorage) SaveRecords(records []ResourceRecord) error {
 		return nil
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// 开始事务
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -211,14 +354,14 @@ func (s *SQLiteStorage) SaveRecords(records []ResourceRecord) error {
 	}
 	defer tx.Rollback()
 
-	// 准备插入语句
+	// 准备插入语句（静态属性写入 processes，数值指标写入 samples）
+	// 同一进程同一时刻的采样已存在时忽略，重发的批次不会重复写入
 	stmt, err := tx.Prepare(`
-		INSERT INTO resource_records (
-			timestamp, name, cpu_percent, cpu_percent_normalized,
+		INSERT OR IGNORE INTO samples (
+			process_id, timestamp, cpu_percent, cpu_percent_normalized,
 			memory_mb, memory_percent, threads, disk_read_mb, disk_write_mb,
-			net_sent_kb, net_recv_kb, is_active, command, working_dir,
-			category, pid, ppid, create_time, cpu_time
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			net_sent_kb, net_recv_kb, is_active, cpu_time
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare insert statement: %w", err)
@@ -227,9 +370,14 @@ func (s *SQLiteStorage) SaveRecords(records []ResourceRecord) error {
 
 	// 批量插入记录
 	for _, record := range records {
-		_, err := stmt.Exec(
+		processID, err := s.processID(tx, record)
+		if err != nil {
+			s.resetProcessCache()
+			return err
+		}
+		_, err = stmt.Exec(
+			processID,
 			record.Timestamp,
-			record.Name,
 			record.CPUPercent,
 			record.CPUPercentNormalized,
 			record.MemoryMB,
@@ -240,21 +388,17 @@ func (s *SQLiteStorage) SaveRecords(records []ResourceRecord) error {
 			record.NetSentKB,
 			record.NetRecvKB,
 			record.IsActive,
-			record.Command,
-			record.WorkingDir,
-			record.Category,
-			record.PID,
-			record.PPID,
-			record.CreateTime,
 			record.CPUTime,
 		)
 		if err != nil {
+			s.resetProcessCache()
 			return fmt.Errorf("failed to insert record: %w", err)
 		}
 	}
 
 	// 提交事务
 	if err := tx.Commit(); err != nil {
+		s.resetProcessCache()
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
@@ -279,7 +423,7 @@ func (s *SQLiteStorage) ReadRecords(filePath string) ([]ResourceRecord, error) {
 		SELECT timestamp, name, cpu_percent, cpu_percent_normalized,
 			   memory_mb, memory_percent, threads, disk_read_mb, disk_write_mb,
 			   net_sent_kb, net_recv_kb, is_active, command, working_dir,
-			   category, pid, ppid, create_time, cpu_time
+			   category, pid, ppid, create_time, cpu_time, labels, uid, username, host
 		FROM resource_records
 		ORDER BY timestamp DESC
 	`
@@ -293,6 +437,8 @@ func (s *SQLiteStorage) ReadRecords(filePath string) ([]ResourceRecord, error) {
 	var records []ResourceRecord
 	for rows.Next() {
 		var record ResourceRecord
+		var labels, username sql.NullString
+		var uid sql.NullInt64
 		err := rows.Scan(
 			&record.Timestamp,
 			&record.Name,
@@ -313,10 +459,17 @@ func (s *SQLiteStorage) ReadRecords(filePath string) ([]ResourceRecord, error) {
 			&record.PPID,
 			&record.CreateTime,
 			&record.CPUTime,
+			&labels,
+			&uid,
+			&username,
+			&record.Host,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan record: %w", err)
 		}
+		record.Labels = ParseLabels(labels.String)
+		record.UID = int32(uid.Int64)
+		record.Username = username.String
 		records = append(records, record)
 	}
 
@@ -329,11 +482,15 @@ func (s *SQLiteStorage) ReadRecords(filePath string) ([]ResourceRecord, error) {
 
 // ReadRecordsByTimeRange 按时间范围读取记录
 func (s *SQLiteStorage) ReadRecordsByTimeRange(start, end time.Time) ([]ResourceRecord, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("SQLite database not initialized")
+	}
+
 	query := `
 		SELECT timestamp, name, cpu_percent, cpu_percent_normalized,
 			   memory_mb, memory_percent, threads, disk_read_mb, disk_write_mb,
 			   net_sent_kb, net_recv_kb, is_active, command, working_dir,
-			   category, pid, ppid, create_time, cpu_time
+			   category, pid, ppid, create_time, cpu_time, labels, uid, username, host
 		FROM resource_records
 		WHERE timestamp BETWEEN ? AND ?
 		ORDER BY timestamp DESC
@@ -348,6 +505,8 @@ func (s *SQLiteStorage) ReadRecordsByTimeRange(start, end time.Time) ([]Resource
 	var records []ResourceRecord
 	for rows.Next() {
 		var record ResourceRecord
+		var labels, username sql.NullString
+		var uid sql.NullInt64
 		err := rows.Scan(
 			&record.Timestamp,
 			&record.Name,
@@ -368,158 +527,423 @@ func (s *SQLiteStorage) ReadRecordsByTimeRange(start, end time.Time) ([]Resource
 			&record.PPID,
 			&record.CreateTime,
 			&record.CPUTime,
+			&labels,
+			&uid,
+			&username,
+			&record.Host,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan record: %w", err)
 		}
+		record.Labels = ParseLabels(labels.String)
+		record.UID = int32(uid.Int64)
+		record.Username = username.String
 		records = append(records, record)
 	}
 
 	return records, rows.Err()
 }
 
-// GetRecordCount 获取记录总数
-func (s *SQLiteStorage) GetRecordCount() (int, error) {
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM resource_records").Scan(&count)
+// SaveSystemRecord 保存一条主机级指标记录
+func (s *SQLiteStorage) SaveSystemRecord(record SystemRecord) error {
+	disks, err := json.Marshal(record.Disks)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get record count: %w", err)
+		return fmt.Errorf("failed to encode disks: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO system_records (
+			timestamp, load1, load5, load15,
+			cpu_percent, cpu_user, cpu_system, cpu_nice, cpu_idle, cpu_iowait, cpu_irq, cpu_steal,
+			memory_total_mb, memory_used_mb, memory_available_mb, memory_cached_mb, memory_buffers_mb,
+			memory_percent, swap_total_mb, swap_used_mb,
+			psi_cpu_some, psi_memory_some, psi_memory_full, psi_io_some, psi_io_full, disks
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.Timestamp, record.Load1, record.Load5, record.Load15,
+		record.CPUPercent, record.CPUUser, record.CPUSystem, record.CPUNice, record.CPUIdle,
+		record.CPUIOWait, record.CPUIRQ, record.CPUSteal,
+		record.MemoryTotalMB, record.MemoryUsedMB, record.MemoryAvailableMB, record.MemoryCachedMB,
+		record.MemoryBuffersMB, record.MemoryPercent, record.SwapTotalMB, record.SwapUsedMB,
+		record.PSICPUSome, record.PSIMemorySome, record.PSIMemoryFull, record.PSIIOSome, record.PSIIOFull,
+		string(disks),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert system record: %w", err)
 	}
-	return count, nil
+	return nil
 }
 
-// CalculateStats 计算资源统计信息
-func (s *SQLiteStorage) CalculateStats(records []ResourceRecord) []ResourceStats {
-	// 复用现有的统计计算逻辑
-	return s.calculateResourceStats(records)
+// ReadSystemRecordsByTimeRange 按时间范围读取主机级指标记录（按时间升序）
+func (s *SQLiteStorage) ReadSystemRecordsByTimeRange(start, end time.Time) ([]SystemRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT timestamp, load1, load5, load15,
+			   cpu_percent, cpu_user, cpu_system, cpu_nice, cpu_idle, cpu_iowait, cpu_irq, cpu_steal,
+			   memory_total_mb, memory_used_mb, memory_available_mb, memory_cached_mb, memory_buffers_mb,
+			   memory_percent, swap_total_mb, swap_used_mb,
+			   psi_cpu_some, psi_memory_some, psi_memory_full, psi_io_some, psi_io_full, disks
+		FROM system_records
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query system records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []SystemRecord
+	for rows.Next() {
+		var record SystemRecord
+		var disks sql.NullString
+		err := rows.Scan(
+			&record.Timestamp, &record.Load1, &record.Load5, &record.Load15,
+			&record.CPUPercent, &record.CPUUser, &record.CPUSystem, &record.CPUNice, &record.CPUIdle,
+			&record.CPUIOWait, &record.CPUIRQ, &record.CPUSteal,
+			&record.MemoryTotalMB, &record.MemoryUsedMB, &record.MemoryAvailableMB, &record.MemoryCachedMB,
+			&record.MemoryBuffersMB, &record.MemoryPercent, &record.SwapTotalMB, &record.SwapUsedMB,
+			&record.PSICPUSome, &record.PSIMemorySome, &record.PSIMemoryFull, &record.PSIIOSome, &record.PSIIOFull,
+			&disks,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan system record: %w", err)
+		}
+		if disks.Valid && disks.String != "" {
+			if err := json.Unmarshal([]byte(disks.String), &record.Disks); err != nil {
+				log.Printf("Warning: failed to decode disks for system record: %v", err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
 }
 
-// calculateResourceStats 计算资源统计信息的内部方法
-func (s *SQLiteStorage) calculateResourceStats(records []ResourceRecord) []ResourceStats {
-	// 简单的统计计算实现，可以后续优化
-	if len(records) == 0 {
-		return []ResourceStats{}
+// SaveProcessEvents 批量保存进程生命周期事件
+func (s *SQLiteStorage) SaveProcessEvents(events []ProcessEvent) error {
+	if len(events) == 0 {
+		return nil
 	}
 
-	// 按进程名称分组
-	processMap := make(map[string][]ResourceRecord)
-	for _, record := range records {
-		processMap[record.Name] = append(processMap[record.Name], record)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO process_events (
+			timestamp, type, pid, ppid, name, command, previous_command, category,
+			create_time, last_seen, lifetime_seconds, cpu_percent, memory_mb, threads, cpu_time
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
+	defer stmt.Close()
 
-	var stats []ResourceStats
-	for name, processRecords := range processMap {
-		if len(processRecords) == 0 {
-			continue
+	for _, event := range events {
+		var lastSeen interface{}
+		if !event.LastSeen.IsZero() {
+			lastSeen = event.LastSeen
 		}
+		_, err := stmt.Exec(
+			event.Timestamp, string(event.Type), event.PID, event.PPID, event.Name,
+			event.Command, event.PreviousCommand, event.Category, event.CreateTime,
+			lastSeen, event.LifetimeSeconds, event.CPUPercent, event.MemoryMB,
+			event.Threads, event.CPUTime,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert process event: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReadProcessEventsByTimeRange 按时间范围读取进程生命周期事件（按时间升序）
+func (s *SQLiteStorage) ReadProcessEventsByTimeRange(start, end time.Time) ([]ProcessEvent, error) {
+	rows, err := s.db.Query(`
+		SELECT timestamp, type, pid, ppid, name, command, previous_command, category,
+			   create_time, last_seen, lifetime_seconds, cpu_percent, memory_mb, threads, cpu_time
+		FROM process_events
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, id ASC`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query process events: %w", err)
+	}
+	defer rows.Close()
 
-		stat := ResourceStats{
-			Name:    name,
-			Samples: len(processRecords),
+	var events []ProcessEvent
+	for rows.Next() {
+		var event ProcessEvent
+		var eventType string
+		var command, previousCommand, category sql.NullString
+		var lastSeen sql.NullTime
+		err := rows.Scan(
+			&event.Timestamp, &eventType, &event.PID, &event.PPID, &event.Name,
+			&command, &previousCommand, &category, &event.CreateTime,
+			&lastSeen, &event.LifetimeSeconds, &event.CPUPercent, &event.MemoryMB,
+			&event.Threads, &event.CPUTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan process event: %w", err)
 		}
+		event.Type = ProcessEventType(eventType)
+		event.Command = command.String
+		event.PreviousCommand = previousCommand.String
+		event.Category = category.String
+		if lastSeen.Valid {
+			event.LastSeen = lastSeen.Time
+		}
+		events = append(events, event)
+	}
 
-		// 计算统计数据
-		var totalCPU, totalMem, totalDiskRead, totalDiskWrite, totalNetSent, totalNetRecv float64
-		var maxCPU, maxMem, maxDiskRead, maxDiskWrite, maxNetSent, maxNetRecv float64
-		var activeTime time.Duration
-		var activeSamples int
-
-		firstSeen := processRecords[0].Timestamp
-		lastSeen := processRecords[0].Timestamp
-
-		for _, record := range processRecords {
-			totalCPU += record.CPUPercent
-			totalMem += record.MemoryMB
-			totalDiskRead += record.DiskReadMB
-			totalDiskWrite += record.DiskWriteMB
-			totalNetSent += record.NetSentKB
-			totalNetRecv += record.NetRecvKB
-
-			if record.CPUPercent > maxCPU {
-				maxCPU = record.CPUPercent
-			}
-			if record.MemoryMB > maxMem {
-				maxMem = record.MemoryMB
-			}
-			if record.DiskReadMB > maxDiskRead {
-				maxDiskRead = record.DiskReadMB
-			}
-			if record.DiskWriteMB > maxDiskWrite {
-				maxDiskWrite = record.DiskWriteMB
-			}
-			if record.NetSentKB > maxNetSent {
-				maxNetSent = record.NetSentKB
-			}
-			if record.NetRecvKB > maxNetRecv {
-				maxNetRecv = record.NetRecvKB
-			}
+	return events, rows.Err()
+}
 
-			if record.IsActive {
-				activeTime += 5 * time.Second // 假设5秒间隔
-				activeSamples++
-			}
+// Query 按条件查询资源记录，过滤、排序、分页和字段投影都下推到SQL中执行
+func (s *SQLiteStorage) Query(ctx context.Context, q RecordQuery) (RecordIterator, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("SQLite database not initialized")
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
 
-			if record.Timestamp.Before(firstSeen) {
-				firstSeen = record.Timestamp
-			}
-			if record.Timestamp.After(lastSeen) {
-				lastSeen = record.Timestamp
-			}
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = RecordFields
+	}
+
+	where, args := s.recordWhere(q)
+	if q.LatestOnly {
+		// 每台主机的每个PID只保留最新一条记录（按插入顺序，id最大即最新）
+		latestWhere, latestArgs := s.recordWhere(q)
+		where = append(where, "id IN (SELECT MAX(id) FROM resource_records"+whereClause(latestWhere)+" GROUP BY host, pid)")
+		args = append(args, latestArgs...)
+	}
+
+	query := "SELECT " + strings.Join(fields, ", ") + " FROM resource_records" + whereClause(where)
+
+	orderBy := q.OrderBy
+	if orderBy == "" {
+		orderBy = "timestamp"
+	}
+	direction := "ASC"
+	if q.Descending {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", orderBy, direction, direction)
+
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit == 0 {
+			limit = -1 // SQLite: 不限制数量
 		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	return &sqliteRecordIterator{rows: rows, fields: fields}, nil
+}
 
-		sampleCount := float64(len(processRecords))
-		stat.CPUAvg = totalCPU / sampleCount
-		stat.CPUMax = maxCPU
-		stat.MemoryAvg = totalMem / sampleCount
-		stat.MemoryMax = maxMem
-		stat.DiskReadAvg = totalDiskRead / sampleCount
-		stat.DiskWriteAvg = totalDiskWrite / sampleCount
-		stat.NetSentAvg = totalNetSent / sampleCount
-		stat.NetRecvAvg = totalNetRecv / sampleCount
-		stat.ActiveTime = activeTime
-		stat.ActiveSamples = activeSamples
-		stat.FirstSeen = firstSeen
-		stat.LastSeen = lastSeen
-		stat.TotalUptime = lastSeen.Sub(firstSeen)
-
-		// 设置其他字段
-		if len(processRecords) > 0 {
-			firstRecord := processRecords[0]
-			stat.Category = firstRecord.Category
-			stat.Command = firstRecord.Command
-			stat.WorkingDir = firstRecord.WorkingDir
-			stat.PIDs = []int32{firstRecord.PID}
-			stat.ProcessStartTime = time.UnixMilli(firstRecord.CreateTime)
-			stat.TotalCPUTime = time.Duration(firstRecord.CPUTime * float64(time.Second))
-			stat.AvgCPUTime = firstRecord.CPUTime
+// buildRecordWhere 根据查询条件生成WHERE子句（使用timestamp、name、pid、username、host索引）
+func buildRecordWhere(q RecordQuery) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	if !q.Start.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.Start)
+	}
+	if !q.End.IsZero() {
+		where = append(where, "timestamp <= ?")
+		args = append(args, q.End)
+	}
+	addIn := func(column string, values []interface{}) {
+		if len(values) == 0 {
+			return
 		}
+		where = append(where, column+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")+")")
+		args = append(args, values...)
+	}
+	addIn("name", stringArgs(q.Names))
+	addIn("category", stringArgs(q.Categories))
+	addIn("username", stringArgs(q.Users))
+	addIn("host", stringArgs(q.Hosts))
+	pids := make([]interface{}, 0, len(q.PIDs))
+	for _, pid := range q.PIDs {
+		pids = append(pids, pid)
+	}
+	addIn("pid", pids)
+
+	return where, args
+}
 
-		stats = append(stats, stat)
+// recordWhere 在 buildRecordWhere 的基础上加入命令行搜索条件
+func (s *SQLiteStorage) recordWhere(q RecordQuery) ([]string, []interface{}) {
+	where, args := buildRecordWhere(q)
+	if q.Text != "" {
+		condition, textArgs := s.textCondition(q.Text)
+		where = append(where, condition)
+		args = append(args, textArgs...)
 	}
+	return where, args
+}
 
-	return stats
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
 }
 
-// CleanOldData 清理旧数据
-func (s *SQLiteStorage) CleanOldData(keepDays int) error {
-	cutoff := time.Now().AddDate(0, 0, -keepDays)
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
 
-	// 删除旧记录
-	result, err := s.db.Exec("DELETE FROM resource_records WHERE timestamp < ?", cutoff)
-	if err != nil {
-		return fmt.Errorf("failed to delete old records: %w", err)
+// sqliteRecordIterator 逐行扫描查询结果
+type sqliteRecordIterator struct {
+	rows    *sql.Rows
+	fields  []string
+	current ResourceRecord
+	err     error
+}
+
+func (it *sqliteRecordIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
 	}
 
-	// 获取删除的记录数
-	deletedRows, _ := result.RowsAffected()
-	log.Printf("Cleaned up %d old records (older than %d days)", deletedRows, keepDays)
+	var record ResourceRecord
+	dests := make([]interface{}, len(it.fields))
+	applies := make([]func(), len(it.fields))
+	for i, field := range it.fields {
+		dests[i], applies[i] = recordColumnScanner(field, &record)
+	}
+	if err := it.rows.Scan(dests...); err != nil {
+		it.err = fmt.Errorf("failed to scan record: %w", err)
+		return false
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	it.current = record
+	return true
+}
 
-	// 清理数据库
-	if _, err := s.db.Exec("VACUUM"); err != nil {
-		log.Printf("Warning: failed to vacuum database: %v", err)
+func (it *sqliteRecordIterator) Record() ResourceRecord { return it.current }
+
+func (it *sqliteRecordIterator) Err() error {
+	if it.err != nil {
+		return it.err
 	}
+	return it.rows.Err()
+}
 
-	return nil
+func (it *sqliteRecordIterator) Close() error { return it.rows.Close() }
+
+// recordColumnScanner 返回列的扫描目标以及写回记录字段的函数（旧数据中的列可能为NULL）
+func recordColumnScanner(field string, r *ResourceRecord) (interface{}, func()) {
+	switch field {
+	case "timestamp":
+		var v sql.NullTime
+		return &v, func() { r.Timestamp = v.Time }
+	case "name":
+		return scanString(&r.Name)
+	case "cpu_percent":
+		return scanFloat(&r.CPUPercent)
+	case "cpu_percent_normalized":
+		return scanFloat(&r.CPUPercentNormalized)
+	case "memory_mb":
+		return scanFloat(&r.MemoryMB)
+	case "memory_percent":
+		return scanFloat(&r.MemoryPercent)
+	case "threads":
+		return scanInt32(&r.Threads)
+	case "disk_read_mb":
+		return scanFloat(&r.DiskReadMB)
+	case "disk_write_mb":
+		return scanFloat(&r.DiskWriteMB)
+	case "net_sent_kb":
+		return scanFloat(&r.NetSentKB)
+	case "net_recv_kb":
+		return scanFloat(&r.NetRecvKB)
+	case "is_active":
+		var v sql.NullBool
+		return &v, func() { r.IsActive = v.Bool }
+	case "command":
+		return scanString(&r.Command)
+	case "working_dir":
+		return scanString(&r.WorkingDir)
+	case "category":
+		return scanString(&r.Category)
+	case "pid":
+		return scanInt32(&r.PID)
+	case "ppid":
+		return scanInt32(&r.PPID)
+	case "create_time":
+		var v sql.NullInt64
+		return &v, func() { r.CreateTime = v.Int64 }
+	case "cpu_time":
+		return scanFloat(&r.CPUTime)
+	case "labels":
+		var v sql.NullString
+		return &v, func() { r.Labels = ParseLabels(v.String) }
+	case "uid":
+		return scanInt32(&r.UID)
+	case "username":
+		return scanString(&r.Username)
+	case "host":
+		return scanString(&r.Host)
+	}
+	var discard interface{}
+	return &discard, func() {}
+}
+
+func scanString(target *string) (interface{}, func()) {
+	var v sql.NullString
+	return &v, func() { *target = v.String }
+}
+
+func scanFloat(target *float64) (interface{}, func()) {
+	var v sql.NullFloat64
+	return &v, func() { *target = v.Float64 }
+}
+
+func scanInt32(target *int32) (interface{}, func()) {
+	var v sql.NullInt64
+	return &v, func() { *target = int32(v.Int64) }
+}
+
+// GetRecordCount 获取记录总数
+func (s *SQLiteStorage) GetRecordCount() (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM samples").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get record count: %w", err)
+	}
+	return count, nil
+}
+
+// CalculateStats 计算资源统计信息
+func (s *SQLiteStorage) CalculateStats(records []ResourceRecord) []ResourceStats {
+	return ComputeResourceStats(records, StatsOptions{})
+}
+
+// CleanOldData 按 keep_days 和保留规则清理旧数据
+func (s *SQLiteStorage) CleanOldData(keepDays int) error {
+	policy, err := NewRetentionPolicy(keepDays, s.config.Retention)
+	if err != nil {
+		return err
+	}
+	_, err = s.ApplyRetention(policy, time.Now(), false)
+	return err
 }
 
 // GetStorageInfo 获取存储信息
@@ -541,16 +965,27 @@ func (s *SQLiteStorage) GetStorageInfo() StorageInfo {
 	}
 
 	// 获取最早和最新记录时间
-	s.db.QueryRow("SELECT MIN(timestamp) FROM resource_records").Scan(&info.OldestRecord)
-	s.db.QueryRow("SELECT MAX(timestamp) FROM resource_records").Scan(&info.NewestRecord)
+	s.db.QueryRow("SELECT MIN(timestamp) FROM samples").Scan(&info.OldestRecord)
+	s.db.QueryRow("SELECT MAX(timestamp) FROM samples").Scan(&info.NewestRecord)
 
 	return info
 }
 
 // Close 关闭存储
 func (s *SQLiteStorage) Close() error {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	s.closed = true
+	return s.closeDB()
+}
+
+// closeDB 关闭当前连接，之后仍可以重新打开
+func (s *SQLiteStorage) closeDB() error {
 	if s.db != nil {
-		return s.db.Close()
+		err := s.db.Close()
+		s.db = nil
+		return err
 	}
 	return nil
 }
\ No newline at end of file
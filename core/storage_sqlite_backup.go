@@ -0,0 +1,315 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Backup 使用SQLite在线备份API将数据库复制到 path
+// 备份在一个读事务中完成，WAL模式下守护进程可以继续写入；先写入临时文件再重命名，避免留下不完整的备份
+func (s *SQLiteStorage) Backup(ctx context.Context, path string) (BackupInfo, error) {
+	info := BackupInfo{Path: path, Type: "sqlite", CreatedAt: time.Now()}
+	if s.db == nil {
+		return info, fmt.Errorf("SQLite database not initialized")
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := s.backupTo(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return info, err
+	}
+
+	count, err := validateSQLiteBackup(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return info, fmt.Errorf("backup failed validation: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return info, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	info.Records = count
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, nil
+}
+
+// backupTo 将 main 数据库一次性复制到 dest
+func (s *SQLiteStorage) backupTo(ctx context.Context, dest string) error {
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected sqlite driver connection")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			// -1 表示一次复制全部页面，得到一致的快照
+			if _, err := backup.Step(-1); err != nil {
+				backup.Close()
+				return fmt.Errorf("backup step failed: %w", err)
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// validateSQLiteBackup 检查备份文件的完整性和结构版本，返回其中的采样数
+func validateSQLiteBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", integrity)
+	}
+
+	var version string
+	err = db.QueryRow("SELECT value FROM storage_meta WHERE key = 'schema_version'").Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("not a process-tracker database: %w", err)
+	}
+	var v int
+	fmt.Sscanf(version, "%d", &v)
+	if v > LatestSchemaVersion() {
+		return 0, fmt.Errorf("backup schema version %d is newer than this build supports (%d)", v, LatestSchemaVersion())
+	}
+
+	// 旧版本数据库只有 resource_records 宽表
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM resource_records").Scan(&count); err != nil {
+		return 0, fmt.Errorf("not a process-tracker database: %w", err)
+	}
+	return count, nil
+}
+
+// Restore 用备份替换当前数据库，或将备份中缺少的数据合并进来
+// 备份先复制到临时文件并迁移到当前结构版本，校验失败时不会修改当前数据库
+func (s *SQLiteStorage) Restore(ctx context.Context, path string, merge bool) (RestoreResult, error) {
+	result := RestoreResult{Merged: merge}
+
+	count, err := validateSQLiteBackup(path)
+	if err != nil {
+		return result, fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+
+	target := expandSQLitePath(s.sqlitePath)
+	work := target + ".restore"
+	if err := copyFile(path, work); err != nil {
+		return result, fmt.Errorf("failed to copy backup: %w", err)
+	}
+	defer os.Remove(work)
+
+	staged := NewSQLiteStorage(s.dataFile, s.bufferSize, StorageConfig{SQLitePath: work})
+	if err := staged.Initialize(); err != nil {
+		staged.Close()
+		return result, fmt.Errorf("failed to upgrade backup: %w", err)
+	}
+	staged.Close()
+
+	if merge {
+		if s.db == nil {
+			if err := s.Initialize(); err != nil {
+				return result, err
+			}
+		}
+		merged, err := s.mergeFrom(ctx, work)
+		result.Records = int(merged)
+		return result, err
+	}
+
+	// 替换：关闭当前连接，移走WAL文件后用备份覆盖；期间其他使用者等待重新打开
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	wasOpen := s.db != nil
+	if wasOpen {
+		if err := s.closeDB(); err != nil {
+			return result, fmt.Errorf("failed to close database: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(target + suffix)
+		os.Remove(work + suffix)
+	}
+	if err := os.Rename(work, target); err != nil {
+		return result, fmt.Errorf("failed to replace database: %w", err)
+	}
+	s.resetProcessCache()
+	log.Printf("Restored database %s from %s", target, path)
+
+	result.Records = count
+	if wasOpen {
+		if err := s.initialize(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// mergeFrom 将 path 中当前数据库没有的进程、采样、主机指标、事件和汇总数据插入当前数据库
+// 采样按 (进程, 时间戳) 去重，返回新增的采样数
+func (s *SQLiteStorage) mergeFrom(ctx context.Context, path string) (int64, error) {
+	// ATTACH 不能在事务中执行，且只对当前连接有效
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS backup", path); err != nil {
+		return 0, fmt.Errorf("failed to attach backup: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE backup")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	steps := []struct{ name, sql string }{
+		{"processes", `
+			INSERT INTO processes (host, pid, create_time, ppid, name, command, working_dir, category, labels, uid, username)
+			SELECT host, pid, create_time, ppid, name, command, working_dir, category, labels, uid, username
+			FROM backup.processes WHERE true
+			ON CONFLICT (host, pid, create_time) DO NOTHING`},
+		{"samples", `
+			INSERT INTO samples (
+				process_id, timestamp, cpu_percent, cpu_percent_normalized,
+				memory_mb, memory_percent, threads, disk_read_mb, disk_write_mb,
+				net_sent_kb, net_recv_kb, is_active, cpu_time, created_at
+			)
+			SELECT p.id, b.timestamp, b.cpu_percent, b.cpu_percent_normalized,
+				b.memory_mb, b.memory_percent, b.threads, b.disk_read_mb, b.disk_write_mb,
+				b.net_sent_kb, b.net_recv_kb, b.is_active, b.cpu_time, b.created_at
+			FROM backup.samples b
+			JOIN backup.processes bp ON bp.id = b.process_id
+			JOIN main.processes p ON p.host = bp.host AND p.pid = bp.pid AND p.create_time = bp.create_time
+			WHERE NOT EXISTS (
+				SELECT 1 FROM main.samples s WHERE s.process_id = p.id AND s.timestamp = b.timestamp
+			)
+			ORDER BY b.timestamp, b.id`},
+		{"system_records", `
+			INSERT INTO system_records (
+				timestamp, load1, load5, load15, cpu_percent, cpu_user, cpu_system, cpu_nice, cpu_idle,
+				cpu_iowait, cpu_irq, cpu_steal, memory_total_mb, memory_used_mb, memory_available_mb,
+				memory_cached_mb, memory_buffers_mb, memory_percent, swap_total_mb, swap_used_mb,
+				psi_cpu_some, psi_memory_some, psi_memory_full, psi_io_some, psi_io_full, disks
+			)
+			SELECT timestamp, load1, load5, load15, cpu_percent, cpu_user, cpu_system, cpu_nice, cpu_idle,
+				cpu_iowait, cpu_irq, cpu_steal, memory_total_mb, memory_used_mb, memory_available_mb,
+				memory_cached_mb, memory_buffers_mb, memory_percent, swap_total_mb, swap_used_mb,
+				psi_cpu_some, psi_memory_some, psi_memory_full, psi_io_some, psi_io_full, disks
+			FROM backup.system_records b
+			WHERE NOT EXISTS (SELECT 1 FROM main.system_records s WHERE s.timestamp = b.timestamp)
+			ORDER BY b.timestamp`},
+		{"process_events", `
+			INSERT INTO process_events (
+				timestamp, type, pid, ppid, name, command, previous_command, category, create_time,
+				last_seen, lifetime_seconds, cpu_percent, memory_mb, threads, cpu_time
+			)
+			SELECT timestamp, type, pid, ppid, name, command, previous_command, category, create_time,
+				last_seen, lifetime_seconds, cpu_percent, memory_mb, threads, cpu_time
+			FROM backup.process_events b
+			WHERE NOT EXISTS (
+				SELECT 1 FROM main.process_events e
+				WHERE e.timestamp = b.timestamp AND e.type = b.type AND e.pid = b.pid
+			)
+			ORDER BY b.timestamp`},
+	}
+	// 汇总表以 (bucket, host, pid, name) 为主键，已存在的时间桶保留当前数据
+	for _, tier := range RollupTiers {
+		steps = append(steps, struct{ name, sql string }{
+			tier.Table, fmt.Sprintf("INSERT OR IGNORE INTO main.%s (host, %s) SELECT host, %s FROM backup.%s",
+				tier.Table, rollupColumns, rollupColumns, tier.Table),
+		})
+	}
+
+	var merged int64
+	for _, step := range steps {
+		res, err := tx.ExecContext(ctx, step.sql)
+		if err != nil {
+			return 0, fmt.Errorf("failed to merge %s: %w", step.name, err)
+		}
+		if step.name == "samples" {
+			merged, _ = res.RowsAffected()
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	log.Printf("Merged %d samples from %s", merged, path)
+	return merged, nil
+}
+
+// rollupColumns 汇总表的列（不含迁移8加入的 host），合并时显式列出而不依赖建表顺序
+const rollupColumns = `bucket, pid, name, category, username, samples, active_samples,
+	cpu_sum, cpu_max, cpu_min, cpu_normalized_sum, cpu_normalized_max, cpu_normalized_min,
+	memory_sum, memory_max, memory_min, disk_read_mb, disk_write_mb, net_sent_kb, net_recv_kb`
+
+// copyFile 复制文件内容
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,489 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// salvageChunkRows 抢救数据时每次按 rowid 复制的行数；整段失败时再逐行复制
+const salvageChunkRows = 1000
+
+// schemaObject 数据库中的一个表或索引
+type schemaObject struct {
+	Type  string
+	Name  string
+	Table string
+	SQL   string
+}
+
+// referenceSchema 在内存数据库中执行全部迁移，返回最新结构的表和索引（按创建顺序）
+func referenceSchema() ([]schemaObject, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// 内存数据库按连接独立，只使用一个连接
+	db.SetMaxOpenConns(1)
+
+	ref := &SQLiteStorage{db: db}
+	if err := ref.createMetaTable(); err != nil {
+		return nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, m := range schemaMigrations {
+		if err := m.Up(tx); err != nil {
+			return nil, fmt.Errorf("failed to build reference schema (migration %d): %w", m.Version, err)
+		}
+	}
+	return readSchemaObjects(tx)
+}
+
+// readSchemaObjects 读取数据库中的表和索引，不含SQLite内部对象和自动索引
+func readSchemaObjects(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}) ([]schemaObject, error) {
+	rows, err := q.Query(`
+		SELECT type, name, tbl_name, COALESCE(sql, '') FROM sqlite_master
+		WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'
+		ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	var objects []schemaObject
+	for rows.Next() {
+		var o schemaObject
+		if err := rows.Scan(&o.Type, &o.Name, &o.Table, &o.SQL); err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// CheckIntegrity 检查数据库：PRAGMA integrity_check、外键、与最新结构相比缺失的索引以及各表行数
+// repair 时：只有索引损坏则重建索引，删除引用不存在进程的行；表数据损坏时把可读的行抢救到
+// 按最新结构新建的数据库并替换原文件，原文件改名保留在同目录下
+func (s *SQLiteStorage) CheckIntegrity(repair bool) (IntegrityReport, error) {
+	report := IntegrityReport{Type: "sqlite", Repair: repair, OK: true}
+	path := expandSQLitePath(s.sqlitePath)
+	if _, err := os.Stat(path); err != nil {
+		return report, fmt.Errorf("database %s not found: %w", path, err)
+	}
+
+	// 检查不执行迁移；由本方法打开的连接在结束时关闭
+	wasOpen := s.db != nil
+	if !wasOpen {
+		if err := s.open(); err != nil {
+			return report, err
+		}
+		defer s.closeDB()
+	}
+
+	ref, err := referenceSchema()
+	if err != nil {
+		return report, err
+	}
+
+	check := FileCheck{Path: path, Kind: "database", Tables: make(map[string]int64)}
+	damaged, indexDamaged := s.integrityCheck(&check)
+	missing := s.missingIndexes(ref, &check)
+	orphans := s.foreignKeyCheck(&check)
+	searchMissing, searchDamaged := s.searchIndexCheck(ref, &check)
+	if s.countTables(ref, &check) {
+		damaged = true
+	}
+
+	if !repair || len(check.Problems) == 0 {
+		report.addFile(check)
+		return report, nil
+	}
+
+	if damaged {
+		// 抢救按最新结构建库；版本无法读取时按最新处理
+		if version, err := s.schemaVersion(); err == nil && version != LatestSchemaVersion() {
+			report.addFile(check)
+			return report, fmt.Errorf("cannot salvage database: schema version %d is not the latest (%d); run 'db migrate' first",
+				version, LatestSchemaVersion())
+		}
+		if err := s.salvage(path, ref, &check); err != nil {
+			report.addFile(check)
+			return report, err
+		}
+		if wasOpen {
+			if err := s.Initialize(); err != nil {
+				return report, err
+			}
+		}
+		report.addFile(check)
+		return report, nil
+	}
+
+	// 索引可以从表数据重建
+	if indexDamaged {
+		if _, err := s.db.Exec("REINDEX"); err != nil {
+			return report, fmt.Errorf("failed to rebuild indexes: %w", err)
+		}
+	}
+	for _, o := range missing {
+		if _, err := s.db.Exec(o.SQL); err != nil {
+			return report, fmt.Errorf("failed to create index %s: %w", o.Name, err)
+		}
+	}
+	if searchMissing {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return report, err
+		}
+		if err := createSearchIndex(tx); err != nil {
+			tx.Rollback()
+			return report, err
+		}
+		if err := tx.Commit(); err != nil {
+			return report, err
+		}
+	} else if searchDamaged {
+		if err := s.rebuildSearchIndex(); err != nil {
+			return report, err
+		}
+	}
+	for table, rowids := range orphans {
+		for _, rowid := range rowids {
+			if _, err := s.db.Exec("DELETE FROM "+table+" WHERE rowid = ?", rowid); err != nil {
+				return report, fmt.Errorf("failed to delete orphaned row from %s: %w", table, err)
+			}
+			check.Malformed++
+		}
+	}
+	s.resetProcessCache()
+	check.Repaired = true
+	report.addFile(check)
+	return report, nil
+}
+
+// integrityCheck 执行 PRAGMA integrity_check，返回表数据是否损坏、索引是否损坏
+func (s *SQLiteStorage) integrityCheck(check *FileCheck) (bool, bool) {
+	rows, err := s.db.Query("PRAGMA integrity_check(100)")
+	if err != nil {
+		check.problem("integrity_check failed: %v", err)
+		return true, false
+	}
+	defer rows.Close()
+
+	damaged, indexDamaged := false, false
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			check.problem("integrity_check failed: %v", err)
+			return true, indexDamaged
+		}
+		if message == "ok" {
+			continue
+		}
+		check.problem("%s", message)
+		// 只涉及索引的问题（缺少索引项、索引项数量不符等）可以用 REINDEX 修复
+		if strings.Contains(message, " index ") {
+			indexDamaged = true
+		} else {
+			damaged = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		check.problem("integrity_check failed: %v", err)
+		damaged = true
+	}
+	return damaged, indexDamaged
+}
+
+// missingIndexes 返回最新结构中有、数据库中缺失的索引
+func (s *SQLiteStorage) missingIndexes(ref []schemaObject, check *FileCheck) []schemaObject {
+	current, err := readSchemaObjects(s.db)
+	if err != nil {
+		check.problem("%v", err)
+		return nil
+	}
+	existing := make(map[string]bool)
+	for _, o := range current {
+		existing[o.Name] = true
+	}
+
+	var missing []schemaObject
+	for _, o := range ref {
+		if o.Type == "index" && o.SQL != "" && !existing[o.Name] {
+			check.problem("missing index %s on %s", o.Name, o.Table)
+			missing = append(missing, o)
+		}
+	}
+	return missing
+}
+
+// searchIndexCheck 检查全文索引：返回是否缺失、是否与 processes 表不一致（两者都可在原库上重建）
+func (s *SQLiteStorage) searchIndexCheck(ref []schemaObject, check *FileCheck) (bool, bool) {
+	expected := false
+	for _, o := range ref {
+		if o.Name == searchTable {
+			expected = true
+		}
+	}
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", searchTable).Scan(&exists); err != nil {
+		check.problem("failed to read schema: %v", err)
+		return false, false
+	}
+	if exists == 0 {
+		if expected {
+			check.problem("missing search index %s", searchTable)
+		}
+		return expected, false
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO process_search (process_search) VALUES ('integrity-check')`); err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			// 当前程序缺少创建索引时使用的全文模块，无法检查
+			return false, false
+		}
+		check.problem("search index %s is damaged: %v", searchTable, err)
+		return false, true
+	}
+	return false, false
+}
+
+// foreignKeyCheck 返回引用不存在父行的行（表名 -> rowid）
+func (s *SQLiteStorage) foreignKeyCheck(check *FileCheck) map[string][]int64 {
+	rows, err := s.db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		check.problem("foreign_key_check failed: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	orphans := make(map[string][]int64)
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			check.problem("foreign_key_check failed: %v", err)
+			return orphans
+		}
+		if rowid.Valid {
+			if len(orphans[table]) == 0 {
+				check.problem("rows in %s reference missing rows in %s", table, parent)
+			}
+			orphans[table] = append(orphans[table], rowid.Int64)
+		}
+	}
+	return orphans
+}
+
+// countTables 统计最新结构中各表的行数，返回是否有表无法完整读取
+func (s *SQLiteStorage) countTables(ref []schemaObject, check *FileCheck) bool {
+	damaged := false
+	for _, o := range ref {
+		if o.Type != "table" || isSearchTable(o.Name) {
+			continue
+		}
+		var n int64
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + o.Name).Scan(&n); err != nil {
+			if strings.Contains(err.Error(), "no such table") {
+				check.problem("missing table %s", o.Name)
+			} else {
+				check.problem("failed to read %s: %v", o.Name, err)
+			}
+			damaged = true
+			continue
+		}
+		check.Tables[o.Name] = n
+	}
+	check.Records = check.Tables["samples"]
+	return damaged
+}
+
+// salvage 把损坏数据库中可读的行复制到按最新结构新建的数据库，替换原文件
+// 原文件（连同 -wal、-shm）改名为 <路径>.corrupt-<时间> 保留
+func (s *SQLiteStorage) salvage(path string, ref []schemaObject, check *FileCheck) error {
+	stamp := time.Now().Format("20060102-150405")
+	salvagePath := path + ".salvage-" + stamp
+	log.Printf("Salvaging readable rows of %s into a new database", path)
+
+	config := s.config
+	config.SQLitePath = salvagePath
+	fresh := NewSQLiteStorage(s.dataFile, s.bufferSize, config)
+	if err := fresh.Initialize(); err != nil {
+		os.Remove(salvagePath)
+		return fmt.Errorf("failed to create salvage database: %w", err)
+	}
+
+	copied, lost, err := fresh.copyFrom(path, ref)
+	fresh.Close()
+	if err != nil {
+		removeSQLiteFiles(salvagePath)
+		return err
+	}
+	check.Tables = copied
+	check.Records = copied["samples"]
+	check.Malformed = lost
+
+	// 替换原文件
+	s.closeDB()
+	corruptPath := path + ".corrupt-" + stamp
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, corruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to move damaged database aside: %w", err)
+		}
+	}
+	if err := os.Rename(salvagePath, path); err != nil {
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+	check.Quarantine = corruptPath
+	check.Repaired = true
+	log.Printf("Rebuilt %s (%d rows could not be read); damaged database kept as %s", path, lost, corruptPath)
+	return nil
+}
+
+// copyFrom 从损坏的数据库复制最新结构中各表的共同列，返回各表复制的行数和无法读取的行数
+func (s *SQLiteStorage) copyFrom(damagedPath string, ref []schemaObject) (map[string]int64, int64, error) {
+	// ATTACH 只对当前连接生效
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS damaged", damagedPath); err != nil {
+		return nil, 0, fmt.Errorf("failed to attach damaged database: %w", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE damaged")
+
+	// 被引用的表先复制：重建过的表（如迁移8的 processes）在 sqlite_master 中排在引用它的表之后
+	var tables []schemaObject
+	for _, o := range ref {
+		// 全文索引由新库中 processes 表的触发器随复制重新建立
+		if o.Type == "table" && !isSearchTable(o.Name) {
+			tables = append(tables, o)
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return !strings.Contains(tables[i].SQL, "REFERENCES") && strings.Contains(tables[j].SQL, "REFERENCES")
+	})
+
+	copied := make(map[string]int64)
+	var lost int64
+	for _, o := range tables {
+		columns, err := commonColumns(ctx, conn, o.Name)
+		if err != nil || len(columns) == 0 {
+			log.Printf("Warning: skipping %s: %v", o.Name, err)
+			continue
+		}
+		n, l := salvageTable(ctx, conn, o.Name, strings.Join(columns, ", "))
+		copied[o.Name] = n
+		lost += l
+	}
+	return copied, lost, nil
+}
+
+// commonColumns 返回新旧数据库中同一张表都有的列
+func commonColumns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	read := func(schema string) ([]string, error) {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT name FROM pragma_table_info('%s', '%s')", table, schema))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		return names, rows.Err()
+	}
+
+	fresh, err := read("main")
+	if err != nil {
+		return nil, err
+	}
+	old, err := read("damaged")
+	if err != nil {
+		return nil, err
+	}
+	inOld := make(map[string]bool)
+	for _, name := range old {
+		inOld[name] = true
+	}
+	var columns []string
+	for _, name := range fresh {
+		if inOld[name] {
+			columns = append(columns, name)
+		}
+	}
+	return columns, nil
+}
+
+// salvageTable 复制一张表：先整表复制，失败时按 rowid 分段，分段失败时逐行，跳过无法读取的行
+// storage_meta 沿用旧库的值，但保留新库中的结构版本
+func salvageTable(ctx context.Context, conn *sql.Conn, table, columns string) (int64, int64) {
+	insert := fmt.Sprintf("INSERT OR IGNORE INTO main.%s (%s) SELECT %s FROM damaged.%s", table, columns, columns, table)
+	where := " WHERE "
+	if table == "storage_meta" {
+		insert = fmt.Sprintf("INSERT OR REPLACE INTO main.%s (%s) SELECT %s FROM damaged.%s WHERE key NOT LIKE 'schema_%%'",
+			table, columns, columns, table)
+		where = " AND "
+	}
+
+	exec := func(query string, args ...interface{}) (int64, error) {
+		res, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	if n, err := exec(insert); err == nil {
+		return n, 0
+	}
+
+	var maxRowid sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT MAX(rowid) FROM damaged."+table).Scan(&maxRowid); err != nil || !maxRowid.Valid {
+		log.Printf("Warning: no readable rows in %s: %v", table, err)
+		return 0, 0
+	}
+
+	var copied, lost int64
+	for lo := int64(0); lo <= maxRowid.Int64; lo += salvageChunkRows {
+		hi := lo + salvageChunkRows - 1
+		if n, err := exec(insert+where+"rowid BETWEEN ? AND ?", lo, hi); err == nil {
+			copied += n
+			continue
+		}
+		for rowid := lo; rowid <= hi && rowid <= maxRowid.Int64; rowid++ {
+			if n, err := exec(insert+where+"rowid = ?", rowid); err == nil {
+				copied += n
+			} else {
+				lost++
+			}
+		}
+	}
+	return copied, lost
+}
+
+// removeSQLiteFiles 删除数据库文件及其 -wal、-shm 文件
+func removeSQLiteFiles(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+}
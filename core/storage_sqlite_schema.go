@@ -0,0 +1,367 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 规范化表结构：
+//   processes  进程维度表，按 (host, pid, create_time) 唯一，保存名称、命令、工作目录等静态属性
+//   samples    窄的采样表，只保存数值指标并通过 process_id 引用进程
+//   resource_records 兼容视图，保持旧的一行一条完整记录的形状，供查询和汇总使用
+
+const createProcessesSQL = `
+CREATE TABLE IF NOT EXISTS processes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pid INTEGER NOT NULL,
+	create_time INTEGER NOT NULL DEFAULT 0,
+	ppid INTEGER,
+	name TEXT NOT NULL,
+	command TEXT,
+	working_dir TEXT,
+	category TEXT,
+	labels TEXT,
+	uid INTEGER,
+	username TEXT,
+	UNIQUE (pid, create_time)
+);`
+
+const createSamplesSQL = `
+CREATE TABLE IF NOT EXISTS samples (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	process_id INTEGER NOT NULL REFERENCES processes(id),
+	timestamp DATETIME NOT NULL,
+	cpu_percent REAL NOT NULL,
+	cpu_percent_normalized REAL NOT NULL,
+	memory_mb REAL NOT NULL,
+	memory_percent REAL NOT NULL,
+	threads INTEGER NOT NULL,
+	disk_read_mb REAL NOT NULL,
+	disk_write_mb REAL NOT NULL,
+	net_sent_kb REAL NOT NULL,
+	net_recv_kb REAL NOT NULL,
+	is_active BOOLEAN NOT NULL,
+	cpu_time REAL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+// createHostProcessesSQL 加入 host 后的进程维度表（迁移8），本机记录的 host 为空字符串
+const createHostProcessesSQL = `
+CREATE TABLE %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	host TEXT NOT NULL DEFAULT '',
+	pid INTEGER NOT NULL,
+	create_time INTEGER NOT NULL DEFAULT 0,
+	ppid INTEGER,
+	name TEXT NOT NULL,
+	command TEXT,
+	working_dir TEXT,
+	category TEXT,
+	labels TEXT,
+	uid INTEGER,
+	username TEXT,
+	UNIQUE (host, pid, create_time)
+);`
+
+// createRecordsViewSQL 兼容视图，列名与旧的 resource_records 表一致（迁移3）
+const createRecordsViewSQL = `
+CREATE VIEW IF NOT EXISTS resource_records AS
+SELECT
+	s.id AS id,
+	s.timestamp AS timestamp,
+	p.name AS name,
+	s.cpu_percent AS cpu_percent,
+	s.cpu_percent_normalized AS cpu_percent_normalized,
+	s.memory_mb AS memory_mb,
+	s.memory_percent AS memory_percent,
+	s.threads AS threads,
+	s.disk_read_mb AS disk_read_mb,
+	s.disk_write_mb AS disk_write_mb,
+	s.net_sent_kb AS net_sent_kb,
+	s.net_recv_kb AS net_recv_kb,
+	s.is_active AS is_active,
+	p.command AS command,
+	p.working_dir AS working_dir,
+	p.category AS category,
+	p.pid AS pid,
+	p.ppid AS ppid,
+	p.create_time AS create_time,
+	s.cpu_time AS cpu_time,
+	p.labels AS labels,
+	p.uid AS uid,
+	p.username AS username,
+	s.created_at AS created_at
+FROM samples s
+JOIN processes p ON p.id = s.process_id;`
+
+// createHostRecordsViewSQL 加入 host 列的兼容视图（迁移8）
+const createHostRecordsViewSQL = `
+CREATE VIEW resource_records AS
+SELECT
+	s.id AS id,
+	s.timestamp AS timestamp,
+	p.name AS name,
+	s.cpu_percent AS cpu_percent,
+	s.cpu_percent_normalized AS cpu_percent_normalized,
+	s.memory_mb AS memory_mb,
+	s.memory_percent AS memory_percent,
+	s.threads AS threads,
+	s.disk_read_mb AS disk_read_mb,
+	s.disk_write_mb AS disk_write_mb,
+	s.net_sent_kb AS net_sent_kb,
+	s.net_recv_kb AS net_recv_kb,
+	s.is_active AS is_active,
+	p.command AS command,
+	p.working_dir AS working_dir,
+	p.category AS category,
+	p.pid AS pid,
+	p.ppid AS ppid,
+	p.create_time AS create_time,
+	s.cpu_time AS cpu_time,
+	p.labels AS labels,
+	p.uid AS uid,
+	p.username AS username,
+	p.host AS host,
+	s.created_at AS created_at
+FROM samples s
+JOIN processes p ON p.id = s.process_id;`
+
+// processAttrs 进程的静态属性，写入维度表时使用
+type processAttrs struct {
+	PPID       int32
+	Name       string
+	Command    string
+	WorkingDir string
+	Category   string
+	Labels     string
+	UID        int32
+	Username   string
+}
+
+// cachedProcess 已写入维度表的进程及其属性
+type cachedProcess struct {
+	id    int64
+	attrs processAttrs
+}
+
+func recordProcessAttrs(r ResourceRecord) processAttrs {
+	return processAttrs{
+		PPID:       r.PPID,
+		Name:       r.Name,
+		Command:    r.Command,
+		WorkingDir: r.WorkingDir,
+		Category:   r.Category,
+		Labels:     FormatLabels(r.Labels),
+		UID:        r.UID,
+		Username:   r.Username,
+	}
+}
+
+// createRecordTables 创建进程维度表和采样表
+func createRecordTables(tx *sql.Tx) error {
+	if _, err := tx.Exec(createProcessesSQL); err != nil {
+		return fmt.Errorf("failed to create processes table: %w", err)
+	}
+	if _, err := tx.Exec(createSamplesSQL); err != nil {
+		return fmt.Errorf("failed to create samples table: %w", err)
+	}
+	return nil
+}
+
+// hasLegacyRecordsTable 判断 resource_records 是否仍是旧版本的宽表
+func hasLegacyRecordsTable(tx *sql.Tx) (bool, error) {
+	var kind string
+	err := tx.QueryRow("SELECT type FROM sqlite_master WHERE name = 'resource_records'").Scan(&kind)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect resource_records: %w", err)
+	}
+	return kind == "table", nil
+}
+
+// addLegacyRecordColumns 为更早版本的宽表补齐 labels/uid/username 列
+func addLegacyRecordColumns(tx *sql.Tx) error {
+	legacy, err := hasLegacyRecordsTable(tx)
+	if err != nil || !legacy {
+		return err
+	}
+
+	legacyColumns := []struct{ name, definition string }{
+		{"labels", "TEXT"},
+		{"uid", "INTEGER"},
+		{"username", "TEXT"},
+	}
+	for _, col := range legacyColumns {
+		if err := ensureColumn(tx, "resource_records", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeRecords 将旧的宽表拆分为 processes 和 samples 并删除旧表，然后创建兼容视图
+// 同一进程的属性取最早一条记录（与运行时写入一致，只更新 ppid）；采样保留原有的 id，因此游标和排序不受影响
+func normalizeRecords(tx *sql.Tx) error {
+	legacy, err := hasLegacyRecordsTable(tx)
+	if err != nil {
+		return err
+	}
+
+	if legacy {
+		steps := []struct{ name, sql string }{
+			{"processes", `
+				INSERT INTO processes (pid, create_time, ppid, name, command, working_dir, category, labels, uid, username)
+				SELECT pid, COALESCE(create_time, 0), ppid, name, command, working_dir, category, labels, uid, username
+				FROM resource_records WHERE true ORDER BY id
+				ON CONFLICT (pid, create_time) DO UPDATE SET ppid = excluded.ppid`},
+			{"samples", `
+				INSERT INTO samples (
+					id, process_id, timestamp, cpu_percent, cpu_percent_normalized,
+					memory_mb, memory_percent, threads, disk_read_mb, disk_write_mb,
+					net_sent_kb, net_recv_kb, is_active, cpu_time, created_at
+				)
+				SELECT r.id, p.id, r.timestamp, r.cpu_percent, r.cpu_percent_normalized,
+					r.memory_mb, r.memory_percent, r.threads, r.disk_read_mb, r.disk_write_mb,
+					r.net_sent_kb, r.net_recv_kb, r.is_active, r.cpu_time, r.created_at
+				FROM resource_records r
+				JOIN processes p ON p.pid = r.pid AND p.create_time = COALESCE(r.create_time, 0)
+				ORDER BY r.id`},
+			{"drop", "DROP TABLE resource_records"},
+		}
+
+		var migrated int64
+		for _, step := range steps {
+			result, err := tx.Exec(step.sql)
+			if err != nil {
+				return fmt.Errorf("failed to migrate resource_records (%s): %w", step.name, err)
+			}
+			if step.name == "samples" {
+				migrated, _ = result.RowsAffected()
+			}
+		}
+		log.Printf("Migrated %d records into processes/samples tables", migrated)
+	}
+
+	if _, err := tx.Exec(createRecordsViewSQL); err != nil {
+		return fmt.Errorf("failed to create resource_records view: %w", err)
+	}
+	return nil
+}
+
+// addRecordHost 为进程维度表和汇总表加入 host 列，进程的唯一键改为 (host, pid, create_time)
+// SQLite 不能修改唯一约束，因此按原 id 复制到新表后替换；已有数据的 host 为空字符串（本机）。
+// 采样表通过 id 引用进程，全文索引以 id 为 rowid，复制后都保持有效，只需重建随旧表删除的触发器和索引
+func addRecordHost(tx *sql.Tx) error {
+	const columns = "id, pid, create_time, ppid, name, command, working_dir, category, labels, uid, username"
+	steps := []struct{ name, sql string }{
+		{"drop view", "DROP VIEW IF EXISTS resource_records"},
+		{"create processes", fmt.Sprintf(createHostProcessesSQL, "processes_host")},
+		{"copy processes", "INSERT INTO processes_host (" + columns + ") SELECT " + columns + " FROM processes"},
+		{"drop processes", "DROP TABLE processes"},
+		{"rename processes", "ALTER TABLE processes_host RENAME TO processes"},
+		{"create view", createHostRecordsViewSQL},
+		{"index name", "CREATE INDEX IF NOT EXISTS idx_processes_name ON processes(name)"},
+		{"index username", "CREATE INDEX IF NOT EXISTS idx_processes_username ON processes(username)"},
+		{"index host", "CREATE INDEX IF NOT EXISTS idx_processes_host ON processes(host)"},
+	}
+	for _, tier := range RollupTiers {
+		steps = append(steps,
+			struct{ name, sql string }{tier.Table, createRollupTableSQL(tier.Table+"_host", true)},
+			struct{ name, sql string }{tier.Table, fmt.Sprintf("INSERT INTO %s_host (%s) SELECT %s FROM %s",
+				tier.Table, rollupColumns, rollupColumns, tier.Table)},
+			struct{ name, sql string }{tier.Table, "DROP TABLE " + tier.Table},
+			struct{ name, sql string }{tier.Table, fmt.Sprintf("ALTER TABLE %s_host RENAME TO %s", tier.Table, tier.Table)},
+		)
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.sql); err != nil {
+			return fmt.Errorf("failed to add host column (%s): %w", step.name, err)
+		}
+	}
+
+	// 全文索引的维护触发器随旧表删除，按已建立的模块重新创建
+	var createSQL string
+	err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE name = ?", searchTable).Scan(&createSQL)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect search index: %w", err)
+	}
+	for _, index := range searchIndexSQL {
+		if !strings.Contains(strings.ToLower(createSQL), "using "+index.module) {
+			continue
+		}
+		for _, trigger := range index.triggers {
+			if _, err := tx.Exec(trigger); err != nil {
+				return fmt.Errorf("failed to restore search index trigger: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueSamples 删除重复的采样（保留最早写入的一条）并为 (进程, 时间戳) 建立唯一索引
+// 代理重发的批次或重放的日志因此不会重复计数，写入时忽略已存在的采样
+func uniqueSamples(tx *sql.Tx) error {
+	steps := []struct{ name, sql string }{
+		{"duplicates", `DELETE FROM samples WHERE id NOT IN (SELECT MIN(id) FROM samples GROUP BY process_id, timestamp)`},
+		{"drop index", "DROP INDEX IF EXISTS idx_samples_process_id"},
+		{"unique index", "CREATE UNIQUE INDEX IF NOT EXISTS idx_samples_process_time ON samples(process_id, timestamp)"},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.sql); err != nil {
+			return fmt.Errorf("failed to make samples unique (%s): %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// processID 返回记录所属进程在维度表中的 id
+// 维度表保留进程首次出现时的属性，之后只更新 ppid（父进程退出后会被重新挂接）；
+// 命令行或工作目录的变化由 cmdline_changed 事件记录，不改写已有的进程行
+// 调用方需持有 s.mu
+func (s *SQLiteStorage) processID(tx *sql.Tx, r ResourceRecord) (int64, error) {
+	key := recordProcessKey(r)
+	attrs := recordProcessAttrs(r)
+	if cached, ok := s.processes[key]; ok && cached.attrs.PPID == attrs.PPID {
+		return cached.id, nil
+	}
+
+	var id int64
+	err := tx.QueryRow(`
+		INSERT INTO processes (host, pid, create_time, ppid, name, command, working_dir, category, labels, uid, username)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (host, pid, create_time) DO UPDATE SET ppid = excluded.ppid
+		RETURNING id`,
+		r.Host, r.PID, r.CreateTime, attrs.PPID, attrs.Name, attrs.Command, attrs.WorkingDir,
+		attrs.Category, attrs.Labels, attrs.UID, attrs.Username,
+	).Scan(&id)
+	if err != nil {
+		return 0, s.searchModuleError(fmt.Errorf("failed to upsert process: %w", err))
+	}
+
+	s.processes[key] = cachedProcess{id: id, attrs: attrs}
+	return id, nil
+}
+
+// deleteOrphanProcesses 删除已没有任何采样的进程
+func (s *SQLiteStorage) deleteOrphanProcesses() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec("DELETE FROM processes WHERE id NOT IN (SELECT DISTINCT process_id FROM samples)"); err != nil {
+		return s.searchModuleError(fmt.Errorf("failed to delete orphan processes: %w", err))
+	}
+	s.processes = make(map[processKey]cachedProcess)
+	return nil
+}
+
+// resetProcessCache 清空进程缓存（事务回滚后缓存的 id 可能无效）
+func (s *SQLiteStorage) resetProcessCache() {
+	s.processes = make(map[processKey]cachedProcess)
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// searchTable 命令行和工作目录的全文索引（外部内容表，内容来自 processes，rowid 即 processes.id）
+const searchTable = "process_search"
+
+// 优先使用 FTS5（需以 -tags sqlite_fts5 编译），否则使用默认编译进来的 FTS4，两者的 MATCH 语法在这里的用法上一致
+var searchIndexSQL = []struct {
+	module   string
+	create   string
+	triggers []string
+}{
+	{
+		module: "fts5",
+		create: `CREATE VIRTUAL TABLE process_search USING fts5(command, working_dir, content='processes', content_rowid='id')`,
+		triggers: []string{
+			`CREATE TRIGGER IF NOT EXISTS process_search_insert AFTER INSERT ON processes BEGIN
+				INSERT INTO process_search (rowid, command, working_dir) VALUES (new.id, new.command, new.working_dir);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS process_search_delete AFTER DELETE ON processes BEGIN
+				INSERT INTO process_search (process_search, rowid, command, working_dir) VALUES ('delete', old.id, old.command, old.working_dir);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS process_search_update AFTER UPDATE OF command, working_dir ON processes BEGIN
+				INSERT INTO process_search (process_search, rowid, command, working_dir) VALUES ('delete', old.id, old.command, old.working_dir);
+				INSERT INTO process_search (rowid, command, working_dir) VALUES (new.id, new.command, new.working_dir);
+			END`,
+		},
+	},
+	{
+		module: "fts4",
+		create: `CREATE VIRTUAL TABLE process_search USING fts4(content='processes', command, working_dir, tokenize=unicode61)`,
+		triggers: []string{
+			`CREATE TRIGGER IF NOT EXISTS process_search_insert AFTER INSERT ON processes BEGIN
+				INSERT INTO process_search (docid, command, working_dir) VALUES (new.id, new.command, new.working_dir);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS process_search_delete BEFORE DELETE ON processes BEGIN
+				DELETE FROM process_search WHERE docid = old.id;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS process_search_update_before BEFORE UPDATE OF command, working_dir ON processes BEGIN
+				DELETE FROM process_search WHERE docid = old.id;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS process_search_update AFTER UPDATE OF command, working_dir ON processes BEGIN
+				INSERT INTO process_search (docid, command, working_dir) VALUES (new.id, new.command, new.working_dir);
+			END`,
+		},
+	},
+}
+
+// createSearchIndex 创建全文索引和维护它的触发器，并为已有进程建立索引
+// 两种全文模块都不可用时不建索引，搜索退回到 LIKE 子串匹配
+func createSearchIndex(tx *sql.Tx) error {
+	for _, index := range searchIndexSQL {
+		if _, err := tx.Exec(index.create); err != nil {
+			if strings.Contains(err.Error(), "no such module") {
+				continue
+			}
+			return fmt.Errorf("failed to create %s search index: %w", index.module, err)
+		}
+		for _, trigger := range index.triggers {
+			if _, err := tx.Exec(trigger); err != nil {
+				return fmt.Errorf("failed to create search index trigger: %w", err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO process_search (process_search) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
+		return nil
+	}
+	log.Printf("Warning: SQLite has neither FTS5 nor FTS4, command search will scan process rows")
+	return nil
+}
+
+// isSearchTable 判断是否为全文索引表或其影子表（由全文模块维护，不单独复制或统计）
+func isSearchTable(name string) bool {
+	return name == searchTable || strings.HasPrefix(name, searchTable+"_")
+}
+
+// detectSearchIndex 检查全文索引是否可用
+// 数据库由带 FTS5 的程序创建、当前程序却没有 FTS5 时不修改表结构：搜索退回到 LIKE，
+// 维护触发器保留，写入新进程会失败并提示需要 -tags sqlite_fts5（见 searchModuleError）。
+// 旧版本曾在这种情况下删除触发器，触发器缺失时重建触发器和索引
+func (s *SQLiteStorage) detectSearchIndex() {
+	s.searchIndex = false
+	var createSQL string
+	if err := s.db.QueryRow("SELECT sql FROM sqlite_master WHERE name = ?", searchTable).Scan(&createSQL); err != nil {
+		return
+	}
+	if _, err := s.db.Exec("SELECT rowid FROM " + searchTable + " LIMIT 0"); err != nil {
+		log.Printf("Warning: search index unavailable (%v), command search will scan process rows "+
+			"and new processes cannot be stored; build with -tags sqlite_fts5", err)
+		return
+	}
+
+	var triggers int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'process_search_insert'").Scan(&triggers); err != nil {
+		return
+	}
+	if triggers == 0 {
+		if err := s.restoreSearchTriggers(createSQL); err != nil {
+			log.Printf("Warning: %v, command search will scan process rows", err)
+			return
+		}
+	}
+	s.searchIndex = true
+}
+
+// restoreSearchTriggers 重新创建维护触发器并重建索引
+func (s *SQLiteStorage) restoreSearchTriggers(createSQL string) error {
+	for _, index := range searchIndexSQL {
+		if !strings.Contains(strings.ToLower(createSQL), "using "+index.module) {
+			continue
+		}
+		for _, trigger := range index.triggers {
+			if _, err := s.db.Exec(trigger); err != nil {
+				return fmt.Errorf("failed to restore search index trigger: %w", err)
+			}
+		}
+		log.Printf("Rebuilding command search index")
+		return s.rebuildSearchIndex()
+	}
+	return fmt.Errorf("unknown search index module")
+}
+
+// searchModuleError 说明写入进程失败是因为当前程序缺少数据库全文索引使用的模块
+func (s *SQLiteStorage) searchModuleError(err error) error {
+	if err == nil || !strings.Contains(err.Error(), "no such module") {
+		return err
+	}
+	return fmt.Errorf("%w: the command search index of %s was created with SQLite FTS5, "+
+		"which this build lacks; build with -tags sqlite_fts5 (see build.sh)", err, s.sqlitePath)
+}
+
+// rebuildSearchIndex 从 processes 表重建全文索引
+func (s *SQLiteStorage) rebuildSearchIndex() error {
+	if _, err := s.db.Exec(`INSERT INTO process_search (process_search) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
+}
+
+// textCondition 生成命令行/工作目录的搜索条件
+// 有全文索引时每个查询词作为一个短语匹配；否则每个词按子串匹配（LIKE 不区分 ASCII 大小写）
+func (s *SQLiteStorage) textCondition(text string) (string, []interface{}) {
+	words := parseSearchText(text)
+	if s.searchIndex {
+		phrases := make([]string, 0, len(words))
+		for _, w := range words {
+			phrases = append(phrases, `"`+strings.Join(w.tokens, " ")+`"`)
+		}
+		return "(host, pid, create_time) IN (SELECT host, pid, create_time FROM processes WHERE id IN " +
+				"(SELECT rowid FROM " + searchTable + " WHERE " + searchTable + " MATCH ?))",
+			[]interface{}{strings.Join(phrases, " ")}
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, w := range words {
+		pattern := "%" + escapeLike(w.text) + "%"
+		conditions = append(conditions, `(command LIKE ? ESCAPE '\' OR working_dir LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,520 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// createTaskTables 创建任务、任务运行记录和任务事件表
+func createTaskTables(tx *sql.Tx) error {
+	statements := []string{`
+	CREATE TABLE IF NOT EXISTS tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		command TEXT NOT NULL,
+		status TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		root_pid INTEGER NOT NULL DEFAULT 0,
+		process_count INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		started_at DATETIME,
+		completed_at DATETIME,
+		total_cpu REAL NOT NULL DEFAULT 0,
+		total_memory REAL NOT NULL DEFAULT 0,
+		total_disk_io REAL NOT NULL DEFAULT 0,
+		total_net_io REAL NOT NULL DEFAULT 0,
+		exit_code INTEGER,
+		error_message TEXT,
+		tags TEXT,
+		work_dir TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`, `
+	CREATE TABLE IF NOT EXISTS task_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL REFERENCES tasks(id),
+		started_at DATETIME NOT NULL,
+		completed_at DATETIME,
+		root_pid INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		exit_code INTEGER,
+		error_message TEXT,
+		UNIQUE (task_id, started_at)
+	);`, `
+	CREATE TABLE IF NOT EXISTS task_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		data TEXT
+	);`,
+		"CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status)",
+		"CREATE INDEX IF NOT EXISTS idx_task_events_task ON task_events(task_id, timestamp)",
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create task tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// createTaskSampleTable 创建任务资源时间序列表
+func createTaskSampleTable(tx *sql.Tx) error {
+	statements := []string{`
+	CREATE TABLE IF NOT EXISTS task_samples (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		timestamp DATETIME NOT NULL,
+		cpu REAL NOT NULL DEFAULT 0,
+		memory_mb REAL NOT NULL DEFAULT 0,
+		disk_io_mb REAL NOT NULL DEFAULT 0,
+		net_io_kb REAL NOT NULL DEFAULT 0,
+		process_count INTEGER NOT NULL DEFAULT 0
+	);`,
+		"CREATE INDEX IF NOT EXISTS idx_task_samples_task ON task_samples(task_id, timestamp)",
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create task sample table: %w", err)
+		}
+	}
+	return nil
+}
+
+// TaskRun 任务的一次运行
+type TaskRun struct {
+	TaskID       int        `json:"task_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	RootPID      int32      `json:"root_pid"`
+	Status       TaskStatus `json:"status"`
+	ExitCode     *int       `json:"exit_code"`
+	ErrorMessage string     `json:"error_message"`
+}
+
+// SQLiteTaskStorage 将任务保存在SQLite数据库中，与进程记录共用同一个数据库
+// 每次保存只更新一行，多个进程（start 和 web）可以同时读写；任务ID由数据库分配
+type SQLiteTaskStorage struct {
+	storage    *SQLiteStorage
+	importPath string // 首次使用时导入的旧 tasks.json
+
+	mu       sync.Mutex
+	imported bool
+}
+
+// NewSQLiteTaskStorage 创建SQLite任务存储；数据库尚未打开时在第一次使用时打开
+func NewSQLiteTaskStorage(storage *SQLiteStorage, importPath string) *SQLiteTaskStorage {
+	return &SQLiteTaskStorage{storage: storage, importPath: importPath}
+}
+
+// db 返回数据库连接并确保完成 tasks.json 的导入
+// 数据库可能尚未由 App.Initialize 打开；存储关闭后返回错误，不会重新打开和迁移
+func (ts *SQLiteTaskStorage) db() (*sql.DB, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	db, err := ts.storage.openedDB()
+	if err != nil {
+		return nil, err
+	}
+	if !ts.imported {
+		if err := ts.importTaskFile(db); err != nil {
+			log.Printf("Warning: failed to import %s: %v", ts.importPath, err)
+		}
+		ts.imported = true
+	}
+	return db, nil
+}
+
+// importTaskFile 一次性导入旧的 tasks.json，导入后重命名为 tasks.json.imported
+// 已存在的任务ID不会被覆盖，导入中断后重复执行是安全的
+func (ts *SQLiteTaskStorage) importTaskFile(db *sql.DB) error {
+	if ts.importPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(ts.importPath); err != nil {
+		return nil
+	}
+
+	tasks, err := NewTaskStorageFile(ts.importPath).LoadTasks()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, task := range tasks {
+		if err := upsertTask(tx, task, false); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	log.Printf("Imported %d tasks from %s", len(tasks), ts.importPath)
+	return os.Rename(ts.importPath, ts.importPath+".imported")
+}
+
+// taskColumns tasks 表中除 id 外由 Task 写入的列
+const taskColumns = `name, command, status, priority, root_pid, process_count, created_at,
+	started_at, completed_at, total_cpu, total_memory, total_disk_io, total_net_io,
+	exit_code, error_message, tags, work_dir`
+
+// taskValues 按 taskColumns 的顺序返回任务字段
+func taskValues(task *Task) []interface{} {
+	tags, _ := json.Marshal(task.Tags)
+	return []interface{}{
+		task.Name, task.Command, string(task.Status), task.Priority, task.RootPID, task.ProcessCount,
+		task.CreatedAt, task.StartedAt, task.CompletedAt, task.TotalCPU, task.TotalMemory,
+		task.TotalDiskIO, task.TotalNetIO, task.ExitCode, task.ErrorMessage, string(tags), task.WorkDir,
+	}
+}
+
+// upsertTask 按ID写入任务；overwrite 为 false 时保留已存在的任务
+// 任务已开始时同时写入对应的运行记录
+func upsertTask(tx *sql.Tx, task *Task, overwrite bool) error {
+	conflict := "DO NOTHING"
+	if overwrite {
+		conflict = `DO UPDATE SET
+			name = excluded.name, command = excluded.command, status = excluded.status,
+			priority = excluded.priority, root_pid = excluded.root_pid, process_count = excluded.process_count,
+			started_at = excluded.started_at, completed_at = excluded.completed_at,
+			total_cpu = excluded.total_cpu, total_memory = excluded.total_memory,
+			total_disk_io = excluded.total_disk_io, total_net_io = excluded.total_net_io,
+			exit_code = excluded.exit_code, error_message = excluded.error_message,
+			tags = excluded.tags, work_dir = excluded.work_dir, updated_at = CURRENT_TIMESTAMP`
+	}
+
+	args := append([]interface{}{task.ID}, taskValues(task)...)
+	_, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO tasks (id, %s) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) %s`, taskColumns, conflict), args...)
+	if err != nil {
+		return fmt.Errorf("failed to save task %d: %w", task.ID, err)
+	}
+	return saveTaskRun(tx, task)
+}
+
+// saveTaskRun 写入或更新任务当前这次运行（以开始时间区分）
+func saveTaskRun(tx *sql.Tx, task *Task) error {
+	if task.StartedAt == nil {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO task_runs (task_id, started_at, completed_at, root_pid, status, exit_code, error_message)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (task_id, started_at) DO UPDATE SET
+			completed_at = excluded.completed_at, root_pid = excluded.root_pid, status = excluded.status,
+			exit_code = excluded.exit_code, error_message = excluded.error_message`,
+		task.ID, *task.StartedAt, task.CompletedAt, task.RootPID, string(task.Status), task.ExitCode, task.ErrorMessage)
+	if err != nil {
+		return fmt.Errorf("failed to save run of task %d: %w", task.ID, err)
+	}
+	return nil
+}
+
+// InsertTask 写入新任务，由数据库分配任务ID
+func (ts *SQLiteTaskStorage) InsertTask(task *Task) error {
+	db, err := ts.db()
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	err = db.QueryRow(fmt.Sprintf(`
+		INSERT INTO tasks (%s) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`, taskColumns), taskValues(task)...).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to insert task: %w", err)
+	}
+	task.ID = int(id)
+	return nil
+}
+
+// SaveTask 保存任务的当前状态
+func (ts *SQLiteTaskStorage) SaveTask(task *Task) error {
+	db, err := ts.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := upsertTask(tx, task, true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadTasks 读取全部任务
+func (ts *SQLiteTaskStorage) LoadTasks() ([]*Task, error) {
+	return ts.loadTasks("1 = 1")
+}
+
+// LoadActiveTasks 读取等待中和运行中的任务，以及 ids 指定的任务
+// 任务管理器每个采集周期同步一次，已结束的任务不会再变化，不必每次读取
+func (ts *SQLiteTaskStorage) LoadActiveTasks(ids []int) ([]*Task, error) {
+	where := "status IN (?, ?)"
+	args := []interface{}{string(StatusPending), string(StatusRunning)}
+	if len(ids) > 0 {
+		where += " OR id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	return ts.loadTasks(where, args...)
+}
+
+// loadTasks 按条件读取任务，按ID排序
+func (ts *SQLiteTaskStorage) loadTasks(where string, args ...interface{}) ([]*Task, error) {
+	db, err := ts.db()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT id, %s FROM tasks WHERE %s ORDER BY id", taskColumns, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		task := &Task{PIDMap: make(map[int32]int)}
+		var status, tags string
+		var errorMessage, workDir sql.NullString
+		var startedAt, completedAt sql.NullTime
+		var exitCode sql.NullInt64
+		err := rows.Scan(
+			&task.ID, &task.Name, &task.Command, &status, &task.Priority, &task.RootPID, &task.ProcessCount,
+			&task.CreatedAt, &startedAt, &completedAt, &task.TotalCPU, &task.TotalMemory,
+			&task.TotalDiskIO, &task.TotalNetIO, &exitCode, &errorMessage, &tags, &workDir,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %w", err)
+		}
+		task.Status = TaskStatus(status)
+		task.StartedAt = nullTimePtr(startedAt)
+		task.CompletedAt = nullTimePtr(completedAt)
+		task.ExitCode = nullIntPtr(exitCode)
+		task.ErrorMessage = errorMessage.String
+		task.WorkDir = workDir.String
+		if err := json.Unmarshal([]byte(tags), &task.Tags); err != nil || task.Tags == nil {
+			task.Tags = []string{}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// DeleteTask 删除任务及其运行记录、事件和时间序列
+func (ts *SQLiteTaskStorage) DeleteTask(id int) error {
+	return ts.deleteTasks("id = ?", id)
+}
+
+// CleanupOldTasks 删除在 olderThan 之前结束的任务
+func (ts *SQLiteTaskStorage) CleanupOldTasks(olderThan time.Time) error {
+	return ts.deleteTasks("completed_at IS NOT NULL AND completed_at < ?", olderThan)
+}
+
+// deleteTasks 在一个事务中删除符合条件的任务及其运行记录、事件和时间序列
+func (ts *SQLiteTaskStorage) deleteTasks(where string, args ...interface{}) error {
+	db, err := ts.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	selected := "SELECT id FROM tasks WHERE " + where
+	for _, table := range []string{"task_events", "task_runs", "task_samples"} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE task_id IN (%s)", table, selected), args...); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM tasks WHERE "+where, args...); err != nil {
+		return fmt.Errorf("failed to delete tasks: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SaveTaskEvent 记录一条任务事件
+func (ts *SQLiteTaskStorage) SaveTaskEvent(event TaskEvent) error {
+	db, err := ts.db()
+	if err != nil {
+		return err
+	}
+
+	data := event.Data
+	if e, ok := data.(error); ok {
+		data = e.Error()
+	}
+	var encoded sql.NullString
+	if data != nil {
+		if b, err := json.Marshal(data); err == nil {
+			encoded = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+
+	_, err = db.Exec("INSERT INTO task_events (task_id, type, timestamp, data) VALUES (?, ?, ?, ?)",
+		event.TaskID, string(event.Type), event.Timestamp, encoded)
+	if err != nil {
+		return fmt.Errorf("failed to save task event: %w", err)
+	}
+	return nil
+}
+
+// TaskEvents 按时间顺序读取任务的事件，Data 为事件数据的JSON文本
+func (ts *SQLiteTaskStorage) TaskEvents(taskID int) ([]TaskEvent, error) {
+	db, err := ts.db()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT type, timestamp, data FROM task_events WHERE task_id = ? ORDER BY timestamp, id", taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []TaskEvent
+	for rows.Next() {
+		event := TaskEvent{TaskID: taskID}
+		var eventType string
+		var data sql.NullString
+		if err := rows.Scan(&eventType, &event.Timestamp, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan task event: %w", err)
+		}
+		event.Type = EventType(eventType)
+		if data.Valid {
+			event.Data = data.String
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// TaskRuns 按开始时间读取任务的运行记录
+func (ts *SQLiteTaskStorage) TaskRuns(taskID int) ([]TaskRun, error) {
+	db, err := ts.db()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT started_at, completed_at, root_pid, status, exit_code, error_message
+		FROM task_runs WHERE task_id = ? ORDER BY started_at`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []TaskRun
+	for rows.Next() {
+		run := TaskRun{TaskID: taskID}
+		var status string
+		var completedAt sql.NullTime
+		var exitCode sql.NullInt64
+		var errorMessage sql.NullString
+		if err := rows.Scan(&run.StartedAt, &completedAt, &run.RootPID, &status, &exitCode, &errorMessage); err != nil {
+			return nil, fmt.Errorf("failed to scan task run: %w", err)
+		}
+		run.Status = TaskStatus(status)
+		run.CompletedAt = nullTimePtr(completedAt)
+		run.ExitCode = nullIntPtr(exitCode)
+		run.ErrorMessage = errorMessage.String
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// SaveTaskSamples 在一个事务中写入一批任务采样
+func (ts *SQLiteTaskStorage) SaveTaskSamples(samples []TaskSample) error {
+	db, err := ts.db()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO task_samples (task_id, timestamp, cpu, memory_mb, disk_io_mb, net_io_kb, process_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, s := range samples {
+		if _, err := stmt.Exec(s.TaskID, s.Timestamp, s.CPU, s.MemoryMB, s.DiskIOMB, s.NetIOKB, s.ProcessCount); err != nil {
+			return fmt.Errorf("failed to save sample of task %d: %w", s.TaskID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// TaskSamples 按时间顺序读取任务的资源时间序列
+func (ts *SQLiteTaskStorage) TaskSamples(taskID int) ([]TaskSample, error) {
+	db, err := ts.db()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT timestamp, cpu, memory_mb, disk_io_mb, net_io_kb, process_count
+		FROM task_samples WHERE task_id = ? ORDER BY timestamp, id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task samples: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []TaskSample{}
+	for rows.Next() {
+		s := TaskSample{TaskID: taskID}
+		if err := rows.Scan(&s.Timestamp, &s.CPU, &s.MemoryMB, &s.DiskIOMB, &s.NetIOKB, &s.ProcessCount); err != nil {
+			return nil, fmt.Errorf("failed to scan task sample: %w", err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
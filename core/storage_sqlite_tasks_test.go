@@ -0,0 +1,211 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func taskTestConfig() TaskConfig {
+	return TaskConfig{MaxConcurrentTasks: 10, ProcessTreeDepth: 10}
+}
+
+// TestSQLiteTaskStorage_ImportAndShare tests the one-time tasks.json import and that two
+// processes sharing the database never hand out the same task ID
+func TestSQLiteTaskStorage_ImportAndShare(t *testing.T) {
+	dir := t.TempDir()
+	taskFile := filepath.Join(dir, "tasks.json")
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	exitCode := 0
+	legacy := NewTaskStorageFile(taskFile)
+	legacy.SaveTask(&Task{ID: 1, Name: "build", Command: "make", Status: StatusPending, CreatedAt: started, Tags: []string{"ci"}})
+	legacy.SaveTask(&Task{ID: 2, Name: "test", Command: "make test", Status: StatusCompleted, CreatedAt: started,
+		StartedAt: &started, CompletedAt: &started, ExitCode: &exitCode})
+
+	dbPath := filepath.Join(dir, "tracker.db")
+	web := openTestSQLite(t, dbPath)
+	defer web.Close()
+	webTasks := NewTaskManagerWithStorage(dir, taskTestConfig(), NewSQLiteTaskStorage(web, taskFile))
+
+	tasks, _ := webTasks.ListTasks("")
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 imported tasks, got %d", len(tasks))
+	}
+	if _, err := os.Stat(taskFile); !os.IsNotExist(err) {
+		t.Errorf("Expected tasks.json renamed after import")
+	}
+	imported, _ := webTasks.GetTask(1)
+	if imported.Name != "build" || len(imported.Tags) != 1 || imported.Tags[0] != "ci" {
+		t.Errorf("Unexpected imported task: %+v", imported)
+	}
+
+	// A second process on the same database gets the next ID, not a duplicate
+	daemon := openTestSQLite(t, dbPath)
+	defer daemon.Close()
+	daemonTasks := NewTaskManagerWithStorage(dir, taskTestConfig(), NewSQLiteTaskStorage(daemon, taskFile))
+	a, err := webTasks.CreateTask("a", "true", 1)
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	b, err := daemonTasks.CreateTask("b", "true", 1)
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if a.ID != 3 || b.ID != 4 {
+		t.Errorf("Expected IDs 3 and 4 from the shared database, got %d and %d", a.ID, b.ID)
+	}
+
+	reloaded, err := NewSQLiteTaskStorage(web, "").LoadTasks()
+	if err != nil || len(reloaded) != 4 {
+		t.Fatalf("Expected 4 stored tasks, got %d (%v)", len(reloaded), err)
+	}
+	if reloaded[1].ExitCode == nil || *reloaded[1].ExitCode != 0 || reloaded[1].CompletedAt == nil {
+		t.Errorf("Expected exit code and completion time kept, got %+v", reloaded[1])
+	}
+
+	if err := webTasks.DeleteTask(a.ID); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+	if events, _ := NewSQLiteTaskStorage(web, "").TaskEvents(a.ID); len(events) != 0 {
+		t.Errorf("Expected events deleted with the task, got %d", len(events))
+	}
+}
+
+// TestSQLiteTaskStorage_SyncActiveTasks tests that syncing reads the tasks in progress and the
+// ones this instance is tracking, and still sees a task finished by another instance
+func TestSQLiteTaskStorage_SyncActiveTasks(t *testing.T) {
+	dir := t.TempDir()
+	storage := openTestSQLite(t, filepath.Join(dir, "tracker.db"))
+	defer storage.Close()
+	web := NewSQLiteTaskStorage(storage, "")
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, task := range []*Task{
+		{Name: "done", Command: "true", Status: StatusCompleted, CreatedAt: started, CompletedAt: &started},
+		{Name: "queued", Command: "true", Status: StatusPending, CreatedAt: started},
+		{Name: "serve", Command: "sleep 60", Status: StatusRunning, CreatedAt: started, StartedAt: &started, RootPID: 4242},
+	} {
+		if err := web.InsertTask(task); err != nil {
+			t.Fatalf("InsertTask failed: %v", err)
+		}
+	}
+
+	active, err := web.LoadActiveTasks(nil)
+	if err != nil || len(active) != 2 || active[0].Name != "queued" || active[1].Name != "serve" {
+		t.Fatalf("Expected the pending and running tasks, got %+v (%v)", active, err)
+	}
+	if tracked, _ := web.LoadActiveTasks([]int{1}); len(tracked) != 3 {
+		t.Errorf("Expected the tracked finished task included, got %d tasks", len(tracked))
+	}
+
+	daemon := NewTaskManagerWithStorage(dir, taskTestConfig(), NewSQLiteTaskStorage(storage, ""))
+	daemon.syncNow()
+	if task, _ := daemon.GetTask(3); task == nil || task.Status != StatusRunning {
+		t.Fatalf("Expected the running task synced, got %+v", task)
+	}
+
+	// The web instance stops the task; the daemon picks up the final status
+	stopped := active[1]
+	stopped.Status = StatusStopped
+	stopped.CompletedAt = &started
+	if err := web.SaveTask(stopped); err != nil {
+		t.Fatalf("SaveTask failed: %v", err)
+	}
+	daemon.syncNow()
+	if task, _ := daemon.GetTask(3); task.Status != StatusStopped {
+		t.Errorf("Expected the stop synced, got %s", task.Status)
+	}
+}
+
+// TestSQLiteTaskStorage_Closed tests that task storage does not reopen a closed database
+func TestSQLiteTaskStorage_Closed(t *testing.T) {
+	storage := openTestSQLite(t, filepath.Join(t.TempDir(), "tracker.db"))
+	tasks := NewSQLiteTaskStorage(storage, "")
+	if _, err := tasks.LoadTasks(); err != nil {
+		t.Fatalf("LoadTasks failed: %v", err)
+	}
+
+	storage.Close()
+	if _, err := tasks.LoadTasks(); err == nil {
+		t.Error("Expected an error from a closed database")
+	}
+	if storage.db != nil {
+		t.Error("Expected the closed database to stay closed")
+	}
+
+	// Reopening the storage explicitly makes the tasks available again
+	if err := storage.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer storage.Close()
+	if _, err := tasks.LoadTasks(); err != nil {
+		t.Errorf("LoadTasks after reopening failed: %v", err)
+	}
+}
+
+// TestSQLiteTaskStorage_RunsAndEvents tests that a task run and its events are recorded
+func TestSQLiteTaskStorage_RunsAndEvents(t *testing.T) {
+	dir := t.TempDir()
+	storage := openTestSQLite(t, filepath.Join(dir, "tracker.db"))
+	defer storage.Close()
+	taskStorage := NewSQLiteTaskStorage(storage, "")
+	tm := NewTaskManagerWithStorage(dir, taskTestConfig(), taskStorage)
+
+	task, err := tm.CreateTask("fail", "exit 3", 1)
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if err := tm.StartTask(task.ID); err != nil {
+		t.Fatalf("StartTask failed: %v", err)
+	}
+	waitFor(t, "task to finish", func() bool {
+		runs, _ := taskStorage.TaskRuns(task.ID)
+		return len(runs) == 1 && runs[0].CompletedAt != nil
+	})
+
+	runs, _ := taskStorage.TaskRuns(task.ID)
+	if runs[0].Status != StatusFailed || runs[0].ExitCode == nil || *runs[0].ExitCode != 3 {
+		t.Errorf("Expected a failed run with exit code 3, got %+v", runs[0])
+	}
+
+	events, err := taskStorage.TaskEvents(task.ID)
+	if err != nil {
+		t.Fatalf("TaskEvents failed: %v", err)
+	}
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if len(types) != 3 || types[0] != EventTaskCreated || types[1] != EventTaskStarted || types[2] != EventTaskFailed {
+		t.Errorf("Expected created, started and failed events, got %v", types)
+	}
+}
+
+// TestTaskStorageFile_ConcurrentSaves tests that saves within a process do not overwrite
+// each other and leave no temporary files behind
+func TestTaskStorageFile_ConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	ts := NewTaskStorageFile(filepath.Join(dir, "tasks.json"))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := ts.SaveTask(&Task{ID: id, Name: "t", Status: StatusPending, CreatedAt: time.Now()}); err != nil {
+				t.Errorf("SaveTask failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tasks, err := ts.LoadTasks()
+	if err != nil || len(tasks) != 20 {
+		t.Fatalf("Expected 20 tasks, got %d (%v)", len(tasks), err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only tasks.json in %s, found %d entries", dir, len(entries))
+	}
+}
@@ -0,0 +1,511 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// legacyRecordsSQL is the wide resource_records table used before the processes/samples split
+const legacyRecordsSQL = `
+CREATE TABLE resource_records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME NOT NULL,
+	name TEXT NOT NULL,
+	cpu_percent REAL NOT NULL,
+	cpu_percent_normalized REAL NOT NULL,
+	memory_mb REAL NOT NULL,
+	memory_percent REAL NOT NULL,
+	threads INTEGER NOT NULL,
+	disk_read_mb REAL NOT NULL,
+	disk_write_mb REAL NOT NULL,
+	net_sent_kb REAL NOT NULL,
+	net_recv_kb REAL NOT NULL,
+	is_active BOOLEAN NOT NULL,
+	command TEXT,
+	working_dir TEXT,
+	category TEXT,
+	pid INTEGER NOT NULL,
+	ppid INTEGER,
+	create_time INTEGER,
+	cpu_time REAL,
+	labels TEXT,
+	uid INTEGER,
+	username TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_resource_records_timestamp ON resource_records(timestamp);
+CREATE INDEX idx_resource_records_name ON resource_records(name);`
+
+// writeLegacyRecords creates a database in the pre-normalization layout holding records
+func writeLegacyRecords(t testing.TB, path string, records []ResourceRecord) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(legacyRecordsSQL); err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, r := range records {
+		_, err := tx.Exec(`INSERT INTO resource_records (
+			timestamp, name, cpu_percent, cpu_percent_normalized, memory_mb, memory_percent,
+			threads, disk_read_mb, disk_write_mb, net_sent_kb, net_recv_kb, is_active, command,
+			working_dir, category, pid, ppid, create_time, cpu_time, labels, uid, username
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Timestamp, r.Name, r.CPUPercent, r.CPUPercentNormalized, r.MemoryMB, r.MemoryPercent,
+			r.Threads, r.DiskReadMB, r.DiskWriteMB, r.NetSentKB, r.NetRecvKB, r.IsActive, r.Command,
+			r.WorkingDir, r.Category, r.PID, r.PPID, r.CreateTime, r.CPUTime, FormatLabels(r.Labels), r.UID, r.Username)
+		if err != nil {
+			t.Fatalf("Failed to insert legacy record: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit legacy records: %v", err)
+	}
+}
+
+// schemaTestRecords returns cycles snapshots of procs long-running processes, one per second
+func schemaTestRecords(start time.Time, procs, cycles int) []ResourceRecord {
+	records := make([]ResourceRecord, 0, procs*cycles)
+	for c := 0; c < cycles; c++ {
+		for p := 0; p < procs; p++ {
+			records = append(records, ResourceRecord{
+				Timestamp:            start.Add(time.Duration(c) * time.Second),
+				Name:                 fmt.Sprintf("worker-%d", p),
+				PID:                  int32(1000 + p),
+				PPID:                 1,
+				CreateTime:           start.UnixMilli() - int64(p),
+				CPUPercent:           float64(p % 7),
+				CPUPercentNormalized: float64(p%7) / 4,
+				MemoryMB:             float64(100 + p),
+				Threads:              4,
+				IsActive:             p%2 == 0,
+				Command:              fmt.Sprintf("/usr/bin/python3 -m service.worker --queue=jobs-%d --concurrency=8 --log-level=info", p),
+				WorkingDir:           "/srv/apps/service/current",
+				Category:             "python",
+				Username:             "svc",
+				UID:                  1001,
+			})
+		}
+	}
+	return records
+}
+
+func openTestSQLite(t testing.TB, path string) *SQLiteStorage {
+	t.Helper()
+	config := GetDefaultStorageConfig()
+	config.Type = "sqlite"
+	config.SQLitePath = path
+	storage := NewSQLiteStorage(path, 100, config)
+	if err := storage.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	return storage
+}
+
+// TestSQLiteStorage_ProcessDimension tests that static attributes are stored once per process
+func TestSQLiteStorage_ProcessDimension(t *testing.T) {
+	storage := openTestSQLite(t, filepath.Join(t.TempDir(), "normalized.db"))
+	defer storage.Close()
+
+	now := time.Now().Truncate(time.Second)
+	records := schemaTestRecords(now, 3, 10)
+	if err := storage.SaveRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+
+	var processes, samples int
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	storage.db.QueryRow("SELECT COUNT(*) FROM samples").Scan(&samples)
+	if processes != 3 || samples != 30 {
+		t.Errorf("Expected 3 processes and 30 samples, got %d and %d", processes, samples)
+	}
+
+	// A changed command keeps the first-seen dimension row; the change itself is a process event
+	changed := records[0]
+	changed.Timestamp = now.Add(time.Minute)
+	changed.Command = "/usr/bin/python3 -m service.worker --reloaded"
+	changed.PPID = 42
+	if err := storage.SaveRecord(changed); err != nil {
+		t.Fatalf("Failed to save record: %v", err)
+	}
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	if processes != 3 {
+		t.Errorf("Expected attribute change to keep 3 processes, got %d", processes)
+	}
+
+	it, err := storage.Query(context.Background(), RecordQuery{PIDs: []int32{changed.PID}, LatestOnly: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got, err := CollectRecords(it)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Command != records[0].Command || got[0].WorkingDir != records[0].WorkingDir || got[0].Username != "svc" || got[0].PPID != 42 {
+		t.Errorf("Unexpected latest record through the view: %+v", got)
+	}
+
+	// Expiring every sample also removes the processes
+	var ids []int64
+	rows, err := storage.db.Query("SELECT id FROM samples")
+	if err != nil {
+		t.Fatalf("Failed to list samples: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		// Samples stay unique per process and timestamp
+		aged := now.AddDate(0, 0, -30).Add(time.Duration(id) * time.Second)
+		if _, err := storage.db.Exec("UPDATE samples SET timestamp = ? WHERE id = ?", aged, id); err != nil {
+			t.Fatalf("Failed to age samples: %v", err)
+		}
+	}
+	if err := storage.CleanOldData(7); err != nil {
+		t.Fatalf("CleanOldData failed: %v", err)
+	}
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	if processes != 0 {
+		t.Errorf("Expected orphaned processes to be removed, got %d", processes)
+	}
+	if err := storage.SaveRecord(changed); err != nil {
+		t.Fatalf("Failed to save record after cleanup: %v", err)
+	}
+}
+
+// TestSQLiteStorage_MigrateLegacyRecords tests the one-time split of the old wide table
+func TestSQLiteStorage_MigrateLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	now := time.Now().Truncate(time.Second)
+	records := schemaTestRecords(now, 4, 5)
+	records[len(records)-1].Category = "renamed"
+	writeLegacyRecords(t, path, records)
+
+	storage := openTestSQLite(t, path)
+	defer storage.Close()
+
+	var kind string
+	storage.db.QueryRow("SELECT type FROM sqlite_master WHERE name = 'resource_records'").Scan(&kind)
+	if kind != "view" {
+		t.Fatalf("Expected resource_records to become a view, got %q", kind)
+	}
+
+	var processes int
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	if processes != 4 {
+		t.Errorf("Expected 4 processes, got %d", processes)
+	}
+	if count, _ := storage.GetRecordCount(); count != len(records) {
+		t.Errorf("Expected %d samples, got %d", len(records), count)
+	}
+
+	got, err := storage.ReadRecordsByTimeRange(now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ReadRecordsByTimeRange failed: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("Expected %d records, got %d", len(records), len(got))
+	}
+	var first ResourceRecord
+	for _, r := range got {
+		if r.PID == records[0].PID {
+			first = r
+		}
+	}
+	if first.Command != records[0].Command || first.CreateTime != records[0].CreateTime || first.MemoryMB != records[0].MemoryMB {
+		t.Errorf("Unexpected migrated record: %+v", first)
+	}
+	for _, r := range got {
+		if r.PID == records[len(records)-1].PID && r.Category == "renamed" {
+			t.Errorf("Expected process attributes from the first record, got %q", r.Category)
+		}
+	}
+
+	status, err := storage.SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus failed: %v", err)
+	}
+	if status.CurrentVersion != LatestSchemaVersion() || status.Pending() != 0 {
+		t.Errorf("Expected every migration applied, got %+v", status)
+	}
+	if _, err := os.Stat(status.LastBackup); status.LastBackup == "" || err != nil {
+		t.Errorf("Expected a backup before the destructive migration, got %q (%v)", status.LastBackup, err)
+	}
+
+	var autoVacuum int
+	storage.db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum)
+	if autoVacuum != 2 {
+		t.Errorf("Expected legacy database to switch to incremental auto-vacuum, got %d", autoVacuum)
+	}
+
+	// New samples append after the migrated ones
+	next := records[0]
+	next.Timestamp = now.Add(time.Minute)
+	if err := storage.SaveRecord(next); err != nil {
+		t.Fatalf("Failed to save after migration: %v", err)
+	}
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	if count, _ := storage.GetRecordCount(); count != len(records)+1 || processes != 4 {
+		t.Errorf("Expected %d samples across 4 processes, got %d across %d", len(records)+1, count, processes)
+	}
+
+	// The same PID and start time on another host is another process
+	remote := records[0]
+	remote.Host = "web-1"
+	if err := storage.SaveRecord(remote); err != nil {
+		t.Fatalf("Failed to save a record of another host: %v", err)
+	}
+	storage.db.QueryRow("SELECT COUNT(*) FROM processes").Scan(&processes)
+	if processes != 5 {
+		t.Errorf("Expected a separate process for web-1, got %d processes", processes)
+	}
+	it, err := storage.Query(context.Background(), RecordQuery{Hosts: []string{"web-1"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got, _ = CollectRecords(it)
+	if len(got) != 1 || got[0].Host != "web-1" || got[0].PID != records[0].PID {
+		t.Errorf("Expected only the web-1 record, got %+v", got)
+	}
+
+	// Reopening does not migrate again
+	storage.Close()
+	storage = openTestSQLite(t, path)
+	if count, _ := storage.GetRecordCount(); count != len(records)+2 {
+		t.Errorf("Expected reopen to keep %d samples, got %d", len(records)+2, count)
+	}
+}
+
+// TestSQLiteStorage_SchemaStatus tests schema versioning of new and future databases
+func TestSQLiteStorage_SchemaStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.db")
+
+	// Status of a missing database reports every migration pending without creating it
+	status, err := NewSQLiteStorage(path, 100, StorageConfig{SQLitePath: path}).SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus failed: %v", err)
+	}
+	if status.Exists || status.CurrentVersion != 0 || status.Pending() != len(status.Migrations) {
+		t.Errorf("Unexpected status for a missing database: %+v", status)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected SchemaStatus not to create the database")
+	}
+
+	storage := openTestSQLite(t, path)
+	status, err = storage.SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus failed: %v", err)
+	}
+	if status.CurrentVersion != LatestSchemaVersion() || status.Pending() != 0 || status.LastBackup != "" {
+		t.Errorf("Expected a new database at the latest version without a backup, got %+v", status)
+	}
+	for _, m := range status.Migrations {
+		if m.AppliedAt.IsZero() {
+			t.Errorf("Expected migration %d to record when it was applied", m.Version)
+		}
+	}
+
+	// A database written by a newer build is refused
+	storage.db.Exec("UPDATE storage_meta SET value = ? WHERE key = 'schema_version'", fmt.Sprint(LatestSchemaVersion()+1))
+	storage.Close()
+	newer := NewSQLiteStorage(path, 100, StorageConfig{SQLitePath: path})
+	if err := newer.Initialize(); err == nil {
+		t.Error("Expected an error opening a database with a newer schema")
+	}
+	newer.Close()
+}
+
+// TestSQLiteStorage_EnforceSizeLimit tests that the oldest samples are pruned to fit the size budget
+func TestSQLiteStorage_EnforceSizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.db")
+	storage := openTestSQLite(t, path)
+	defer storage.Close()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	records := schemaTestRecords(start, 20, 1500)
+	if err := storage.SaveRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	storage.SaveSystemRecord(SystemRecord{Timestamp: start})
+	storage.SaveSystemRecord(SystemRecord{Timestamp: start.Add(time.Hour)})
+
+	before, err := storage.usedBytes()
+	if err != nil {
+		t.Fatalf("usedBytes failed: %v", err)
+	}
+	budget := before / 2
+	result, err := storage.EnforceSizeLimit(budget)
+	if err != nil {
+		t.Fatalf("EnforceSizeLimit failed: %v", err)
+	}
+	if result.SizeAfter > budget || result.DeletedSamples == 0 || result.Batches == 0 {
+		t.Errorf("Expected database pruned under %d bytes, got %+v", budget, result)
+	}
+
+	// The newest samples survive and the file itself shrank
+	count, _ := storage.GetRecordCount()
+	if count != len(records)-int(result.DeletedSamples) {
+		t.Errorf("Expected %d samples left, got %d", len(records)-int(result.DeletedSamples), count)
+	}
+	latest, _ := storage.ReadRecordsByTimeRange(start.Add(1499*time.Second), start.Add(1500*time.Second))
+	if len(latest) != 20 {
+		t.Errorf("Expected the newest snapshot to be kept, got %d records", len(latest))
+	}
+	if !result.Oldest.After(start) {
+		t.Errorf("Expected oldest sample after %v, got %v", start, result.Oldest)
+	}
+	if system, _ := storage.ReadSystemRecordsByTimeRange(start.Add(-time.Minute), start.Add(2*time.Hour)); len(system) != 1 {
+		t.Errorf("Expected system records older than the oldest sample pruned, got %d", len(system))
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Size() > before {
+		t.Errorf("Expected incremental vacuum to shrink the file below %d bytes", before)
+	}
+
+	// Within budget nothing is pruned
+	again, err := storage.EnforceSizeLimit(budget)
+	if err != nil || again.DeletedSamples != 0 {
+		t.Errorf("Expected no pruning within budget, got %+v (%v)", again, err)
+	}
+}
+
+// TestSQLiteStorage_BackupRestore tests an online backup, restoring it over newer data and merging it back
+func TestSQLiteStorage_BackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	storage := openTestSQLite(t, filepath.Join(dir, "live.db"))
+	defer storage.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := storage.SaveRecords(schemaTestRecords(start, 3, 10)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	if err := storage.SaveSystemRecord(SystemRecord{Timestamp: start, Load1: 1.5}); err != nil {
+		t.Fatalf("Failed to save system record: %v", err)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	info, err := storage.Backup(context.Background(), backupPath)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if info.Records != 30 || info.Size == 0 {
+		t.Errorf("Expected 30 records in a non-empty backup, got %+v", info)
+	}
+
+	// Writes after the backup are not in it
+	later := schemaTestRecords(start.Add(time.Minute), 3, 5)
+	if err := storage.SaveRecords(later); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+
+	result, err := storage.Restore(context.Background(), backupPath, false)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if count, _ := storage.GetRecordCount(); count != 30 || result.Records != 30 {
+		t.Errorf("Expected 30 records after replacing, got %d (result %+v)", count, result)
+	}
+
+	// Merging adds only the samples missing from the current store
+	if err := storage.SaveRecords(later); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	other := openTestSQLite(t, filepath.Join(dir, "other.db"))
+	if err := other.SaveRecords(append(schemaTestRecords(start, 3, 10), schemaTestRecords(start.Add(-time.Minute), 2, 4)...)); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	otherBackup := filepath.Join(dir, "other-backup.db")
+	if _, err := other.Backup(context.Background(), otherBackup); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	other.Close()
+
+	result, err = storage.Restore(context.Background(), otherBackup, true)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if result.Records != 8 {
+		t.Errorf("Expected 8 merged samples, got %+v", result)
+	}
+	if count, _ := storage.GetRecordCount(); count != 53 {
+		t.Errorf("Expected 53 records after merging, got %d", count)
+	}
+	system, _ := storage.ReadSystemRecordsByTimeRange(start.Add(-time.Hour), time.Now())
+	if len(system) != 1 {
+		t.Errorf("Expected the restored system record, got %d", len(system))
+	}
+
+	// Anything that is not a valid backup leaves the store untouched
+	bogus := filepath.Join(dir, "bogus.db")
+	os.WriteFile(bogus, []byte("not a database"), 0644)
+	if _, err := storage.Restore(context.Background(), bogus, false); err == nil {
+		t.Error("Expected restoring an invalid file to fail")
+	}
+	if count, _ := storage.GetRecordCount(); count != 53 {
+		t.Errorf("Expected store untouched after failed restore, got %d records", count)
+	}
+}
+
+// BenchmarkSQLiteSchema compares the legacy wide table with the normalized schema
+// on 50 processes sampled 2000 times; reports database size and times a filtered range query
+func BenchmarkSQLiteSchema(b *testing.B) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	records := schemaTestRecords(start, 50, 2000)
+	window := RecordQuery{Start: start.Add(10 * time.Minute), End: start.Add(20 * time.Minute), Names: []string{"worker-7"}}
+
+	for _, layout := range []string{"legacy", "normalized"} {
+		b.Run(layout, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), layout+".db")
+			var storage *SQLiteStorage
+			if layout == "legacy" {
+				writeLegacyRecords(b, path, records)
+				storage = &SQLiteStorage{processes: make(map[processKey]cachedProcess)}
+				db, err := sql.Open("sqlite3", path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				storage.db = db
+				db.Exec("VACUUM")
+			} else {
+				storage = openTestSQLite(b, path)
+				if err := storage.SaveRecords(records); err != nil {
+					b.Fatal(err)
+				}
+				storage.db.Exec("VACUUM")
+			}
+			defer storage.Close()
+
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it, err := storage.Query(ctx, window)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if got, err := CollectRecords(it); err != nil || len(got) != 601 {
+					b.Fatalf("Expected 601 records, got %d (%v)", len(got), err)
+				}
+			}
+			b.StopTimer()
+
+			if stat, err := os.Stat(path); err == nil {
+				b.ReportMetric(float64(stat.Size())/float64(len(records)), "bytes/record")
+			}
+		})
+	}
+}
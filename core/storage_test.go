@@ -3,6 +3,7 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -289,3 +290,115 @@ func TestMalformedData(t *testing.T) {
 		t.Errorf("Expected 'valid-process', got '%s'", records[0].Name)
 	}
 }
+
+// TestDataFormatV8 tests that v8 rows keep commas, quotes and newlines intact and store PPID
+func TestDataFormatV8(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-v8.log")
+	os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+
+	manager := NewManager(tmpFile, 100, false, GetDefaultStorageConfig())
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	record := ResourceRecord{
+		Timestamp:  time.Unix(1729000000, 0),
+		Name:       "java",
+		PID:        4242,
+		PPID:       1,
+		Command:    `java -Dhosts=a,b -Dmsg="hi there" -jar app.jar`,
+		WorkingDir: "/srv/app,v2",
+		Category:   "development",
+		Labels:     map[string]string{"team": "ml"},
+		UID:        1000,
+		Username:   "alice",
+	}
+	second := record
+	second.Command = "sh -c 'echo one\necho two'"
+	if err := manager.SaveRecords([]ResourceRecord{record, second}); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Failed to close manager: %v", err)
+	}
+
+	data, _ := os.ReadFile(tmpFile)
+	if !strings.HasPrefix(string(data), "#v8,timestamp,name,") {
+		t.Errorf("Expected v8 header, got %q", strings.SplitN(string(data), "\n", 2)[0])
+	}
+
+	records, err := NewManager(tmpFile, 100, false, GetDefaultStorageConfig()).ReadRecords(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	r := records[0]
+	if r.Command != record.Command || r.WorkingDir != record.WorkingDir {
+		t.Errorf("Command or working dir not preserved: %q %q", r.Command, r.WorkingDir)
+	}
+	if r.PPID != 1 || r.Username != "alice" || r.Labels["team"] != "ml" {
+		t.Errorf("Unexpected record: %+v", r)
+	}
+	if records[1].Command != second.Command {
+		t.Errorf("Multi-line command not preserved: %q", records[1].Command)
+	}
+}
+
+// TestDataFormatMixed tests a file with legacy rows followed by a header and v8 rows
+func TestDataFormatMixed(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-mixed.log")
+	defer os.Remove(tmpFile)
+
+	data := "1729000000,legacy,75.50,1.049,1024.00,0.32,5,10.00,5.00,100.00,200.00,true,/usr/bin/test,/home/user,development,12345,1729000000000,123.45\n" +
+		"#v8,pid,timestamp,name,future_column,ppid\n" +
+		"200,1729000010,\"with,comma\",ignored,100\n"
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write test data: %v", err)
+	}
+
+	manager := NewManager(tmpFile, 100, false, GetDefaultStorageConfig())
+	records, err := manager.ReadRecords(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Name != "legacy" || records[0].PID != 12345 {
+		t.Errorf("Unexpected legacy record: %+v", records[0])
+	}
+	if records[1].Name != "with,comma" || records[1].PID != 200 || records[1].PPID != 100 {
+		t.Errorf("Unexpected v8 record: %+v", records[1])
+	}
+	if count, _ := manager.GetTotalRecords(); count != 2 {
+		t.Errorf("Expected header to be excluded from record count, got %d", count)
+	}
+}
+
+// TestDataFormatV8_StorageManager tests that rotated storage writes a header before its rows
+func TestDataFormatV8_StorageManager(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test-rotated.log")
+
+	manager := NewManager(tmpFile, 1, true, GetDefaultStorageConfig())
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	record := ResourceRecord{Timestamp: time.Unix(1729000000, 0), Name: "worker", PID: 7, PPID: 3, Command: "worker --queues=a,b"}
+	if err := manager.SaveRecord(record); err != nil {
+		t.Fatalf("Failed to save record: %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Failed to close manager: %v", err)
+	}
+
+	records, err := manager.ReadRecords(tmpFile)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Failed to read records: %v (%d records)", err, len(records))
+	}
+	if records[0].Command != record.Command || records[0].PPID != 3 {
+		t.Errorf("Unexpected record: %+v", records[0])
+	}
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// pressureDir is where the kernel exposes pressure stall information
+var pressureDir = "/proc/pressure"
+
+// SystemCollector collects host-level metrics
+// CPU utilization is computed from the delta between consecutive samples,
+// so the collector keeps the previous CPU times between calls
+type SystemCollector struct {
+	mu        sync.Mutex
+	prevTimes *cpu.TimesStat
+}
+
+// NewSystemCollector creates a new system collector and takes the initial CPU baseline
+func NewSystemCollector() *SystemCollector {
+	sc := &SystemCollector{}
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		sc.prevTimes = &times[0]
+	}
+	return sc
+}
+
+// Collect gathers a single host-level metrics sample
+// Individual sources that fail are left at zero; an error is returned only
+// when nothing at all could be collected
+func (sc *SystemCollector) Collect() (SystemRecord, error) {
+	record := SystemRecord{Timestamp: time.Now()}
+	var errs []string
+
+	if avg, err := load.Avg(); err == nil {
+		record.Load1 = avg.Load1
+		record.Load5 = avg.Load5
+		record.Load15 = avg.Load15
+	} else {
+		errs = append(errs, fmt.Sprintf("load: %v", err))
+	}
+
+	if err := sc.collectCPU(&record); err != nil {
+		errs = append(errs, fmt.Sprintf("cpu: %v", err))
+	}
+
+	if vm, err := mem.VirtualMemory(); err == nil {
+		record.MemoryTotalMB = bytesToMB(vm.Total)
+		record.MemoryUsedMB = bytesToMB(vm.Used)
+		record.MemoryAvailableMB = bytesToMB(vm.Available)
+		record.MemoryCachedMB = bytesToMB(vm.Cached)
+		record.MemoryBuffersMB = bytesToMB(vm.Buffers)
+		if vm.Total > 0 {
+			record.MemoryPercent = float64(vm.Total-vm.Available) / float64(vm.Total) * 100
+		}
+	} else {
+		errs = append(errs, fmt.Sprintf("memory: %v", err))
+	}
+
+	if swap, err := mem.SwapMemory(); err == nil {
+		record.SwapTotalMB = bytesToMB(swap.Total)
+		record.SwapUsedMB = bytesToMB(swap.Used)
+	}
+
+	sc.collectPressure(&record)
+
+	disks, err := collectDiskUsage()
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("disk: %v", err))
+	}
+	record.Disks = disks
+
+	if len(errs) >= 4 {
+		return record, fmt.Errorf("failed to collect system metrics: %s", strings.Join(errs, "; "))
+	}
+	return record, nil
+}
+
+// collectCPU fills CPU utilization by mode from the delta since the previous sample
+func (sc *SystemCollector) collectCPU(record *SystemRecord) error {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return err
+	}
+	if len(times) == 0 {
+		return fmt.Errorf("no cpu times available")
+	}
+	current := times[0]
+
+	sc.mu.Lock()
+	prev := sc.prevTimes
+	sc.prevTimes = &current
+	sc.mu.Unlock()
+
+	// Without a baseline use the counters since boot
+	if prev == nil {
+		prev = &cpu.TimesStat{}
+	}
+
+	fillCPUPercent(record, *prev, current)
+	return nil
+}
+
+// fillCPUPercent converts two cumulative CPU time samples into per-mode percentages
+func fillCPUPercent(record *SystemRecord, prev, current cpu.TimesStat) {
+	// Guest time is already accounted in user/nice on Linux
+	total := cpuTimesTotal(current) - cpuTimesTotal(prev)
+	if total <= 0 {
+		return
+	}
+
+	pct := func(a, b float64) float64 {
+		delta := a - b
+		if delta < 0 {
+			return 0
+		}
+		return delta / total * 100
+	}
+
+	record.CPUUser = pct(current.User, prev.User)
+	record.CPUSystem = pct(current.System, prev.System)
+	record.CPUNice = pct(current.Nice, prev.Nice)
+	record.CPUIdle = pct(current.Idle, prev.Idle)
+	record.CPUIOWait = pct(current.Iowait, prev.Iowait)
+	record.CPUIRQ = pct(current.Irq+current.Softirq, prev.Irq+prev.Softirq)
+	record.CPUSteal = pct(current.Steal, prev.Steal)
+
+	busy := 100 - record.CPUIdle - record.CPUIOWait
+	if busy < 0 {
+		busy = 0
+	}
+	record.CPUPercent = busy
+}
+
+// cpuTimesTotal sums all CPU modes except guest time (already included in user/nice)
+func cpuTimesTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Nice + t.Idle + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// collectPressure reads pressure stall information from /proc/pressure
+// Kernels without PSI (before 4.20, or booted with psi=0) simply leave the fields at zero
+func (sc *SystemCollector) collectPressure(record *SystemRecord) {
+	if some, _, err := readPressureFile(filepath.Join(pressureDir, "cpu")); err == nil {
+		record.PSICPUSome = some
+	}
+	if some, full, err := readPressureFile(filepath.Join(pressureDir, "memory")); err == nil {
+		record.PSIMemorySome = some
+		record.PSIMemoryFull = full
+	}
+	if some, full, err := readPressureFile(filepath.Join(pressureDir, "io")); err == nil {
+		record.PSIIOSome = some
+		record.PSIIOFull = full
+	}
+}
+
+// readPressureFile parses a /proc/pressure file and returns the "some" and "full" avg10 values
+// Format:
+//
+//	some avg10=0.78 avg60=3.32 avg300=4.92 total=31561851
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressureFile(path string) (some, full float64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kind, value, ok := parsePressureLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "some":
+			some = value
+		case "full":
+			full = value
+		}
+	}
+	return some, full, scanner.Err()
+}
+
+// parsePressureLine extracts the kind ("some"/"full") and the avg10 value from a PSI line
+func parsePressureLine(line string) (string, float64, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", 0, false
+	}
+	for _, field := range fields[1:] {
+		if value, found := strings.CutPrefix(field, "avg10="); found {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", 0, false
+			}
+			return fields[0], v, true
+		}
+	}
+	return "", 0, false
+}
+
+// collectDiskUsage returns usage for every physical mounted filesystem
+func collectDiskUsage() ([]DiskUsage, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var disks []DiskUsage
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		// Skip read-only image mounts (snaps etc.) and duplicate bind mounts
+		if p.Fstype == "squashfs" || seen[p.Mountpoint] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		disks = append(disks, DiskUsage{
+			Mountpoint:  p.Mountpoint,
+			Device:      p.Device,
+			Fstype:      p.Fstype,
+			TotalMB:     bytesToMB(usage.Total),
+			UsedMB:      bytesToMB(usage.Used),
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+	return disks, nil
+}
+
+// MetricValue returns a host metric by its alert rule name (e.g. "host_load1")
+// For host_disk_percent an optional mountpoint selects the disk; otherwise the fullest disk is used
+func (r SystemRecord) MetricValue(metric, mountpoint string) (float64, bool) {
+	switch metric {
+	case "host_cpu_percent":
+		return r.CPUPercent, true
+	case "host_cpu_user":
+		return r.CPUUser, true
+	case "host_cpu_system":
+		return r.CPUSystem, true
+	case "host_cpu_iowait":
+		return r.CPUIOWait, true
+	case "host_cpu_steal":
+		return r.CPUSteal, true
+	case "host_load1":
+		return r.Load1, true
+	case "host_load5":
+		return r.Load5, true
+	case "host_load15":
+		return r.Load15, true
+	case "host_memory_percent":
+		return r.MemoryPercent, true
+	case "host_memory_available_mb":
+		return r.MemoryAvailableMB, true
+	case "host_memory_cached_mb":
+		return r.MemoryCachedMB, true
+	case "host_swap_used_mb":
+		return r.SwapUsedMB, true
+	case "host_swap_percent":
+		if r.SwapTotalMB == 0 {
+			return 0, true
+		}
+		return r.SwapUsedMB / r.SwapTotalMB * 100, true
+	case "host_psi_cpu_some":
+		return r.PSICPUSome, true
+	case "host_psi_memory_some":
+		return r.PSIMemorySome, true
+	case "host_psi_memory_full":
+		return r.PSIMemoryFull, true
+	case "host_psi_io_some":
+		return r.PSIIOSome, true
+	case "host_psi_io_full":
+		return r.PSIIOFull, true
+	case "host_disk_percent":
+		var max float64
+		for _, d := range r.Disks {
+			if mountpoint != "" {
+				if d.Mountpoint == mountpoint {
+					return d.UsedPercent, true
+				}
+				continue
+			}
+			if d.UsedPercent > max {
+				max = d.UsedPercent
+			}
+		}
+		return max, mountpoint == ""
+	}
+	return 0, false
+}
+
+// bytesToMB converts a byte count to megabytes
+func bytesToMB(b uint64) float64 {
+	return float64(b) / 1024 / 1024
+}
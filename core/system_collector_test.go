@@ -0,0 +1,145 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// TestParsePressureLine tests parsing of /proc/pressure lines
+func TestParsePressureLine(t *testing.T) {
+	kind, value, ok := parsePressureLine("some avg10=1.25 avg60=3.32 avg300=4.92 total=31561851")
+	if !ok || kind != "some" || value != 1.25 {
+		t.Errorf("Expected some=1.25, got %s=%.2f (ok=%v)", kind, value, ok)
+	}
+
+	kind, value, ok = parsePressureLine("full avg10=0.50 avg60=0.00 avg300=0.00 total=0")
+	if !ok || kind != "full" || value != 0.5 {
+		t.Errorf("Expected full=0.50, got %s=%.2f (ok=%v)", kind, value, ok)
+	}
+
+	if _, _, ok := parsePressureLine("garbage"); ok {
+		t.Error("Expected malformed line to be rejected")
+	}
+}
+
+// TestReadPressureFile tests reading a PSI file with some and full lines
+func TestReadPressureFile(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-pressure-memory")
+	defer os.Remove(tmpFile)
+
+	content := "some avg10=2.00 avg60=1.00 avg300=0.50 total=100\nfull avg10=0.75 avg60=0.10 avg300=0.00 total=10\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write pressure file: %v", err)
+	}
+
+	some, full, err := readPressureFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read pressure file: %v", err)
+	}
+	if some != 2.0 || full != 0.75 {
+		t.Errorf("Expected some=2.00 full=0.75, got some=%.2f full=%.2f", some, full)
+	}
+
+	if _, _, err := readPressureFile(filepath.Join(os.TempDir(), "nonexistent-pressure")); err == nil {
+		t.Error("Expected error for missing pressure file")
+	}
+}
+
+// TestFillCPUPercent tests per-mode CPU percentages from two samples
+func TestFillCPUPercent(t *testing.T) {
+	prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 50}
+	current := cpu.TimesStat{User: 130, System: 60, Idle: 850, Iowait: 60}
+
+	var record SystemRecord
+	fillCPUPercent(&record, prev, current)
+
+	// Total delta = 30 + 10 + 50 + 10 = 100
+	if record.CPUUser != 30 || record.CPUSystem != 10 || record.CPUIdle != 50 || record.CPUIOWait != 10 {
+		t.Errorf("Unexpected per-mode values: %+v", record)
+	}
+	if record.CPUPercent != 40 {
+		t.Errorf("Expected busy CPU 40%%, got %.2f", record.CPUPercent)
+	}
+}
+
+// TestSystemRecordMetricValue tests host metric lookup used by alert rules
+func TestSystemRecordMetricValue(t *testing.T) {
+	record := SystemRecord{
+		Load1:       3.5,
+		SwapTotalMB: 1000,
+		SwapUsedMB:  250,
+		Disks: []DiskUsage{
+			{Mountpoint: "/", UsedPercent: 40},
+			{Mountpoint: "/data", UsedPercent: 85},
+		},
+	}
+
+	if v, ok := record.MetricValue("host_load1", ""); !ok || v != 3.5 {
+		t.Errorf("Expected host_load1=3.5, got %.2f", v)
+	}
+	if v, _ := record.MetricValue("host_swap_percent", ""); v != 25 {
+		t.Errorf("Expected host_swap_percent=25, got %.2f", v)
+	}
+	if v, _ := record.MetricValue("host_disk_percent", ""); v != 85 {
+		t.Errorf("Expected fullest disk 85%%, got %.2f", v)
+	}
+	if v, _ := record.MetricValue("host_disk_percent", "/"); v != 40 {
+		t.Errorf("Expected / at 40%%, got %.2f", v)
+	}
+	if _, ok := record.MetricValue("host_unknown", ""); ok {
+		t.Error("Expected unknown metric to be rejected")
+	}
+}
+
+// TestManager_SystemRecords tests saving and reading host-level samples with CSV storage
+func TestManager_SystemRecords(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-system.log")
+	manager := NewManager(tmpFile, 10, false, GetDefaultStorageConfig())
+	defer os.Remove(tmpFile)
+	defer os.Remove(manager.systemDataFile())
+
+	now := time.Now().Truncate(time.Second)
+	old := SystemRecord{Timestamp: now.Add(-48 * time.Hour), Load1: 1}
+	recent := SystemRecord{
+		Timestamp:     now,
+		Load1:         2.5,
+		MemoryPercent: 61.2,
+		PSIIOSome:     4.5,
+		Disks:         []DiskUsage{{Mountpoint: "/", Device: "/dev/sda1", UsedPercent: 70}},
+	}
+
+	for _, r := range []SystemRecord{old, recent} {
+		if err := manager.SaveSystemRecord(r); err != nil {
+			t.Fatalf("Failed to save system record: %v", err)
+		}
+	}
+
+	records, err := manager.ReadSystemRecordsByTimeRange(now.Add(-time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to read system records: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record in range, got %d", len(records))
+	}
+
+	got := records[0]
+	if got.Load1 != 2.5 || got.MemoryPercent != 61.2 || got.PSIIOSome != 4.5 {
+		t.Errorf("Unexpected record values: %+v", got)
+	}
+	if len(got.Disks) != 1 || got.Disks[0].Mountpoint != "/" || got.Disks[0].UsedPercent != 70 {
+		t.Errorf("Unexpected disks: %+v", got.Disks)
+	}
+
+	// Pruning keeps only samples newer than the cutoff
+	if err := manager.pruneSystemRecords(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("Failed to prune system records: %v", err)
+	}
+	records, _ = manager.ReadSystemRecordsByTimeRange(now.Add(-72*time.Hour), now.Add(time.Minute))
+	if len(records) != 1 {
+		t.Errorf("Expected 1 record after pruning, got %d", len(records))
+	}
+}
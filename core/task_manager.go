@@ -33,6 +33,11 @@ type TaskManager struct {
 	taskEvents   chan TaskEvent
 	stopSignals  map[int]chan struct{} // Task ID -> Stop channel
 
+	// Task storage I/O is done by the monitor goroutine, never by the collector
+	pendingSamples []TaskSample   // Samples waiting to be saved
+	syncRequests   chan struct{}  // Wakes the monitor goroutine after a collection
+	syncMu         sync.Mutex     // Serializes syncs with the task storage
+
 	// Daemon management
 	dataDir      string
 }
@@ -66,22 +71,52 @@ type TaskStorage interface {
 	CleanupOldTasks(olderThan time.Time) error
 }
 
+// TaskIDAllocator is implemented by task storage shared between processes; the storage assigns
+// the ID of a new task so the web and monitoring instances never hand out the same one
+type TaskIDAllocator interface {
+	InsertTask(task *Task) error
+}
+
+// ActiveTaskLoader is implemented by task storage that can load the tasks still in progress
+// without reading every finished task
+type ActiveTaskLoader interface {
+	// LoadActiveTasks loads pending and running tasks, and the tasks with the given IDs
+	LoadActiveTasks(ids []int) ([]*Task, error)
+}
+
+// TaskEventStorage is implemented by task storage that keeps a history of task events
+type TaskEventStorage interface {
+	SaveTaskEvent(event TaskEvent) error
+}
+
 // TaskStorageFile implements TaskStorage using file-based storage
 type TaskStorageFile struct {
 	filePath string
+	mu       sync.Mutex // Serializes read-modify-write cycles within this process
+
+	// Tasks parsed by the last LoadActiveTasks, reused while the file is unchanged
+	activeTasks   []*Task
+	activeModTime time.Time
+	activeSize    int64
 }
 
-// NewTaskManager creates a new task manager
+// NewTaskStorageFile creates a JSON file task storage
+func NewTaskStorageFile(filePath string) *TaskStorageFile {
+	return &TaskStorageFile{filePath: filePath}
+}
+
+// NewTaskManager creates a new task manager that keeps tasks in tasks.json in dataDir
 func NewTaskManager(dataDir string, config TaskConfig) *TaskManager {
+	return NewTaskManagerWithStorage(dataDir, config, NewTaskStorageFile(filepath.Join(dataDir, "tasks.json")))
+}
+
+// NewTaskManagerWithStorage creates a new task manager using the given task storage
+func NewTaskManagerWithStorage(dataDir string, config TaskConfig, storage TaskStorage) *TaskManager {
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Printf("Warning: Failed to create task data directory: %v", err)
 	}
 
-	storage := &TaskStorageFile{
-		filePath: filepath.Join(dataDir, "tasks.json"),
-	}
-
 	tm := &TaskManager{
 		tasks:        make(map[int]*Task),
 		pidMap:       make(map[int32]int),
@@ -91,6 +126,7 @@ func NewTaskManager(dataDir string, config TaskConfig) *TaskManager {
 		storage:      storage,
 		taskEvents:   make(chan TaskEvent, 100),
 		stopSignals:  make(map[int]chan struct{}),
+		syncRequests: make(chan struct{}, 1),
 		dataDir:      dataDir,
 	}
 
@@ -137,18 +173,24 @@ func (tm *TaskManager) CreateTask(name, command string, priority int) (*Task, er
 		WorkDir:       "",
 	}
 
+	// Save to storage; shared storage assigns the task ID
+	if allocator, ok := tm.storage.(TaskIDAllocator); ok {
+		if err := allocator.InsertTask(task); err != nil {
+			return nil, fmt.Errorf("failed to save task: %w", err)
+		}
+	} else if err := tm.storage.SaveTask(task); err != nil {
+		log.Printf("Warning: Failed to save task %d: %v", task.ID, err)
+	}
+
 	// Add to storage
 	tm.tasks[task.ID] = task
-	tm.nextTaskID++
+	if task.ID >= tm.nextTaskID {
+		tm.nextTaskID = task.ID + 1
+	}
 
 	// Create stop channel
 	tm.stopSignals[task.ID] = make(chan struct{})
 
-	// Save to storage
-	if err := tm.storage.SaveTask(task); err != nil {
-		log.Printf("Warning: Failed to save task %d: %v", task.ID, err)
-	}
-
 	// Send event
 	tm.sendEvent(EventTaskCreated, task.ID, task)
 
@@ -218,6 +260,11 @@ func (tm *TaskManager) executeTask(taskID int) {
 
 	// Add to PID map
 	tm.pidMap[rootPID] = taskID
+
+	// Record the run so other instances see the task as running
+	if err := tm.storage.SaveTask(task); err != nil {
+		log.Printf("Warning: Failed to save started task %d: %v", taskID, err)
+	}
 	tm.mu.Unlock()
 
 	log.Printf("Task started: %s (PID: %d)", task.Name, rootPID)
@@ -440,10 +487,11 @@ func (tm *TaskManager) DeleteTask(taskID int) error {
 	return nil
 }
 
-// UpdateTaskFromProcessTree updates task resource usage from process tree
+// UpdateTaskFromProcessTree updates running tasks from the collected processes and records
+// each task's aggregated usage as a time series sample. It only works in memory: the samples
+// are saved, and tasks started by other instances picked up, by the monitor goroutine.
 func (tm *TaskManager) UpdateTaskFromProcessTree(processes []ResourceRecord) {
 	tm.mu.Lock()
-	defer tm.mu.Unlock()
 
 	// Build new process trees
 	newTrees := BuildProcessTree(processes)
@@ -451,34 +499,142 @@ func (tm *TaskManager) UpdateTaskFromProcessTree(processes []ResourceRecord) {
 	// Clear old process trees
 	tm.processTrees = make(map[int32]*ProcessTreeNode)
 
-	// Update tasks with new process data
-	for _, tree := range newTrees {
-		pid := tree.Process.PID
-
-		// Check if this PID belongs to a task
-		if taskID, exists := tm.pidMap[pid]; exists {
+	now := time.Now()
+	var samples []TaskSample
+	sampled := make(map[int]bool)
+
+	// A task's root process is usually a child of the process that started it,
+	// so look for task PIDs anywhere in the trees, not only at the roots
+	var visit func(node *ProcessTreeNode)
+	visit = func(node *ProcessTreeNode) {
+		if taskID, exists := tm.pidMap[node.Process.PID]; exists && !sampled[taskID] {
 			task := tm.tasks[taskID]
 			if task != nil && task.Status == StatusRunning {
-				// Update process tree
-				task.ProcessTree = tree
-				task.ProcessCount = tree.ChildCount + 1
-
-				// Update resource usage
-				task.TotalCPU = tree.TotalCPU
-				task.TotalMemory = tree.TotalMemory
-
-				// Calculate additional metrics
-				task.TotalDiskIO = 0
-				task.TotalNetIO = 0
-				tm.calculateTaskIO(task, tree)
+				sample := taskSampleFromTree(taskID, node, now)
+				sampled[taskID] = true
+				samples = append(samples, sample)
+
+				// Update process tree and current resource usage
+				task.ProcessTree = node
+				task.ProcessCount = sample.ProcessCount
+				task.TotalCPU = sample.CPU
+				task.TotalMemory = sample.MemoryMB
+				task.TotalDiskIO = sample.DiskIOMB
+				task.TotalNetIO = sample.NetIOKB
 
 				// Update PID mappings for all processes in tree
-				tm.updatePIDMappings(tree, taskID)
+				tm.updatePIDMappings(node, taskID)
+				return
 			}
 		}
+		for _, child := range node.Children {
+			visit(child)
+		}
+	}
+
+	for _, tree := range newTrees {
+		visit(tree)
 
 		// Store process tree for reference
-		tm.processTrees[pid] = tree
+		tm.processTrees[tree.Process.PID] = tree
+	}
+	if _, ok := tm.storage.(TaskSeriesStorage); ok {
+		tm.pendingSamples = append(tm.pendingSamples, samples...)
+	}
+	tm.mu.Unlock()
+
+	select {
+	case tm.syncRequests <- struct{}{}:
+	default:
+		// A sync is already pending
+	}
+}
+
+// syncNow saves the pending task samples, then picks up tasks created or started by other
+// instances sharing the task storage; tasks are usually started by the web server while
+// the daemon collects
+func (tm *TaskManager) syncNow() {
+	tm.syncMu.Lock()
+	defer tm.syncMu.Unlock()
+
+	tm.mu.Lock()
+	samples := tm.pendingSamples
+	tm.pendingSamples = nil
+	tm.mu.Unlock()
+
+	if len(samples) > 0 {
+		if err := tm.storage.(TaskSeriesStorage).SaveTaskSamples(samples); err != nil {
+			log.Printf("Warning: Failed to save task samples: %v", err)
+		}
+	}
+	tm.syncTasks()
+}
+
+// syncTasks picks up tasks created or started by another instance sharing the task storage.
+// A task's status only moves forward, so a task this instance is starting is never reverted
+func (tm *TaskManager) syncTasks() {
+	stored, err := tm.loadTasksToSync()
+	if err != nil {
+		log.Printf("Warning: Failed to reload tasks: %v", err)
+		return
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for _, s := range stored {
+		task, exists := tm.tasks[s.ID]
+		if !exists {
+			task = s
+			tm.tasks[s.ID] = task
+			if s.ID >= tm.nextTaskID {
+				tm.nextTaskID = s.ID + 1
+			}
+		} else if taskStatusRank(s.Status) > taskStatusRank(task.Status) ||
+			(s.Status == StatusRunning && task.Status == StatusRunning && s.RootPID != 0 && s.RootPID != task.RootPID) {
+			task.Status = s.Status
+			task.RootPID = s.RootPID
+			task.StartedAt = s.StartedAt
+			task.CompletedAt = s.CompletedAt
+			task.ExitCode = s.ExitCode
+			task.ErrorMessage = s.ErrorMessage
+		}
+
+		if task.Status == StatusRunning && task.RootPID > 0 {
+			tm.pidMap[task.RootPID] = task.ID
+		}
+	}
+}
+
+// loadTasksToSync loads the tasks syncTasks may change: when the storage supports it, the
+// tasks in progress plus those this instance still has in progress, which another instance
+// may have finished. Finished tasks never change, so they are not read on every collection.
+func (tm *TaskManager) loadTasksToSync() ([]*Task, error) {
+	loader, ok := tm.storage.(ActiveTaskLoader)
+	if !ok {
+		return tm.storage.LoadTasks()
+	}
+
+	tm.mu.RLock()
+	var ids []int
+	for id, task := range tm.tasks {
+		if taskStatusRank(task.Status) < taskStatusRank(StatusCompleted) {
+			ids = append(ids, id)
+		}
+	}
+	tm.mu.RUnlock()
+	return loader.LoadActiveTasks(ids)
+}
+
+// taskStatusRank orders task statuses by lifecycle stage
+func taskStatusRank(status TaskStatus) int {
+	switch status {
+	case StatusPending:
+		return 0
+	case StatusRunning:
+		return 1
+	default:
+		return 2
 	}
 }
 
@@ -493,18 +649,25 @@ func (tm *TaskManager) updatePIDMappings(tree *ProcessTreeNode, taskID int) {
 	}
 }
 
-// calculateTaskIO calculates total I/O for a task from its process tree
-func (tm *TaskManager) calculateTaskIO(task *Task, tree *ProcessTreeNode) {
-	// Add I/O from root process
-	task.TotalDiskIO += tree.Process.DiskReadMB + tree.Process.DiskWriteMB
-	task.TotalNetIO += tree.Process.NetSentKB + tree.Process.NetRecvKB
+// GetTaskStats returns a task's resource time series with peak and total summaries
+func (tm *TaskManager) GetTaskStats(taskID int) (*TaskStats, error) {
+	task, err := tm.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Recursively add I/O from children
-	for _, child := range tree.Children {
-		task.TotalDiskIO += child.Process.DiskReadMB + child.Process.DiskWriteMB
-		task.TotalNetIO += child.Process.NetSentKB + child.Process.NetRecvKB
-		tm.calculateTaskIO(task, child)
+	samples := []TaskSample{}
+	if series, ok := tm.storage.(TaskSeriesStorage); ok {
+		if samples, err = series.TaskSamples(taskID); err != nil {
+			return nil, fmt.Errorf("failed to read samples of task %d: %w", taskID, err)
+		}
 	}
+
+	return &TaskStats{
+		Task:    task,
+		Samples: samples,
+		Summary: SummarizeTaskSamples(samples),
+	}, nil
 }
 
 // monitorTasks runs background monitoring and cleanup
@@ -516,6 +679,8 @@ func (tm *TaskManager) monitorTasks() {
 		select {
 		case <-ticker.C:
 			tm.cleanupCompletedTasks()
+		case <-tm.syncRequests:
+			tm.syncNow()
 		}
 	}
 }
@@ -546,15 +711,23 @@ func (tm *TaskManager) cleanupCompletedTasks() {
 	}
 }
 
-// sendEvent sends a task event
+// sendEvent sends a task event and records it when the storage keeps event history
 func (tm *TaskManager) sendEvent(eventType EventType, taskID int, data interface{}) {
+	event := TaskEvent{
+		Type:      eventType,
+		TaskID:    taskID,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	if es, ok := tm.storage.(TaskEventStorage); ok {
+		if err := es.SaveTaskEvent(event); err != nil {
+			log.Printf("Warning: Failed to save task event: %v", err)
+		}
+	}
+
 	select {
-	case tm.taskEvents <- TaskEvent{
-			Type:      eventType,
-			TaskID:    taskID,
-			Data:      data,
-			Timestamp: time.Now(),
-		}:
+	case tm.taskEvents <- event:
 	default:
 		// Channel full, drop event
 	}
@@ -599,6 +772,9 @@ func (tm *TaskManager) GetTaskEvents() <-chan TaskEvent {
 
 // SaveTask saves a task to file
 func (ts *TaskStorageFile) SaveTask(task *Task) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	// Load existing tasks
 	tasks, err := ts.LoadTasks()
 	if err != nil {
@@ -654,8 +830,47 @@ func (ts *TaskStorageFile) LoadTasks() ([]*Task, error) {
 	return tasks, nil
 }
 
+// LoadActiveTasks loads pending and running tasks, and the tasks with the given IDs.
+// The file is only parsed again when it changed since the previous call.
+func (ts *TaskStorageFile) LoadActiveTasks(ids []int) ([]*Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	info, err := os.Stat(ts.filePath)
+	if os.IsNotExist(err) {
+		return []*Task{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ts.activeTasks == nil || !info.ModTime().Equal(ts.activeModTime) || info.Size() != ts.activeSize {
+		tasks, err := ts.LoadTasks()
+		if err != nil {
+			return nil, err
+		}
+		ts.activeTasks, ts.activeModTime, ts.activeSize = tasks, info.ModTime(), info.Size()
+	}
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	tasks := []*Task{}
+	for _, task := range ts.activeTasks {
+		if taskStatusRank(task.Status) < taskStatusRank(StatusCompleted) || wanted[task.ID] {
+			// Callers keep the tasks they load, so never hand out the cached ones
+			copied := *task
+			tasks = append(tasks, &copied)
+		}
+	}
+	return tasks, nil
+}
+
 // DeleteTask removes a task from file
 func (ts *TaskStorageFile) DeleteTask(id int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	// Load existing tasks
 	tasks, err := ts.LoadTasks()
 	if err != nil {
@@ -671,11 +886,18 @@ func (ts *TaskStorageFile) DeleteTask(id int) error {
 	}
 
 	// Write back to file
-	return ts.saveTasksToFile(filtered)
+	if err := ts.saveTasksToFile(filtered); err != nil {
+		return err
+	}
+	ts.removeTaskSamples(id)
+	return nil
 }
 
 // CleanupOldTasks removes old tasks from file
 func (ts *TaskStorageFile) CleanupOldTasks(olderThan time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	// Load existing tasks
 	tasks, err := ts.LoadTasks()
 	if err != nil {
@@ -683,15 +905,23 @@ func (ts *TaskStorageFile) CleanupOldTasks(olderThan time.Time) error {
 	}
 
 	// Filter out old tasks
-	var filtered []*Task
+	var filtered, removed []*Task
 	for _, task := range tasks {
 		if task.CompletedAt == nil || task.CompletedAt.After(olderThan) {
 			filtered = append(filtered, task)
+		} else {
+			removed = append(removed, task)
 		}
 	}
 
 	// Write back to file
-	return ts.saveTasksToFile(filtered)
+	if err := ts.saveTasksToFile(filtered); err != nil {
+		return err
+	}
+	for _, task := range removed {
+		ts.removeTaskSamples(task.ID)
+	}
+	return nil
 }
 
 // saveTasksToFile is a helper method to save tasks to JSON file
@@ -707,6 +937,5 @@ func (ts *TaskStorageFile) saveTasksToFile(tasks []*Task) error {
 		return err
 	}
 
-	// Write to file
-	return os.WriteFile(ts.filePath, data, 0644)
-}
\ No newline at end of file
+	return writeFileAtomic(ts.filePath, data)
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// TaskSample is the aggregated resource usage of a task's process tree at one collection tick
+type TaskSample struct {
+	TaskID       int       `json:"task_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	CPU          float64   `json:"cpu"`           // Normalized CPU percentage of the whole tree
+	MemoryMB     float64   `json:"memory_mb"`     // RSS of the whole tree
+	DiskIOMB     float64   `json:"disk_io_mb"`    // Cumulative disk read+write of live processes
+	NetIOKB      float64   `json:"net_io_kb"`     // Cumulative network sent+received of live processes
+	ProcessCount int       `json:"process_count"` // Processes in the tree
+}
+
+// TaskStatsSummary summarizes a task's time series
+type TaskStatsSummary struct {
+	Samples       int        `json:"samples"`
+	FirstSample   *time.Time `json:"first_sample"`
+	LastSample    *time.Time `json:"last_sample"`
+	PeakCPU       float64    `json:"peak_cpu"`
+	AvgCPU        float64    `json:"avg_cpu"`
+	PeakMemoryMB  float64    `json:"peak_memory_mb"`
+	AvgMemoryMB   float64    `json:"avg_memory_mb"`
+	PeakProcesses int        `json:"peak_processes"`
+	CPUSeconds    float64    `json:"cpu_seconds"`      // CPU time used by the tree, in core-seconds
+	TotalDiskIOMB float64    `json:"total_disk_io_mb"` // Largest cumulative disk I/O observed
+	TotalNetIOKB  float64    `json:"total_net_io_kb"`  // Largest cumulative network I/O observed
+}
+
+// TaskStats is a task together with its resource time series
+type TaskStats struct {
+	Task    *Task            `json:"task"`
+	Samples []TaskSample     `json:"samples"`
+	Summary TaskStatsSummary `json:"summary"`
+}
+
+// TaskSeriesStorage is implemented by task storage that keeps per-task resource time series
+type TaskSeriesStorage interface {
+	SaveTaskSamples(samples []TaskSample) error
+	TaskSamples(taskID int) ([]TaskSample, error)
+}
+
+// SummarizeTaskSamples computes peak, average and total usage from samples in time order
+func SummarizeTaskSamples(samples []TaskSample) TaskStatsSummary {
+	summary := TaskStatsSummary{Samples: len(samples)}
+	if len(samples) == 0 {
+		return summary
+	}
+
+	first, last := samples[0].Timestamp, samples[len(samples)-1].Timestamp
+	summary.FirstSample = &first
+	summary.LastSample = &last
+
+	cores := float64(SystemCPUCores())
+	var cpuSum, memorySum float64
+	for i, s := range samples {
+		cpuSum += s.CPU
+		memorySum += s.MemoryMB
+		if s.CPU > summary.PeakCPU {
+			summary.PeakCPU = s.CPU
+		}
+		if s.MemoryMB > summary.PeakMemoryMB {
+			summary.PeakMemoryMB = s.MemoryMB
+		}
+		if s.ProcessCount > summary.PeakProcesses {
+			summary.PeakProcesses = s.ProcessCount
+		}
+		// Cumulative counters drop when a process in the tree exits, so the largest value
+		// observed is the best estimate of what the task did overall
+		if s.DiskIOMB > summary.TotalDiskIOMB {
+			summary.TotalDiskIOMB = s.DiskIOMB
+		}
+		if s.NetIOKB > summary.TotalNetIOKB {
+			summary.TotalNetIOKB = s.NetIOKB
+		}
+		// A sample's CPU percentage is the average since the previous tick
+		if i > 0 {
+			elapsed := s.Timestamp.Sub(samples[i-1].Timestamp).Seconds()
+			summary.CPUSeconds += s.CPU / 100 * cores * elapsed
+		}
+	}
+	summary.AvgCPU = cpuSum / float64(len(samples))
+	summary.AvgMemoryMB = memorySum / float64(len(samples))
+	return summary
+}
+
+// taskSampleFromTree aggregates a task's process tree into a sample
+func taskSampleFromTree(taskID int, tree *ProcessTreeNode, timestamp time.Time) TaskSample {
+	sample := TaskSample{
+		TaskID:       taskID,
+		Timestamp:    timestamp,
+		CPU:          tree.TotalCPU,
+		MemoryMB:     tree.TotalMemory,
+		ProcessCount: tree.ChildCount + 1,
+	}
+	var walk func(node *ProcessTreeNode)
+	walk = func(node *ProcessTreeNode) {
+		sample.DiskIOMB += node.Process.DiskReadMB + node.Process.DiskWriteMB
+		sample.NetIOKB += node.Process.NetSentKB + node.Process.NetRecvKB
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(tree)
+	return sample
+}
+
+// ============== TaskStorageFile Implementation ==============
+
+// samplesPath returns the JSON lines file holding a task's time series
+func (ts *TaskStorageFile) samplesPath(taskID int) string {
+	return filepath.Join(filepath.Dir(ts.filePath), "task-stats", strconv.Itoa(taskID)+".jsonl")
+}
+
+// SaveTaskSamples appends samples to each task's JSON lines file
+func (ts *TaskStorageFile) SaveTaskSamples(samples []TaskSample) error {
+	byTask := make(map[int][]TaskSample)
+	for _, s := range samples {
+		byTask[s.TaskID] = append(byTask[s.TaskID], s)
+	}
+
+	for taskID, taskSamples := range byTask {
+		path := ts.samplesPath(taskID)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		encoder := json.NewEncoder(w)
+		for _, s := range taskSamples {
+			if err := encoder.Encode(s); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaskSamples reads a task's time series; a partially written last line is skipped
+func (ts *TaskStorageFile) TaskSamples(taskID int) ([]TaskSample, error) {
+	f, err := os.Open(ts.samplesPath(taskID))
+	if os.IsNotExist(err) {
+		return []TaskSample{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := []TaskSample{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s TaskSample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read samples of task %d: %w", taskID, err)
+	}
+	return samples, nil
+}
+
+// removeTaskSamples deletes a task's time series file
+func (ts *TaskStorageFile) removeTaskSamples(taskID int) {
+	os.Remove(ts.samplesPath(taskID))
+}
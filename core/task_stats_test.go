@@ -0,0 +1,158 @@
+package core
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// taskTreeRecords returns a web server process running a task's shell with two descendants,
+// plus an unrelated process
+func taskTreeRecords(rootPID int32) []ResourceRecord {
+	return []ResourceRecord{
+		{PID: 100, PPID: 1, Name: "process-tracker", CPUPercentNormalized: 50, MemoryMB: 1000},
+		{PID: rootPID, PPID: 100, Name: "sh", CPUPercentNormalized: 1, MemoryMB: 2, DiskReadMB: 1, NetSentKB: 10},
+		{PID: rootPID + 1, PPID: rootPID, Name: "make", CPUPercentNormalized: 10, MemoryMB: 20, DiskReadMB: 1, DiskWriteMB: 1},
+		{PID: rootPID + 2, PPID: rootPID + 1, Name: "cc", CPUPercentNormalized: 30, MemoryMB: 200, DiskWriteMB: 5, NetRecvKB: 5},
+		{PID: 200, PPID: 1, Name: "other", CPUPercentNormalized: 90, MemoryMB: 4000},
+	}
+}
+
+// TestTaskManager_UpdateTaskFromProcessTree tests that the collecting instance picks up a task
+// started by another instance and records its tree usage as a time series
+func TestTaskManager_UpdateTaskFromProcessTree(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "tracker.db")
+	web := openTestSQLite(t, dbPath)
+	defer web.Close()
+	daemon := openTestSQLite(t, dbPath)
+	defer daemon.Close()
+
+	webTasks := NewTaskManagerWithStorage(dir, taskTestConfig(), NewSQLiteTaskStorage(web, ""))
+	daemonTasks := NewTaskManagerWithStorage(dir, taskTestConfig(), NewSQLiteTaskStorage(daemon, ""))
+
+	task, err := webTasks.CreateTask("build", "make", 1)
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	// Mark the task running the way executeTask does, without starting a real command
+	started := time.Now()
+	task.Status = StatusRunning
+	task.StartedAt = &started
+	task.RootPID = 500
+	if err := webTasks.storage.SaveTask(task); err != nil {
+		t.Fatalf("SaveTask failed: %v", err)
+	}
+
+	daemonTasks.syncNow()
+	daemonTasks.UpdateTaskFromProcessTree(taskTreeRecords(500))
+	daemonTasks.UpdateTaskFromProcessTree(taskTreeRecords(500))
+	daemonTasks.syncNow()
+
+	stats, err := webTasks.GetTaskStats(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskStats failed: %v", err)
+	}
+	if len(stats.Samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(stats.Samples))
+	}
+	s := stats.Samples[0]
+	if s.ProcessCount != 3 || s.CPU != 41 || s.MemoryMB != 222 || s.DiskIOMB != 8 || s.NetIOKB != 15 {
+		t.Errorf("Expected the task tree aggregated once per process, got %+v", s)
+	}
+	if stats.Summary.PeakMemoryMB != 222 || stats.Summary.PeakProcesses != 3 || stats.Summary.TotalDiskIOMB != 8 {
+		t.Errorf("Unexpected summary: %+v", stats.Summary)
+	}
+
+	// Once the task has finished elsewhere, no more samples are recorded
+	completed := time.Now()
+	task.Status = StatusCompleted
+	task.CompletedAt = &completed
+	webTasks.storage.SaveTask(task)
+	daemonTasks.syncNow()
+	daemonTasks.UpdateTaskFromProcessTree(taskTreeRecords(500))
+	daemonTasks.syncNow()
+
+	synced, _ := daemonTasks.GetTask(task.ID)
+	if synced.Status != StatusCompleted {
+		t.Errorf("Expected the daemon to see the task completed, got %s", synced.Status)
+	}
+	if stats, _ := daemonTasks.GetTaskStats(task.ID); len(stats.Samples) != 2 {
+		t.Errorf("Expected no samples after completion, got %d", len(stats.Samples))
+	}
+
+	if err := webTasks.DeleteTask(task.ID); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+	if samples, _ := NewSQLiteTaskStorage(web, "").TaskSamples(task.ID); len(samples) != 0 {
+		t.Errorf("Expected samples deleted with the task, got %d", len(samples))
+	}
+}
+
+// TestTaskStorageFile_Samples tests the JSON lines time series of the file task storage
+// and the summary computed from it
+func TestTaskStorageFile_Samples(t *testing.T) {
+	dir := t.TempDir()
+	ts := NewTaskStorageFile(filepath.Join(dir, "tasks.json"))
+	ts.SaveTask(&Task{ID: 1, Name: "t", Status: StatusRunning, CreatedAt: time.Now()})
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	samples := []TaskSample{
+		{TaskID: 1, Timestamp: start, CPU: 10, MemoryMB: 100, DiskIOMB: 5, ProcessCount: 1},
+		{TaskID: 1, Timestamp: start.Add(10 * time.Second), CPU: 50, MemoryMB: 300, DiskIOMB: 20, ProcessCount: 4},
+		{TaskID: 1, Timestamp: start.Add(20 * time.Second), CPU: 30, MemoryMB: 200, DiskIOMB: 12, ProcessCount: 2},
+	}
+	if err := ts.SaveTaskSamples(samples); err != nil {
+		t.Fatalf("SaveTaskSamples failed: %v", err)
+	}
+
+	got, err := ts.TaskSamples(1)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("Expected 3 samples, got %d (%v)", len(got), err)
+	}
+
+	summary := SummarizeTaskSamples(got)
+	if summary.PeakCPU != 50 || summary.AvgCPU != 30 || summary.PeakMemoryMB != 300 || summary.PeakProcesses != 4 {
+		t.Errorf("Unexpected peaks and averages: %+v", summary)
+	}
+	// The largest cumulative counter wins, even after a process in the tree exited
+	if summary.TotalDiskIOMB != 20 {
+		t.Errorf("Expected total disk I/O 20, got %v", summary.TotalDiskIOMB)
+	}
+	expected := (50.0 + 30.0) / 100 * float64(SystemCPUCores()) * 10
+	if math.Abs(summary.CPUSeconds-expected) > 1e-9 {
+		t.Errorf("Expected %v CPU seconds, got %v", expected, summary.CPUSeconds)
+	}
+
+	if err := ts.DeleteTask(1); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+	if got, _ := ts.TaskSamples(1); len(got) != 0 {
+		t.Errorf("Expected samples deleted with the task, got %d", len(got))
+	}
+}
+
+// TestTaskStorageFile_LoadActiveTasks tests that the file task storage sees tasks changed by
+// another instance and hands out copies of the tasks it keeps between calls
+func TestTaskStorageFile_LoadActiveTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	daemon := NewTaskStorageFile(path)
+	web := NewTaskStorageFile(path)
+	web.SaveTask(&Task{ID: 1, Name: "done", Status: StatusCompleted, CreatedAt: time.Now()})
+	web.SaveTask(&Task{ID: 2, Name: "serve", Status: StatusRunning, CreatedAt: time.Now()})
+
+	active, err := daemon.LoadActiveTasks([]int{1})
+	if err != nil || len(active) != 2 {
+		t.Fatalf("Expected the running task and the tracked one, got %d (%v)", len(active), err)
+	}
+	active[1].Status = StatusFailed
+	if again, _ := daemon.LoadActiveTasks(nil); len(again) != 1 || again[0].Status != StatusRunning {
+		t.Errorf("Expected the cached running task unchanged, got %+v", again)
+	}
+
+	web.SaveTask(&Task{ID: 2, Name: "serve", Status: StatusStopped, CreatedAt: time.Now()})
+	if active, _ := daemon.LoadActiveTasks([]int{2}); len(active) != 1 || active[0].Status != StatusStopped {
+		t.Errorf("Expected the stop made by the other instance, got %+v", active)
+	}
+}
@@ -2,7 +2,6 @@ package core
 
 import (
 	"fmt"
-	"strings"
 	"time"
 )
 
@@ -10,12 +9,18 @@ import (
 // Simplified to follow "simple first" principle
 type Config struct {
 	// Core settings (rarely need to change)
-	EnableSmartCategories bool                // Enable intelligent process categorization (default: true)
-	Storage               StorageConfig       // Storage management configuration
-	Docker                DockerConfig        // Docker monitoring configuration
-	Web                   WebConfig           // Web dashboard configuration
-	Alerts                AlertConfig         // Alert configuration
-	Notifiers             NotifiersConfig     // Notifiers configuration
+	EnableSmartCategories bool             `yaml:"enable_smart_categories"` // Enable intelligent process categorization (default: true)
+	Storage               StorageConfig    `yaml:"storage"`                 // Storage management configuration
+	Docker                DockerConfig     `yaml:"docker"`                  // Docker monitoring configuration
+	Web                   WebConfig        `yaml:"web"`                     // Web dashboard configuration
+	Alerts                AlertConfig      `yaml:"alerts"`                  // Alert configuration
+	Notifiers             NotifiersConfig  `yaml:"notifiers"`               // Notifiers configuration
+	Filters               FilterConfig     `yaml:"filters"`                 // Process include/exclude filters
+	Categories            CategoriesConfig `yaml:"categories"`              // User-defined categorization rules
+	Backup                BackupConfig     `yaml:"backup"`                  // Scheduled backups
+	Sinks                 []SinkConfig     `yaml:"sinks"`                   // Extra destinations receiving every snapshot
+	Metrics               MetricsConfig    `yaml:"metrics"`                 // Prometheus exporter series and labels
+	Cluster               ClusterConfig    `yaml:"cluster"`                 // Agent/aggregator mode for tracking several hosts
 }
 
 // WebConfig represents web dashboard configuration
@@ -31,34 +36,125 @@ type StorageConfig struct {
 	MaxSizeMB int `yaml:"max_size_mb"` // Maximum total storage size in MB (default: 100)
 	KeepDays  int `yaml:"keep_days"`   // Keep data for N days, 0=forever (default: 7)
 
+	// Per-process retention overriding keep_days for process samples; first matching rule wins
+	Retention []RetentionRule `yaml:"retention"`
+
 	// SQLite特有配置
 	Type           string `yaml:"type"`             // 存储类型: "csv", "sqlite"
 	SQLitePath     string `yaml:"sqlite_path"`     // SQLite数据库路径
 	SQLiteWAL      bool   `yaml:"sqlite_wal"`      // 是否启用WAL模式
 	SQLiteCacheSize int    `yaml:"sqlite_cache_size"` // SQLite缓存大小(KB)
+
+	// 分级汇总配置（仅SQLite）
+	Rollups RollupConfig `yaml:"rollups"`
+
+	// Asynchronous write queue used by the monitoring daemon
+	Write WriteConfig `yaml:"write"`
+}
+
+// WriteConfig controls the bounded write queue between collection and storage
+type WriteConfig struct {
+	QueueSize    int    `yaml:"queue_size"`     // Snapshots buffered before spilling to the journal (default: 64)
+	BatchSize    int    `yaml:"batch_size"`     // Records per storage write (default: 5000)
+	FlushSeconds int    `yaml:"flush_seconds"`  // Longest time records wait before being written (default: 5)
+	MaxRetries   int    `yaml:"max_retries"`    // Write attempts before a batch is spilled (default: 5)
+	JournalPath  string `yaml:"journal_path"`   // Spill journal (default: write-journal.jsonl next to the data file)
+	JournalMaxMB int    `yaml:"journal_max_mb"` // Journal size limit; records beyond it are dropped (default: 50)
+}
+
+// BackupConfig controls backups taken on a schedule by the monitoring daemon
+type BackupConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // Take scheduled backups (default: false)
+	Dir           string `yaml:"dir"`            // Backup directory (default: backups/ next to the data file)
+	IntervalHours int    `yaml:"interval_hours"` // Hours between backups (default: 24)
+	Keep          int    `yaml:"keep"`           // Backups retained, oldest removed first; 0=keep all (default: 7)
+}
+
+// RollupConfig 控制SQLite进程记录的分级汇总（1分钟、1小时、1天），每个层级有独立的保留期限
+type RollupConfig struct {
+	Enabled        bool `yaml:"enabled"`          // 是否维护汇总表 (默认: true)
+	MinuteKeepDays int  `yaml:"minute_keep_days"` // 1分钟汇总保留天数，0=永久 (默认: 30)
+	HourKeepDays   int  `yaml:"hour_keep_days"`   // 1小时汇总保留天数，0=永久 (默认: 400)
+	DayKeepDays    int  `yaml:"day_keep_days"`    // 1天汇总保留天数，0=永久 (默认: 1825)
 }
 
 // ResourceRecord represents a single resource usage record
 type ResourceRecord struct {
-	Timestamp            time.Time `json:"timestamp"`
-	Name                 string    `json:"name"`
-	CPUPercent           float64   `json:"cpu_percent"`            // Raw CPU percent (can exceed 100% on multi-core)
-	CPUPercentNormalized float64   `json:"cpu_percent_normalized"` // Normalized CPU percent (0-100% of total system CPU)
-	MemoryMB             float64   `json:"memory_mb"`
-	MemoryPercent        float64   `json:"memory_percent"` // Memory usage as percentage of system total
-	Threads              int32     `json:"threads"`
-	DiskReadMB           float64   `json:"disk_read_mb"`
-	DiskWriteMB          float64   `json:"disk_write_mb"`
-	NetSentKB            float64   `json:"net_sent_kb"`
-	NetRecvKB            float64   `json:"net_recv_kb"`
-	IsActive             bool      `json:"is_active"`
-	Command              string    `json:"command"`
-	WorkingDir           string    `json:"working_dir"`
-	Category             string    `json:"category"`
-	PID                  int32     `json:"pid"`         // Process ID
-	PPID                 int32     `json:"ppid"`        // Parent Process ID
-	CreateTime           int64     `json:"create_time"` // Process start time (Unix timestamp)
-	CPUTime              float64   `json:"cpu_time"`    // Cumulative CPU time in seconds
+	Timestamp            time.Time         `json:"timestamp"`
+	Name                 string            `json:"name"`
+	CPUPercent           float64           `json:"cpu_percent"`            // Raw CPU percent (can exceed 100% on multi-core)
+	CPUPercentNormalized float64           `json:"cpu_percent_normalized"` // Normalized CPU percent (0-100% of total system CPU)
+	MemoryMB             float64           `json:"memory_mb"`
+	MemoryPercent        float64           `json:"memory_percent"` // Memory usage as percentage of system total
+	Threads              int32             `json:"threads"`
+	DiskReadMB           float64           `json:"disk_read_mb"`
+	DiskWriteMB          float64           `json:"disk_write_mb"`
+	NetSentKB            float64           `json:"net_sent_kb"`
+	NetRecvKB            float64           `json:"net_recv_kb"`
+	IsActive             bool              `json:"is_active"`
+	Command              string            `json:"command"`
+	WorkingDir           string            `json:"working_dir"`
+	Category             string            `json:"category"`
+	Labels               map[string]string `json:"labels,omitempty"` // Labels assigned by category rules
+	PID                  int32             `json:"pid"`              // Process ID
+	PPID                 int32             `json:"ppid"`             // Parent Process ID
+	CreateTime           int64             `json:"create_time"`      // Process start time (Unix timestamp)
+	CPUTime              float64           `json:"cpu_time"`         // Cumulative CPU time in seconds
+	UID                  int32             `json:"uid"`              // Real user ID of the owner
+	Username             string            `json:"username"`         // Owner user name (numeric UID if unresolvable)
+	Host                 string            `json:"host,omitempty"`   // Machine the record was collected on; empty when running standalone
+}
+
+// SystemRecord represents a single host-level metrics sample
+// Unlike the per-process sums, these values come straight from the kernel and
+// include kernel memory, page cache and idle CPU
+type SystemRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	// Load averages
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+
+	// CPU utilization by mode (percent of total CPU time since the previous sample)
+	CPUPercent float64 `json:"cpu_percent"` // Busy = 100 - idle - iowait
+	CPUUser    float64 `json:"cpu_user"`
+	CPUSystem  float64 `json:"cpu_system"`
+	CPUNice    float64 `json:"cpu_nice"`
+	CPUIdle    float64 `json:"cpu_idle"`
+	CPUIOWait  float64 `json:"cpu_iowait"`
+	CPUIRQ     float64 `json:"cpu_irq"` // irq + softirq
+	CPUSteal   float64 `json:"cpu_steal"`
+
+	// Memory (MB)
+	MemoryTotalMB     float64 `json:"memory_total_mb"`
+	MemoryUsedMB      float64 `json:"memory_used_mb"`
+	MemoryAvailableMB float64 `json:"memory_available_mb"`
+	MemoryCachedMB    float64 `json:"memory_cached_mb"`
+	MemoryBuffersMB   float64 `json:"memory_buffers_mb"`
+	MemoryPercent     float64 `json:"memory_percent"`
+	SwapTotalMB       float64 `json:"swap_total_mb"`
+	SwapUsedMB        float64 `json:"swap_used_mb"`
+
+	// Pressure stall information (avg10, percent), zero when /proc/pressure is unavailable
+	PSICPUSome    float64 `json:"psi_cpu_some"`
+	PSIMemorySome float64 `json:"psi_memory_some"`
+	PSIMemoryFull float64 `json:"psi_memory_full"`
+	PSIIOSome     float64 `json:"psi_io_some"`
+	PSIIOFull     float64 `json:"psi_io_full"`
+
+	// Per-mount disk usage
+	Disks []DiskUsage `json:"disks"`
+}
+
+// DiskUsage represents usage of a single mounted filesystem
+type DiskUsage struct {
+	Mountpoint  string  `json:"mountpoint"`
+	Device      string  `json:"device"`
+	Fstype      string  `json:"fstype"`
+	TotalMB     float64 `json:"total_mb"`
+	UsedMB      float64 `json:"used_mb"`
+	UsedPercent float64 `json:"used_percent"`
 }
 
 // ResourceStats represents calculated resource statistics
@@ -78,13 +174,24 @@ type ResourceStats struct {
 	NetRecvAvg    float64       `json:"net_recv_avg"`
 	Samples       int           `json:"samples"`
 	ActiveSamples int           `json:"active_samples"`
+	CPUP50        float64       `json:"cpu_p50"`
+	CPUP90        float64       `json:"cpu_p90"`
+	CPUP95        float64       `json:"cpu_p95"`
+	CPUP99        float64       `json:"cpu_p99"`
+	CPUStdDev     float64       `json:"cpu_stddev"`
+	MemoryP50     float64       `json:"memory_p50"`
+	MemoryP90     float64       `json:"memory_p90"`
+	MemoryP95     float64       `json:"memory_p95"`
+	MemoryP99     float64       `json:"memory_p99"`
+	MemoryStdDev  float64       `json:"memory_stddev"`
 	PIDs             []int32       `json:"pids"`               // All observed PIDs
 	FirstSeen        time.Time     `json:"first_seen"`         // First observation time
 	LastSeen         time.Time     `json:"last_seen"`          // Last observation time
 	TotalUptime      time.Duration `json:"total_uptime"`       // Observation duration
 	ProcessStartTime time.Time     `json:"process_start_time"` // Process actual start time
-	TotalCPUTime     time.Duration `json:"total_cpu_time"`     // Total CPU time consumed
+	TotalCPUTime     time.Duration `json:"total_cpu_time"`     // CPU time consumed while observed
 	AvgCPUTime       float64       `json:"avg_cpu_time"`       // Average CPU time per sample
+	Latest           ResourceRecord `json:"-"`                 // Most recent record
 }
 
 // ProcessTreeNode represents a node in the process tree hierarchy
@@ -118,6 +225,8 @@ func GetDefaultConfig() Config {
 		Storage: StorageConfig{
 			MaxSizeMB: 100, // 100MB total storage (auto-rotates)
 			KeepDays:  7,   // Keep 7 days of data
+			Rollups:   GetDefaultRollupConfig(),
+			Write:     GetDefaultWriteConfig(),
 		},
 		Docker: DockerConfig{
 			Enabled: true, // Auto-detect and enable if available
@@ -133,6 +242,8 @@ func GetDefaultConfig() Config {
 			SuppressDuration: 30, // 30 minutes
 		},
 		Notifiers: NotifiersConfig{},
+		Filters:   GetDefaultFilterConfig(),
+		Backup:    GetDefaultBackupConfig(),
 	}
 }
 
@@ -145,6 +256,35 @@ func GetDefaultActivityConfig() ActivityConfig {
 	}
 }
 
+// GetDefaultRollupConfig returns default rollup tiers: a month of minutes, over a year of hours, five years of days
+func GetDefaultRollupConfig() RollupConfig {
+	return RollupConfig{
+		Enabled:        true,
+		MinuteKeepDays: 30,
+		HourKeepDays:   400,
+		DayKeepDays:    1825,
+	}
+}
+
+// GetDefaultWriteConfig returns default write queue settings
+func GetDefaultWriteConfig() WriteConfig {
+	return WriteConfig{
+		QueueSize:    64,
+		BatchSize:    5000,
+		FlushSeconds: 5,
+		MaxRetries:   5,
+		JournalMaxMB: 50,
+	}
+}
+
+// GetDefaultBackupConfig returns default backup settings: daily, keeping a week (disabled until enabled in config)
+func GetDefaultBackupConfig() BackupConfig {
+	return BackupConfig{
+		IntervalHours: 24,
+		Keep:          7,
+	}
+}
+
 // GetDefaultStorageConfig returns default storage configuration
 func GetDefaultStorageConfig() StorageConfig {
 	return StorageConfig{
@@ -154,6 +294,8 @@ func GetDefaultStorageConfig() StorageConfig {
 		SQLitePath:     "",    // 使用默认路径
 		SQLiteWAL:      true,  // 启用WAL模式
 		SQLiteCacheSize: 2000,  // 2KB缓存
+		Rollups:         GetDefaultRollupConfig(),
+		Write:           GetDefaultWriteConfig(),
 	}
 }
 
@@ -164,45 +306,12 @@ func IsActive(record ResourceRecord, config ActivityConfig) bool {
 }
 
 // IdentifyApplication categorizes an application based on name and command
+// using the built-in category rules (see Categorizer for user-defined rules)
 func IdentifyApplication(name, command string, useSmartCategories bool) string {
 	if !useSmartCategories {
 		return "other"
 	}
-
-	name = strings.ToLower(name)
-	command = strings.ToLower(command)
-
-	// Development tools
-	if strings.Contains(name, "go") || strings.Contains(name, "gcc") || strings.Contains(name, "python") ||
-		strings.Contains(name, "node") || strings.Contains(name, "java") || strings.Contains(name, "code") {
-		return "development"
-	}
-
-	// Browsers
-	if strings.Contains(name, "chrome") || strings.Contains(name, "firefox") || strings.Contains(name, "safari") ||
-		strings.Contains(name, "edge") || strings.Contains(name, "opera") {
-		return "browser"
-	}
-
-	// System tools
-	if strings.Contains(name, "ssh") || strings.Contains(name, "bash") || strings.Contains(name, "zsh") ||
-		strings.Contains(name, "systemd") || strings.Contains(name, "docker") {
-		return "system"
-	}
-
-	// Media
-	if strings.Contains(name, "vlc") || strings.Contains(name, "mpv") || strings.Contains(name, "spotify") ||
-		strings.Contains(name, "rhythm") {
-		return "media"
-	}
-
-	// Office
-	if strings.Contains(name, "libre") || strings.Contains(name, "office") || strings.Contains(name, "word") ||
-		strings.Contains(name, "excel") || strings.Contains(name, "powerpoint") {
-		return "office"
-	}
-
-	return "other"
+	return defaultCategorizer.Categorize(CategoryInput{Name: name, Cmdline: command}).Category
 }
 
 // ValidateStorageConfig validates storage configuration (simplified)
@@ -219,12 +328,44 @@ func ValidateStorageConfig(config StorageConfig) error {
 	if config.KeepDays > 365 {
 		return fmt.Errorf("keep_days too large (max 365 days)")
 	}
+	rollups := config.Rollups
+	if rollups.MinuteKeepDays < 0 || rollups.HourKeepDays < 0 || rollups.DayKeepDays < 0 {
+		return fmt.Errorf("rollups keep days must be non-negative (0 means forever)")
+	}
+	if err := ValidateRetentionRules(config.Retention); err != nil {
+		return err
+	}
+	write := config.Write
+	if write.QueueSize < 0 || write.BatchSize < 0 || write.FlushSeconds < 0 || write.MaxRetries < 0 || write.JournalMaxMB < 0 {
+		return fmt.Errorf("write queue settings must be non-negative (0 means default)")
+	}
 	return nil
 }
 
 // ValidateConfig validates the entire configuration (simplified)
 func ValidateConfig(config Config) error {
-	return ValidateStorageConfig(config.Storage)
+	if err := ValidateStorageConfig(config.Storage); err != nil {
+		return err
+	}
+	if err := ValidateFilterConfig(config.Filters); err != nil {
+		return err
+	}
+	if config.Backup.IntervalHours < 0 || config.Backup.Keep < 0 {
+		return fmt.Errorf("backup interval_hours and keep must be non-negative")
+	}
+	if err := ValidateSinkConfigs(config.Sinks); err != nil {
+		return err
+	}
+	if err := ValidateMetricsConfig(config.Metrics); err != nil {
+		return err
+	}
+	if err := ValidateClusterConfig(config.Cluster); err != nil {
+		return err
+	}
+	if err := ValidateAlertConfig(config.Alerts); err != nil {
+		return err
+	}
+	return ValidateCategoriesConfig(config.Categories)
 }
 
 // ============== Task Management Structures ==============
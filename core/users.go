@@ -0,0 +1,162 @@
+package core
+
+import (
+	"os/user"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// usernameCache maps UIDs to user names; user lookups are too slow to repeat every collection cycle
+var usernameCache sync.Map
+
+// usernameForUID resolves a UID to a user name, falling back to the numeric UID
+// (e.g. for users that only exist inside a container)
+func usernameForUID(uid int32) string {
+	if name, ok := usernameCache.Load(uid); ok {
+		return name.(string)
+	}
+
+	uidStr := strconv.FormatInt(int64(uid), 10)
+	name := uidStr
+	if u, err := user.LookupId(uidStr); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	usernameCache.Store(uid, name)
+	return name
+}
+
+// UserStats aggregates the resource usage of all processes owned by one user
+type UserStats struct {
+	Username     string  `json:"username"`
+	UID          int32   `json:"uid"`
+	ProcessCount int     `json:"process_count"` // Distinct processes seen in the period
+	Samples      int     `json:"samples"`       // Number of collection cycles the user had processes in
+	AvgCPU       float64 `json:"avg_cpu"`       // Average of the per-cycle CPU sum (raw percent)
+	MaxCPU       float64 `json:"max_cpu"`       // Maximum per-cycle CPU sum (raw percent)
+	AvgMemoryMB  float64 `json:"avg_memory_mb"` // Average of the per-cycle memory sum
+	MaxMemoryMB  float64 `json:"max_memory_mb"` // Maximum per-cycle memory sum
+}
+
+// UserKey returns the name records are grouped by in per-user statistics
+func (r ResourceRecord) UserKey() string {
+	if r.Username == "" {
+		return "unknown"
+	}
+	return r.Username
+}
+
+// collectionCycles numbers the collection cycle of each record
+// A collection stamps all its records with one timestamp, but records written by older versions
+// are milliseconds apart and may straddle a second, so records of the same host less than a
+// second apart count as one cycle
+func collectionCycles(records []ResourceRecord) []int {
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := records[order[i]], records[order[j]]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+
+	cycles := make([]int, len(records))
+	cycle := -1
+	for n, i := range order {
+		if n == 0 {
+			cycle++
+		} else if prev := records[order[n-1]]; prev.Host != records[i].Host || records[i].Timestamp.Sub(prev.Timestamp) >= time.Second {
+			cycle++
+		}
+		cycles[i] = cycle
+	}
+	return cycles
+}
+
+// CalculateUserStats aggregates records by owner
+// Within each collection cycle the usage of a user's processes is summed, then the
+// per-cycle totals are averaged, so the result answers "how much does this user use"
+// rather than "how much does a typical process of this user use"
+func CalculateUserStats(records []ResourceRecord) []UserStats {
+	type cycle struct {
+		cpu    float64
+		memory float64
+	}
+	type userAgg struct {
+		stats  UserStats
+		pids   map[int32]struct{}
+		cycles map[int]*cycle
+	}
+
+	cycleOf := collectionCycles(records)
+	users := make(map[string]*userAgg)
+	for i, r := range records {
+		key := r.UserKey()
+		agg, ok := users[key]
+		if !ok {
+			agg = &userAgg{
+				stats:  UserStats{Username: key, UID: r.UID},
+				pids:   make(map[int32]struct{}),
+				cycles: make(map[int]*cycle),
+			}
+			users[key] = agg
+		}
+
+		agg.pids[r.PID] = struct{}{}
+		c, ok := agg.cycles[cycleOf[i]]
+		if !ok {
+			c = &cycle{}
+			agg.cycles[cycleOf[i]] = c
+		}
+		c.cpu += r.CPUPercent
+		c.memory += r.MemoryMB
+	}
+
+	stats := make([]UserStats, 0, len(users))
+	for _, agg := range users {
+		s := agg.stats
+		s.ProcessCount = len(agg.pids)
+		s.Samples = len(agg.cycles)
+		for _, c := range agg.cycles {
+			s.AvgCPU += c.cpu
+			s.AvgMemoryMB += c.memory
+			if c.cpu > s.MaxCPU {
+				s.MaxCPU = c.cpu
+			}
+			if c.memory > s.MaxMemoryMB {
+				s.MaxMemoryMB = c.memory
+			}
+		}
+		if s.Samples > 0 {
+			s.AvgCPU /= float64(s.Samples)
+			s.AvgMemoryMB /= float64(s.Samples)
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].AvgCPU != stats[j].AvgCPU {
+			return stats[i].AvgCPU > stats[j].AvgCPU
+		}
+		return stats[i].Username < stats[j].Username
+	})
+	return stats
+}
+
+// filterRecordsByUser returns the records owned by a user; an empty user matches all records
+func filterRecordsByUser(records []ResourceRecord, username string) []ResourceRecord {
+	if username == "" {
+		return records
+	}
+	var filtered []ResourceRecord
+	for _, r := range records {
+		if r.Username == username {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
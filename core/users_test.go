@@ -0,0 +1,131 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCalculateUserStats tests per-user aggregation across collection cycles
+func TestCalculateUserStats(t *testing.T) {
+	t1 := time.Unix(1729000000, 0)
+	t2 := t1.Add(5 * time.Second)
+
+	records := []ResourceRecord{
+		{Timestamp: t1, PID: 1, Username: "alice", UID: 1000, CPUPercent: 50, MemoryMB: 100},
+		{Timestamp: t1, PID: 2, Username: "alice", UID: 1000, CPUPercent: 30, MemoryMB: 50},
+		{Timestamp: t2, PID: 1, Username: "alice", UID: 1000, CPUPercent: 40, MemoryMB: 100},
+		{Timestamp: t1, PID: 3, Username: "bob", UID: 1001, CPUPercent: 10, MemoryMB: 500},
+		{Timestamp: t2, PID: 4, CPUPercent: 5, MemoryMB: 10},
+	}
+
+	stats := CalculateUserStats(records)
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 users, got %d: %+v", len(stats), stats)
+	}
+
+	alice := stats[0]
+	if alice.Username != "alice" || alice.UID != 1000 {
+		t.Fatalf("Expected alice first (highest CPU), got %+v", alice)
+	}
+	if alice.ProcessCount != 2 || alice.Samples != 2 {
+		t.Errorf("Expected 2 processes in 2 samples, got %d/%d", alice.ProcessCount, alice.Samples)
+	}
+	// Cycle totals: t1 = 80% / 150MB, t2 = 40% / 100MB
+	if alice.AvgCPU != 60 || alice.MaxCPU != 80 {
+		t.Errorf("Expected avg/max CPU 60/80, got %.1f/%.1f", alice.AvgCPU, alice.MaxCPU)
+	}
+	if alice.AvgMemoryMB != 125 || alice.MaxMemoryMB != 150 {
+		t.Errorf("Expected avg/max memory 125/150, got %.1f/%.1f", alice.AvgMemoryMB, alice.MaxMemoryMB)
+	}
+
+	if stats[1].Username != "bob" || stats[2].Username != "unknown" {
+		t.Errorf("Unexpected order: %s, %s", stats[1].Username, stats[2].Username)
+	}
+}
+
+// TestCalculateUserStats_SecondBoundary tests that a collection whose records straddle a
+// second boundary counts as one cycle, per host
+func TestCalculateUserStats_SecondBoundary(t *testing.T) {
+	t1 := time.Unix(1729000000, 995*int64(time.Millisecond))
+	t2 := t1.Add(5 * time.Second)
+
+	records := []ResourceRecord{
+		{Timestamp: t1, PID: 1, Username: "alice", CPUPercent: 50, MemoryMB: 100},
+		{Timestamp: t1.Add(10 * time.Millisecond), PID: 2, Username: "alice", CPUPercent: 30, MemoryMB: 50},
+		{Timestamp: t2, PID: 1, Username: "alice", CPUPercent: 40, MemoryMB: 100},
+		{Timestamp: t2.Add(10 * time.Millisecond), PID: 2, Username: "alice", CPUPercent: 20, MemoryMB: 50},
+		{Timestamp: t1, Host: "web-1", PID: 1, Username: "alice", CPUPercent: 10, MemoryMB: 10},
+	}
+
+	stats := CalculateUserStats(records)
+	if len(stats) != 1 {
+		t.Fatalf("Expected 1 user, got %+v", stats)
+	}
+	alice := stats[0]
+	// Cycle totals: t1 = 80% / 150MB, t2 = 60% / 150MB, web-1 = 10% / 10MB
+	if alice.Samples != 3 {
+		t.Errorf("Expected 3 cycles, got %d", alice.Samples)
+	}
+	if alice.AvgCPU != 50 || alice.MaxCPU != 80 || alice.MaxMemoryMB != 150 {
+		t.Errorf("Expected avg/max CPU 50/80 and max memory 150, got %+v", alice)
+	}
+}
+
+// TestAlertRule_UserFilter tests that alert rules only consider the configured user's processes
+func TestAlertRule_UserFilter(t *testing.T) {
+	config := AlertConfig{
+		Enabled: true,
+		Rules: []AlertRule{
+			{Name: "alice-cpu", Metric: "cpu_percent", Threshold: 50, Aggregation: "sum", User: "alice", Enabled: true},
+			{Name: "bob-cpu", Metric: "cpu_percent", Threshold: 50, Aggregation: "sum", User: "bob", Enabled: true},
+		},
+		SuppressDuration: 30,
+	}
+	am := NewAlertManager(config, NotifiersConfig{})
+
+	am.Evaluate([]ResourceRecord{
+		{Name: "train", Username: "alice", CPUPercent: 40},
+		{Name: "train", Username: "alice", CPUPercent: 40},
+		{Name: "vim", Username: "bob", CPUPercent: 20},
+	})
+
+	am.mu.RLock()
+	_, aliceAlert := am.states["alice-cpu"]
+	_, bobAlert := am.states["bob-cpu"]
+	am.mu.RUnlock()
+
+	if !aliceAlert {
+		t.Error("Expected alert for alice (80% total)")
+	}
+	if bobAlert {
+		t.Error("Expected no alert for bob (20% total)")
+	}
+}
+
+// TestOwnerStorageRoundTrip tests that UID and username survive the CSV format
+func TestOwnerStorageRoundTrip(t *testing.T) {
+	tmpFile := filepath.Join(os.TempDir(), "test-owner.log")
+	defer os.Remove(tmpFile)
+
+	manager := NewManager(tmpFile, 1, false, StorageConfig{})
+	record := ResourceRecord{
+		Timestamp: time.Unix(1729000000, 0),
+		Name:      "train",
+		PID:       4242,
+		UID:       1000,
+		Username:  "alice",
+	}
+	if err := os.WriteFile(tmpFile, []byte(manager.formatRecord(record)), 0644); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+
+	records, err := manager.ReadRecords(tmpFile)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Failed to read records: %v (%d records)", err, len(records))
+	}
+	if records[0].UID != 1000 || records[0].Username != "alice" {
+		t.Errorf("Unexpected owner: uid=%d username=%s", records[0].UID, records[0].Username)
+	}
+}
@@ -0,0 +1,571 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	writeJournalFile = "write-journal.jsonl"
+	writeStatsFile   = "write-stats.json"
+
+	// Backoff between write attempts doubles from writeRetryBase up to writeRetryMax
+	writeRetryBase = 100 * time.Millisecond
+	writeRetryMax  = 5 * time.Second
+)
+
+// WriteStats reports the state of the write pipeline
+// All counts are records, except QueueDepth and QueueCapacity which count batches.
+type WriteStats struct {
+	QueueDepth     int       `json:"queue_depth"`     // Batches waiting to be written
+	QueueCapacity  int       `json:"queue_capacity"`  // Batches the queue holds before spilling
+	Enqueued       int64     `json:"enqueued"`        // Records accepted from the collector
+	Written        int64     `json:"written"`         // Records saved to storage (including replayed ones)
+	Retries        int64     `json:"retries"`         // Failed write attempts that were retried
+	Spilled        int64     `json:"spilled"`         // Records written to the spill journal
+	Replayed       int64     `json:"replayed"`        // Journal records later saved to storage
+	Dropped        int64     `json:"dropped"`         // Records lost (journal full or unwritable)
+	JournalRecords int64     `json:"journal_records"` // Records currently waiting in the journal
+	LastError      string    `json:"last_error,omitempty"`
+	LastErrorAt    time.Time `json:"last_error_at,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// RecordSaver is the destination of a write pipeline: storage, or a remote push target
+type RecordSaver interface {
+	SaveRecords(records []ResourceRecord) error
+}
+
+// permanentError marks a write the destination will never accept (e.g. a push rejected as
+// invalid), so the pipeline drops the batch instead of retrying or journaling it
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// WritePipeline decouples collection from storage with a bounded queue
+// Records are written in batches by size and time, failed writes are retried with
+// backoff, and batches that still fail (or arrive while the queue is full) are spilled
+// to a journal file that is replayed once storage accepts writes again.
+type WritePipeline struct {
+	storage RecordSaver
+	config  WriteConfig
+
+	flushInterval   time.Duration
+	journalMaxBytes int64
+	journalPath     string
+	statsPath       string
+
+	queue   chan []ResourceRecord
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu    sync.Mutex // Guards stats
+	stats WriteStats
+
+	journalMu sync.Mutex // Guards the journal file
+}
+
+// NewWritePipeline creates a write pipeline for storage; journal and stats files live in dataDir
+func NewWritePipeline(storage Storage, config WriteConfig, dataDir string) *WritePipeline {
+	if config.JournalPath == "" {
+		config.JournalPath = filepath.Join(dataDir, writeJournalFile)
+	}
+	return newWritePipeline(storage, config, filepath.Join(dataDir, writeStatsFile))
+}
+
+// newWritePipeline creates a pipeline writing to saver; an empty statsPath publishes no stats
+func newWritePipeline(saver RecordSaver, config WriteConfig, statsPath string) *WritePipeline {
+	defaults := GetDefaultWriteConfig()
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushSeconds <= 0 {
+		config.FlushSeconds = defaults.FlushSeconds
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = defaults.MaxRetries
+	}
+	if config.JournalMaxMB <= 0 {
+		config.JournalMaxMB = defaults.JournalMaxMB
+	}
+	journalPath := config.JournalPath
+
+	p := &WritePipeline{
+		storage:         saver,
+		config:          config,
+		flushInterval:   time.Duration(config.FlushSeconds) * time.Second,
+		journalMaxBytes: int64(config.JournalMaxMB) * 1024 * 1024,
+		journalPath:     journalPath,
+		statsPath:       statsPath,
+		queue:           make(chan []ResourceRecord, config.QueueSize),
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	p.stats.QueueCapacity = config.QueueSize
+
+	// Records left in the journal by a previous run are replayed on the first flush; a journal
+	// with nothing readable would never be replayed, so it is removed
+	if batches, corrupt, err := readJournal(journalPath); err == nil {
+		for _, batch := range batches {
+			p.stats.JournalRecords += int64(len(batch))
+		}
+		if p.stats.JournalRecords > 0 {
+			log.Printf("Write journal holds %d records from a previous run", p.stats.JournalRecords)
+		} else if corrupt > 0 {
+			log.Printf("Warning: removing write journal with %d unreadable lines", corrupt)
+			os.Remove(journalPath)
+		}
+	}
+	return p
+}
+
+// Start runs the writer goroutine
+func (p *WritePipeline) Start() {
+	go p.run()
+}
+
+// Enqueue hands a snapshot to the writer without blocking
+// When the queue is full the records go straight to the journal.
+func (p *WritePipeline) Enqueue(records []ResourceRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.stats.Enqueued += int64(len(records))
+	p.mu.Unlock()
+
+	select {
+	case p.queue <- records:
+	default:
+		p.recordError(fmt.Errorf("write queue full (%d batches)", cap(p.queue)))
+		p.spill(records)
+	}
+}
+
+// Close stops accepting work, writes what is queued and persists the final stats
+// Anything that cannot be written is left in the journal for the next run.
+func (p *WritePipeline) Close() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	close(p.done)
+	<-p.stopped
+	return nil
+}
+
+// Stats returns a snapshot of the pipeline counters
+func (p *WritePipeline) Stats() WriteStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.QueueDepth = len(p.queue)
+	return stats
+}
+
+func (p *WritePipeline) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	var pending []ResourceRecord
+	for {
+		select {
+		case batch := <-p.queue:
+			pending = append(pending, batch...)
+			if len(pending) >= p.config.BatchSize {
+				p.flush(pending)
+				pending = nil
+			}
+		case <-ticker.C:
+			p.flush(pending)
+			pending = nil
+		case <-p.done:
+			for len(p.queue) > 0 {
+				pending = append(pending, <-p.queue...)
+			}
+			p.flush(pending)
+			return
+		}
+	}
+}
+
+// flush replays the journal first so records reach storage in order, then writes pending
+func (p *WritePipeline) flush(pending []ResourceRecord) {
+	defer p.saveStats()
+
+	if p.journalRecords() > 0 {
+		if err := p.replayJournal(); err != nil {
+			p.recordError(err)
+			p.spill(pending)
+			return
+		}
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+	if err := p.writeWithRetry(pending); err != nil {
+		if isPermanent(err) {
+			p.drop(pending, err)
+			return
+		}
+		log.Printf("Warning: write failed after %d attempts, spilling %d records to journal: %v",
+			p.config.MaxRetries, len(pending), err)
+		p.spill(pending)
+	}
+}
+
+// writeWithRetry saves records, retrying with exponential backoff
+// Retrying stops early when the pipeline is closing.
+func (p *WritePipeline) writeWithRetry(records []ResourceRecord) error {
+	backoff := writeRetryBase
+	for attempt := 1; ; attempt++ {
+		err := p.storage.SaveRecords(records)
+		if err == nil {
+			p.mu.Lock()
+			p.stats.Written += int64(len(records))
+			p.mu.Unlock()
+			return nil
+		}
+		p.recordError(err)
+		if attempt >= p.config.MaxRetries || isPermanent(err) {
+			return err
+		}
+
+		p.mu.Lock()
+		p.stats.Retries++
+		p.mu.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-p.done:
+			return err
+		}
+		if backoff *= 2; backoff > writeRetryMax {
+			backoff = writeRetryMax
+		}
+	}
+}
+
+// spill appends records to the journal, dropping (and counting) them if that fails
+func (p *WritePipeline) spill(records []ResourceRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	line, err := json.Marshal(records)
+	if err != nil {
+		p.drop(records, err)
+		return
+	}
+	line = append(line, '\n')
+
+	p.journalMu.Lock()
+	defer p.journalMu.Unlock()
+
+	var size int64
+	if stat, err := os.Stat(p.journalPath); err == nil {
+		size = stat.Size()
+	}
+	if size+int64(len(line)) > p.journalMaxBytes {
+		p.drop(records, fmt.Errorf("write journal full (%d MB)", p.config.JournalMaxMB))
+		return
+	}
+
+	if err := appendJournal(p.journalPath, line); err != nil {
+		p.drop(records, err)
+		return
+	}
+
+	p.mu.Lock()
+	p.stats.Spilled += int64(len(records))
+	p.stats.JournalRecords += int64(len(records))
+	p.mu.Unlock()
+}
+
+func (p *WritePipeline) drop(records []ResourceRecord, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Dropped += int64(len(records))
+	p.stats.LastError = err.Error()
+	p.stats.LastErrorAt = time.Now()
+	log.Printf("Error: dropped %d records (%d lost in total): %v", len(records), p.stats.Dropped, err)
+}
+
+func (p *WritePipeline) recordError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.LastError = err.Error()
+	p.stats.LastErrorAt = time.Now()
+}
+
+func (p *WritePipeline) journalRecords() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats.JournalRecords
+}
+
+// replayJournal saves journaled batches in order
+// The journal lock is only held to read the oldest batch and, once it is saved, to cut it from
+// the journal, so spilling never waits for storage and a crash repeats at most one batch.
+// On failure the unsaved batches stay in the journal and the error is returned.
+func (p *WritePipeline) replayJournal() error {
+	replayed := 0
+	for {
+		p.journalMu.Lock()
+		batch, end, corrupt, err := readJournalHead(p.journalPath)
+		if err == nil && batch == nil {
+			// Only unreadable lines, if any, are left
+			err = os.Remove(p.journalPath)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+			p.mu.Lock()
+			p.stats.JournalRecords = 0
+			p.mu.Unlock()
+		}
+		p.journalMu.Unlock()
+		if corrupt > 0 {
+			log.Printf("Warning: skipped %d unreadable lines in write journal", corrupt)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replay write journal: %w", err)
+		}
+		if batch == nil {
+			break
+		}
+
+		n := int64(len(batch))
+		if err := p.storage.SaveRecords(batch); err != nil {
+			if !isPermanent(err) {
+				return fmt.Errorf("journal replay: %w", err)
+			}
+			p.drop(batch, err)
+		} else {
+			p.mu.Lock()
+			p.stats.Replayed += n
+			p.stats.Written += n
+			p.mu.Unlock()
+			replayed++
+		}
+
+		p.journalMu.Lock()
+		err = dropJournalHead(p.journalPath, end)
+		p.journalMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to rewrite write journal: %w", err)
+		}
+		p.mu.Lock()
+		p.stats.JournalRecords -= n
+		p.mu.Unlock()
+	}
+
+	if replayed > 0 {
+		log.Printf("Replayed %d journaled batches into storage", replayed)
+	}
+	return nil
+}
+
+// saveStats publishes the counters for `process-tracker status`
+func (p *WritePipeline) saveStats() {
+	if p.statsPath == "" {
+		return
+	}
+	stats := p.Stats()
+	stats.UpdatedAt = time.Now()
+	writeJSONAtomic(p.statsPath, stats)
+}
+
+// ReadWriteStats reads the write pipeline stats last published by the daemon writing dataFile
+func ReadWriteStats(dataFile string) (WriteStats, error) {
+	var stats WriteStats
+	err := readJSONFile(filepath.Join(filepath.Dir(dataFile), writeStatsFile), &stats)
+	return stats, err
+}
+
+// writeJSONAtomic writes v as JSON through a temporary file renamed over path, so the
+// processes reading the files the daemon publishes never see a partial one
+func writeJSONAtomic(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a uniquely named temporary file in the same directory,
+// syncs it and renames it over path, so neither a crash nor a concurrent writer leaves a
+// truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// readJSONFile decodes a file written by writeJSONAtomic into v
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// readJournal decodes journal batches; a missing journal is empty
+// Lines that do not decode (e.g. torn by a full disk) are skipped and counted.
+func readJournal(path string) ([][]ResourceRecord, int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var batches [][]ResourceRecord
+	corrupt := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var batch []ResourceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &batch); err != nil {
+			corrupt++
+			continue
+		}
+		batches = append(batches, batch)
+	}
+	return batches, corrupt, scanner.Err()
+}
+
+func appendJournal(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readJournalHead decodes the oldest batch of the journal and returns the offset just past it
+// Unreadable lines before it are counted and skipped; the batch is nil when none is left.
+func readJournalHead(path string) ([]ResourceRecord, int64, int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, 0, nil
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	corrupt := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) > 0 {
+			var batch []ResourceRecord
+			if json.Unmarshal(line, &batch) == nil {
+				return batch, offset, corrupt, nil
+			}
+			corrupt++
+		}
+		if err == io.EOF {
+			return nil, offset, corrupt, nil
+		}
+		if err != nil {
+			return nil, offset, corrupt, err
+		}
+	}
+}
+
+// dropJournalHead removes the first n bytes of the journal, and the journal once it is empty
+func dropJournalHead(path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if stat, err := f.Stat(); err != nil {
+		return err
+	} else if stat.Size() <= n {
+		return os.Remove(path)
+	}
+	if _, err := f.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyStorage records saved batches and fails while broken is set
+type flakyStorage struct {
+	Storage
+	mu     sync.Mutex
+	broken bool
+	saved  []ResourceRecord
+	calls  int
+	failAt int           // Fails the save with this call number (1-based) when set
+	slow   chan struct{} // Each save waits for a value when set
+}
+
+func (f *flakyStorage) SaveRecords(records []ResourceRecord) error {
+	if f.slow != nil {
+		<-f.slow
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.broken || f.calls == f.failAt {
+		return errors.New("database is locked")
+	}
+	f.saved = append(f.saved, records...)
+	return nil
+}
+
+func (f *flakyStorage) setBroken(broken bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.broken = broken
+}
+
+func (f *flakyStorage) savedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.saved)
+}
+
+func pipelineRecords(n int) []ResourceRecord {
+	records := make([]ResourceRecord, n)
+	for i := range records {
+		records[i] = ResourceRecord{Timestamp: time.Now(), Name: "worker", PID: int32(i + 1)}
+	}
+	return records
+}
+
+func newTestPipeline(t *testing.T, storage Storage, config WriteConfig) *WritePipeline {
+	t.Helper()
+	p := NewWritePipeline(storage, config, t.TempDir())
+	p.flushInterval = 20 * time.Millisecond
+	return p
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestWritePipeline_Batching tests that records are written by batch size and on close
+func TestWritePipeline_Batching(t *testing.T) {
+	storage := &flakyStorage{}
+	p := NewWritePipeline(storage, WriteConfig{BatchSize: 10, FlushSeconds: 3600}, t.TempDir())
+	p.Start()
+
+	for i := 0; i < 5; i++ {
+		p.Enqueue(pipelineRecords(5))
+	}
+	waitFor(t, "two full batches", func() bool { return storage.savedCount() == 20 })
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	stats := p.Stats()
+	if storage.savedCount() != 25 || stats.Enqueued != 25 || stats.Written != 25 || stats.Dropped != 0 {
+		t.Errorf("Expected all 25 records written on close, got saved=%d stats=%+v", storage.savedCount(), stats)
+	}
+}
+
+// TestWritePipeline_SpillAndReplay tests that failed writes go to the journal and replay in order
+func TestWritePipeline_SpillAndReplay(t *testing.T) {
+	storage := &flakyStorage{broken: true}
+	p := newTestPipeline(t, storage, WriteConfig{MaxRetries: 2})
+	p.Start()
+	defer p.Close()
+
+	first := pipelineRecords(3)
+	p.Enqueue(first)
+	waitFor(t, "spill", func() bool { return p.Stats().JournalRecords == 3 })
+
+	stats := p.Stats()
+	if stats.Retries != 1 || stats.Spilled != 3 || stats.LastError == "" {
+		t.Errorf("Expected one retry and a spilled batch, got %+v", stats)
+	}
+	if _, err := os.Stat(p.journalPath); err != nil {
+		t.Fatalf("Expected journal file: %v", err)
+	}
+
+	// Once storage recovers the journal is replayed before newer records
+	storage.setBroken(false)
+	second := pipelineRecords(2)
+	second[0].Name = "newer"
+	p.Enqueue(second)
+	waitFor(t, "replay", func() bool { return storage.savedCount() == 5 })
+
+	storage.mu.Lock()
+	order := storage.saved[3].Name
+	storage.mu.Unlock()
+	if order != "newer" {
+		t.Errorf("Expected journaled records before newer ones, got %q at index 3", order)
+	}
+	stats = p.Stats()
+	if stats.Replayed != 3 || stats.JournalRecords != 0 || stats.Written != 5 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats after replay: %+v", stats)
+	}
+	if _, err := os.Stat(p.journalPath); !os.IsNotExist(err) {
+		t.Errorf("Expected journal removed after replay")
+	}
+}
+
+// TestWritePipeline_DropsCounted tests that records are counted as dropped when the journal is full
+func TestWritePipeline_DropsCounted(t *testing.T) {
+	storage := &flakyStorage{broken: true}
+	p := newTestPipeline(t, storage, WriteConfig{MaxRetries: 1})
+	p.journalMaxBytes = 1
+	p.Start()
+
+	p.Enqueue(pipelineRecords(4))
+	waitFor(t, "drop", func() bool { return p.Stats().Dropped == 4 })
+	p.Close()
+
+	stats, err := ReadWriteStats(filepath.Join(filepath.Dir(p.statsPath), "process-tracker.log"))
+	if err != nil {
+		t.Fatalf("ReadWriteStats failed: %v", err)
+	}
+	if stats.Dropped != 4 || stats.Enqueued != 4 || stats.LastError == "" {
+		t.Errorf("Expected published stats to report the loss, got %+v", stats)
+	}
+}
+
+// TestWritePipeline_JournalSurvivesRestart tests that a closed pipeline leaves unwritten records for the next run
+func TestWritePipeline_JournalSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	storage := &flakyStorage{broken: true}
+	p := NewWritePipeline(storage, WriteConfig{FlushSeconds: 3600}, dir)
+	p.Start()
+	p.Enqueue(pipelineRecords(6))
+	p.Close()
+
+	if storage.savedCount() != 0 || p.Stats().JournalRecords != 6 {
+		t.Fatalf("Expected records journaled on close, got %+v", p.Stats())
+	}
+
+	storage.setBroken(false)
+	next := NewWritePipeline(storage, WriteConfig{FlushSeconds: 3600}, dir)
+	if next.Stats().JournalRecords != 6 {
+		t.Fatalf("Expected restart to find 6 journaled records, got %d", next.Stats().JournalRecords)
+	}
+	next.Start()
+	next.Close()
+	if storage.savedCount() != 6 || next.Stats().Replayed != 6 {
+		t.Errorf("Expected journal replayed after restart, got saved=%d stats=%+v", storage.savedCount(), next.Stats())
+	}
+}
+
+// TestWritePipeline_SpillDuringSlowReplay tests that a full queue spills to the journal while
+// the writer is blocked replaying it
+func TestWritePipeline_SpillDuringSlowReplay(t *testing.T) {
+	dir := t.TempDir()
+	broken := &flakyStorage{broken: true}
+	p := NewWritePipeline(broken, WriteConfig{FlushSeconds: 3600}, dir)
+	p.Start()
+	p.Enqueue(pipelineRecords(2))
+	p.Close()
+
+	storage := &flakyStorage{slow: make(chan struct{})}
+	p = NewWritePipeline(storage, WriteConfig{QueueSize: 1}, dir)
+	p.flushInterval = 10 * time.Millisecond
+	p.Start()
+	defer p.Close()
+
+	// Once the first flush has started, the writer waits for storage in the middle of the replay
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			p.Enqueue(pipelineRecords(1))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Enqueue blocked while the journal was being replayed")
+	}
+	if p.Stats().Spilled == 0 {
+		t.Errorf("Expected snapshots spilled while the queue was full, got %+v", p.Stats())
+	}
+	close(storage.slow)
+	waitFor(t, "replay", func() bool { return storage.savedCount() == 7 })
+}
+
+// TestWritePipeline_ReplayProgress tests that batches replayed before a failure are removed from
+// the journal, and that a journal holding only unreadable lines is removed
+func TestWritePipeline_ReplayProgress(t *testing.T) {
+	dir := t.TempDir()
+	broken := &flakyStorage{broken: true}
+	p := NewWritePipeline(broken, WriteConfig{FlushSeconds: 3600}, dir)
+	p.Start()
+	p.Close()
+	for i := 0; i < 3; i++ {
+		p.spill(pipelineRecords(2))
+	}
+
+	storage := &flakyStorage{failAt: 2}
+	p = NewWritePipeline(storage, WriteConfig{FlushSeconds: 3600}, dir)
+	if err := p.replayJournal(); err == nil {
+		t.Fatal("Expected the second batch to fail")
+	}
+	batches, _, err := readJournal(p.journalPath)
+	if err != nil || len(batches) != 2 || p.Stats().JournalRecords != 4 {
+		t.Fatalf("Expected the 2 unsaved batches left, got %d (%v) and %+v", len(batches), err, p.Stats())
+	}
+	if err := p.replayJournal(); err != nil || storage.savedCount() != 6 {
+		t.Fatalf("Expected every record saved once, got %d (%v)", storage.savedCount(), err)
+	}
+
+	if err := os.WriteFile(p.journalPath, []byte("{torn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	NewWritePipeline(storage, WriteConfig{}, dir)
+	if _, err := os.Stat(p.journalPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the unreadable journal removed")
+	}
+}
@@ -7,6 +7,7 @@ toolchain go1.24.7
 require (
 	github.com/docker/docker v26.1.4+incompatible
 	github.com/gin-gonic/gin v1.11.0
+	github.com/golang/snappy v1.0.0
 	github.com/google/uuid v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/shirou/gopsutil/v3 v3.23.4
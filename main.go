@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -30,6 +33,14 @@ type GlobalOptions struct {
 	Help        bool
 	Version     bool
 	Quiet       bool
+	ConfigFile  string
+	DryRun      bool
+	Status      bool
+	Output      string
+	Merge       bool
+	From        string
+	To          string
+	Args        []string
 }
 
 // LoadDefaultConfig returns default configuration
@@ -43,15 +54,35 @@ func LoadDefaultConfig() core.Config {
 			SQLitePath:   "",
 			SQLiteWAL:    true,
 			SQLiteCacheSize: 2000,
+			Rollups:         core.GetDefaultRollupConfig(),
+			Write:           core.GetDefaultWriteConfig(),
 		},
 		Web: core.WebConfig{
 			Enabled: true,
 			Host:    "localhost",
 			Port:    "9999",
 		},
+		Filters: core.GetDefaultFilterConfig(),
+		Backup:  core.GetDefaultBackupConfig(),
 	}
 }
 
+// loadConfig loads the configuration file on top of the defaults
+// An unreadable or invalid file is reported and the defaults are used
+func loadConfig(options GlobalOptions) core.Config {
+	path := options.ConfigFile
+	if path == "" {
+		path = core.DefaultConfigPath()
+	}
+
+	config, err := core.LoadConfig(path, LoadDefaultConfig())
+	if err != nil {
+		log.Printf("Warning: %v, using default configuration", err)
+		return LoadDefaultConfig()
+	}
+	return config
+}
+
 // getMonitoringConfig returns monitoring configuration
 func getMonitoringConfig() MonitoringConfig {
 	homeDir, _ := os.UserHomeDir()
@@ -125,12 +156,40 @@ func parseCommandLine() (command string, options GlobalOptions) {
 				}
 				i++
 			}
+		case "-c", "--config":
+			if i+1 < len(args) {
+				options.ConfigFile = args[i+1]
+				i++
+			}
 		case "-h", "--help":
 			options.Help = true
 		case "-v", "--version":
 			options.Version = true
 		case "-q", "--quiet":
 			options.Quiet = true
+		case "--dry-run":
+			options.DryRun = true
+		case "--status":
+			options.Status = true
+		case "-o", "--output":
+			if i+1 < len(args) {
+				options.Output = args[i+1]
+				i++
+			}
+		case "--merge":
+			options.Merge = true
+		case "--from":
+			if i+1 < len(args) {
+				options.From = args[i+1]
+				i++
+			}
+		case "--to":
+			if i+1 < len(args) {
+				options.To = args[i+1]
+				i++
+			}
+		default:
+			options.Args = append(options.Args, args[i])
 		}
 		i++
 	}
@@ -162,10 +221,22 @@ func printHelp() {
   status   显示监控状态
   stats    显示统计信息
   web      启动Web界面
+  categorize 显示分类规则 (--dry-run: 预览当前进程的分类结果)
+  db migrate 执行SQLite数据库结构迁移 (--status: 只显示版本状态)
+  db check   检查存储文件完整性 (SQLite完整性和索引，CSV损坏行和不完整的gzip文件)
+  db repair  修复存储文件 (损坏的数据移到隔离目录或改名保留，需先停止监控)
+  backup   在线备份数据 (-o: 备份文件路径)
+  restore  从备份恢复数据 (--merge: 合并而不是替换)
+  clean    按 keep_days 和保留规则清理旧数据 (--dry-run: 只显示将删除的数据)
+  search   搜索历史命令行和工作目录，按进程运行分组显示 (--from/--to: 时间范围，默认最近30天)
+
+多主机: 在配置文件的 cluster 段设置 mode: agent 或 aggregator，agent 把数据发送到 aggregator，
+        aggregator 的 Web 界面和 API 可按 ?host=<主机名> 查看单台主机
 
 选项:
   -p <端口>       设置Web服务器端口 (默认: 9999)
   -i <秒数>       设置监控间隔 (默认: 5)
+  -c <文件>       配置文件路径 (默认: ~/.process-tracker/config.yaml)
   -f <格式>       输出格式: table, json (默认: table)
   --filter <条件>  过滤条件
   --sort <字段>    排序字段
@@ -174,12 +245,25 @@ func printHelp() {
   -h, --help       显示帮助信息
   -v, --version    显示版本信息
   -q, --quiet      静默模式
+  --dry-run        只预览结果，不做任何修改
+  --status         只显示状态，不做任何修改
+  -o, --output <文件> 输出文件路径
+  --merge          恢复时合并到当前数据
+  --from <时间>    开始时间 (如 2006-01-02、'2006-01-02 15:04'、12h、30d)
+  --to <时间>      结束时间 (默认: 现在)
 
 示例:
   process-tracker start -i 10          # 启动监控，间隔10秒
   process-tracker web -p 8080           # 启动Web界面，端口8080
   process-tracker stats --format json  # 以JSON格式显示统计
   process-tracker status --filter running # 显示运行中的任务
+  process-tracker categorize --dry-run  # 预览当前进程的分类
+  process-tracker db migrate --status   # 查看数据库结构版本
+  process-tracker db check              # 断电后检查数据是否损坏
+  process-tracker backup -o pt.db       # 备份到 pt.db (监控可继续运行)
+  process-tracker restore pt.db --merge # 把备份中缺少的数据合并进来
+  process-tracker clean --dry-run       # 预览保留规则将删除的数据
+  process-tracker search rsync /data --from 60d # 最近60天运行过的 rsync ... /data
 
 `, Version)
 }
@@ -198,7 +282,7 @@ func formatOutput(data interface{}, format string) {
 
 // handleStart starts process monitoring
 func handleStart(options GlobalOptions) {
-	config := LoadDefaultConfig()
+	config := loadConfig(options)
 	monitoringConfig := getMonitoringConfig()
 	if options.Interval > 0 {
 		monitoringConfig.Interval = options.Interval
@@ -233,10 +317,29 @@ func handleStart(options GlobalOptions) {
 		fmt.Printf("📁 数据文件: %s\n", monitoringConfig.DataFile)
 	}
 
+	// Write records through the bounded queue so slow storage never delays sampling
+	app.StartWritePipeline()
+
+	// Fan snapshots out to the configured sinks, each behind its own queue
+	if err := app.StartSinks(); err != nil {
+		log.Fatalf("Failed to start sinks: %v", err)
+	}
+
+	// An aggregator also accepts the snapshots shipped by its agents
+	if err := app.StartCluster(); err != nil {
+		log.Fatalf("Failed to start cluster: %v", err)
+	}
+
 	// Start monitoring loop
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// Storage maintenance (rollups, size pruning) runs once a minute in the background
+	// so a long prune never delays sampling; a run still in progress skips the next tick
+	maintenanceTicker := time.NewTicker(time.Minute)
+	defer maintenanceTicker.Stop()
+	maintenanceRunning := make(chan struct{}, 1)
+
 	// Graceful shutdown handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -247,8 +350,29 @@ func handleStart(options GlobalOptions) {
 			if err := app.CollectAndSaveData(); err != nil {
 				log.Printf("Error collecting data: %v", err)
 			}
+		case <-maintenanceTicker.C:
+			select {
+			case maintenanceRunning <- struct{}{}:
+				go func() {
+					defer func() { <-maintenanceRunning }()
+					// Every step runs and logs its own error
+					app.RunMaintenance()
+				}()
+			default:
+				log.Printf("Storage maintenance still running, skipping this round")
+			}
 		case <-sigChan:
 			fmt.Println("\n🛑 收到停止信号，正在关闭...")
+			// Take the maintenance slot so a run in progress finishes before the storage closes
+			select {
+			case maintenanceRunning <- struct{}{}:
+			default:
+				fmt.Println("⏳ 等待存储维护完成...")
+				maintenanceRunning <- struct{}{}
+			}
+			if err := app.CloseFile(); err != nil {
+				log.Printf("Error closing storage: %v", err)
+			}
 			daemon.RemovePID()
 			return
 		}
@@ -288,25 +412,44 @@ func handleStatus(options GlobalOptions) {
 	dataDir := filepath.Dir(monitoringConfig.DataFile)
 	daemon := core.NewDaemonManager(dataDir)
 
-	// Check if monitoring is running
-	running, pid, err := daemon.IsRunning()
-	if err != nil {
-		fmt.Printf("❌ 错误: %v\n", err)
-		return
-	}
+	// Check if monitoring is running (a missing PID file means it is not running)
+	status, pid, _ := daemon.GetStatus()
 
-	if running {
+	if status == "running" {
 		fmt.Printf("🔄 监控正在运行 (PID: %d)\n", pid)
 	} else {
 		fmt.Println("⏸️ 监控未运行")
 		fmt.Println("💡 使用 'process-tracker start' 启动监控")
 	}
 
+	// Show the write pipeline counters last published by the daemon
+	if stats, err := core.ReadWriteStats(monitoringConfig.DataFile); err == nil {
+		printWriteStats(stats)
+	}
+	if stats, err := core.ReadSinkStats(monitoringConfig.DataFile); err == nil && len(stats) > 0 {
+		printSinkStats(stats)
+	}
+
 	// Show task status
-	config := LoadDefaultConfig()
+	config := loadConfig(options)
 	interval := time.Duration(monitoringConfig.Interval) * time.Second
 	app := core.NewApp(monitoringConfig.DataFile, interval, config)
 
+	// Show the cluster role and the hosts last seen by the aggregator
+	if config.Cluster.Enabled() {
+		printClusterStatus(config.Cluster, monitoringConfig.DataFile)
+	}
+
+	// Show effective process filters
+	if rules := app.FilterRules(); len(rules) > 0 {
+		fmt.Println("🔍 进程过滤规则:")
+		for _, rule := range rules {
+			fmt.Printf("  - %s\n", rule)
+		}
+	} else {
+		fmt.Println("🔍 进程过滤规则: 无 (记录所有进程)")
+	}
+
 	tasks, err := app.ListTasks(core.StatusPending)
 	if err != nil {
 		log.Printf("Error getting tasks: %v", err)
@@ -330,9 +473,71 @@ func handleStatus(options GlobalOptions) {
 	}
 }
 
+// printWriteStats prints the write queue state and any data loss
+func printWriteStats(stats core.WriteStats) {
+	fmt.Printf("💾 写入队列: %d/%d 批待写入, 已写入 %d 条, 重试 %d 次 (更新于 %s)\n",
+		stats.QueueDepth, stats.QueueCapacity, stats.Written, stats.Retries,
+		stats.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if stats.Spilled > 0 || stats.JournalRecords > 0 {
+		fmt.Printf("  📥 暂存日志: 累计 %d 条, 已回放 %d 条, 待回放 %d 条\n",
+			stats.Spilled, stats.Replayed, stats.JournalRecords)
+	}
+	if stats.Dropped > 0 {
+		fmt.Printf("  ⚠️  已丢失 %d 条记录\n", stats.Dropped)
+	}
+	if stats.LastError != "" {
+		fmt.Printf("  ❌ 最近错误 (%s): %s\n", stats.LastErrorAt.Format("2006-01-02 15:04:05"), stats.LastError)
+	}
+}
+
+// printSinkStats prints each output sink's queue and delivery counters
+func printSinkStats(stats []core.SinkStats) {
+	fmt.Println("📤 输出目标:")
+	for _, s := range stats {
+		queue := "同步写入"
+		if s.QueueCapacity > 0 {
+			queue = fmt.Sprintf("队列 %d/%d", s.QueueDepth, s.QueueCapacity)
+		}
+		fmt.Printf("  - %s (%s): %s, 已发送 %d 条, 丢弃 %d 条, 失败 %d 次\n",
+			s.Name, s.Type, queue, s.Sent, s.Dropped, s.Failures)
+		if s.Spooled > 0 {
+			fmt.Printf("    📥 暂存待推送 %d 条\n", s.Spooled)
+		}
+		if s.LastError != "" {
+			fmt.Printf("    ❌ 最近错误 (%s): %s\n", s.LastErrorAt.Format("2006-01-02 15:04:05"), s.LastError)
+		}
+	}
+}
+
+// printClusterStatus prints the cluster role and, on the aggregator, its hosts
+func printClusterStatus(cluster core.ClusterConfig, dataFile string) {
+	switch cluster.Mode {
+	case core.ClusterAgent:
+		fmt.Printf("🌐 集群模式: agent (主机 %s → %s)\n", cluster.HostName(), cluster.Aggregator)
+		return
+	case core.ClusterAggregator:
+		fmt.Printf("🌐 集群模式: aggregator (主机 %s)\n", cluster.HostName())
+	}
+
+	hosts, err := core.ReadHostInfo(dataFile)
+	if err != nil || len(hosts) == 0 {
+		fmt.Println("  暂无主机上报")
+		return
+	}
+	now := time.Now()
+	for _, h := range hosts {
+		state := "在线"
+		if !h.Online(now) {
+			state = "离线"
+		}
+		fmt.Printf("  - %s (%s): %s, 最后上报 %s, 已接收 %d 条\n",
+			h.Host, h.Role, state, h.LastSeen.Format("2006-01-02 15:04:05"), h.Records)
+	}
+}
+
 // handleStats shows statistics
 func handleStats(options GlobalOptions) {
-	config := LoadDefaultConfig()
+	config := loadConfig(options)
 	monitoringConfig := getMonitoringConfig()
 	interval := time.Duration(monitoringConfig.Interval) * time.Second
 	app := core.NewApp(monitoringConfig.DataFile, interval, config)
@@ -370,9 +575,97 @@ func handleStats(options GlobalOptions) {
 	formatOutput(stats, options.Format)
 }
 
+// handleCategorize shows the category rules, or previews how running processes are classified
+func handleCategorize(options GlobalOptions) {
+	config := loadConfig(options)
+	if err := core.ValidateCategoriesConfig(config.Categories); err != nil {
+		fmt.Printf("❌ 分类规则无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	monitoringConfig := getMonitoringConfig()
+	interval := time.Duration(monitoringConfig.Interval) * time.Second
+	app := core.NewApp(monitoringConfig.DataFile, interval, config)
+
+	if !options.DryRun {
+		fmt.Println("📋 分类规则 (按顺序匹配, 第一条命中的规则生效):")
+		for i, rule := range app.CategoryRules() {
+			fmt.Printf("  %3d. %s\n", i+1, rule)
+		}
+		fmt.Println("\n使用 --dry-run 预览当前进程的分类结果")
+		return
+	}
+
+	processes, err := app.ClassifyProcesses()
+	if err != nil {
+		fmt.Printf("❌ 获取进程失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Format == "json" {
+		type classifiedJSON struct {
+			PID      int32             `json:"pid"`
+			Name     string            `json:"name"`
+			Category string            `json:"category"`
+			Labels   map[string]string `json:"labels,omitempty"`
+			Rule     string            `json:"rule,omitempty"`
+			Command  string            `json:"command"`
+		}
+		output := make([]classifiedJSON, 0, len(processes))
+		for _, p := range processes {
+			output = append(output, classifiedJSON{
+				PID:      p.Record.PID,
+				Name:     p.Record.Name,
+				Category: p.Record.Category,
+				Labels:   p.Record.Labels,
+				Rule:     p.Rule,
+				Command:  p.Record.Command,
+			})
+		}
+		formatOutput(output, options.Format)
+		return
+	}
+
+	counts := make(map[string]int)
+	fmt.Printf("%-8s %-24s %-14s %-28s %s\n", "PID", "NAME", "CATEGORY", "LABELS", "RULE")
+	for _, p := range processes {
+		counts[p.Record.Category]++
+		rule := p.Rule
+		if rule == "" {
+			rule = "(no match)"
+		}
+		fmt.Printf("%-8d %-24s %-14s %-28s %s\n",
+			p.Record.PID, truncate(p.Record.Name, 24), p.Record.Category,
+			truncate(core.FormatLabels(p.Record.Labels), 28), rule)
+	}
+
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Printf("\n共 %d 个进程:", len(processes))
+	for _, category := range categories {
+		fmt.Printf(" %s=%d", category, counts[category])
+	}
+	fmt.Println()
+}
+
+// truncate shortens a string to at most n characters for table output
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 3 {
+		return s[:n]
+	}
+	return s[:n-3] + "..."
+}
+
 // handleWeb starts web interface
 func handleWeb(options GlobalOptions) {
-	config := LoadDefaultConfig()
+	config := loadConfig(options)
 	monitoringConfig := getMonitoringConfig()
 
 	// Handle port option
@@ -412,6 +705,339 @@ func handleWeb(options GlobalOptions) {
 	}
 }
 
+// handleDB handles SQLite database maintenance subcommands
+func handleDB(options GlobalOptions) {
+	if len(options.Args) == 0 {
+		fmt.Println("用法: process-tracker db migrate [--status] | db check | db repair")
+		os.Exit(1)
+	}
+
+	config := loadConfig(options)
+	switch options.Args[0] {
+	case "check", "repair":
+		handleDBCheck(options, config, options.Args[0] == "repair")
+		return
+	}
+	if config.Storage.Type != "sqlite" && config.Storage.SQLitePath == "" {
+		fmt.Println("❌ 当前配置未使用SQLite存储 (storage.type)")
+		os.Exit(1)
+	}
+	storage := core.NewSQLiteStorage(getMonitoringConfig().DataFile, 100, config.Storage)
+	defer storage.Close()
+
+	switch options.Args[0] {
+	case "migrate":
+		if !options.Status {
+			if err := storage.Initialize(); err != nil {
+				fmt.Printf("❌ 迁移失败: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		status, err := storage.SchemaStatus()
+		if err != nil {
+			fmt.Printf("❌ 读取结构版本失败: %v\n", err)
+			os.Exit(1)
+		}
+		printSchemaStatus(status, options.Format)
+	default:
+		fmt.Printf("未知的db子命令: %s\n", options.Args[0])
+		os.Exit(1)
+	}
+}
+
+// handleDBCheck checks the store's files and, with repair, fixes what it can
+func handleDBCheck(options GlobalOptions, config core.Config, repair bool) {
+	monitoringConfig := getMonitoringConfig()
+	if repair {
+		daemon := core.NewDaemonManager(filepath.Dir(monitoringConfig.DataFile))
+		if running, pid, _ := daemon.IsRunning(); running {
+			fmt.Printf("❌ 监控正在运行 (PID: %d)，请先执行 'process-tracker stop'\n", pid)
+			os.Exit(1)
+		}
+	}
+
+	storage := core.NewStorage(monitoringConfig.DataFile, 100, true, config.Storage)
+	defer storage.Close()
+	checker, ok := storage.(core.IntegrityStorage)
+	if !ok {
+		fmt.Println("❌ 当前存储不支持完整性检查")
+		os.Exit(1)
+	}
+
+	report, err := checker.CheckIntegrity(repair)
+	if options.Format == "json" {
+		formatOutput(report, options.Format)
+	} else {
+		printIntegrityReport(report)
+	}
+	if err != nil {
+		fmt.Printf("❌ 修复失败: %v\n", err)
+		os.Exit(1)
+	}
+	if !report.OK && !report.Repaired {
+		os.Exit(2)
+	}
+}
+
+// printIntegrityReport prints the per-file results of a check or repair
+func printIntegrityReport(report core.IntegrityReport) {
+	for _, f := range report.Files {
+		state := "✅"
+		if len(f.Problems) > 0 {
+			state = "⚠️ "
+			if f.Repaired {
+				state = "🔧"
+			}
+		}
+		fmt.Printf("%s %s (%s)\n", state, f.Path, f.Kind)
+		fmt.Printf("   记录: %d, 损坏: %d", f.Records, f.Malformed)
+		if f.Truncated {
+			fmt.Print(", gzip 不完整")
+		}
+		fmt.Println()
+		if len(f.Tables) > 0 {
+			tables := make([]string, 0, len(f.Tables))
+			for table := range f.Tables {
+				tables = append(tables, table)
+			}
+			sort.Strings(tables)
+			for _, table := range tables {
+				fmt.Printf("   %-28s %d\n", table, f.Tables[table])
+			}
+		}
+		for _, problem := range f.Problems {
+			fmt.Printf("   - %s\n", problem)
+		}
+		if f.Quarantine != "" {
+			fmt.Printf("   已移出的数据: %s\n", f.Quarantine)
+		}
+	}
+
+	switch {
+	case report.OK:
+		fmt.Println("\n✅ 未发现问题")
+	case report.Repaired:
+		fmt.Println("\n🔧 已修复")
+	default:
+		fmt.Println("\n⚠️  发现问题，执行 'process-tracker db repair' 修复 (需先停止监控)")
+	}
+}
+
+// printSchemaStatus prints the schema version and each migration's state
+func printSchemaStatus(status core.SchemaStatus, format string) {
+	if format == "json" {
+		formatOutput(status, format)
+		return
+	}
+
+	fmt.Printf("📦 数据库: %s\n", status.Path)
+	if !status.Exists {
+		fmt.Println("   数据库尚未创建")
+	}
+	fmt.Printf("   结构版本: %d / %d (待执行 %d 个迁移)\n", status.CurrentVersion, status.LatestVersion, status.Pending())
+	if status.LastBackup != "" {
+		fmt.Printf("   最近备份: %s\n", status.LastBackup)
+	}
+	fmt.Println()
+	for _, m := range status.Migrations {
+		state := "待执行"
+		if m.Applied {
+			state = "已应用"
+			if !m.AppliedAt.IsZero() {
+				state += " " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+		}
+		note := ""
+		if m.Destructive {
+			note = " (执行前备份)"
+		}
+		fmt.Printf("  %3d. %-48s %s%s\n", m.Version, m.Name, state, note)
+	}
+}
+
+// handleBackup writes an online backup of the current store
+func handleBackup(options GlobalOptions) {
+	config := loadConfig(options)
+	monitoringConfig := getMonitoringConfig()
+	interval := time.Duration(monitoringConfig.Interval) * time.Second
+	app := core.NewApp(monitoringConfig.DataFile, interval, config)
+	if err := app.Initialize(); err != nil {
+		fmt.Printf("❌ 初始化存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer app.CloseFile()
+
+	path := options.Output
+	if path == "" {
+		path = app.DefaultBackupPath(app.BackupDir(), time.Now())
+	}
+
+	info, err := app.Backup(context.Background(), path)
+	if err != nil {
+		fmt.Printf("❌ 备份失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Format == "json" {
+		formatOutput(info, options.Format)
+		return
+	}
+	fmt.Printf("✅ 备份完成: %s\n", info.Path)
+	fmt.Printf("   类型: %s, 大小: %.1f MB, 记录数: %d\n", info.Type, float64(info.Size)/1024/1024, info.Records)
+}
+
+// handleRestore validates a backup and replaces or merges into the current store
+func handleRestore(options GlobalOptions) {
+	if len(options.Args) == 0 {
+		fmt.Println("用法: process-tracker restore <备份文件> [--merge]")
+		os.Exit(1)
+	}
+	path := options.Args[0]
+
+	config := loadConfig(options)
+	monitoringConfig := getMonitoringConfig()
+
+	// Replacing files under a running daemon would lose its writes; SQLite merges are safe
+	// because they go through the database's own locking
+	sqlite := config.Storage.Type == "sqlite" || config.Storage.SQLitePath != ""
+	daemon := core.NewDaemonManager(filepath.Dir(monitoringConfig.DataFile))
+	if running, pid, _ := daemon.IsRunning(); running && (!options.Merge || !sqlite) {
+		fmt.Printf("❌ 监控正在运行 (PID: %d)，请先执行 'process-tracker stop'\n", pid)
+		os.Exit(1)
+	}
+
+	interval := time.Duration(monitoringConfig.Interval) * time.Second
+	app := core.NewApp(monitoringConfig.DataFile, interval, config)
+	if err := app.Initialize(); err != nil {
+		fmt.Printf("❌ 初始化存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer app.CloseFile()
+
+	result, err := app.Restore(context.Background(), path, options.Merge)
+	if err != nil {
+		fmt.Printf("❌ 恢复失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Format == "json" {
+		formatOutput(result, options.Format)
+		return
+	}
+	if result.Merged {
+		fmt.Printf("✅ 已合并 %s: 新增 %d 条记录\n", path, result.Records)
+	} else {
+		fmt.Printf("✅ 已从 %s 恢复 %d 条记录\n", path, result.Records)
+	}
+}
+
+// handleClean applies keep_days and the retention rules, or previews them with --dry-run
+func handleClean(options GlobalOptions) {
+	config := loadConfig(options)
+	monitoringConfig := getMonitoringConfig()
+
+	// CSV files are rewritten in place, which a running daemon would write past
+	sqlite := config.Storage.Type == "sqlite" || config.Storage.SQLitePath != ""
+	daemon := core.NewDaemonManager(filepath.Dir(monitoringConfig.DataFile))
+	if running, pid, _ := daemon.IsRunning(); running && !options.DryRun && !sqlite {
+		fmt.Printf("❌ 监控正在运行 (PID: %d)，请先执行 'process-tracker stop'\n", pid)
+		os.Exit(1)
+	}
+
+	interval := time.Duration(monitoringConfig.Interval) * time.Second
+	app := core.NewApp(monitoringConfig.DataFile, interval, config)
+	if err := app.Initialize(); err != nil {
+		fmt.Printf("❌ 初始化存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer app.CloseFile()
+
+	report, err := app.ApplyRetention(options.DryRun)
+	if err != nil {
+		fmt.Printf("❌ 清理失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Format == "json" {
+		formatOutput(report, options.Format)
+		return
+	}
+	if report.DryRun {
+		fmt.Println("🔍 预览 (--dry-run)，不会删除任何数据")
+	}
+	fmt.Printf("\n%-40s %10s %20s %12s\n", "规则", "保留", "截止时间", "采样数")
+	for _, r := range report.Rules {
+		cutoff := "-"
+		if r.Cutoff != nil {
+			cutoff = r.Cutoff.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-40s %10s %20s %12d\n", truncate(r.Rule, 40), r.Keep, cutoff, r.Samples)
+	}
+
+	verb := "已删除"
+	if report.DryRun {
+		verb = "将删除"
+	}
+	fmt.Printf("\n%s: %d 条进程采样, %d 条主机指标, %d 条进程事件\n",
+		verb, report.Samples, report.SystemRecords, report.ProcessEvents)
+	if report.Malformed > 0 {
+		fmt.Printf("⚠️  %d 行无法解析的数据未做处理，执行 'process-tracker db repair' 隔离 (需先停止监控)\n", report.Malformed)
+	}
+}
+
+// handleSearch searches historical command lines and prints the matching runs
+func handleSearch(options GlobalOptions) {
+	text := strings.Join(options.Args, " ")
+	if err := core.ValidateSearchText(text); err != nil {
+		fmt.Println("用法: process-tracker search <关键词...> [--from <时间>] [--to <时间>] [--limit <数量>]")
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	from, err := core.ParseQueryTime(options.From, now.AddDate(0, 0, -30), now)
+	if err != nil {
+		fmt.Printf("❌ --from 无效: %v\n", err)
+		os.Exit(1)
+	}
+	to, err := core.ParseQueryTime(options.To, now, now)
+	if err != nil {
+		fmt.Printf("❌ --to 无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	config := loadConfig(options)
+	monitoringConfig := getMonitoringConfig()
+	interval := time.Duration(monitoringConfig.Interval) * time.Second
+	app := core.NewApp(monitoringConfig.DataFile, interval, config)
+	defer app.CloseFile()
+
+	runs, err := app.SearchCommands(context.Background(), core.SearchQuery{Text: text, Start: from, End: to, Limit: options.Limit})
+	if err != nil {
+		fmt.Printf("❌ 搜索失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Format == "json" {
+		formatOutput(runs, options.Format)
+		return
+	}
+	if len(runs) == 0 {
+		fmt.Printf("未找到 %s 至 %s 之间匹配 %q 的进程\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), text)
+		return
+	}
+	fmt.Printf("%-16s %-16s %10s %-12s %8s %10s  %s\n", "开始", "结束", "时长", "用户", "CPU峰值", "内存峰值", "命令")
+	for _, run := range runs {
+		fmt.Printf("%-16s %-16s %10s %-12s %7.1f%% %8.1fMB  %s\n",
+			run.FirstSeen.Format("2006-01-02 15:04"), run.LastSeen.Format("2006-01-02 15:04"),
+			run.TotalUptime.Round(time.Second), truncate(run.Username, 12), run.CPUMax, run.MemoryMax,
+			truncate(run.Command, 80))
+		if run.WorkingDir != "" || len(run.PIDs) > 0 {
+			fmt.Printf("%-16s 目录: %s  PID: %v\n", "", run.WorkingDir, run.PIDs)
+		}
+	}
+	fmt.Printf("\n共 %d 次运行\n", len(runs))
+}
+
 func main() {
 	command, options := parseCommandLine()
 
@@ -436,6 +1062,18 @@ func main() {
 		handleStats(options)
 	case "web":
 		handleWeb(options)
+	case "categorize":
+		handleCategorize(options)
+	case "db":
+		handleDB(options)
+	case "backup":
+		handleBackup(options)
+	case "restore":
+		handleRestore(options)
+	case "clean":
+		handleClean(options)
+	case "search":
+		handleSearch(options)
 	default:
 		fmt.Printf("未知命令: %s\n", command)
 		fmt.Println("使用 -h 查看帮助信息")
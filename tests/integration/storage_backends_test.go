@@ -0,0 +1,350 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/process-tracker/api"
+	"github.com/yourusername/process-tracker/core"
+)
+
+// TestMain runs from the repository root so the web templates can be loaded
+func TestMain(m *testing.M) {
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// backends lists the storage configurations every handler must serve identically
+var backends = []struct {
+	name    string
+	storage func(dir string) core.StorageConfig
+}{
+	{"csv", func(dir string) core.StorageConfig {
+		config := core.GetDefaultStorageConfig()
+		config.Type = "csv"
+		return config
+	}},
+	{"sqlite", func(dir string) core.StorageConfig {
+		config := core.GetDefaultStorageConfig()
+		config.Type = "sqlite"
+		config.SQLitePath = filepath.Join(dir, "process-tracker.db")
+		return config
+	}},
+}
+
+// testRecords returns two collection cycles of three processes owned by two users
+func testRecords(now time.Time) []core.ResourceRecord {
+	var records []core.ResourceRecord
+	for i, ts := range []time.Time{now.Add(-20 * time.Second), now.Add(-10 * time.Second)} {
+		records = append(records,
+			core.ResourceRecord{Timestamp: ts, Name: "init-shell", PID: 100, PPID: 1, CPUPercent: 1, CPUPercentNormalized: 1, MemoryMB: 10, Command: "bash", Category: "system", UID: 1000, Username: "alice"},
+			core.ResourceRecord{Timestamp: ts, Name: "train", PID: 200, PPID: 100, CPUPercent: 80 + float64(i)*10, CPUPercentNormalized: 20, MemoryMB: 512, IsActive: true, Command: "python3 train.py --gpus=0,1", Category: "development", UID: 1000, Username: "alice"},
+			core.ResourceRecord{Timestamp: ts, Name: "vim", PID: 300, PPID: 1, CPUPercent: 2, CPUPercentNormalized: 0.5, MemoryMB: 20, Command: "vim notes.txt", Category: "other", UID: 1001, Username: "bob"},
+		)
+	}
+	return records
+}
+
+// newBackendServer writes test records with one App and serves them from a second App,
+// the way the daemon and the web server share a data directory
+func newBackendServer(t *testing.T, storage func(dir string) core.StorageConfig) *gin.Engine {
+	t.Helper()
+	return newBackendServerWith(t, storage, testRecords(time.Now()))
+}
+
+// newBackendServerWith is newBackendServer with the given records
+func newBackendServerWith(t *testing.T, storage func(dir string) core.StorageConfig, records []core.ResourceRecord) *gin.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "process-tracker.log")
+
+	config := core.GetDefaultConfig()
+	config.Docker.Enabled = false
+	config.Storage = storage(dir)
+
+	writer := core.NewApp(dataFile, time.Second, config)
+	if err := writer.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize writer: %v", err)
+	}
+	if err := writer.SaveResourceRecords(records); err != nil {
+		t.Fatalf("Failed to save records: %v", err)
+	}
+	if err := writer.CloseFile(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	reader := core.NewApp(dataFile, time.Second, config)
+	if err := reader.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize reader: %v", err)
+	}
+	t.Cleanup(func() { reader.CloseFile() })
+
+	return api.NewServer(reader, 0).GetEngine()
+}
+
+// getJSON performs a GET request and decodes the response body
+func getJSON(t *testing.T, engine *gin.Engine, path string, out interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s returned %d: %s", path, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatalf("GET %s returned invalid JSON: %v", path, err)
+	}
+}
+
+// TestBackends_ProcessList tests that the process list reflects stored records for each backend
+func TestBackends_ProcessList(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var result struct {
+				Data []struct {
+					PID      int32   `json:"pid"`
+					Name     string  `json:"name"`
+					Username string  `json:"username"`
+					CPU      float64 `json:"cpuPercent"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/processes?sort=pid", &result)
+
+			if len(result.Data) != 3 {
+				t.Fatalf("Expected 3 processes, got %d: %+v", len(result.Data), result.Data)
+			}
+			sort.Slice(result.Data, func(i, j int) bool { return result.Data[i].PID < result.Data[j].PID })
+			if result.Data[1].Name != "train" || result.Data[1].Username != "alice" {
+				t.Errorf("Unexpected process: %+v", result.Data[1])
+			}
+		})
+	}
+}
+
+// TestBackends_ProcessDetail tests the single-process endpoint for each backend
+func TestBackends_ProcessDetail(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var process struct {
+				Data struct {
+					PID  int32  `json:"pid"`
+					Name string `json:"name"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/processes/200", &process)
+			if process.Data.PID != 200 || process.Data.Name != "train" {
+				t.Errorf("Unexpected process: %+v", process.Data)
+			}
+		})
+	}
+}
+
+// TestBackends_UserStats tests per-user aggregation for each backend
+func TestBackends_UserStats(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var result struct {
+				Data struct {
+					Users []struct {
+						Username      string  `json:"username"`
+						ProcessCount  int     `json:"processCount"`
+						MaxCPUPercent float64 `json:"maxCpuPercent"`
+					} `json:"users"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/stats?group_by=user&period=1h", &result)
+
+			users := result.Data.Users
+			if len(users) != 2 {
+				t.Fatalf("Expected 2 users, got %+v", users)
+			}
+			if users[0].Username != "alice" || users[0].ProcessCount != 2 || users[0].MaxCPUPercent != 91 {
+				t.Errorf("Unexpected stats for alice: %+v", users[0])
+			}
+		})
+	}
+}
+
+// TestBackends_WebProcessData tests the web dashboard data endpoint for each backend
+func TestBackends_WebProcessData(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var result struct {
+				Processes []struct {
+					PID int32
+				} `json:"processes"`
+				Count int `json:"count"`
+			}
+			getJSON(t, engine, "/api/processes", &result)
+
+			if len(result.Processes) != 3 {
+				t.Errorf("Expected 3 processes, got %d", len(result.Processes))
+			}
+		})
+	}
+}
+
+// TestBackends_ProcessFilter tests that list filters, sorting and paging are applied by each backend
+func TestBackends_ProcessFilter(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var result struct {
+				Data []struct {
+					PID  int32  `json:"pid"`
+					Name string `json:"name"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/processes?filter=user=alice&sort=-pid", &result)
+			if len(result.Data) != 2 || result.Data[0].Name != "train" || result.Data[1].Name != "init-shell" {
+				t.Errorf("Unexpected processes for alice: %+v", result.Data)
+			}
+
+			getJSON(t, engine, "/v1/processes?sort=pid&limit=1&offset=2", &result)
+			if len(result.Data) != 1 || result.Data[0].PID != 300 {
+				t.Errorf("Unexpected page: %+v", result.Data)
+			}
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/processes?filter=color=red", nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for unknown filter, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestBackends_ProcessChildren tests that process trees can be rebuilt from each backend's history
+func TestBackends_ProcessChildren(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			var result struct {
+				Data []struct {
+					PID  int32 `json:"pid"`
+					PPID int32 `json:"ppid"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/processes/100/children", &result)
+			if len(result.Data) != 1 || result.Data[0].PID != 200 || result.Data[0].PPID != 100 {
+				t.Errorf("Unexpected children of 100: %+v", result.Data)
+			}
+		})
+	}
+}
+
+// TestBackends_Metrics tests that the Prometheus exporter reads the newest collection from
+// each backend when the web server is not the collector
+func TestBackends_Metrics(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			engine := newBackendServer(t, backend.storage)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/system/metrics", nil))
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != core.MetricsContentType {
+				t.Fatalf("Unexpected response %d (%s): %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			body := w.Body.String()
+			for _, want := range []string{
+				`process_tracker_process_cpu_percent{name="train",category="development"} 90`,
+				`process_tracker_process_count{name="vim",category="other"} 1`,
+				`process_tracker_storage_size_bytes{type="` + backend.name + `"}`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected %q in:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+// TestBackends_HostFilter tests that records of several hosts are kept apart and can be
+// selected by host for each backend
+func TestBackends_HostFilter(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			// The same PIDs on two hosts, as an aggregator stores them
+			var records []core.ResourceRecord
+			for _, host := range []string{"hub", "web-1"} {
+				for _, r := range testRecords(time.Now()) {
+					r.Host = host
+					if host == "web-1" {
+						r.CPUPercentNormalized /= 2
+					}
+					records = append(records, r)
+				}
+			}
+			engine := newBackendServerWith(t, backend.storage, records)
+
+			var result struct {
+				Data []struct {
+					PID  int32   `json:"pid"`
+					Host string  `json:"host"`
+					CPU  float64 `json:"cpuPercent"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/processes?sort=pid", &result)
+			if len(result.Data) != 6 {
+				t.Fatalf("Expected 6 processes across both hosts, got %d: %+v", len(result.Data), result.Data)
+			}
+
+			getJSON(t, engine, "/v1/processes?sort=pid&host=web-1", &result)
+			if len(result.Data) != 3 {
+				t.Fatalf("Expected 3 processes on web-1, got %d: %+v", len(result.Data), result.Data)
+			}
+			for _, p := range result.Data {
+				if p.Host != "web-1" {
+					t.Errorf("Expected only web-1 processes, got %+v", p)
+				}
+			}
+			if result.Data[1].PID != 200 || result.Data[1].CPU != 10 {
+				t.Errorf("Expected web-1's own train process, got %+v", result.Data[1])
+			}
+
+			var hosts struct {
+				Data []struct {
+					Host      string `json:"host"`
+					Processes int    `json:"processes"`
+				} `json:"data"`
+			}
+			getJSON(t, engine, "/v1/hosts", &hosts)
+			if len(hosts.Data) != 2 || hosts.Data[0].Host != "hub" || hosts.Data[1].Host != "web-1" || hosts.Data[1].Processes != 3 {
+				t.Errorf("Unexpected hosts: %+v", hosts.Data)
+			}
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/processes?host=web%201", nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for an invalid host, got %d", w.Code)
+			}
+
+			// The dashboard offers a host switcher with the selected host
+			w = httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard?host=web-1", nil))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<option value="web-1" selected>`) {
+				t.Errorf("Expected the dashboard to select web-1, got %d", w.Code)
+			}
+		})
+	}
+}
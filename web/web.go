@@ -3,11 +3,13 @@ package web
 import (
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/v3/host"
 	"github.com/yourusername/process-tracker/core"
 )
 
@@ -24,12 +26,26 @@ func NewWebHandler(app *core.App) *WebHandler {
 // DashboardData represents dashboard data
 type DashboardData struct {
 	Title       string
+	Host        string     // Selected host; empty shows every host
+	HostMetrics bool       // Host-level metrics are available for the selection (only the local machine has them)
+	Hosts       []HostInfo // Fleet overview; empty unless several hosts are tracked
 	SystemStats SystemStats
 	Tasks       []TaskInfo
 	Processes   []ProcessInfo
 	GeneratedAt time.Time
 }
 
+// HostInfo represents one host of the fleet overview for web display
+type HostInfo struct {
+	Host       string    `json:"host"`
+	Role       string    `json:"role"`
+	Online     bool      `json:"online"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Processes  int       `json:"processes"`
+	CPUPercent float64   `json:"cpuPercent"`
+	MemoryMB   float64   `json:"memoryMb"`
+}
+
 // SystemStats represents system statistics
 type SystemStats struct {
 	CPUUsage    float64
@@ -38,6 +54,22 @@ type SystemStats struct {
 	ActiveCount  int
 	LoadAverage  []float64
 	Uptime      string
+	CPUIOWait   float64
+	SwapUsedMB  float64
+	SwapTotalMB float64
+	PSICPU      float64 // CPU pressure (some, avg10)
+	PSIMemory   float64 // Memory pressure (some, avg10)
+	PSIIO       float64 // IO pressure (some, avg10)
+	Disks       []DiskInfo
+}
+
+// DiskInfo represents disk usage for web display
+type DiskInfo struct {
+	Mountpoint  string
+	Device      string
+	TotalGB     float64
+	UsedGB      float64
+	UsedPercent float64
 }
 
 // TaskInfo represents task information for web display
@@ -62,7 +94,9 @@ type ProcessInfo struct {
 	MemoryMB      float64
 	MemoryPercent float64
 	Category      string
+	Username      string
 	Uptime        string
+	Host          string
 }
 
 // min returns the minimum of two float64 values
@@ -101,6 +135,7 @@ func SetupWebRoutes(router *gin.Engine, app *core.App) {
 	router.GET("/api/dashboard", webHandler.GetDashboardData)
 	router.GET("/api/tasks", webHandler.GetTaskData)
 	router.GET("/api/processes", webHandler.GetProcessData)
+	router.GET("/api/hosts", webHandler.GetHostData)
 	router.POST("/api/tasks/:id/start", webHandler.StartTask)
 	router.POST("/api/tasks/:id/stop", webHandler.StopTask)
 	router.POST("/api/tasks", webHandler.CreateTask)
@@ -111,7 +146,11 @@ func SetupWebRoutes(router *gin.Engine, app *core.App) {
 
 // Dashboard renders the dashboard page
 func (h *WebHandler) Dashboard(c *gin.Context) {
-	data := h.prepareDashboardData()
+	hostName, ok := hostParam(c)
+	if !ok {
+		return
+	}
+	data := h.prepareDashboardData(hostName)
 	c.HTML(http.StatusOK, "dashboard.html", data)
 }
 
@@ -144,20 +183,15 @@ func (h *WebHandler) Tasks(c *gin.Context) {
 
 // Processes renders the processes page
 func (h *WebHandler) Processes(c *gin.Context) {
-	// Get recent processes
-	storageManager := core.NewManager(h.app.DataFile, 0, false, core.StorageConfig{})
-	allRecords, _ := storageManager.ReadRecords(h.app.DataFile)
-
-	// Filter recent records (last 5 minutes)
-	cutoffTime := time.Now().Add(-5 * time.Minute)
-	latest := make(map[int32]core.ResourceRecord)
-
-	for _, record := range allRecords {
-		if record.Timestamp.After(cutoffTime) {
-			if existing, ok := latest[record.PID]; !ok || record.Timestamp.After(existing.Timestamp) {
-				latest[record.PID] = record
-			}
-		}
+	hostName, ok := hostParam(c)
+	if !ok {
+		return
+	}
+
+	// Latest record of each process seen in the last 5 minutes
+	latest, err := h.app.GetLatestProcesses(5*time.Minute, hostName)
+	if err != nil {
+		log.Printf("Warning: failed to read process records: %v", err)
 	}
 
 	var processInfos []ProcessInfo
@@ -189,7 +223,9 @@ func (h *WebHandler) Processes(c *gin.Context) {
 			MemoryMB:      record.MemoryMB,
 			MemoryPercent: memoryPercent,
 			Category:      record.Category,
+			Username:      record.Username,
 			Uptime:        uptime,
+			Host:          record.Host,
 		}
 		processInfos = append(processInfos, processInfo)
 	}
@@ -204,10 +240,23 @@ func (h *WebHandler) Processes(c *gin.Context) {
 
 // GetDashboardData returns dashboard data as JSON
 func (h *WebHandler) GetDashboardData(c *gin.Context) {
-	data := h.prepareDashboardData()
+	hostName, ok := hostParam(c)
+	if !ok {
+		return
+	}
+	data := h.prepareDashboardData(hostName)
 	c.JSON(http.StatusOK, data)
 }
 
+// GetHostData returns the fleet overview as JSON
+func (h *WebHandler) GetHostData(c *gin.Context) {
+	hosts := h.fleet()
+	c.JSON(http.StatusOK, gin.H{
+		"hosts": hosts,
+		"count": len(hosts),
+	})
+}
+
 // GetTaskData returns task data as JSON
 func (h *WebHandler) GetTaskData(c *gin.Context) {
 	tasks, _ := h.app.ListTasks(core.StatusPending)
@@ -235,18 +284,15 @@ func (h *WebHandler) GetTaskData(c *gin.Context) {
 
 // GetProcessData returns process data as JSON
 func (h *WebHandler) GetProcessData(c *gin.Context) {
-	storageManager := core.NewManager(h.app.DataFile, 0, false, core.StorageConfig{})
-	allRecords, _ := storageManager.ReadRecords(h.app.DataFile)
-
-	cutoffTime := time.Now().Add(-5 * time.Minute)
-	latest := make(map[int32]core.ResourceRecord)
+	hostName, ok := hostParam(c)
+	if !ok {
+		return
+	}
 
-	for _, record := range allRecords {
-		if record.Timestamp.After(cutoffTime) {
-			if existing, ok := latest[record.PID]; !ok || record.Timestamp.After(existing.Timestamp) {
-				latest[record.PID] = record
-			}
-		}
+	// Latest record of each process seen in the last 5 minutes
+	latest, err := h.app.GetLatestProcesses(5*time.Minute, hostName)
+	if err != nil {
+		log.Printf("Warning: failed to read process records: %v", err)
 	}
 
 	var processInfos []ProcessInfo
@@ -272,6 +318,8 @@ func (h *WebHandler) GetProcessData(c *gin.Context) {
 			MemoryMB:      record.MemoryMB,
 			MemoryPercent: memoryPercent,
 			Category:      record.Category,
+			Username:      record.Username,
+			Host:          record.Host,
 		}
 		processInfos = append(processInfos, processInfo)
 	}
@@ -349,8 +397,47 @@ func (h *WebHandler) CreateTask(c *gin.Context) {
 
 // Helper functions
 
-// prepareDashboardData prepares dashboard data
-func (h *WebHandler) prepareDashboardData() DashboardData {
+// hostParam returns the host query parameter, answering 400 when it is not a valid host name
+func hostParam(c *gin.Context) (string, bool) {
+	hostName := c.Query("host")
+	if hostName == "" {
+		return "", true
+	}
+	if err := core.ValidateHostName(hostName); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return hostName, true
+}
+
+// fleet returns the fleet overview, or nothing when only this machine is tracked
+func (h *WebHandler) fleet() []HostInfo {
+	summaries, err := h.app.FleetOverview()
+	if err != nil {
+		log.Printf("Warning: failed to read hosts: %v", err)
+		return nil
+	}
+
+	var hosts []HostInfo
+	for _, s := range summaries {
+		if s.Host == "" {
+			continue
+		}
+		hosts = append(hosts, HostInfo{
+			Host:       s.Host,
+			Role:       s.Role,
+			Online:     s.Online,
+			LastSeen:   s.LastSeen,
+			Processes:  s.Processes,
+			CPUPercent: s.CPUPercent,
+			MemoryMB:   s.MemoryMB,
+		})
+	}
+	return hosts
+}
+
+// prepareDashboardData prepares dashboard data for one host ("" for every host)
+func (h *WebHandler) prepareDashboardData(hostName string) DashboardData {
 	// Get tasks
 	tasks, _ := h.app.ListTasks(core.StatusPending)
 	var taskInfos []TaskInfo
@@ -368,29 +455,23 @@ func (h *WebHandler) prepareDashboardData() DashboardData {
 		taskInfos = append(taskInfos, taskInfo)
 	}
 
-	// Get processes
-	storageManager := core.NewManager(h.app.DataFile, 0, false, core.StorageConfig{})
-	allRecords, _ := storageManager.ReadRecords(h.app.DataFile)
-
-	cutoffTime := time.Now().Add(-5 * time.Minute)
-	latest := make(map[int32]core.ResourceRecord)
-
-	for _, record := range allRecords {
-		if record.Timestamp.After(cutoffTime) {
-			if existing, ok := latest[record.PID]; !ok || record.Timestamp.After(existing.Timestamp) {
-				latest[record.PID] = record
-			}
-		}
+	// Latest record of each process seen in the last 5 minutes
+	latest, err := h.app.GetLatestProcesses(5*time.Minute, hostName)
+	if err != nil {
+		log.Printf("Warning: failed to read process records: %v", err)
 	}
 
 	var processInfos []ProcessInfo
 	totalMemoryMB := core.SystemMemoryMB()
 	activeCount := 0
+	var processCPU, processMemory float64
 
 	for _, record := range latest {
 		if record.IsActive {
 			activeCount++
 		}
+		processCPU += record.CPUPercentNormalized
+		processMemory += record.MemoryPercent
 
 		memoryPercent := 0.0
 		if totalMemoryMB > 0 {
@@ -417,19 +498,28 @@ func (h *WebHandler) prepareDashboardData() DashboardData {
 			MemoryMB:      record.MemoryMB,
 			MemoryPercent: memoryPercent,
 			Category:      record.Category,
+			Username:      record.Username,
 			Uptime:        uptime,
+			Host:          record.Host,
 		}
 		processInfos = append(processInfos, processInfo)
 	}
 
-	// Calculate system stats (simplified)
+	// Calculate system stats from the latest host-level sample
 	systemStats := SystemStats{
-		CPUUsage:    25.0, // Mock data
-		MemoryUsage: 45.0, // Mock data
 		ProcessCount: len(processInfos),
 		ActiveCount:  activeCount,
-		LoadAverage:  []float64{0.5, 0.8, 1.2}, // Mock data
-		Uptime:      "2d 15h 30m", // Mock data
+		LoadAverage:  []float64{0, 0, 0},
+		Uptime:       "unknown",
+	}
+	hostMetrics := h.app.IsLocalHost(hostName)
+	if hostMetrics {
+		h.addHostMetrics(&systemStats)
+	} else {
+		// Other hosts only ship process records: estimate usage from their latest processes
+		// (memory percentages were computed against the agent's own total)
+		systemStats.CPUUsage = processCPU
+		systemStats.MemoryUsage = processMemory
 	}
 
 	// Safely get top 10 processes (handle empty slice)
@@ -442,6 +532,9 @@ func (h *WebHandler) prepareDashboardData() DashboardData {
 
 	return DashboardData{
 		Title:       "系统概览 - Process Tracker",
+		Host:        hostName,
+		HostMetrics: hostMetrics,
+		Hosts:       h.fleet(),
 		SystemStats: systemStats,
 		Tasks:       taskInfos,
 		Processes:   topProcesses, // Top 10 processes (safe)
@@ -449,6 +542,35 @@ func (h *WebHandler) prepareDashboardData() DashboardData {
 	}
 }
 
+// addHostMetrics fills in the latest host-level sample of this machine
+func (h *WebHandler) addHostMetrics(systemStats *SystemStats) {
+	if uptime, err := host.Uptime(); err == nil {
+		systemStats.Uptime = formatUptime(time.Duration(uptime) * time.Second)
+	}
+	record, err := h.app.GetLatestSystemRecord()
+	if err != nil {
+		return
+	}
+	systemStats.CPUUsage = record.CPUPercent
+	systemStats.MemoryUsage = record.MemoryPercent
+	systemStats.LoadAverage = []float64{record.Load1, record.Load5, record.Load15}
+	systemStats.CPUIOWait = record.CPUIOWait
+	systemStats.SwapUsedMB = record.SwapUsedMB
+	systemStats.SwapTotalMB = record.SwapTotalMB
+	systemStats.PSICPU = record.PSICPUSome
+	systemStats.PSIMemory = record.PSIMemorySome
+	systemStats.PSIIO = record.PSIIOSome
+	for _, d := range record.Disks {
+		systemStats.Disks = append(systemStats.Disks, DiskInfo{
+			Mountpoint:  d.Mountpoint,
+			Device:      d.Device,
+			TotalGB:     d.TotalMB / 1024,
+			UsedGB:      d.UsedMB / 1024,
+			UsedPercent: d.UsedPercent,
+		})
+	}
+}
+
 // formatUptime formats duration into human readable string
 func formatUptime(d time.Duration) string {
 	if d < time.Minute {